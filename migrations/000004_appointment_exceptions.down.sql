@@ -0,0 +1,14 @@
+BEGIN;
+DROP TABLE IF EXISTS appointment_exceptions;
+
+-- series split off another one share its subject, which the index below does not allow
+DELETE FROM appointments WHERE parent_id IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_calendar_id_subject_unique;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_calendar_id_subject_unique
+    ON appointments (calendar_id, subject);
+
+ALTER TABLE appointments
+    DROP COLUMN IF EXISTS parent_id;
+COMMIT;
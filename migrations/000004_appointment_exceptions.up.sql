@@ -0,0 +1,41 @@
+-- series split off another one keep the subject of their parent
+BEGIN;
+ALTER TABLE appointments
+    ADD COLUMN IF NOT EXISTS parent_id uuid
+        CONSTRAINT appointments_parent_id_appointments_id_foreign
+            REFERENCES appointments
+            ON UPDATE CASCADE ON DELETE SET NULL;
+
+DROP INDEX IF EXISTS idx_calendar_id_subject_unique;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_calendar_id_subject_unique
+    ON appointments (calendar_id, subject)
+    WHERE parent_id IS NULL;
+COMMIT;
+
+-- CREATE appointment_exceptions table
+BEGIN;
+create table if not exists appointment_exceptions
+(
+    id uuid default uuid_generate_v1() not null
+        constraint appointment_exceptions_pkey
+            primary key,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    appointment_id uuid not null
+        constraint appointment_exceptions_appointment_id_appointments_id_foreign
+            references appointments
+            on update cascade on delete cascade,
+    recurrence_id timestamp with time zone not null,
+    cancelled boolean,
+    subject text,
+    description text,
+    start timestamp with time zone,
+    "end" timestamp with time zone
+);
+
+alter table appointment_exceptions owner to "user";
+
+create unique index if not exists idx_appointment_id_recurrence_id_unique
+    on appointment_exceptions (appointment_id, recurrence_id);
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+ALTER TABLE appointments
+    DROP CONSTRAINT IF EXISTS appointments_calendar_id_during_excl;
+
+ALTER TABLE appointments
+    DROP COLUMN IF EXISTS during;
+COMMIT;
@@ -0,0 +1,12 @@
+-- appointments booked under the reject conflict policy can not overlap within a calendar
+BEGIN;
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+ALTER TABLE appointments
+    ADD COLUMN IF NOT EXISTS during tstzrange;
+
+ALTER TABLE appointments
+    ADD CONSTRAINT appointments_calendar_id_during_excl
+        EXCLUDE USING gist (calendar_id WITH =, during WITH &&)
+        WHERE (during IS NOT NULL);
+COMMIT;
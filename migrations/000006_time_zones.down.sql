@@ -0,0 +1,7 @@
+BEGIN;
+ALTER TABLE users
+    DROP COLUMN IF EXISTS time_zone;
+
+ALTER TABLE appointments
+    DROP COLUMN IF EXISTS time_zone;
+COMMIT;
@@ -0,0 +1,8 @@
+-- IANA time zone names, empty means UTC
+BEGIN;
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS time_zone text;
+
+ALTER TABLE appointments
+    ADD COLUMN IF NOT EXISTS time_zone text;
+COMMIT;
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS idx_appointments_calendar_id_start_end;
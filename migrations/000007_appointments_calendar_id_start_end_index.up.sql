@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS idx_appointments_calendar_id_start_end
+    ON appointments (calendar_id, start, "end");
@@ -0,0 +1,6 @@
+BEGIN;
+DROP INDEX IF EXISTS idx_appointments_search_vector;
+DROP TRIGGER IF EXISTS appointments_search_vector_update ON appointments;
+DROP FUNCTION IF EXISTS appointments_search_vector_update();
+ALTER TABLE appointments DROP COLUMN IF EXISTS search_vector;
+COMMIT;
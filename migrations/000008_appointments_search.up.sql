@@ -0,0 +1,26 @@
+-- full text search over the subject and the description of appointments,
+-- matches in the subject weigh more than the ones in the description
+BEGIN;
+ALTER TABLE appointments ADD COLUMN IF NOT EXISTS search_vector tsvector;
+
+CREATE OR REPLACE FUNCTION appointments_search_vector_update() RETURNS trigger AS $$
+BEGIN
+    NEW.search_vector :=
+        setweight(to_tsvector('english', COALESCE(NEW.subject, '')), 'A') ||
+        setweight(to_tsvector('english', COALESCE(NEW.description, '')), 'B');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS appointments_search_vector_update ON appointments;
+CREATE TRIGGER appointments_search_vector_update
+    BEFORE INSERT OR UPDATE OF subject, description ON appointments
+    FOR EACH ROW EXECUTE PROCEDURE appointments_search_vector_update();
+
+UPDATE appointments SET search_vector =
+    setweight(to_tsvector('english', COALESCE(subject, '')), 'A') ||
+    setweight(to_tsvector('english', COALESCE(description, '')), 'B');
+
+CREATE INDEX IF NOT EXISTS idx_appointments_search_vector
+    ON appointments USING gin (search_vector);
+COMMIT;
@@ -0,0 +1,30 @@
+-- access of other users than the owner to calendars
+BEGIN;
+create table if not exists calendar_shares
+(
+    id uuid default uuid_generate_v1() not null
+        constraint calendar_shares_pkey
+            primary key,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    calendar_id uuid not null
+        constraint calendar_shares_calendar_id_calendars_id_foreign
+            references calendars
+            on update cascade on delete cascade,
+    user_id uuid not null
+        constraint calendar_shares_user_id_users_id_foreign
+            references users
+            on update cascade on delete cascade,
+    level text not null
+        constraint calendar_shares_level_check
+            check (level in ('freebusy', 'read', 'write', 'manage'))
+);
+
+alter table calendar_shares owner to "user";
+
+create unique index if not exists idx_calendar_shares_calendar_id_user_id_unique
+    on calendar_shares (calendar_id, user_id);
+
+create index if not exists idx_calendar_shares_user_id
+    on calendar_shares (user_id);
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+alter table users_appointments
+    drop column if exists status,
+    drop column if exists role,
+    drop column if exists rsvp_at,
+    drop column if exists comment;
+COMMIT;
@@ -0,0 +1,12 @@
+-- participation of the attendees in appointments
+BEGIN;
+alter table users_appointments
+    add column if not exists status text default 'needs-action' not null
+        constraint users_appointments_status_check
+            check (status in ('needs-action', 'accepted', 'declined', 'tentative')),
+    add column if not exists role text default 'required' not null
+        constraint users_appointments_role_check
+            check (role in ('required', 'optional', 'chair')),
+    add column if not exists rsvp_at timestamp with time zone,
+    add column if not exists comment text default '' not null;
+COMMIT;
@@ -0,0 +1,31 @@
+-- attendees invited by email without being registered users
+BEGIN;
+create table if not exists external_attendees
+(
+    id uuid default uuid_generate_v1() not null
+        constraint external_attendees_pkey
+            primary key,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    appointment_id uuid not null
+        constraint external_attendees_appointment_id_appointments_id_foreign
+            references appointments
+            on update cascade on delete cascade,
+    email text not null,
+    name text,
+    status text default 'needs-action' not null
+        constraint external_attendees_status_check
+            check (status in ('needs-action', 'accepted', 'declined', 'tentative')),
+    role text default 'required' not null
+        constraint external_attendees_role_check
+            check (role in ('required', 'optional', 'chair'))
+);
+
+alter table external_attendees owner to "user";
+
+create unique index if not exists idx_external_attendees_appointment_id_email_unique
+    on external_attendees (appointment_id, email);
+
+create index if not exists idx_external_attendees_email
+    on external_attendees (email);
+COMMIT;
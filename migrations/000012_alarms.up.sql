@@ -0,0 +1,36 @@
+-- alarms reminding users of appointments, fired by the scheduler of the service
+BEGIN;
+create table if not exists alarms
+(
+    id uuid default uuid_generate_v1() not null
+        constraint alarms_pkey
+            primary key,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    appointment_id uuid not null
+        constraint alarms_appointment_id_appointments_id_foreign
+            references appointments
+            on update cascade on delete cascade,
+    user_id uuid not null
+        constraint alarms_user_id_users_id_foreign
+            references users
+            on update cascade on delete cascade,
+    offset_minutes integer,
+    at timestamp with time zone,
+    next_fire_at timestamp with time zone,
+    next_occurrence timestamp with time zone,
+    last_fired_at timestamp with time zone,
+    last_occurrence timestamp with time zone,
+    locked_until timestamp with time zone,
+    constraint alarms_offset_minutes_at_check
+        check ((offset_minutes is null) <> (at is null))
+);
+
+alter table alarms owner to "user";
+
+create index if not exists idx_alarms_next_fire_at
+    on alarms (next_fire_at);
+
+create index if not exists idx_alarms_appointment_id_user_id
+    on alarms (appointment_id, user_id);
+COMMIT;
@@ -0,0 +1,54 @@
+-- webhooks of users and the deliveries of events to them, sent by the dispatcher of the service
+BEGIN;
+create table if not exists webhooks
+(
+    id uuid default uuid_generate_v1() not null
+        constraint webhooks_pkey
+            primary key,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    user_id uuid not null
+        constraint webhooks_user_id_users_id_foreign
+            references users
+            on update cascade on delete cascade,
+    url text not null,
+    secret text not null,
+    events text[]
+);
+
+alter table webhooks owner to "user";
+
+create index if not exists idx_webhooks_user_id
+    on webhooks (user_id);
+
+create table if not exists webhook_deliveries
+(
+    id uuid default uuid_generate_v1() not null
+        constraint webhook_deliveries_pkey
+            primary key,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    webhook_id uuid not null
+        constraint webhook_deliveries_webhook_id_webhooks_id_foreign
+            references webhooks
+            on update cascade on delete cascade,
+    event_id uuid not null,
+    event text not null,
+    payload jsonb not null,
+    status text not null,
+    attempts integer default 0 not null,
+    next_attempt_at timestamp with time zone,
+    last_attempt_at timestamp with time zone,
+    response_status integer default 0 not null,
+    error text default '' not null,
+    locked_until timestamp with time zone
+);
+
+alter table webhook_deliveries owner to "user";
+
+create index if not exists idx_webhook_deliveries_status_next_attempt_at
+    on webhook_deliveries (status, next_attempt_at);
+
+create index if not exists idx_webhook_deliveries_webhook_id_created_at
+    on webhook_deliveries (webhook_id, created_at);
+COMMIT;
@@ -0,0 +1,18 @@
+-- changes of users, calendars and appointments written in the transactions making them, read through GET /changes
+BEGIN;
+create table if not exists outbox
+(
+    id bigserial not null
+        constraint outbox_pkey
+            primary key,
+    entity text not null,
+    entity_id uuid not null,
+    operation text not null,
+    before jsonb,
+    after jsonb,
+    audience text[],
+    created_at timestamp with time zone
+);
+
+alter table outbox owner to "user";
+COMMIT;
@@ -0,0 +1,15 @@
+-- event types and calendars of the changes, streamed to the clients of GET /calendar/{calendar_id}/events/stream
+BEGIN;
+alter table outbox
+    add column if not exists event text not null default '',
+    add column if not exists calendar_ids text[];
+
+update outbox set event = entity || '.' || operation || 'd' where event = '';
+
+update outbox set calendar_ids = array [entity_id::text] where entity = 'calendar';
+
+update outbox set calendar_ids = case
+    when before ->> 'calendar_id' = after ->> 'calendar_id' then array [after ->> 'calendar_id']
+    else array_remove(array [before ->> 'calendar_id', after ->> 'calendar_id'], null) end
+where entity = 'appointment';
+COMMIT;
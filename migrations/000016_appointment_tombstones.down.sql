@@ -0,0 +1,13 @@
+BEGIN;
+DELETE FROM appointments WHERE deleted_at IS NOT NULL;
+
+DROP INDEX IF EXISTS idx_calendar_id_subject_unique;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_calendar_id_subject_unique
+    ON appointments (calendar_id, subject)
+    WHERE parent_id IS NULL;
+
+DROP INDEX IF EXISTS idx_appointments_deleted_at;
+
+ALTER TABLE appointments DROP COLUMN IF EXISTS deleted_at;
+COMMIT;
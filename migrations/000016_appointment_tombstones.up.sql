@@ -0,0 +1,14 @@
+-- deleted appointments are kept as tombstones for GET /calendar/{calendar_id}/sync
+BEGIN;
+ALTER TABLE appointments
+    ADD COLUMN IF NOT EXISTS deleted_at timestamp with time zone;
+
+CREATE INDEX IF NOT EXISTS idx_appointments_deleted_at
+    ON appointments (deleted_at);
+
+DROP INDEX IF EXISTS idx_calendar_id_subject_unique;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_calendar_id_subject_unique
+    ON appointments (calendar_id, subject)
+    WHERE parent_id IS NULL AND deleted_at IS NULL;
+COMMIT;
@@ -0,0 +1,7 @@
+BEGIN;
+ALTER TABLE appointments DROP COLUMN IF EXISTS version;
+
+ALTER TABLE calendars DROP COLUMN IF EXISTS version;
+
+ALTER TABLE users DROP COLUMN IF EXISTS version;
+COMMIT;
@@ -0,0 +1,11 @@
+-- versions back the etags of users, calendars and appointments
+BEGIN;
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 1;
+
+ALTER TABLE calendars
+    ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 1;
+
+ALTER TABLE appointments
+    ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 1;
+COMMIT;
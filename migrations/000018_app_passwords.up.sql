@@ -0,0 +1,23 @@
+-- app passwords users sign in with over basic auth, from the caldav clients which can not send bearer tokens
+BEGIN;
+create table if not exists app_passwords
+(
+    id uuid default uuid_generate_v1() not null
+        constraint app_passwords_pkey
+            primary key,
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    user_id uuid not null
+        constraint app_passwords_user_id_users_id_foreign
+            references users
+            on update cascade on delete cascade,
+    name text not null,
+    hash text not null,
+    last_used_at timestamp with time zone
+);
+
+alter table app_passwords owner to "user";
+
+create index if not exists idx_app_passwords_user_id_hash
+    on app_passwords (user_id, hash);
+COMMIT;
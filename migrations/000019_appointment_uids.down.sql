@@ -0,0 +1,9 @@
+BEGIN;
+DROP INDEX IF EXISTS idx_appointments_calendar_id_uid_unique;
+
+DROP INDEX IF EXISTS idx_appointments_calendar_id_object_name_unique;
+
+ALTER TABLE appointments
+    DROP COLUMN IF EXISTS object_name,
+    DROP COLUMN IF EXISTS uid;
+COMMIT;
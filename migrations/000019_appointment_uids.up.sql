@@ -0,0 +1,14 @@
+-- caldav clients address appointments by the object name they chose and tell them apart by the iCalendar UID
+BEGIN;
+ALTER TABLE appointments
+    ADD COLUMN IF NOT EXISTS uid text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS object_name text NOT NULL DEFAULT '';
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_appointments_calendar_id_object_name_unique
+    ON appointments (calendar_id, object_name)
+    WHERE object_name <> '' AND deleted_at IS NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_appointments_calendar_id_uid_unique
+    ON appointments (calendar_id, uid)
+    WHERE uid <> '' AND deleted_at IS NULL;
+COMMIT;
@@ -0,0 +1,26 @@
+package alarms
+
+import (
+	"calendar_service/src/logger"
+	"calendar_service/src/models"
+	"time"
+)
+
+// Notifier delivers reminders to users. A failed delivery is retried later
+type Notifier interface {
+	Notify(reminder *models.Reminder) error
+}
+
+// LogNotifier writes reminders to the service log
+type LogNotifier struct{}
+
+func (n *LogNotifier) Notify(reminder *models.Reminder) error {
+	logger.Logger.Infow("reminder",
+		"alarm_id", reminder.Alarm.ID,
+		"user_id", reminder.User.ID,
+		"email", reminder.User.Email,
+		"appointment_id", reminder.Appointment.ID,
+		"subject", reminder.Appointment.Subject,
+		"occurrence_start", reminder.OccurrenceStart.Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,132 @@
+package alarms
+
+import (
+	"calendar_service/src/logger"
+	"calendar_service/src/models"
+	"github.com/jinzhu/gorm"
+	"sync"
+	"time"
+)
+
+const (
+	// batchSize is the number of alarms claimed at once
+	batchSize = 100
+	// lease is how long a claimed alarm stays locked, alarms of a scheduler
+	// stopped while firing them are picked up again once it expires
+	lease = 5 * time.Minute
+	// retryDelay is the time a failed notification is retried after
+	retryDelay = time.Minute
+)
+
+// Scheduler fires the due alarms every interval. Its state lives in the alarms
+// table, so alarms missed while the service was down fire once it is back and
+// several instances of the service can run a scheduler each
+type Scheduler struct {
+	db       *gorm.DB
+	notifier Notifier
+	interval time.Duration
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewScheduler(db *gorm.DB, notifier Notifier, interval time.Duration) *Scheduler {
+	return &Scheduler{db: db, notifier: notifier, interval: interval}
+}
+
+func (s *Scheduler) Start() {
+	s.stop = make(chan struct{})
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		for {
+			if _, err := s.FireDue(time.Now()); err != nil {
+				logger.Logger.Errorw("unable to fire alarms", "err", err.Error())
+			}
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop waits for the alarms being fired
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+// FireDue notifies about the alarms due at now and returns how many were delivered
+func (s *Scheduler) FireDue(now time.Time) (int, error) {
+	fired := 0
+	for {
+		alarms, err := models.ClaimDueAlarms(now, now.Add(lease), batchSize, s.db)
+		if err != nil {
+			return fired, err
+		}
+		for _, alarm := range alarms {
+			if s.fire(alarm, now) {
+				fired++
+			}
+		}
+		if len(alarms) < batchSize {
+			return fired, nil
+		}
+	}
+}
+
+func (s *Scheduler) fire(alarm *models.Alarm, now time.Time) bool {
+	readable, err := alarm.Readable(s.db)
+	if err != nil {
+		logger.Logger.Errorw("unable to check access to appointment of alarm", "alarm_id", alarm.ID, "err", err.Error())
+		return false
+	}
+	if !readable {
+		logger.Logger.Infow("skipping alarm of user without access", "alarm_id", alarm.ID, "user_id", alarm.UserId)
+		if err := alarm.MarkStale(s.db); err != nil {
+			logger.Logger.Errorw("unable to mark alarm stale", "alarm_id", alarm.ID, "err", err.Error())
+		}
+		return false
+	}
+	appt := &models.Appointment{Base: models.Base{ID: alarm.AppointmentId}}
+	if err := appt.Read(s.db); err != nil {
+		logger.Logger.Errorw("unable to read appointment of alarm", "alarm_id", alarm.ID, "err", err.Error())
+		return false
+	}
+	if alarm.Stale(now) {
+		logger.Logger.Infow("skipping missed alarm", "alarm_id", alarm.ID, "occurrence_start", alarm.NextOccurrence)
+		s.fired(alarm, appt, now)
+		return false
+	}
+	usr := &models.User{Base: models.Base{ID: alarm.UserId}}
+	if err := s.db.Find(usr, "id = ?", usr.ID).Error; err != nil {
+		logger.Logger.Errorw("unable to read user of alarm", "alarm_id", alarm.ID, "err", err.Error())
+		return false
+	}
+
+	reminder := &models.Reminder{Alarm: alarm, Appointment: appt, User: usr}
+	if alarm.NextOccurrence != nil {
+		reminder.OccurrenceStart = *alarm.NextOccurrence
+	} else {
+		reminder.OccurrenceStart = appt.Start
+	}
+	if err := s.notifier.Notify(reminder); err != nil {
+		logger.Logger.Infow("unable to deliver reminder", "alarm_id", alarm.ID, "err", err.Error())
+		if err := alarm.Retry(now.Add(retryDelay), s.db); err != nil {
+			logger.Logger.Errorw("unable to reschedule alarm", "alarm_id", alarm.ID, "err", err.Error())
+		}
+		return false
+	}
+	s.fired(alarm, appt, now)
+	return true
+}
+
+func (s *Scheduler) fired(alarm *models.Alarm, appt *models.Appointment, now time.Time) {
+	if err := alarm.Fired(appt, now, s.db); err != nil {
+		logger.Logger.Errorw("unable to schedule next alarm", "alarm_id", alarm.ID, "err", err.Error())
+	}
+}
@@ -0,0 +1,135 @@
+package alarms
+
+import (
+	"calendar_service/src/config"
+	"calendar_service/src/models"
+	"errors"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+var (
+	db *gorm.DB
+)
+
+func TestMain(m *testing.M) {
+	var err error
+	err = godotenv.Load("../../.env.test")
+	if err != nil {
+		fmt.Println("unable to load test env")
+		os.Exit(1)
+	}
+	if err := config.Load(); err != nil {
+		fmt.Println("unable to load config", err)
+		os.Exit(1)
+	}
+	db, err = models.InitDbConnection(
+		config.Config.CalendarDb.Host,
+		config.Config.CalendarDb.Port,
+		config.Config.CalendarDb.User,
+		config.Config.CalendarDb.Password,
+		config.Config.CalendarDb.DbName,
+		config.Config.CalendarDb.SslMode,
+		config.Config.CalendarDb.MaxOpenConnections,
+		config.Config.CalendarDb.MaxIdleConnections,
+		config.Config.CalendarDb.ConnectionMaxLifetime)
+	if err != nil {
+		fmt.Println("unable to connect to db", err)
+		os.Exit(1)
+	}
+	models.RecreateTables(db)
+	models.InitIndexes(db)
+	os.Exit(m.Run())
+}
+
+// recordingNotifier keeps the reminders it receives, failing while err is set
+type recordingNotifier struct {
+	reminders []*models.Reminder
+	err       error
+}
+
+func (n *recordingNotifier) Notify(reminder *models.Reminder) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.reminders = append(n.reminders, reminder)
+	return nil
+}
+
+func TestScheduler_FireDue(t *testing.T) {
+	err := models.MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(db)
+
+	start := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+	appt := &models.Appointment{Subject: "Planning", CalendarId: models.KnownCalendarId, Start: start, End: start.Add(time.Hour)}
+	if err := appt.Create(db); err != nil {
+		t.Fatal("unable to create appointment", err)
+	}
+	offset := 60
+	alarm := &models.Alarm{AppointmentId: appt.ID, UserId: models.KnownUserId, OffsetMinutes: &offset}
+	if err := alarm.Create(db); err != nil {
+		t.Fatal("unable to create alarm", err)
+	}
+
+	notifier := &recordingNotifier{err: errors.New("smtp is down")}
+	scheduler := NewScheduler(db, notifier, time.Minute)
+	fireAt := start.Add(-59 * time.Minute)
+
+	fired, err := scheduler.FireDue(fireAt)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, fired)
+
+	// a failed delivery is retried once the retry delay passed
+	notifier.err = nil
+	fired, err = scheduler.FireDue(fireAt)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, fired)
+	fired, err = scheduler.FireDue(fireAt.Add(retryDelay))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, fired)
+	assert.Len(t, notifier.reminders, 1)
+	assert.Equal(t, appt.ID, notifier.reminders[0].Appointment.ID)
+	assert.Equal(t, models.KnownUserId, notifier.reminders[0].User.ID)
+	assert.True(t, start.Equal(notifier.reminders[0].OccurrenceStart))
+
+	// an alarm fires once
+	fired, err = scheduler.FireDue(fireAt.Add(2 * retryDelay))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, fired)
+}
+
+func TestScheduler_FireDue_lostAccess(t *testing.T) {
+	err := models.MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(db)
+
+	// the alarm of a user without access to the appointment, as left behind by a lost share
+	at := time.Now().Add(time.Hour).Truncate(time.Second)
+	alarm := &models.Alarm{AppointmentId: models.AppointmentFixedTimeId, UserId: models.SecondKnownUserId, At: &at, NextFireAt: &at}
+	if err := db.Create(alarm).Error; err != nil {
+		t.Fatal("unable to create alarm", err)
+	}
+
+	notifier := &recordingNotifier{}
+	scheduler := NewScheduler(db, notifier, time.Minute)
+	fired, err := scheduler.FireDue(at)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, fired)
+	assert.Len(t, notifier.reminders, 0)
+
+	alarms, err := models.AlarmsOf(models.AppointmentFixedTimeId, models.SecondKnownUserId, db)
+	assert.Nil(t, err)
+	assert.Len(t, alarms, 1)
+	assert.Nil(t, alarms[0].NextFireAt)
+}
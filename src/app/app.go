@@ -1,15 +1,25 @@
 package app
 
 import (
+	"calendar_service/src/alarms"
+	"calendar_service/src/auth"
+	"calendar_service/src/caldav"
 	"calendar_service/src/config"
 	"calendar_service/src/controllers"
 	"calendar_service/src/datasources/postgres/calendardb"
+	"calendar_service/src/live"
 	"calendar_service/src/logger"
+	"calendar_service/src/middlewares/auth_middleware"
 	"calendar_service/src/middlewares/logging_middleware"
 	"calendar_service/src/models"
+	"calendar_service/src/webhooks"
+	"errors"
+	"fmt"
 	"github.com/gorilla/mux"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
 	"net/http"
+	"strings"
+	"time"
 )
 
 func ConfigureApp() error {
@@ -36,30 +46,142 @@ func ConfigureApp() error {
 		return err
 	}
 	calendardb.DB.LogMode(false)
+
+	models.AppointmentConflictPolicy, err = models.ParseConflictPolicy(config.Config.ConflictPolicy)
+	if err != nil {
+		return err
+	}
+	models.AllowPrivateWebhooks = config.Config.Webhooks.AllowPrivate
+
+	auth.Tokens, err = newTokenAuth(config.Config.Auth)
+	if err != nil {
+		return err
+	}
+	adminIds := make([]string, 0)
+	for _, id := range strings.Split(config.Config.Auth.AdminIds, ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			adminIds = append(adminIds, id)
+		}
+	}
+	auth.Registration, err = auth.NewRegistrationPolicy(strings.ToLower(config.Config.Auth.Registration), adminIds)
+	if err != nil {
+		return fmt.Errorf("invalid USER_REGISTRATION or ADMIN_USER_IDS: %w", err)
+	}
 	return nil
 }
 
+func newTokenAuth(cfg config.Auth) (*auth.TokenAuth, error) {
+	switch {
+	case cfg.HmacSecret != "" && cfg.RsaPublicKey != "":
+		return nil, errors.New("only one of JWT_HMAC_SECRET and JWT_RSA_PUBLIC_KEY can be set")
+	case cfg.HmacSecret != "":
+		return auth.NewHMACTokenAuth([]byte(cfg.HmacSecret), cfg.Issuer), nil
+	case cfg.RsaPublicKey != "":
+		if cfg.DevTokens {
+			return nil, errors.New("JWT_DEV_TOKENS needs JWT_HMAC_SECRET")
+		}
+		return auth.NewRSATokenAuth([]byte(cfg.RsaPublicKey), cfg.Issuer)
+	}
+	return nil, errors.New("either JWT_HMAC_SECRET or JWT_RSA_PUBLIC_KEY should be set")
+}
+
+// InitScheduler returns the scheduler of alarms, nil when alarms are disabled
+func InitScheduler() *alarms.Scheduler {
+	if !config.Config.Alarms.Enabled {
+		return nil
+	}
+	interval := time.Duration(config.Config.Alarms.PollInterval) * time.Second
+	return alarms.NewScheduler(calendardb.DB, &alarms.LogNotifier{}, interval)
+}
+
+// InitDispatcher returns the dispatcher of webhook deliveries, nil when webhooks are disabled
+func InitDispatcher() *webhooks.Dispatcher {
+	if !config.Config.Webhooks.Enabled {
+		return nil
+	}
+	client := webhooks.NewClient(time.Duration(config.Config.Webhooks.Timeout) * time.Second)
+	interval := time.Duration(config.Config.Webhooks.PollInterval) * time.Second
+	return webhooks.NewDispatcher(calendardb.DB, client, interval)
+}
+
+// InitBroker sets up the broker of the changes streamed to clients, it should be started
+func InitBroker() *live.Broker {
+	connString := models.ConnectString(
+		config.Config.CalendarDb.Host,
+		config.Config.CalendarDb.Port,
+		config.Config.CalendarDb.User,
+		config.Config.CalendarDb.Password,
+		config.Config.CalendarDb.DbName,
+		config.Config.CalendarDb.SslMode,
+	)
+	interval := time.Duration(config.Config.Stream.PollInterval) * time.Second
+	live.Changes = live.NewBroker(calendardb.DB, connString, interval)
+	return live.Changes
+}
+
 func InitApp() http.Handler {
 	r := mux.NewRouter()
 	r.NotFoundHandler = &controllers.NotFoundHandler{}
 	r.HandleFunc("/", controllers.RootController.Get)
+	if config.Config.Auth.DevTokens {
+		r.HandleFunc("/auth/token", controllers.AuthController.Token).Methods("POST")
+	}
+	if auth.Tokens.CanIssue() {
+		r.HandleFunc("/auth/query-token", controllers.AuthController.QueryToken).Methods("POST")
+	}
 
+	r.HandleFunc("/user", controllers.UserController.List).Methods("GET")
 	r.HandleFunc("/user", controllers.UserController.Create).Methods("POST")
 	r.HandleFunc("/user/{id}", controllers.UserController.Read).Methods("GET")
 	r.HandleFunc("/user/{id}", controllers.UserController.Delete).Methods("DELETE")
 	r.HandleFunc("/user/{id}", controllers.UserController.Update).Methods("POST")
+	r.HandleFunc("/user/{id}/agenda", controllers.UserController.Agenda).Methods("GET")
+	r.HandleFunc("/user/{user_id}/calendar", controllers.CalendarController.List).Methods("GET")
 	r.HandleFunc("/user/{user_id}/calendar", controllers.CalendarController.Create).Methods("POST")
+	r.HandleFunc("/calendar/{calendar_id}.ics", controllers.CalendarController.Export).Methods("GET")
 	r.HandleFunc("/calendar/{calendar_id}", controllers.CalendarController.Read).Methods("GET")
 	r.HandleFunc("/calendar/{calendar_id}", controllers.CalendarController.Update).Methods("POST")
 	r.HandleFunc("/calendar/{calendar_id}", controllers.CalendarController.Delete).Methods("DELETE")
+	r.HandleFunc("/calendar/{calendar_id}/import", controllers.CalendarController.Import).Methods("POST")
+	r.HandleFunc("/calendar/{calendar_id}/appointments", controllers.CalendarController.Appointments).Methods("GET")
+	r.HandleFunc("/calendar/{calendar_id}/sync", controllers.CalendarController.Sync).Methods("GET")
+	r.HandleFunc("/calendar/{calendar_id}/events/stream", controllers.StreamController.Calendar).Methods("GET")
+	r.HandleFunc("/calendar/{calendar_id}/share", controllers.CalendarController.Share).Methods("POST")
+	r.HandleFunc("/calendar/{calendar_id}/share", controllers.CalendarController.Unshare).Methods("DELETE")
 	r.HandleFunc("/calendar/{calendar_id}/appointment", controllers.AppointmentController.Create).Methods("POST")
+	r.HandleFunc("/appointment/search", controllers.AppointmentController.Search).Methods("GET")
 	r.HandleFunc("/appointment/{appointment_id}", controllers.AppointmentController.Read).Methods("GET")
 	r.HandleFunc("/appointment/{appointment_id}", controllers.AppointmentController.Update).Methods("POST")
 	r.HandleFunc("/appointment/{appointment_id}", controllers.AppointmentController.Delete).Methods("DELETE")
 	r.HandleFunc("/appointment/{appointment_id}/add-attendees", controllers.AppointmentController.AddAttendees).Methods("POST")
 	r.HandleFunc("/appointment/{appointment_id}/remove-attendees", controllers.AppointmentController.RemoveAttendees).Methods("POST")
+	r.HandleFunc("/appointment/{appointment_id}/rsvp", controllers.AppointmentController.Rsvp).Methods("POST")
+	r.HandleFunc("/appointment/{appointment_id}/alarms", controllers.AlarmController.List).Methods("GET")
+	r.HandleFunc("/appointment/{appointment_id}/alarm", controllers.AlarmController.Create).Methods("POST")
+	r.HandleFunc("/appointment/{appointment_id}/alarm/{alarm_id}", controllers.AlarmController.Delete).Methods("DELETE")
+	r.HandleFunc("/appointment/{appointment_id}/occurrences", controllers.AppointmentController.Occurrences).Methods("GET")
+	r.HandleFunc("/appointment/{appointment_id}/occurrence/{start}", controllers.AppointmentController.UpdateOccurrence).Methods("POST")
+	r.HandleFunc("/appointment/{appointment_id}/occurrence/{start}", controllers.AppointmentController.CancelOccurrence).Methods("DELETE")
+
+	r.HandleFunc("/changes", controllers.ChangeController.List).Methods("GET")
+	r.HandleFunc("/events/ws", controllers.SocketController.Connect).Methods("GET")
+	r.HandleFunc("/webhook", controllers.WebhookController.List).Methods("GET")
+	r.HandleFunc("/webhook", controllers.WebhookController.Create).Methods("POST")
+	r.HandleFunc("/webhook/{webhook_id}", controllers.WebhookController.Delete).Methods("DELETE")
+	r.HandleFunc("/webhook/{webhook_id}/deliveries", controllers.WebhookController.Deliveries).Methods("GET")
+
+	r.HandleFunc("/app-password", controllers.AppPasswordController.List).Methods("GET")
+	r.HandleFunc("/app-password", controllers.AppPasswordController.Create).Methods("POST")
+	r.HandleFunc("/app-password/{app_password_id}", controllers.AppPasswordController.Delete).Methods("DELETE")
+
+	r.HandleFunc("/freebusy", controllers.FreeBusyController.Query).Methods("POST")
+	r.HandleFunc("/freebusy/slots", controllers.FreeBusyController.Slots).Methods("POST")
+
+	r.Handle("/.well-known/caldav", http.RedirectHandler("/caldav/", http.StatusMovedPermanently))
+	r.PathPrefix("/caldav/").Handler(caldav.NewHandler("/caldav"))
 
 	r.Use(logging_middlewaer.LoggingMw)
+	r.Use(auth_middleware.AuthMw)
 
 	return r
 }
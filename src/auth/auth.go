@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+	"time"
+)
+
+var (
+	// Tokens validates the bearer tokens of incoming requests, it is set up by the app configuration
+	Tokens *TokenAuth
+	// Registration tells who may create users, it is set up by the app configuration
+	Registration RegistrationPolicy
+
+	MissingTokenError = errors.New("missing bearer token")
+	InvalidTokenError = errors.New("invalid token")
+	CanNotIssueError  = errors.New("tokens can only be issued with a hmac secret")
+)
+
+// MaxQueryTokenTTL is the longest validity of the tokens accepted in urls, which may end
+// up in proxy logs and browser histories. QueryTokenTTL is the validity of the ones issued for them
+const (
+	MaxQueryTokenTTL = 5 * time.Minute
+	QueryTokenTTL    = time.Minute
+)
+
+type contextKey int
+
+const userIdKey contextKey = iota
+
+// TokenAuth validates JWTs signed either with a shared HMAC secret
+// or with the private key of an RSA key pair
+type TokenAuth struct {
+	method    jwt.SigningMethod
+	verifyKey interface{}
+	signKey   interface{}
+	issuer    string
+}
+
+func NewHMACTokenAuth(secret []byte, issuer string) *TokenAuth {
+	return &TokenAuth{method: jwt.SigningMethodHS256, verifyKey: secret, signKey: secret, issuer: issuer}
+}
+
+// NewRSATokenAuth takes a PEM encoded public key, tokens can not be issued with it
+func NewRSATokenAuth(publicKeyPEM []byte, issuer string) (*TokenAuth, error) {
+	key, err := jwt.ParseRSAPublicKeyFromPEM(publicKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rsa public key: %w", err)
+	}
+	return &TokenAuth{method: jwt.SigningMethodRS256, verifyKey: key, issuer: issuer}, nil
+}
+
+// Authenticate validates the signature, the expiry and the issuer of the token
+// and returns the user id it was issued for, the subject of the token
+func (a *TokenAuth) Authenticate(token string) (string, error) {
+	claims, err := a.parse(token)
+	if err != nil {
+		return "", err
+	}
+	return claims.Subject, nil
+}
+
+// AuthenticateShortLived additionally requires the token to have been issued
+// for at most maxTTL, it is meant for tokens passed outside of the Authorization header
+func (a *TokenAuth) AuthenticateShortLived(token string, maxTTL time.Duration) (string, error) {
+	claims, err := a.parse(token)
+	if err != nil {
+		return "", err
+	}
+	if claims.IssuedAt == nil || claims.ExpiresAt.Sub(claims.IssuedAt.Time) > maxTTL {
+		return "", fmt.Errorf("%w: token should be valid for at most %s", InvalidTokenError, maxTTL)
+	}
+	return claims.Subject, nil
+}
+
+func (a *TokenAuth) parse(token string) (*jwt.RegisteredClaims, error) {
+	if token == "" {
+		return nil, MissingTokenError
+	}
+	claims := jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		// the algorithm is pinned so that an rsa public key is never used as a hmac secret
+		if t.Method.Alg() != a.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+		}
+		return a.verifyKey, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", InvalidTokenError, err.Error())
+	}
+	if claims.ExpiresAt == nil {
+		return nil, fmt.Errorf("%w: token has no expiry", InvalidTokenError)
+	}
+	if a.issuer != "" && !claims.VerifyIssuer(a.issuer, true) {
+		return nil, fmt.Errorf("%w: unexpected issuer %s", InvalidTokenError, claims.Issuer)
+	}
+	if _, err := uuid.Parse(claims.Subject); err != nil {
+		return nil, fmt.Errorf("%w: subject should be a user id", InvalidTokenError)
+	}
+	return &claims, nil
+}
+
+// CanIssue tells whether tokens can be signed, which needs a hmac secret
+func (a *TokenAuth) CanIssue() bool {
+	return a.signKey != nil
+}
+
+// Issue signs a token for the user valid for ttl
+func (a *TokenAuth) Issue(userId string, ttl time.Duration) (string, time.Time, error) {
+	if a.signKey == nil {
+		return "", time.Time{}, CanNotIssueError
+	}
+	now := time.Now()
+	expiresAt := now.Add(ttl).Truncate(time.Second)
+	claims := jwt.RegisteredClaims{
+		Subject:   userId,
+		Issuer:    a.issuer,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}
+	token, err := jwt.NewWithClaims(a.method, claims).SignedString(a.signKey)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+const (
+	OpenRegistration  = "open"
+	AdminRegistration = "admin"
+)
+
+// RegistrationPolicy tells who may create users. Open registration lets anyone
+// do so without a token, otherwise only the admins can
+type RegistrationPolicy struct {
+	Open   bool
+	Admins map[string]bool
+}
+
+// NewRegistrationPolicy takes either OpenRegistration or AdminRegistration together
+// with the ids of the admins, which admin registration can not do without
+func NewRegistrationPolicy(mode string, adminIds []string) (RegistrationPolicy, error) {
+	policy := RegistrationPolicy{Admins: make(map[string]bool, len(adminIds))}
+	for _, id := range adminIds {
+		if _, err := uuid.Parse(id); err != nil {
+			return policy, fmt.Errorf("admin id %s should be a user id", id)
+		}
+		policy.Admins[id] = true
+	}
+	switch mode {
+	case OpenRegistration:
+		policy.Open = true
+	case AdminRegistration:
+		if len(policy.Admins) == 0 {
+			return policy, errors.New("admin registration needs the ids of the admins")
+		}
+	default:
+		return policy, fmt.Errorf("registration should be either %s or %s", OpenRegistration, AdminRegistration)
+	}
+	return policy, nil
+}
+
+// MayRegister tells whether the caller, empty when unauthenticated, may create users
+func (p RegistrationPolicy) MayRegister(callerId string) bool {
+	return p.Open || (callerId != "" && p.Admins[callerId])
+}
+
+func WithUserId(ctx context.Context, userId string) context.Context {
+	return context.WithValue(ctx, userIdKey, userId)
+}
+
+// UserId returns the id of the authenticated user, empty for public routes
+func UserId(ctx context.Context) string {
+	userId, _ := ctx.Value(userIdKey).(string)
+	return userId
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const userId = "123e4567-e89b-12d3-a456-426655440000"
+
+func TestTokenAuth_HMAC(t *testing.T) {
+	tokens := NewHMACTokenAuth([]byte("secret"), "calendar")
+
+	token, expiresAt, err := tokens.Issue(userId, time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, expiresAt.After(time.Now()))
+	id, err := tokens.Authenticate(token)
+	assert.Nil(t, err)
+	assert.Equal(t, userId, id)
+
+	_, err = tokens.Authenticate("")
+	assert.True(t, errors.Is(err, MissingTokenError))
+
+	expired, _, _ := tokens.Issue(userId, -time.Minute)
+	_, err = tokens.Authenticate(expired)
+	assert.True(t, errors.Is(err, InvalidTokenError))
+
+	foreign, _, _ := NewHMACTokenAuth([]byte("secret"), "another issuer").Issue(userId, time.Minute)
+	_, err = tokens.Authenticate(foreign)
+	assert.True(t, errors.Is(err, InvalidTokenError))
+
+	notUser, _, _ := tokens.Issue("admin", time.Minute)
+	_, err = tokens.Authenticate(notUser)
+	assert.True(t, errors.Is(err, InvalidTokenError))
+
+	noExpiry, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: userId, Issuer: "calendar"}).
+		SignedString([]byte("secret"))
+	_, err = tokens.Authenticate(noExpiry)
+	assert.True(t, errors.Is(err, InvalidTokenError))
+}
+
+func TestTokenAuth_AuthenticateShortLived(t *testing.T) {
+	tokens := NewHMACTokenAuth([]byte("secret"), "calendar")
+
+	token, _, err := tokens.Issue(userId, QueryTokenTTL)
+	assert.Nil(t, err)
+	id, err := tokens.AuthenticateShortLived(token, MaxQueryTokenTTL)
+	assert.Nil(t, err)
+	assert.Equal(t, userId, id)
+
+	long, _, _ := tokens.Issue(userId, time.Hour)
+	_, err = tokens.AuthenticateShortLived(long, MaxQueryTokenTTL)
+	assert.True(t, errors.Is(err, InvalidTokenError))
+
+	noIssuedAt, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: userId, Issuer: "calendar",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))}).SignedString([]byte("secret"))
+	_, err = tokens.AuthenticateShortLived(noIssuedAt, MaxQueryTokenTTL)
+	assert.True(t, errors.Is(err, InvalidTokenError))
+}
+
+func TestTokenAuth_RSA(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal("unable to generate key", err)
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal("unable to marshal key", err)
+	}
+	publicKeyPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})
+	tokens, err := NewRSATokenAuth(publicKeyPEM, "calendar")
+	assert.Nil(t, err)
+
+	claims := jwt.RegisteredClaims{
+		Subject:   userId,
+		Issuer:    "calendar",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+	assert.Nil(t, err)
+	id, err := tokens.Authenticate(token)
+	assert.Nil(t, err)
+	assert.Equal(t, userId, id)
+
+	// the public key must not be accepted as a hmac secret
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(publicKeyPEM)
+	assert.Nil(t, err)
+	_, err = tokens.Authenticate(forged)
+	assert.True(t, errors.Is(err, InvalidTokenError))
+
+	_, _, err = tokens.Issue(userId, time.Minute)
+	assert.True(t, errors.Is(err, CanNotIssueError))
+
+	_, err = NewRSATokenAuth([]byte("not a key"), "calendar")
+	assert.NotNil(t, err)
+}
+
+func TestRegistrationPolicy(t *testing.T) {
+	open, err := NewRegistrationPolicy(OpenRegistration, nil)
+	assert.Nil(t, err)
+	assert.True(t, open.MayRegister(""))
+
+	admin, err := NewRegistrationPolicy(AdminRegistration, []string{userId})
+	assert.Nil(t, err)
+	assert.True(t, admin.MayRegister(userId))
+	assert.False(t, admin.MayRegister(""))
+	assert.False(t, admin.MayRegister("b09b7b26-4d83-11ea-b1e0-c83a35cc61f1"))
+
+	_, err = NewRegistrationPolicy(AdminRegistration, nil)
+	assert.NotNil(t, err)
+	_, err = NewRegistrationPolicy(AdminRegistration, []string{"admin"})
+	assert.NotNil(t, err)
+	_, err = NewRegistrationPolicy("closed", nil)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,647 @@
+package caldav
+
+import (
+	"calendar_service/src/auth"
+	"calendar_service/src/ical"
+	"calendar_service/src/logger"
+	"calendar_service/src/models"
+	"calendar_service/src/services"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const (
+	objectExtension   = ".ics"
+	objectContentType = "text/calendar; charset=utf-8; component=vevent"
+	maxBodySize       = 10 << 20
+)
+
+type resourceKind int
+
+const (
+	kindRoot resourceKind = iota
+	kindHome
+	kindCalendar
+	kindObject
+)
+
+// resource is an addressed WebDAV resource. Homes are the users, calendar
+// collections are the calendars and calendar objects are the appointments.
+// denied is set by load when the caller may not access the resource
+type resource struct {
+	callerId   string
+	denied     bool
+	kind       resourceKind
+	userId     string
+	calendarId string
+	objectName string
+	user       *models.User
+	calendar   *models.Calendar
+	appt       *models.Appointment
+}
+
+// Handler serves RFC 4791 CalDAV on top of the calendar and appointment services:
+//
+//	{prefix}/users/{user_id}/                       calendar home of a user
+//	{prefix}/calendars/{calendar_id}/               calendar collection
+//	{prefix}/calendars/{calendar_id}/{name}.ics     calendar object
+//
+// Calendar objects are named after the appointment id unless a client wrote
+// them under a name of its own, which is kept together with their UID
+type Handler struct {
+	prefix string
+}
+
+func NewHandler(prefix string) *Handler {
+	return &Handler{prefix: strings.TrimRight(prefix, "/")}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	res, ok := h.parsePath(r.URL.Path, auth.UserId(r.Context()))
+	if !ok {
+		http.Error(w, "resource not found", http.StatusNotFound)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxBodySize)
+	defer r.Body.Close()
+
+	switch r.Method {
+	case http.MethodOptions:
+		h.options(w)
+	case "PROPFIND":
+		h.propfind(w, r, res)
+	case "REPORT":
+		h.report(w, r, res)
+	case http.MethodGet, http.MethodHead:
+		h.get(w, r, res)
+	case http.MethodPut:
+		h.put(w, r, res)
+	case http.MethodDelete:
+		h.delete(w, r, res)
+	default:
+		w.Header().Set("Allow", allowedMethods)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+const allowedMethods = "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT"
+
+func (h *Handler) options(w http.ResponseWriter) {
+	w.Header().Set("DAV", "1, 3, calendar-access")
+	w.Header().Set("Allow", allowedMethods)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) parsePath(path, callerId string) (*resource, bool) {
+	if !strings.HasPrefix(path, h.prefix) {
+		return nil, false
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, h.prefix), "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "":
+		return &resource{callerId: callerId, kind: kindRoot}, true
+	case len(parts) == 2 && parts[0] == "users" && isUUID(parts[1]):
+		return &resource{callerId: callerId, kind: kindHome, userId: parts[1]}, true
+	case len(parts) == 2 && parts[0] == "calendars" && isUUID(parts[1]):
+		return &resource{callerId: callerId, kind: kindCalendar, calendarId: parts[1]}, true
+	case len(parts) == 3 && parts[0] == "calendars" && isUUID(parts[1]) && strings.HasSuffix(parts[2], objectExtension):
+		return &resource{
+			callerId:   callerId,
+			kind:       kindObject,
+			calendarId: parts[1],
+			objectName: strings.TrimSuffix(parts[2], objectExtension),
+		}, true
+	}
+	return nil, false
+}
+
+// load reads the models the resource is backed by. ok is false
+// when the resource does not exist or the caller may not access it
+func (h *Handler) load(res *resource) bool {
+	switch res.kind {
+	case kindHome:
+		usr, err := services.UserService.Read(res.callerId, res.userId)
+		if err != nil {
+			res.denied = errors.Is(err, services.ForbiddenError)
+			return false
+		}
+		res.user = usr
+	case kindCalendar, kindObject:
+		cal, err := services.CalendarService.ReadDetailed(res.callerId, res.calendarId)
+		if err != nil {
+			res.denied = errors.Is(err, services.ForbiddenError)
+			return false
+		}
+		res.calendar = cal
+		if res.kind == kindObject {
+			res.appt = findAppointment(cal, res.objectName)
+			return res.appt != nil
+		}
+	}
+	return true
+}
+
+func (h *Handler) propfind(w http.ResponseWriter, r *http.Request, res *resource) {
+	var req propfindRequest
+	if err := decodeXML(r.Body, &req); err != nil {
+		logger.Logger.Infow("invalid propfind body", "err", err.Error(), "path", r.URL.Path)
+		http.Error(w, "invalid propfind body", http.StatusBadRequest)
+		return
+	}
+	if !h.load(res) {
+		h.notFound(w, res)
+		return
+	}
+
+	ms := newMultistatus()
+	h.addProps(ms, res, req.Prop)
+	if r.Header.Get("Depth") != "0" {
+		for _, child := range h.children(res) {
+			h.addProps(ms, child, req.Prop)
+		}
+	}
+	ms.write(w)
+}
+
+func (h *Handler) children(res *resource) []*resource {
+	children := make([]*resource, 0)
+	switch res.kind {
+	case kindHome:
+		for _, c := range res.user.Calendars {
+			cal, err := services.CalendarService.ReadDetailed(res.callerId, c.ID)
+			if err != nil {
+				logger.Logger.Infow("unable to read calendar", "err", err.Error(), "calendar_id", c.ID)
+				continue
+			}
+			children = append(children, &resource{callerId: res.callerId, kind: kindCalendar, calendarId: cal.ID, calendar: cal})
+		}
+	case kindCalendar:
+		for _, appt := range res.calendar.Appointments {
+			children = append(children, objectResource(res.calendar, appt))
+		}
+	}
+	return children
+}
+
+func (h *Handler) report(w http.ResponseWriter, r *http.Request, res *resource) {
+	if res.kind != kindCalendar {
+		http.Error(w, "reports are supported on calendar collections only", http.StatusForbidden)
+		return
+	}
+	var req reportRequest
+	if err := decodeXML(r.Body, &req); err != nil {
+		logger.Logger.Infow("invalid report body", "err", err.Error(), "path", r.URL.Path)
+		http.Error(w, "invalid report body", http.StatusBadRequest)
+		return
+	}
+	if !h.load(res) {
+		h.notFound(w, res)
+		return
+	}
+
+	ms := newMultistatus()
+	switch {
+	case req.XMLName.Space == nsCalDAV && req.XMLName.Local == "calendar-query":
+		from, to, ok, err := req.eventTimeRange()
+		if err != nil {
+			http.Error(w, "invalid time-range", http.StatusBadRequest)
+			return
+		}
+		if ok {
+			for _, appt := range res.calendar.Appointments {
+				occurrences, err := appt.Occurrences(from, to)
+				if err != nil || len(occurrences) == 0 {
+					continue
+				}
+				h.addProps(ms, objectResource(res.calendar, appt), req.Prop)
+			}
+		}
+	case req.XMLName.Space == nsCalDAV && req.XMLName.Local == "calendar-multiget":
+		for _, href := range req.Hrefs {
+			// hrefs are escaped and may be absolute urls
+			parsed, err := url.Parse(strings.TrimSpace(href))
+			if err != nil {
+				ms.addStatus(href, http.StatusNotFound)
+				continue
+			}
+			child, ok := h.parsePath(parsed.Path, res.callerId)
+			if ok && child.kind == kindObject && child.calendarId == res.calendarId {
+				if appt := findAppointment(res.calendar, child.objectName); appt != nil {
+					h.addProps(ms, objectResource(res.calendar, appt), req.Prop)
+					continue
+				}
+			}
+			ms.addStatus(href, http.StatusNotFound)
+		}
+	default:
+		http.Error(w, "unsupported report", http.StatusForbidden)
+		return
+	}
+	ms.write(w)
+}
+
+func (h *Handler) get(w http.ResponseWriter, r *http.Request, res *resource) {
+	if res.kind != kindObject && res.kind != kindCalendar {
+		http.Error(w, "resource can not be downloaded", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.load(res) {
+		h.notFound(w, res)
+		return
+	}
+	cal := ical.FromCalendar(res.calendar)
+	if res.kind == kindObject {
+		cal = &ical.Calendar{Events: ical.FromAppointment(res.appt)}
+		w.Header().Set("ETag", etag(res.appt))
+	}
+	w.Header().Set("Content-Type", ical.ContentType)
+	if r.Method == http.MethodHead {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err := cal.Encode(w); err != nil {
+		logger.Logger.Infow("unable to write calendar data", "err", err.Error(), "path", r.URL.Path)
+	}
+}
+
+func (h *Handler) put(w http.ResponseWriter, r *http.Request, res *resource) {
+	if res.kind != kindObject {
+		http.Error(w, "only calendar objects can be written", http.StatusMethodNotAllowed)
+		return
+	}
+	if res.objectName == "" {
+		http.Error(w, "calendar object name can not be empty", http.StatusForbidden)
+		return
+	}
+	exists := h.load(res)
+	if res.denied {
+		h.notFound(w, res)
+		return
+	}
+	if res.calendar == nil {
+		http.Error(w, "calendar not found", http.StatusConflict)
+		return
+	}
+	version, ok := expectedVersion(r, res.appt)
+	if !ok {
+		http.Error(w, "precondition failed", http.StatusPreconditionFailed)
+		return
+	}
+
+	data, err := ical.Decode(r.Body)
+	if err != nil {
+		http.Error(w, "invalid calendar data", http.StatusBadRequest)
+		return
+	}
+	var imported *ical.ImportedEvent
+	for _, item := range ical.ToAppointments(data) {
+		if item.Err == nil {
+			imported = item
+			break
+		}
+	}
+	if imported == nil {
+		http.Error(w, "calendar data has no valid VEVENT", http.StatusBadRequest)
+		return
+	}
+	appt := imported.Appointment
+	if other := findUid(res.calendar, appt.Uid); other != nil && other != res.appt {
+		http.Error(w, "another calendar object has the same UID", http.StatusConflict)
+		return
+	}
+	appt.CalendarId = res.calendarId
+	attendees, err := services.UserService.ReadByEmails(imported.AttendeeEmails)
+	if err != nil {
+		logger.Logger.Infow("unable to resolve attendees", "err", err.Error(), "path", r.URL.Path)
+		http.Error(w, "unable to resolve attendees", http.StatusInternalServerError)
+		return
+	}
+	appt.Attendees = attendees
+	appt.ExternalAttendees = externalAttendees(imported, attendees)
+
+	status := http.StatusCreated
+	var stored *models.Appointment
+	if exists {
+		status = http.StatusNoContent
+		appt.ID = res.appt.ID
+		appt.Version = version
+		stored, err = services.AppointmentService.Replace(res.callerId, *appt)
+	} else {
+		appt.ObjectName = res.objectName
+		stored, err = services.AppointmentService.Create(res.callerId, *appt)
+	}
+	if err != nil {
+		logger.Logger.Infow("unable to store calendar object", "err", err.Error(), "path", r.URL.Path)
+		http.Error(w, err.Error(), writeStatus(err))
+		return
+	}
+	w.Header().Set("ETag", etag(stored))
+	w.WriteHeader(status)
+}
+
+func (h *Handler) delete(w http.ResponseWriter, r *http.Request, res *resource) {
+	if res.kind != kindObject && res.kind != kindCalendar {
+		http.Error(w, "resource can not be deleted", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.load(res) {
+		h.notFound(w, res)
+		return
+	}
+	var err error
+	if res.kind == kindObject {
+		version, ok := expectedVersion(r, res.appt)
+		if !ok {
+			http.Error(w, "precondition failed", http.StatusPreconditionFailed)
+			return
+		}
+		_, err = services.AppointmentService.Delete(res.callerId, res.appt.ID, version)
+	} else {
+		_, err = services.CalendarService.Delete(res.callerId, res.calendar.ID, 0)
+	}
+	if err != nil {
+		logger.Logger.Infow("unable to delete resource", "err", err.Error(), "path", r.URL.Path)
+		http.Error(w, err.Error(), writeStatus(err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// notFound reports a resource load failed on
+func (h *Handler) notFound(w http.ResponseWriter, res *resource) {
+	if res.denied {
+		http.Error(w, "access denied", http.StatusForbidden)
+		return
+	}
+	http.Error(w, "resource not found", http.StatusNotFound)
+}
+
+func (h *Handler) href(res *resource) string {
+	switch res.kind {
+	case kindHome:
+		return fmt.Sprintf("%s/users/%s/", h.prefix, res.userId)
+	case kindCalendar:
+		return fmt.Sprintf("%s/calendars/%s/", h.prefix, res.calendarId)
+	case kindObject:
+		return fmt.Sprintf("%s/calendars/%s/%s%s", h.prefix, res.calendarId, url.PathEscape(res.objectName), objectExtension)
+	}
+	return h.prefix + "/"
+}
+
+var defaultProps = map[resourceKind][]xml.Name{
+	kindRoot: {{Space: nsDAV, Local: "resourcetype"}},
+	kindHome: {
+		{Space: nsDAV, Local: "resourcetype"},
+		{Space: nsDAV, Local: "displayname"},
+		{Space: nsCalDAV, Local: "calendar-home-set"},
+	},
+	kindCalendar: {
+		{Space: nsDAV, Local: "resourcetype"},
+		{Space: nsDAV, Local: "displayname"},
+		{Space: nsCalendarServer, Local: "getctag"},
+		{Space: nsCalDAV, Local: "supported-calendar-component-set"},
+	},
+	kindObject: {
+		{Space: nsDAV, Local: "resourcetype"},
+		{Space: nsDAV, Local: "getetag"},
+		{Space: nsDAV, Local: "getcontenttype"},
+		{Space: nsDAV, Local: "getlastmodified"},
+	},
+}
+
+func (h *Handler) addProps(ms *multistatus, res *resource, names []xml.Name) {
+	if len(names) == 0 {
+		names = defaultProps[res.kind]
+	}
+	found := make([]string, 0, len(names))
+	missing := make([]xml.Name, 0)
+	for _, name := range names {
+		if value, ok := h.prop(res, name); ok {
+			found = append(found, value)
+		} else {
+			missing = append(missing, name)
+		}
+	}
+	ms.add(h.href(res), found, missing)
+}
+
+// prop renders a single property of the resource
+func (h *Handler) prop(res *resource, name xml.Name) (string, bool) {
+	homeHref := ""
+	switch res.kind {
+	case kindHome:
+		homeHref = h.href(res)
+	case kindCalendar, kindObject:
+		homeHref = h.href(&resource{kind: kindHome, userId: res.calendar.UserId})
+	}
+
+	switch name {
+	case xml.Name{Space: nsDAV, Local: "resourcetype"}:
+		switch res.kind {
+		case kindRoot:
+			return element("D", "resourcetype", "<D:collection/>"), true
+		case kindHome:
+			return element("D", "resourcetype", "<D:collection/><D:principal/>"), true
+		case kindCalendar:
+			return element("D", "resourcetype", "<D:collection/><C:calendar/>"), true
+		}
+		return "<D:resourcetype/>", true
+	case xml.Name{Space: nsDAV, Local: "displayname"}:
+		switch res.kind {
+		case kindHome:
+			return element("D", "displayname", escape(res.user.FirstName+" "+res.user.LastName)), true
+		case kindCalendar:
+			return element("D", "displayname", escape(res.calendar.Name)), true
+		case kindObject:
+			return element("D", "displayname", escape(res.appt.Subject)), true
+		}
+	case xml.Name{Space: nsDAV, Local: "current-user-principal"},
+		xml.Name{Space: nsDAV, Local: "principal-URL"},
+		xml.Name{Space: nsCalDAV, Local: "calendar-home-set"}:
+		// clients discover the home of the authenticated user from the root
+		if res.kind == kindRoot && res.callerId != "" && name.Local == "current-user-principal" {
+			return hrefElement("D", name.Local, h.href(&resource{kind: kindHome, userId: res.callerId})), true
+		}
+		if res.kind == kindHome {
+			prefix := "D"
+			if name.Space == nsCalDAV {
+				prefix = "C"
+			}
+			return hrefElement(prefix, name.Local, homeHref), true
+		}
+	case xml.Name{Space: nsDAV, Local: "owner"}:
+		if res.kind == kindCalendar {
+			return hrefElement("D", "owner", homeHref), true
+		}
+	case xml.Name{Space: nsCalDAV, Local: "supported-calendar-component-set"}:
+		if res.kind == kindCalendar {
+			return element("C", "supported-calendar-component-set", `<C:comp name="VEVENT"/>`), true
+		}
+	case xml.Name{Space: nsDAV, Local: "supported-report-set"}:
+		if res.kind == kindCalendar {
+			return element("D", "supported-report-set",
+				"<D:supported-report><D:report><C:calendar-query/></D:report></D:supported-report>"+
+					"<D:supported-report><D:report><C:calendar-multiget/></D:report></D:supported-report>"), true
+		}
+	case xml.Name{Space: nsCalendarServer, Local: "getctag"}:
+		if res.kind == kindCalendar {
+			return element("CS", "getctag", escape(ctag(res.calendar))), true
+		}
+	case xml.Name{Space: nsDAV, Local: "getetag"}:
+		if res.kind == kindObject {
+			return element("D", "getetag", escape(etag(res.appt))), true
+		}
+	case xml.Name{Space: nsDAV, Local: "getcontenttype"}:
+		if res.kind == kindObject {
+			return element("D", "getcontenttype", objectContentType), true
+		}
+	case xml.Name{Space: nsDAV, Local: "getlastmodified"}:
+		if res.kind == kindObject {
+			return element("D", "getlastmodified", res.appt.UpdatedAt.UTC().Format(http.TimeFormat)), true
+		}
+	case xml.Name{Space: nsCalDAV, Local: "calendar-data"}:
+		if res.kind == kindObject {
+			var buf strings.Builder
+			cal := &ical.Calendar{Events: ical.FromAppointment(res.appt)}
+			if err := cal.Encode(&buf); err != nil {
+				return "", false
+			}
+			return element("C", "calendar-data", escape(buf.String())), true
+		}
+	}
+	return "", false
+}
+
+func objectResource(cal *models.Calendar, appt *models.Appointment) *resource {
+	return &resource{
+		kind:       kindObject,
+		calendarId: cal.ID,
+		objectName: objectName(appt),
+		calendar:   cal,
+		appt:       appt,
+	}
+}
+
+// objectName is the name the appointment is addressed by, the one the client
+// wrote it to or else its id
+func objectName(appt *models.Appointment) string {
+	if appt.ObjectName != "" {
+		return appt.ObjectName
+	}
+	return appt.ID
+}
+
+func findAppointment(cal *models.Calendar, name string) *models.Appointment {
+	for _, appt := range cal.Appointments {
+		if appt.ObjectName == name || (appt.ObjectName == "" && strings.EqualFold(appt.ID, name)) {
+			return appt
+		}
+	}
+	return nil
+}
+
+// findUid returns the appointment of the calendar with the UID, nil when there is none
+func findUid(cal *models.Calendar, uid string) *models.Appointment {
+	if uid == "" {
+		return nil
+	}
+	for _, appt := range cal.Appointments {
+		if appt.Uid == uid || (appt.Uid == "" && appt.ID == uid) {
+			return appt
+		}
+	}
+	return nil
+}
+
+// expectedVersion checks If-Match and If-None-Match against the calendar object,
+// appt is nil when it does not exist. It returns the version the write should
+// expect the object at, 0 for any, so that the write checks it once more in its
+// transaction. ok is false when the preconditions already fail
+func expectedVersion(r *http.Request, appt *models.Appointment) (version int64, ok bool) {
+	if ifNoneMatch := strings.TrimSpace(r.Header.Get("If-None-Match")); ifNoneMatch != "" && appt != nil {
+		if ifNoneMatch == "*" || strings.Contains(ifNoneMatch, etag(appt)) {
+			return 0, false
+		}
+	}
+	ifMatch := strings.TrimSpace(r.Header.Get("If-Match"))
+	if ifMatch == "" {
+		return 0, true
+	}
+	if appt == nil {
+		return 0, false
+	}
+	if ifMatch == "*" {
+		return 0, true
+	}
+	for _, tag := range strings.Split(ifMatch, ",") {
+		if version, ok := models.VersionOfETag(tag); ok && version == appt.Version {
+			return version, true
+		}
+	}
+	return 0, false
+}
+
+// writeStatus is the status of a failed write, 412 when the object was changed meanwhile
+func writeStatus(err error) int {
+	if errors.Is(err, models.VersionMismatchError) {
+		return http.StatusPreconditionFailed
+	}
+	return http.StatusConflict
+}
+
+// etag is the version of the appointment, which the etags of the rest api start with as well
+func etag(appt *models.Appointment) string {
+	return fmt.Sprintf(`"%d"`, appt.Version)
+}
+
+// ctag changes whenever an appointment of the calendar is created, changed or deleted
+func ctag(cal *models.Calendar) string {
+	tags := make([]string, 0, len(cal.Appointments))
+	for _, appt := range cal.Appointments {
+		tags = append(tags, appt.ID+":"+etag(appt))
+	}
+	sort.Strings(tags)
+	hash := fnv.New64a()
+	fmt.Fprintf(hash, "%s:%d:%s", cal.ID, cal.Version, strings.Join(tags, ","))
+	return fmt.Sprintf("%x", hash.Sum64())
+}
+
+func isUUID(s string) bool {
+	_, err := uuid.Parse(s)
+	return err == nil
+}
+
+// decodeXML reads an optional XML request body
+func decodeXML(body io.Reader, v interface{}) error {
+	err := xml.NewDecoder(body).Decode(v)
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// externalAttendees lists the attendees of the event that are not registered users
+func externalAttendees(imported *ical.ImportedEvent, registered []*models.User) []*models.ExternalAttendee {
+	known := make(map[string]bool, len(registered))
+	for _, usr := range registered {
+		known[strings.ToLower(usr.Email)] = true
+	}
+	externals := make([]*models.ExternalAttendee, 0)
+	for _, email := range imported.AttendeeEmails {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if known[email] {
+			continue
+		}
+		known[email] = true
+		externals = append(externals, &models.ExternalAttendee{Email: email, Name: imported.AttendeeNames[email]})
+	}
+	return externals
+}
@@ -0,0 +1,167 @@
+package caldav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	nsDAV            = "DAV:"
+	nsCalDAV         = "urn:ietf:params:xml:ns:caldav"
+	nsCalendarServer = "http://calendarserver.org/ns/"
+
+	timeRangeLayout = "20060102T150405Z"
+)
+
+// propNames collects the names of the elements of a DAV:prop
+type propNames []xml.Name
+
+func (p *propNames) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			*p = append(*p, t.Name)
+			if err := d.Skip(); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+type propfindRequest struct {
+	XMLName xml.Name  `xml:"DAV: propfind"`
+	AllProp *struct{} `xml:"DAV: allprop"`
+	Prop    propNames `xml:"DAV: prop"`
+}
+
+type timeRange struct {
+	Start string `xml:"start,attr"`
+	End   string `xml:"end,attr"`
+}
+
+type compFilter struct {
+	Name        string       `xml:"name,attr"`
+	TimeRange   *timeRange   `xml:"urn:ietf:params:xml:ns:caldav time-range"`
+	CompFilters []compFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+}
+
+// reportRequest covers both calendar-query and calendar-multiget reports
+type reportRequest struct {
+	XMLName xml.Name
+	Prop    propNames `xml:"DAV: prop"`
+	Filter  struct {
+		CompFilter compFilter `xml:"urn:ietf:params:xml:ns:caldav comp-filter"`
+	} `xml:"urn:ietf:params:xml:ns:caldav filter"`
+	Hrefs []string `xml:"DAV: href"`
+}
+
+// eventTimeRange returns the VEVENT time-range of a calendar-query filter.
+// ok is false when the filter can not match VEVENTs at all
+func (r *reportRequest) eventTimeRange() (from, to time.Time, ok bool, err error) {
+	root := r.Filter.CompFilter
+	if root.Name != "" && root.Name != "VCALENDAR" {
+		return from, to, false, nil
+	}
+	from = time.Unix(0, 0).UTC()
+	to = time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+	if len(root.CompFilters) == 0 {
+		return from, to, true, nil
+	}
+	for _, cf := range root.CompFilters {
+		if cf.Name != "VEVENT" {
+			continue
+		}
+		if cf.TimeRange == nil {
+			return from, to, true, nil
+		}
+		if cf.TimeRange.Start != "" {
+			if from, err = time.Parse(timeRangeLayout, cf.TimeRange.Start); err != nil {
+				return from, to, false, err
+			}
+		}
+		if cf.TimeRange.End != "" {
+			if to, err = time.Parse(timeRangeLayout, cf.TimeRange.End); err != nil {
+				return from, to, false, err
+			}
+		}
+		return from, to, true, nil
+	}
+	return from, to, false, nil
+}
+
+// multistatus accumulates the responses of a 207 Multi-Status body
+type multistatus struct {
+	buf bytes.Buffer
+}
+
+func newMultistatus() *multistatus {
+	ms := &multistatus{}
+	ms.buf.WriteString(xml.Header)
+	ms.buf.WriteString(fmt.Sprintf(`<D:multistatus xmlns:D="%s" xmlns:C="%s" xmlns:CS="%s">`,
+		nsDAV, nsCalDAV, nsCalendarServer))
+	return ms
+}
+
+// add writes a response for href. found holds the rendered properties,
+// missing the names of the requested properties the resource does not have
+func (ms *multistatus) add(href string, found []string, missing []xml.Name) {
+	ms.buf.WriteString("<D:response><D:href>")
+	xml.EscapeText(&ms.buf, []byte(href))
+	ms.buf.WriteString("</D:href>")
+	if len(found) > 0 {
+		ms.buf.WriteString("<D:propstat><D:prop>")
+		for _, prop := range found {
+			ms.buf.WriteString(prop)
+		}
+		ms.buf.WriteString("</D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat>")
+	}
+	if len(missing) > 0 {
+		ms.buf.WriteString("<D:propstat><D:prop>")
+		for _, name := range missing {
+			if name.Space == "" {
+				ms.buf.WriteString(fmt.Sprintf("<%s/>", name.Local))
+				continue
+			}
+			ms.buf.WriteString(fmt.Sprintf(`<X:%s xmlns:X="%s"/>`, name.Local, escape(name.Space)))
+		}
+		ms.buf.WriteString("</D:prop><D:status>HTTP/1.1 404 Not Found</D:status></D:propstat>")
+	}
+	ms.buf.WriteString("</D:response>")
+}
+
+func (ms *multistatus) addStatus(href string, status int) {
+	ms.buf.WriteString("<D:response><D:href>")
+	xml.EscapeText(&ms.buf, []byte(href))
+	ms.buf.WriteString(fmt.Sprintf("</D:href><D:status>HTTP/1.1 %d %s</D:status></D:response>",
+		status, http.StatusText(status)))
+}
+
+func (ms *multistatus) write(w http.ResponseWriter) {
+	ms.buf.WriteString("</D:multistatus>")
+	w.Header().Set("Content-Type", `application/xml; charset="utf-8"`)
+	w.WriteHeader(http.StatusMultiStatus)
+	w.Write(ms.buf.Bytes())
+}
+
+func escape(s string) string {
+	var buf bytes.Buffer
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
+
+func element(prefix, name, value string) string {
+	return fmt.Sprintf("<%s:%s>%s</%s:%s>", prefix, name, value, prefix, name)
+}
+
+func hrefElement(prefix, name, href string) string {
+	return element(prefix, name, element("D", "href", escape(href)))
+}
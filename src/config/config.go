@@ -5,11 +5,57 @@ import "github.com/jinzhu/configor"
 var Config Configuration
 
 type Configuration struct {
-	ServiceName string `env:"SERVICE_NAME" default:"calendar"`
-	Env         string `env:"ENV" default:"dev"`
-	LogLevel    string `env:"LOG_LEVEL" default:"debug"`
-	Port        string `env:"PORT" default:":8080"`
-	CalendarDb  CalendarDb
+	ServiceName    string `env:"SERVICE_NAME" default:"calendar"`
+	Env            string `env:"ENV" default:"dev"`
+	LogLevel       string `env:"LOG_LEVEL" default:"debug"`
+	Port           string `env:"PORT" default:":8080"`
+	ConflictPolicy string `env:"CONFLICT_POLICY" default:"warn"`
+	CalendarDb     CalendarDb
+	Auth           Auth
+	Alarms         Alarms
+	Webhooks       Webhooks
+	Stream         Stream
+}
+
+// Stream configures the broker delivering changes to the live update streams
+type Stream struct {
+	// PollInterval is the number of seconds between two looks for changes
+	// whose notification got lost, changes are otherwise delivered as soon as they are made
+	PollInterval int `env:"STREAM_POLL_INTERVAL" default:"10"`
+}
+
+// Webhooks configures the dispatcher sending the webhook deliveries
+type Webhooks struct {
+	Enabled bool `env:"WEBHOOKS_ENABLED" default:"true"`
+	// PollInterval is the number of seconds between two looks for pending deliveries
+	PollInterval int `env:"WEBHOOKS_POLL_INTERVAL" default:"5"`
+	// Timeout is the number of seconds a webhook has to respond
+	Timeout int `env:"WEBHOOKS_TIMEOUT" default:"10"`
+	// AllowPrivate lets webhooks deliver to private, loopback and link local addresses, for local development only
+	AllowPrivate bool `env:"WEBHOOKS_ALLOW_PRIVATE" default:"false"`
+}
+
+// Alarms configures the scheduler firing the alarms of appointments
+type Alarms struct {
+	Enabled bool `env:"ALARMS_ENABLED" default:"true"`
+	// PollInterval is the number of seconds between two looks for due alarms
+	PollInterval int `env:"ALARMS_POLL_INTERVAL" default:"30"`
+}
+
+// Auth configures the validation of bearer tokens, exactly one of
+// HmacSecret and RsaPublicKey (PEM encoded) should be set
+type Auth struct {
+	HmacSecret   string `env:"JWT_HMAC_SECRET"`
+	RsaPublicKey string `env:"JWT_RSA_PUBLIC_KEY"`
+	Issuer       string `env:"JWT_ISSUER" default:"calendar"`
+	// DevTokens enables POST /auth/token issuing tokens valid for DevTokenTTL
+	// minutes to any user. It needs HmacSecret and is meant for local development only
+	DevTokens   bool `env:"JWT_DEV_TOKENS" default:"false"`
+	DevTokenTTL int  `env:"JWT_DEV_TOKEN_TTL" default:"60"`
+	// Registration is either open, letting anyone create users without a token,
+	// or admin, letting only the users listed in AdminIds (comma separated) create users
+	Registration string `env:"USER_REGISTRATION" default:"admin"`
+	AdminIds     string `env:"ADMIN_USER_IDS"`
 }
 
 type CalendarDb struct {
@@ -0,0 +1,124 @@
+package controllers
+
+import (
+	"calendar_service/src/auth"
+	"calendar_service/src/logger"
+	"calendar_service/src/models"
+	"calendar_service/src/services"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"io/ioutil"
+	"net/http"
+)
+
+var (
+	AlarmController AlarmControllerInterface = &alarmController{}
+)
+
+type AlarmControllerInterface interface {
+	Create(w http.ResponseWriter, r *http.Request)
+	List(w http.ResponseWriter, r *http.Request)
+	Delete(w http.ResponseWriter, r *http.Request)
+}
+
+type alarmController struct{}
+
+func (a *alarmController) Create(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	apptId := vars["appointment_id"]
+	ok := IsValidUUID(apptId)
+	if !ok {
+		logger.Logger.Infof("received invalid uuid=%s", apptId)
+		apiErr := NewBadRequestApiError("invalid uuid")
+		RespondError(w, apiErr)
+		return
+	}
+
+	requestBody, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		errorMsg := "invalid request body"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(errorMsg)
+		RespondError(w, apiErr)
+		return
+	}
+	defer r.Body.Close()
+	var alarm models.Alarm
+	err = json.Unmarshal(requestBody, &alarm)
+	if err != nil {
+		errorMsg := "invalid json body"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(errorMsg)
+		RespondError(w, apiErr)
+		return
+	}
+	alarm.AppointmentId = apptId
+	alarm.UserId = auth.UserId(r.Context())
+	if err := alarm.Validate(); err != nil {
+		logger.Logger.Infow("invalid alarm", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+
+	result, err := services.AlarmService.Create(auth.UserId(r.Context()), alarm)
+	if err != nil {
+		errorMsg := "unable to create alarm"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusNotFound))
+		RespondError(w, apiErr)
+		return
+	}
+	RespondJSON(w, http.StatusCreated, result)
+}
+
+// List returns the alarms the current user set on the appointment
+func (a *alarmController) List(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	apptId := vars["appointment_id"]
+	ok := IsValidUUID(apptId)
+	if !ok {
+		logger.Logger.Infof("received invalid uuid=%s", apptId)
+		apiErr := NewBadRequestApiError("invalid uuid")
+		RespondError(w, apiErr)
+		return
+	}
+
+	result, err := services.AlarmService.List(auth.UserId(r.Context()), apptId)
+	if err != nil {
+		errorMsg := "unable to get alarms"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusNotFound))
+		RespondError(w, apiErr)
+		return
+	}
+	RespondJSON(w, http.StatusOK, result)
+}
+
+func (a *alarmController) Delete(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	apptId := vars["appointment_id"]
+	alarmId := vars["alarm_id"]
+	for _, id := range []string{apptId, alarmId} {
+		if !IsValidUUID(id) {
+			logger.Logger.Infof("received invalid uuid=%s", id)
+			apiErr := NewBadRequestApiError("invalid uuid")
+			RespondError(w, apiErr)
+			return
+		}
+	}
+
+	deletedId, err := services.AlarmService.Delete(auth.UserId(r.Context()), apptId, alarmId)
+	if err != nil {
+		errorMsg := "unable to delete alarm"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusNotFound))
+		RespondError(w, apiErr)
+		return
+	}
+	response := models.ResponseDeleted{
+		Message:   "alarm deleted",
+		DeletedId: deletedId,
+	}
+	RespondJSON(w, http.StatusAccepted, response)
+}
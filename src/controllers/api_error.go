@@ -1,7 +1,10 @@
 package controllers
 
 import (
+	"calendar_service/src/models"
+	"calendar_service/src/services"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 )
@@ -70,3 +73,18 @@ func NewApiErrorFromBytes(bytes []byte) (ApiErrorInterface, error) {
 	}
 	return &myError, nil
 }
+
+// ErrorStatus is the status code of a failed service call, access denials
+// are reported as 403, version mismatches as 412 and any other error with the given status code
+func ErrorStatus(err error, statusCode int) int {
+	if errors.Is(err, services.ForbiddenError) {
+		return http.StatusForbidden
+	}
+	if errors.Is(err, models.VersionMismatchError) {
+		return http.StatusPreconditionFailed
+	}
+	if errors.Is(err, services.ResyncError) {
+		return http.StatusGone
+	}
+	return statusCode
+}
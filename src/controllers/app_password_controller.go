@@ -0,0 +1,102 @@
+package controllers
+
+import (
+	"calendar_service/src/auth"
+	"calendar_service/src/logger"
+	"calendar_service/src/models"
+	"calendar_service/src/services"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"io/ioutil"
+	"net/http"
+)
+
+var (
+	AppPasswordController AppPasswordControllerInterface = &appPasswordController{}
+)
+
+type AppPasswordControllerInterface interface {
+	Create(w http.ResponseWriter, r *http.Request)
+	List(w http.ResponseWriter, r *http.Request)
+	Delete(w http.ResponseWriter, r *http.Request)
+}
+
+type appPasswordController struct{}
+
+// Create generates an app password of the current user, the response
+// holds the password, it is not returned afterwards
+func (c *appPasswordController) Create(w http.ResponseWriter, r *http.Request) {
+	requestBody, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		errorMsg := "invalid request body"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(errorMsg)
+		RespondError(w, apiErr)
+		return
+	}
+	defer r.Body.Close()
+	var appPassword models.AppPassword
+	err = json.Unmarshal(requestBody, &appPassword)
+	if err != nil {
+		errorMsg := "invalid json body"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(errorMsg)
+		RespondError(w, apiErr)
+		return
+	}
+	appPassword.UserId = auth.UserId(r.Context())
+	if err := appPassword.Validate(); err != nil {
+		logger.Logger.Infow("invalid app password", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+
+	result, err := services.AppPasswordService.Create(auth.UserId(r.Context()), appPassword)
+	if err != nil {
+		errorMsg := "unable to create app password"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusInternalServerError))
+		RespondError(w, apiErr)
+		return
+	}
+	RespondJSON(w, http.StatusCreated, result)
+}
+
+// List returns the app passwords of the current user, without the passwords
+func (c *appPasswordController) List(w http.ResponseWriter, r *http.Request) {
+	result, err := services.AppPasswordService.List(auth.UserId(r.Context()))
+	if err != nil {
+		errorMsg := "unable to get app passwords"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusInternalServerError))
+		RespondError(w, apiErr)
+		return
+	}
+	RespondJSON(w, http.StatusOK, result)
+}
+
+func (c *appPasswordController) Delete(w http.ResponseWriter, r *http.Request) {
+	appPasswordId := mux.Vars(r)["app_password_id"]
+	ok := IsValidUUID(appPasswordId)
+	if !ok {
+		logger.Logger.Infof("received invalid uuid=%s", appPasswordId)
+		apiErr := NewBadRequestApiError("invalid uuid")
+		RespondError(w, apiErr)
+		return
+	}
+
+	deletedId, err := services.AppPasswordService.Delete(auth.UserId(r.Context()), appPasswordId)
+	if err != nil {
+		errorMsg := "unable to delete app password"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusNotFound))
+		RespondError(w, apiErr)
+		return
+	}
+	response := models.ResponseDeleted{
+		Message:   "app password deleted",
+		DeletedId: deletedId,
+	}
+	RespondJSON(w, http.StatusAccepted, response)
+}
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"calendar_service/src/auth"
 	"calendar_service/src/logger"
 	"calendar_service/src/models"
 	"calendar_service/src/services"
@@ -8,6 +9,9 @@ import (
 	"github.com/gorilla/mux"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
 var (
@@ -21,6 +25,11 @@ type AppointmentControllerInterface interface {
 	Delete(w http.ResponseWriter, r *http.Request)
 	AddAttendees(w http.ResponseWriter, r *http.Request)
 	RemoveAttendees(w http.ResponseWriter, r *http.Request)
+	Occurrences(w http.ResponseWriter, r *http.Request)
+	UpdateOccurrence(w http.ResponseWriter, r *http.Request)
+	CancelOccurrence(w http.ResponseWriter, r *http.Request)
+	Search(w http.ResponseWriter, r *http.Request)
+	Rsvp(w http.ResponseWriter, r *http.Request)
 }
 
 type appointmentController struct{}
@@ -56,17 +65,18 @@ func (a *appointmentController) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	appt.CalendarId = calendarId
-	resultAppt, err := services.AppointmentService.Create(appt)
+	resultAppt, err := services.AppointmentService.Create(auth.UserId(r.Context()), appt)
 	if err != nil {
 		errorMsg := "unable to crate appointment"
 		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
-		apiErr := NewApiError(errorMsg, err.Error(), http.StatusConflict)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusConflict))
 		RespondError(w, apiErr)
 		return
 	}
 	response := models.ResponseCreated{
 		Message:   "appointment created",
 		CreatedId: resultAppt.ID,
+		Conflicts: resultAppt.Conflicts,
 	}
 	RespondJSON(w, http.StatusCreated, response)
 }
@@ -81,18 +91,30 @@ func (a *appointmentController) Read(w http.ResponseWriter, r *http.Request) {
 		RespondError(w, apiErr)
 		return
 	}
+	loc, err := ParseTimeZone(r)
+	if err != nil {
+		logger.Logger.Infow("invalid time zone", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
 
-	resAppt, err := services.AppointmentService.Read(apptId)
+	resAppt, err := services.AppointmentService.Read(auth.UserId(r.Context()), apptId)
 	if err != nil {
 		errorMsg := "unable to get appointment"
 		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
-		apiErr := NewApiError(errorMsg, err.Error(), http.StatusNotFound)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusNotFound))
 		RespondError(w, apiErr)
 		return
 	}
-	RespondJSON(w, http.StatusOK, resAppt)
+	if loc != nil {
+		resAppt.In(loc)
+	}
+	RespondVersioned(w, r, http.StatusOK, resAppt.Version, resAppt)
 }
 
+// Update changes the fields set in the body. An If-Match header, or else a version
+// in the body, makes the update fail with 412 unless the appointment is at that version
 func (a *appointmentController) Update(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	apptId := vars["appointment_id"]
@@ -103,6 +125,21 @@ func (a *appointmentController) Update(w http.ResponseWriter, r *http.Request) {
 		RespondError(w, apiErr)
 		return
 	}
+	loc, err := ParseTimeZone(r)
+	if err != nil {
+		logger.Logger.Infow("invalid time zone", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+
+	version, err := ParseIfMatch(r)
+	if err != nil {
+		logger.Logger.Infow("invalid If-Match header", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError("unable to update appointment", err.Error(), ErrorStatus(err, http.StatusBadRequest))
+		RespondError(w, apiErr)
+		return
+	}
 
 	requestBody, err := ioutil.ReadAll(r.Body)
 	if err != nil {
@@ -123,17 +160,25 @@ func (a *appointmentController) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	appt.ID = apptId
-	resAppt, err := services.AppointmentService.Update(appt)
+	if version != 0 {
+		appt.Version = version
+	}
+	resAppt, err := services.AppointmentService.Update(auth.UserId(r.Context()), appt)
 	if err != nil {
 		errorMsg := "unable to update appointment"
 		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
-		apiErr := NewApiError(errorMsg, err.Error(), http.StatusConflict)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusConflict))
 		RespondError(w, apiErr)
 		return
 	}
-	RespondJSON(w, http.StatusOK, resAppt)
+	if loc != nil {
+		resAppt.In(loc)
+	}
+	RespondVersioned(w, r, http.StatusOK, resAppt.Version, resAppt)
 }
 
+// Delete removes the appointment, an If-Match header makes it fail
+// with 412 unless the appointment is at the version of the etag
 func (a *appointmentController) Delete(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	apptId := vars["appointment_id"]
@@ -145,11 +190,19 @@ func (a *appointmentController) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	deletedId, err := services.AppointmentService.Delete(apptId)
+	version, err := ParseIfMatch(r)
+	if err != nil {
+		logger.Logger.Infow("invalid If-Match header", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError("unable to delete appointment", err.Error(), ErrorStatus(err, http.StatusBadRequest))
+		RespondError(w, apiErr)
+		return
+	}
+
+	deletedId, err := services.AppointmentService.Delete(auth.UserId(r.Context()), apptId, version)
 	if err != nil {
 		errorMsg := "unable to delete appointment"
 		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
-		apiErr := NewApiError(errorMsg, err.Error(), http.StatusNotFound)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusNotFound))
 		RespondError(w, apiErr)
 		return
 	}
@@ -160,6 +213,8 @@ func (a *appointmentController) Delete(w http.ResponseWriter, r *http.Request) {
 	RespondJSON(w, http.StatusAccepted, response)
 }
 
+// AddAttendees invites users by id and anyone else by email, an If-Match header
+// makes it fail with 412 unless the appointment is at the version of the etag
 func (a *appointmentController) AddAttendees(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	apptId := vars["appointment_id"]
@@ -170,6 +225,20 @@ func (a *appointmentController) AddAttendees(w http.ResponseWriter, r *http.Requ
 		RespondError(w, apiErr)
 		return
 	}
+	loc, err := ParseTimeZone(r)
+	if err != nil {
+		logger.Logger.Infow("invalid time zone", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+	version, err := ParseIfMatch(r)
+	if err != nil {
+		logger.Logger.Infow("invalid If-Match header", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError("unable to add attendees to appointment", err.Error(), ErrorStatus(err, http.StatusBadRequest))
+		RespondError(w, apiErr)
+		return
+	}
 	requestBody, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		errorMsg := "invalid request body"
@@ -180,8 +249,9 @@ func (a *appointmentController) AddAttendees(w http.ResponseWriter, r *http.Requ
 	}
 	defer r.Body.Close()
 
-	var attendees []string
-	err = json.Unmarshal(requestBody, &attendees)
+	// attendees are user ids or {"email": "...", "name": "..."} objects for people without an account
+	var items []json.RawMessage
+	err = json.Unmarshal(requestBody, &items)
 	if err != nil {
 		errorMsg := "invalid json body"
 		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
@@ -189,19 +259,58 @@ func (a *appointmentController) AddAttendees(w http.ResponseWriter, r *http.Requ
 		RespondError(w, apiErr)
 		return
 	}
+	attendees := make([]string, 0, len(items))
+	externals := make([]*models.ExternalAttendee, 0)
+	for _, item := range items {
+		var userId string
+		if err := json.Unmarshal(item, &userId); err == nil {
+			attendees = append(attendees, userId)
+			continue
+		}
+		external := &models.ExternalAttendee{}
+		if err := json.Unmarshal(item, external); err != nil {
+			errorMsg := "invalid json body"
+			logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+			apiErr := NewBadRequestApiError(errorMsg)
+			RespondError(w, apiErr)
+			return
+		}
+		if err := external.Validate(); err != nil {
+			logger.Logger.Infow("invalid attendee", "err", err.Error(), "path", r.URL.Path)
+			apiErr := NewBadRequestApiError(err.Error())
+			RespondError(w, apiErr)
+			return
+		}
+		externals = append(externals, external)
+	}
+	var role models.AttendeeRole
+	if value := r.URL.Query().Get("role"); value != "" {
+		role, err = models.ParseAttendeeRole(value)
+		if err != nil {
+			logger.Logger.Infow("invalid attendee role", "err", err.Error(), "path", r.URL.Path)
+			apiErr := NewBadRequestApiError(err.Error())
+			RespondError(w, apiErr)
+			return
+		}
+	}
 
-	appt := models.Appointment{Base: models.Base{ID: apptId}}
-	resultAppt, err := services.AppointmentService.AddAttendees(appt, attendees)
+	appt := models.Appointment{Base: models.Base{ID: apptId}, Version: version}
+	resultAppt, err := services.AppointmentService.AddAttendees(auth.UserId(r.Context()), appt, attendees, externals, role)
 	if err != nil {
 		errorMsg := "unable to add attendees to appointment"
 		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
-		apiErr := NewApiError(errorMsg, err.Error(), http.StatusNotFound)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusNotFound))
 		RespondError(w, apiErr)
 		return
 	}
+	if loc != nil {
+		resultAppt.In(loc)
+	}
 	RespondJSON(w, http.StatusOK, resultAppt)
 }
 
+// RemoveAttendees takes users off the appointment by id and external attendees by email, an If-Match
+// header makes it fail with 412 unless the appointment is at the version of the etag
 func (a *appointmentController) RemoveAttendees(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	apptId := vars["appointment_id"]
@@ -212,6 +321,20 @@ func (a *appointmentController) RemoveAttendees(w http.ResponseWriter, r *http.R
 		RespondError(w, apiErr)
 		return
 	}
+	loc, err := ParseTimeZone(r)
+	if err != nil {
+		logger.Logger.Infow("invalid time zone", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+	version, err := ParseIfMatch(r)
+	if err != nil {
+		logger.Logger.Infow("invalid If-Match header", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError("unable to remove attendees from appointment", err.Error(), ErrorStatus(err, http.StatusBadRequest))
+		RespondError(w, apiErr)
+		return
+	}
 	requestBody, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		errorMsg := "invalid request body"
@@ -232,14 +355,312 @@ func (a *appointmentController) RemoveAttendees(w http.ResponseWriter, r *http.R
 		return
 	}
 
-	appt := models.Appointment{Base: models.Base{ID: apptId}}
-	resultAppt, err := services.AppointmentService.RemoveAttendees(appt, attendees)
+	// external attendees are removed by email
+	userIds := make([]string, 0, len(attendees))
+	emails := make([]string, 0)
+	for _, attendee := range attendees {
+		if strings.Contains(attendee, "@") {
+			emails = append(emails, attendee)
+			continue
+		}
+		userIds = append(userIds, attendee)
+	}
+
+	appt := models.Appointment{Base: models.Base{ID: apptId}, Version: version}
+	resultAppt, err := services.AppointmentService.RemoveAttendees(auth.UserId(r.Context()), appt, userIds, emails)
 	if err != nil {
 		errorMsg := "unable to remove attendees from appointment"
 		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
-		apiErr := NewApiError(errorMsg, err.Error(), http.StatusNotFound)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusNotFound))
+		RespondError(w, apiErr)
+		return
+	}
+	if loc != nil {
+		resultAppt.In(loc)
+	}
+	RespondJSON(w, http.StatusOK, resultAppt)
+}
+
+func (a *appointmentController) Occurrences(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	apptId := vars["appointment_id"]
+	ok := IsValidUUID(apptId)
+	if !ok {
+		logger.Logger.Infof("received invalid uuid=%s", apptId)
+		apiErr := NewBadRequestApiError("invalid uuid")
+		RespondError(w, apiErr)
+		return
+	}
+	loc, err := ParseTimeZone(r)
+	if err != nil {
+		logger.Logger.Infow("invalid time zone", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+	from, to, err := ParseTimeRange(r)
+	if err != nil {
+		logger.Logger.Infow("invalid time range", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+
+	occurrences, err := services.AppointmentService.Occurrences(auth.UserId(r.Context()), apptId, from, to)
+	if err != nil {
+		errorMsg := "unable to get appointment occurrences"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusNotFound))
+		RespondError(w, apiErr)
+		return
+	}
+	if loc != nil {
+		for _, occ := range occurrences {
+			occ.In(loc)
+		}
+	}
+	RespondJSON(w, http.StatusOK, occurrences)
+}
+
+// UpdateOccurrence edits the occurrence originally starting at start, an If-Match header
+// makes it fail with 412 unless the series is at the version of the etag
+func (a *appointmentController) UpdateOccurrence(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	apptId := vars["appointment_id"]
+	ok := IsValidUUID(apptId)
+	if !ok {
+		logger.Logger.Infof("received invalid uuid=%s", apptId)
+		apiErr := NewBadRequestApiError("invalid uuid")
+		RespondError(w, apiErr)
+		return
+	}
+	loc, err := ParseTimeZone(r)
+	if err != nil {
+		logger.Logger.Infow("invalid time zone", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+	recurrenceId, err := time.Parse(time.RFC3339, vars["start"])
+	if err != nil {
+		logger.Logger.Infof("received invalid occurrence start=%s", vars["start"])
+		apiErr := NewBadRequestApiError("occurrence start should be a RFC 3339 timestamp")
+		RespondError(w, apiErr)
+		return
+	}
+	scope, err := models.ParseOccurrenceScope(r.URL.Query().Get("scope"))
+	if err != nil {
+		logger.Logger.Infow("invalid occurrence scope", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+	version, err := ParseIfMatch(r)
+	if err != nil {
+		logger.Logger.Infow("invalid If-Match header", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError("unable to update appointment occurrence", err.Error(), ErrorStatus(err, http.StatusBadRequest))
+		RespondError(w, apiErr)
+		return
+	}
+
+	requestBody, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		errorMsg := "invalid request body"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(errorMsg)
+		RespondError(w, apiErr)
+		return
+	}
+	defer r.Body.Close()
+	var changes models.OccurrenceChanges
+	err = json.Unmarshal(requestBody, &changes)
+	if err != nil {
+		errorMsg := "invalid json body"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(errorMsg)
+		RespondError(w, apiErr)
+		return
+	}
+
+	resAppt, err := services.AppointmentService.UpdateOccurrence(auth.UserId(r.Context()), apptId, recurrenceId, changes, scope, version)
+	if err != nil {
+		errorMsg := "unable to update appointment occurrence"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusConflict))
+		RespondError(w, apiErr)
+		return
+	}
+	if loc != nil {
+		resAppt.In(loc)
+	}
+	RespondJSON(w, http.StatusOK, resAppt)
+}
+
+// CancelOccurrence removes the occurrence originally starting at start, an If-Match header
+// makes it fail with 412 unless the series is at the version of the etag
+func (a *appointmentController) CancelOccurrence(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	apptId := vars["appointment_id"]
+	ok := IsValidUUID(apptId)
+	if !ok {
+		logger.Logger.Infof("received invalid uuid=%s", apptId)
+		apiErr := NewBadRequestApiError("invalid uuid")
+		RespondError(w, apiErr)
+		return
+	}
+	recurrenceId, err := time.Parse(time.RFC3339, vars["start"])
+	if err != nil {
+		logger.Logger.Infof("received invalid occurrence start=%s", vars["start"])
+		apiErr := NewBadRequestApiError("occurrence start should be a RFC 3339 timestamp")
+		RespondError(w, apiErr)
+		return
+	}
+	scope, err := models.ParseOccurrenceScope(r.URL.Query().Get("scope"))
+	if err != nil {
+		logger.Logger.Infow("invalid occurrence scope", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+	version, err := ParseIfMatch(r)
+	if err != nil {
+		logger.Logger.Infow("invalid If-Match header", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError("unable to cancel appointment occurrence", err.Error(), ErrorStatus(err, http.StatusBadRequest))
+		RespondError(w, apiErr)
+		return
+	}
+
+	deletedId, err := services.AppointmentService.CancelOccurrence(auth.UserId(r.Context()), apptId, recurrenceId, scope, version)
+	if err != nil {
+		errorMsg := "unable to cancel appointment occurrence"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusNotFound))
+		RespondError(w, apiErr)
+		return
+	}
+	response := models.ResponseDeleted{
+		Message:   "appointment occurrence cancelled",
+		DeletedId: deletedId,
+	}
+	RespondJSON(w, http.StatusAccepted, response)
+}
+
+// Search reads the search text from the q query parameter and its
+// scope from either the user_id or the calendar_id query parameter
+func (a *appointmentController) Search(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	query := models.SearchQuery{
+		Text:       params.Get("q"),
+		UserId:     params.Get("user_id"),
+		CalendarId: params.Get("calendar_id"),
+	}
+	for _, id := range []string{query.UserId, query.CalendarId} {
+		if id != "" && !IsValidUUID(id) {
+			logger.Logger.Infof("received invalid uuid=%s", id)
+			apiErr := NewBadRequestApiError("invalid uuid")
+			RespondError(w, apiErr)
+			return
+		}
+	}
+	if limit := params.Get("limit"); limit != "" {
+		var err error
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit <= 0 {
+			logger.Logger.Infof("received invalid limit=%s", limit)
+			apiErr := NewBadRequestApiError("limit should be a positive number")
+			RespondError(w, apiErr)
+			return
+		}
+	}
+	if err := query.Validate(); err != nil {
+		logger.Logger.Infow("invalid search query", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+	loc, err := ParseTimeZone(r)
+	if err != nil {
+		logger.Logger.Infow("invalid time zone", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+
+	results, err := services.AppointmentService.Search(auth.UserId(r.Context()), query)
+	if err != nil {
+		errorMsg := "unable to search appointments"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusNotFound))
+		RespondError(w, apiErr)
+		return
+	}
+	if loc != nil {
+		results.In(loc)
+	}
+	RespondJSON(w, http.StatusOK, results)
+}
+
+// Rsvp records the answer of the current user to the invitation to the appointment, an
+// If-Match header makes it fail with 412 unless the appointment is at the version of the etag
+func (a *appointmentController) Rsvp(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	apptId := vars["appointment_id"]
+	ok := IsValidUUID(apptId)
+	if !ok {
+		logger.Logger.Infof("received invalid uuid=%s", apptId)
+		apiErr := NewBadRequestApiError("invalid uuid")
+		RespondError(w, apiErr)
+		return
+	}
+	loc, err := ParseTimeZone(r)
+	if err != nil {
+		logger.Logger.Infow("invalid time zone", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+	version, err := ParseIfMatch(r)
+	if err != nil {
+		logger.Logger.Infow("invalid If-Match header", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError("unable to respond to appointment", err.Error(), ErrorStatus(err, http.StatusBadRequest))
+		RespondError(w, apiErr)
+		return
+	}
+	requestBody, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		errorMsg := "invalid request body"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(errorMsg)
+		RespondError(w, apiErr)
+		return
+	}
+	defer r.Body.Close()
+
+	var rsvp models.Rsvp
+	err = json.Unmarshal(requestBody, &rsvp)
+	if err != nil {
+		errorMsg := "invalid json body"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(errorMsg)
+		RespondError(w, apiErr)
+		return
+	}
+	if err := rsvp.Validate(); err != nil {
+		logger.Logger.Infow("invalid rsvp", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+
+	resultAppt, err := services.AppointmentService.Respond(auth.UserId(r.Context()), apptId, rsvp, version)
+	if err != nil {
+		errorMsg := "unable to respond to appointment"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusNotFound))
 		RespondError(w, apiErr)
 		return
 	}
+	if loc != nil {
+		resultAppt.In(loc)
+	}
 	RespondJSON(w, http.StatusOK, resultAppt)
 }
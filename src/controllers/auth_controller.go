@@ -0,0 +1,96 @@
+package controllers
+
+import (
+	"calendar_service/src/auth"
+	"calendar_service/src/config"
+	"calendar_service/src/logger"
+	"calendar_service/src/services"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+var (
+	AuthController AuthControllerInterface = &authController{}
+)
+
+type AuthControllerInterface interface {
+	Token(w http.ResponseWriter, r *http.Request)
+	QueryToken(w http.ResponseWriter, r *http.Request)
+}
+
+type authController struct{}
+
+type tokenRequest struct {
+	UserId string `json:"user_id"`
+}
+
+type tokenResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Token issues a token to any existing user without checking credentials,
+// it is only routed when dev tokens are enabled
+func (a *authController) Token(w http.ResponseWriter, r *http.Request) {
+	requestBody, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		errorMsg := "invalid request body"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(errorMsg)
+		RespondError(w, apiErr)
+		return
+	}
+	defer r.Body.Close()
+	var request tokenRequest
+	err = json.Unmarshal(requestBody, &request)
+	if err != nil {
+		errorMsg := "invalid json body"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(errorMsg)
+		RespondError(w, apiErr)
+		return
+	}
+	ok := IsValidUUID(request.UserId)
+	if !ok {
+		logger.Logger.Infof("received invalid uuid=%s", request.UserId)
+		apiErr := NewBadRequestApiError("invalid uuid")
+		RespondError(w, apiErr)
+		return
+	}
+
+	// the token is issued as if the user asked for it
+	usr, err := services.UserService.Read(request.UserId, request.UserId)
+	if err != nil {
+		errorMsg := "unable to get user"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), http.StatusNotFound)
+		RespondError(w, apiErr)
+		return
+	}
+	ttl := time.Duration(config.Config.Auth.DevTokenTTL) * time.Minute
+	token, expiresAt, err := auth.Tokens.Issue(usr.ID, ttl)
+	if err != nil {
+		errorMsg := "unable to issue token"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), http.StatusInternalServerError)
+		RespondError(w, apiErr)
+		return
+	}
+	RespondJSON(w, http.StatusOK, tokenResponse{Token: token, ExpiresAt: expiresAt})
+}
+
+// QueryToken issues the caller a short lived token, for the clients passing
+// it in the query of the event streams as they can not set headers
+func (a *authController) QueryToken(w http.ResponseWriter, r *http.Request) {
+	token, expiresAt, err := auth.Tokens.Issue(auth.UserId(r.Context()), auth.QueryTokenTTL)
+	if err != nil {
+		errorMsg := "unable to issue token"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), http.StatusInternalServerError)
+		RespondError(w, apiErr)
+		return
+	}
+	RespondJSON(w, http.StatusOK, tokenResponse{Token: token, ExpiresAt: expiresAt})
+}
@@ -1,15 +1,28 @@
 package controllers
 
 import (
+	"calendar_service/src/auth"
+	"calendar_service/src/ical"
 	"calendar_service/src/logger"
 	"calendar_service/src/models"
 	"calendar_service/src/services"
 	"encoding/json"
 	"github.com/gorilla/mux"
+	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"strings"
 )
 
+// maxImportSize limits the size of an uploaded .ics file
+const maxImportSize = 10 << 20
+
+// bodyTooLarge reports whether reading the body failed on the limit set by http.MaxBytesReader
+func bodyTooLarge(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "request body too large")
+}
+
 var (
 	CalendarController CalendarControllerInterface = &calendarController{}
 )
@@ -19,6 +32,13 @@ type CalendarControllerInterface interface {
 	Read(w http.ResponseWriter, r *http.Request)
 	Update(w http.ResponseWriter, r *http.Request)
 	Delete(w http.ResponseWriter, r *http.Request)
+	Export(w http.ResponseWriter, r *http.Request)
+	Import(w http.ResponseWriter, r *http.Request)
+	Appointments(w http.ResponseWriter, r *http.Request)
+	Sync(w http.ResponseWriter, r *http.Request)
+	List(w http.ResponseWriter, r *http.Request)
+	Share(w http.ResponseWriter, r *http.Request)
+	Unshare(w http.ResponseWriter, r *http.Request)
 }
 
 type calendarController struct{}
@@ -54,11 +74,11 @@ func (c *calendarController) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	calendar.UserId = userId
-	resultCalendar, err := services.CalendarService.Create(calendar)
+	resultCalendar, err := services.CalendarService.Create(auth.UserId(r.Context()), calendar)
 	if err != nil {
 		errorMsg := "unable to crate calendar"
 		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
-		apiErr := NewApiError(errorMsg, err.Error(), http.StatusConflict)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusConflict))
 		RespondError(w, apiErr)
 		return
 	}
@@ -79,18 +99,34 @@ func (c *calendarController) Read(w http.ResponseWriter, r *http.Request) {
 		RespondError(w, apiErr)
 		return
 	}
+	loc, err := ParseTimeZone(r)
+	if err != nil {
+		logger.Logger.Infow("invalid time zone", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+	if strings.Contains(r.Header.Get("Accept"), "text/calendar") {
+		c.Export(w, r)
+		return
+	}
 
-	resultCalendar, err := services.CalendarService.Read(calendarId)
+	resultCalendar, err := services.CalendarService.Read(auth.UserId(r.Context()), calendarId)
 	if err != nil {
 		errorMsg := "unable to get calendar"
 		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
-		apiErr := NewApiError(errorMsg, err.Error(), http.StatusNotFound)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusNotFound))
 		RespondError(w, apiErr)
 		return
 	}
-	RespondJSON(w, http.StatusOK, resultCalendar)
+	if loc != nil {
+		resultCalendar.In(loc)
+	}
+	RespondVersioned(w, r, http.StatusOK, resultCalendar.Version, resultCalendar)
 }
 
+// Update renames the calendar or hands it over. An If-Match header, or else a version
+// in the body, makes the update fail with 412 unless the calendar is at that version
 func (c *calendarController) Update(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	calendarId := vars["calendar_id"]
@@ -101,6 +137,21 @@ func (c *calendarController) Update(w http.ResponseWriter, r *http.Request) {
 		RespondError(w, apiErr)
 		return
 	}
+	loc, err := ParseTimeZone(r)
+	if err != nil {
+		logger.Logger.Infow("invalid time zone", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+
+	version, err := ParseIfMatch(r)
+	if err != nil {
+		logger.Logger.Infow("invalid If-Match header", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError("unable to update calendar", err.Error(), ErrorStatus(err, http.StatusBadRequest))
+		RespondError(w, apiErr)
+		return
+	}
 
 	requestBody, err := ioutil.ReadAll(r.Body)
 	if err != nil {
@@ -122,17 +173,25 @@ func (c *calendarController) Update(w http.ResponseWriter, r *http.Request) {
 	}
 
 	calendar.ID = calendarId
-	resultCalendar, err := services.CalendarService.Update(calendar)
+	if version != 0 {
+		calendar.Version = version
+	}
+	resultCalendar, err := services.CalendarService.Update(auth.UserId(r.Context()), calendar)
 	if err != nil {
 		errorMsg := "unable to update calendar"
 		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
-		apiErr := NewApiError(errorMsg, err.Error(), http.StatusNotFound)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusNotFound))
 		RespondError(w, apiErr)
 		return
 	}
-	RespondJSON(w, http.StatusOK, resultCalendar)
+	if loc != nil {
+		resultCalendar.In(loc)
+	}
+	RespondVersioned(w, r, http.StatusOK, resultCalendar.Version, resultCalendar)
 }
 
+// Delete removes the calendar, an If-Match header makes it fail
+// with 412 unless the calendar is at the version of the etag
 func (c *calendarController) Delete(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	calendarId := vars["calendar_id"]
@@ -144,11 +203,19 @@ func (c *calendarController) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	deletedId, err := services.CalendarService.Delete(calendarId)
+	version, err := ParseIfMatch(r)
+	if err != nil {
+		logger.Logger.Infow("invalid If-Match header", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError("unable to delete calendar", err.Error(), ErrorStatus(err, http.StatusBadRequest))
+		RespondError(w, apiErr)
+		return
+	}
+
+	deletedId, err := services.CalendarService.Delete(auth.UserId(r.Context()), calendarId, version)
 	if err != nil {
 		errorMsg := "unable to delete calendar"
 		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
-		apiErr := NewApiError(errorMsg, err.Error(), http.StatusNotFound)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusNotFound))
 		RespondError(w, apiErr)
 		return
 	}
@@ -158,3 +225,288 @@ func (c *calendarController) Delete(w http.ResponseWriter, r *http.Request) {
 	}
 	RespondJSON(w, http.StatusAccepted, response)
 }
+
+func (c *calendarController) Export(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	calendarId := vars["calendar_id"]
+	ok := IsValidUUID(calendarId)
+	if !ok {
+		logger.Logger.Infof("received invalid uuid=%s", calendarId)
+		apiErr := NewBadRequestApiError("invalid uuid")
+		RespondError(w, apiErr)
+		return
+	}
+
+	cal, err := services.CalendarService.Export(auth.UserId(r.Context()), calendarId)
+	if err != nil {
+		errorMsg := "unable to export calendar"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusNotFound))
+		RespondError(w, apiErr)
+		return
+	}
+	RespondICalendar(w, http.StatusOK, cal)
+}
+
+// Import accepts the .ics data either as the raw request body
+// or as the "file" field of a multipart form
+func (c *calendarController) Import(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	calendarId := vars["calendar_id"]
+	ok := IsValidUUID(calendarId)
+	if !ok {
+		logger.Logger.Infof("received invalid uuid=%s", calendarId)
+		apiErr := NewBadRequestApiError("invalid uuid")
+		RespondError(w, apiErr)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+	defer r.Body.Close()
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if bodyTooLarge(err) {
+			errorMsg := "calendar file too large"
+			logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+			apiErr := NewApiError(errorMsg, err.Error(), http.StatusRequestEntityTooLarge)
+			RespondError(w, apiErr)
+			return
+		}
+		if err != nil {
+			errorMsg := "invalid multipart body"
+			logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+			apiErr := NewBadRequestApiError(errorMsg)
+			RespondError(w, apiErr)
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+	data, err := ical.Decode(body)
+	if bodyTooLarge(err) {
+		errorMsg := "calendar file too large"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), http.StatusRequestEntityTooLarge)
+		RespondError(w, apiErr)
+		return
+	}
+	if err != nil {
+		errorMsg := "invalid icalendar body"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(errorMsg)
+		RespondError(w, apiErr)
+		return
+	}
+
+	report, err := services.CalendarService.Import(auth.UserId(r.Context()), calendarId, data)
+	if err != nil {
+		errorMsg := "unable to import calendar"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusNotFound))
+		RespondError(w, apiErr)
+		return
+	}
+	RespondJSON(w, http.StatusOK, report)
+}
+
+func (c *calendarController) Appointments(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	calendarId := vars["calendar_id"]
+	ok := IsValidUUID(calendarId)
+	if !ok {
+		logger.Logger.Infof("received invalid uuid=%s", calendarId)
+		apiErr := NewBadRequestApiError("invalid uuid")
+		RespondError(w, apiErr)
+		return
+	}
+	from, to, err := ParseTimeRange(r)
+	if err != nil {
+		logger.Logger.Infow("invalid time range", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+	page, err := ParsePageRequest(r)
+	if err != nil {
+		logger.Logger.Infow("invalid page request", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+	loc, err := ParseTimeZone(r)
+	if err != nil {
+		logger.Logger.Infow("invalid time zone", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+
+	result, err := services.CalendarService.Appointments(auth.UserId(r.Context()), calendarId, from, to, page)
+	if err != nil {
+		errorMsg := "unable to list calendar appointments"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusNotFound))
+		RespondError(w, apiErr)
+		return
+	}
+	if loc != nil {
+		result.In(loc)
+	}
+	RespondJSON(w, http.StatusOK, result)
+}
+
+// Sync reads the sync_token and limit query parameters, a request without
+// sync_token returns the first page of the whole calendar
+func (c *calendarController) Sync(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	calendarId := vars["calendar_id"]
+	ok := IsValidUUID(calendarId)
+	if !ok {
+		logger.Logger.Infof("received invalid uuid=%s", calendarId)
+		apiErr := NewBadRequestApiError("invalid uuid")
+		RespondError(w, apiErr)
+		return
+	}
+	params := r.URL.Query()
+	sync := models.CalendarSync{CalendarId: calendarId, Token: params.Get("sync_token")}
+	if limit := params.Get("limit"); limit != "" {
+		var err error
+		if sync.Limit, err = strconv.Atoi(limit); err != nil || sync.Limit <= 0 {
+			logger.Logger.Infof("received invalid limit=%s", limit)
+			apiErr := NewBadRequestApiError("limit should be a positive number")
+			RespondError(w, apiErr)
+			return
+		}
+	}
+	if err := sync.Validate(); err != nil {
+		logger.Logger.Infow("invalid calendar sync", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+
+	result, err := services.CalendarService.Sync(auth.UserId(r.Context()), sync)
+	if err != nil {
+		errorMsg := "unable to sync calendar"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusNotFound))
+		RespondError(w, apiErr)
+		return
+	}
+	RespondJSON(w, http.StatusOK, result)
+}
+
+// List reads the optional name filter and the page query parameters
+func (c *calendarController) List(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userId := vars["user_id"]
+	ok := IsValidUUID(userId)
+	if !ok {
+		logger.Logger.Infof("received invalid uuid=%s", userId)
+		apiErr := NewBadRequestApiError("invalid uuid")
+		RespondError(w, apiErr)
+		return
+	}
+	page, err := ParsePageRequest(r)
+	if err != nil {
+		logger.Logger.Infow("invalid page request", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+	filter := services.CalendarFilter{Name: r.URL.Query().Get("name")}
+
+	result, err := services.CalendarService.List(auth.UserId(r.Context()), userId, filter, page)
+	if err != nil {
+		errorMsg := "unable to list calendars"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusNotFound))
+		RespondError(w, apiErr)
+		return
+	}
+	RespondJSON(w, http.StatusOK, result)
+}
+
+func (c *calendarController) Share(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	calendarId := vars["calendar_id"]
+	ok := IsValidUUID(calendarId)
+	if !ok {
+		logger.Logger.Infof("received invalid uuid=%s", calendarId)
+		apiErr := NewBadRequestApiError("invalid uuid")
+		RespondError(w, apiErr)
+		return
+	}
+
+	requestBody, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		errorMsg := "invalid request body"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(errorMsg)
+		RespondError(w, apiErr)
+		return
+	}
+	defer r.Body.Close()
+	var share models.CalendarShare
+	err = json.Unmarshal(requestBody, &share)
+	if err != nil {
+		errorMsg := "invalid json body"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(errorMsg)
+		RespondError(w, apiErr)
+		return
+	}
+	if !IsValidUUID(share.UserId) {
+		logger.Logger.Infof("received invalid uuid=%s", share.UserId)
+		apiErr := NewBadRequestApiError("invalid uuid")
+		RespondError(w, apiErr)
+		return
+	}
+	share.CalendarId = calendarId
+	if err := share.Validate(); err != nil {
+		logger.Logger.Infow("invalid calendar share", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+
+	result, err := services.CalendarService.Share(auth.UserId(r.Context()), share)
+	if err != nil {
+		errorMsg := "unable to share calendar"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusNotFound))
+		RespondError(w, apiErr)
+		return
+	}
+	RespondJSON(w, http.StatusOK, result)
+}
+
+// Unshare takes the user the calendar is no longer shared with from the user_id query parameter
+func (c *calendarController) Unshare(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	calendarId := vars["calendar_id"]
+	userId := r.URL.Query().Get("user_id")
+	for _, id := range []string{calendarId, userId} {
+		if !IsValidUUID(id) {
+			logger.Logger.Infof("received invalid uuid=%s", id)
+			apiErr := NewBadRequestApiError("invalid uuid")
+			RespondError(w, apiErr)
+			return
+		}
+	}
+
+	err := services.CalendarService.Unshare(auth.UserId(r.Context()), calendarId, userId)
+	if err != nil {
+		errorMsg := "unable to unshare calendar"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusNotFound))
+		RespondError(w, apiErr)
+		return
+	}
+	response := models.ResponseDeleted{
+		Message:   "calendar share deleted",
+		DeletedId: userId,
+	}
+	RespondJSON(w, http.StatusAccepted, response)
+}
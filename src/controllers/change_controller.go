@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"calendar_service/src/auth"
+	"calendar_service/src/logger"
+	"calendar_service/src/models"
+	"calendar_service/src/services"
+	"net/http"
+	"strconv"
+)
+
+var (
+	ChangeController ChangeControllerInterface = &changeController{}
+)
+
+type ChangeControllerInterface interface {
+	List(w http.ResponseWriter, r *http.Request)
+}
+
+type changeController struct{}
+
+// List returns the changes made after the since query parameter, the
+// next_cursor of the response is the since of the following request
+func (c *changeController) List(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	feed := models.ChangeFeed{UserId: auth.UserId(r.Context()), Since: params.Get("since")}
+	if limit := params.Get("limit"); limit != "" {
+		var err error
+		if feed.Limit, err = strconv.Atoi(limit); err != nil || feed.Limit <= 0 {
+			logger.Logger.Infof("received invalid limit=%s", limit)
+			apiErr := NewBadRequestApiError("limit should be a positive number")
+			RespondError(w, apiErr)
+			return
+		}
+	}
+	if err := feed.Validate(); err != nil {
+		logger.Logger.Infow("invalid change feed", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+
+	result, err := services.ChangeService.Feed(auth.UserId(r.Context()), feed)
+	if err != nil {
+		errorMsg := "unable to get changes"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusInternalServerError))
+		RespondError(w, apiErr)
+		return
+	}
+	RespondJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"calendar_service/src/auth"
+	"calendar_service/src/logger"
+	"calendar_service/src/models"
+	"calendar_service/src/services"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+)
+
+var (
+	FreeBusyController FreeBusyControllerInterface = &freeBusyController{}
+)
+
+type FreeBusyControllerInterface interface {
+	Query(w http.ResponseWriter, r *http.Request)
+	Slots(w http.ResponseWriter, r *http.Request)
+}
+
+type freeBusyController struct{}
+
+func (f *freeBusyController) Query(w http.ResponseWriter, r *http.Request) {
+	loc, err := ParseTimeZone(r)
+	if err != nil {
+		logger.Logger.Infow("invalid time zone", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+	requestBody, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		errorMsg := "invalid request body"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(errorMsg)
+		RespondError(w, apiErr)
+		return
+	}
+	defer r.Body.Close()
+	var query models.FreeBusyQuery
+	err = json.Unmarshal(requestBody, &query)
+	if err != nil {
+		errorMsg := "invalid json body"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(errorMsg)
+		RespondError(w, apiErr)
+		return
+	}
+	for _, userId := range query.UserIds {
+		if !IsValidUUID(userId) {
+			logger.Logger.Infof("received invalid uuid=%s", userId)
+			apiErr := NewBadRequestApiError("invalid uuid")
+			RespondError(w, apiErr)
+			return
+		}
+	}
+	if err := query.Validate(); err != nil {
+		logger.Logger.Infow("invalid free/busy query", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+
+	freeBusy, err := services.FreeBusyService.Query(auth.UserId(r.Context()), query)
+	if err != nil {
+		errorMsg := "unable to get free/busy"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), http.StatusNotFound)
+		RespondError(w, apiErr)
+		return
+	}
+	if loc != nil {
+		freeBusy.In(loc)
+	}
+	RespondJSON(w, http.StatusOK, freeBusy)
+}
+
+func (f *freeBusyController) Slots(w http.ResponseWriter, r *http.Request) {
+	loc, err := ParseTimeZone(r)
+	if err != nil {
+		logger.Logger.Infow("invalid time zone", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+	requestBody, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		errorMsg := "invalid request body"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(errorMsg)
+		RespondError(w, apiErr)
+		return
+	}
+	defer r.Body.Close()
+	var query models.SlotQuery
+	err = json.Unmarshal(requestBody, &query)
+	if err != nil {
+		errorMsg := "invalid json body"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(errorMsg)
+		RespondError(w, apiErr)
+		return
+	}
+	for _, userId := range query.UserIds {
+		if !IsValidUUID(userId) {
+			logger.Logger.Infof("received invalid uuid=%s", userId)
+			apiErr := NewBadRequestApiError("invalid uuid")
+			RespondError(w, apiErr)
+			return
+		}
+	}
+	if err := query.Validate(); err != nil {
+		logger.Logger.Infow("invalid slot query", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+
+	slots, err := services.FreeBusyService.Slots(auth.UserId(r.Context()), query)
+	if err != nil {
+		errorMsg := "unable to find slots"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), http.StatusNotFound)
+		RespondError(w, apiErr)
+		return
+	}
+	if loc != nil {
+		slots.In(loc)
+	}
+	RespondJSON(w, http.StatusOK, slots)
+}
@@ -1,8 +1,13 @@
 package controllers
 
 import (
+	"calendar_service/src/ical"
+	"calendar_service/src/logger"
 	"encoding/json"
+	"fmt"
+	"hash/fnv"
 	"net/http"
+	"strings"
 )
 
 func RespondJSON(w http.ResponseWriter, statusCode int, data interface{}) {
@@ -11,8 +16,59 @@ func RespondJSON(w http.ResponseWriter, statusCode int, data interface{}) {
 	json.NewEncoder(w).Encode(data)
 }
 
+// ETag is the etag of an entity at the version given. The version guards updates
+// and deletions, the hash of the response covers the entities embedded in it
+// and the time zone it is rendered in
+func ETag(version int64, data []byte) string {
+	hash := fnv.New64a()
+	hash.Write(data)
+	return fmt.Sprintf(`"%d-%x"`, version, hash.Sum64())
+}
+
+// RespondVersioned responds with the entity at the version given and its etag.
+// Reads whose If-None-Match header holds the etag are answered with 304 Not Modified
+func RespondVersioned(w http.ResponseWriter, r *http.Request, statusCode int, version int64, data interface{}) {
+	body, err := json.Marshal(data)
+	if err != nil {
+		logger.Logger.Errorw("unable to marshal response", "err", err.Error(), "path", r.URL.Path)
+		RespondError(w, NewApiError("unable to respond", err.Error(), http.StatusInternalServerError))
+		return
+	}
+	etag := ETag(version, body)
+	w.Header().Set("ETag", etag)
+	if (r.Method == http.MethodGet || r.Method == http.MethodHead) && noneMatch(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(append(body, '\n'))
+}
+
+// noneMatch tells whether the If-None-Match header of the request matches the etag, weakly
+func noneMatch(r *http.Request, etag string) bool {
+	header := strings.TrimSpace(r.Header.Get("If-None-Match"))
+	if header == "*" {
+		return true
+	}
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
 func RespondError(w http.ResponseWriter, err ApiErrorInterface) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(err.GetStatusCode())
 	json.NewEncoder(w).Encode(err)
 }
+
+func RespondICalendar(w http.ResponseWriter, statusCode int, cal *ical.Calendar) {
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.WriteHeader(statusCode)
+	if err := cal.Encode(w); err != nil {
+		logger.Logger.Infow("unable to write icalendar response", "err", err.Error())
+	}
+}
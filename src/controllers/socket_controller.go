@@ -0,0 +1,321 @@
+package controllers
+
+import (
+	"calendar_service/src/auth"
+	"calendar_service/src/live"
+	"calendar_service/src/logger"
+	"calendar_service/src/models"
+	"calendar_service/src/services"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// MaxSocketTopics is the number of topics a connection can subscribe to
+	MaxSocketTopics = 100
+	// socketQueueSize is the number of messages queued for a client before it is considered too slow
+	socketQueueSize = 256
+	// socketMaxMessageSize limits the size of the requests of clients
+	socketMaxMessageSize = 4096
+	// socketWriteWait is the time a message has to be written to the client in
+	socketWriteWait = 10 * time.Second
+	// socketPongWait is how long a connection stays open without hearing from
+	// the client, which is pinged every heartbeatInterval
+	socketPongWait = 4 * heartbeatInterval
+)
+
+// types of the requests of clients
+const (
+	socketSubscribe   = "subscribe"
+	socketUnsubscribe = "unsubscribe"
+	socketPing        = "ping"
+)
+
+// types of the messages sent to clients
+const (
+	socketSubscribed   = "subscribed"
+	socketUnsubscribed = "unsubscribed"
+	socketChange       = "change"
+	socketPong         = "pong"
+	socketError        = "error"
+)
+
+// topics clients subscribe to, followed by a colon and the id of the calendar or of the user
+const (
+	calendarTopic = "calendar"
+	agendaTopic   = "agenda"
+)
+
+// SocketProtocol is the subprotocol echoed to the clients offering it. Browsers, which can not
+// set headers on websockets, offer it together with their token prefixed with SocketTokenProtocol
+const (
+	SocketProtocol      = "calendar.events"
+	SocketTokenProtocol = "access_token."
+)
+
+var (
+	SocketController SocketControllerInterface = &socketController{}
+
+	upgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024, Subprotocols: []string{SocketProtocol}}
+)
+
+type SocketControllerInterface interface {
+	Connect(w http.ResponseWriter, r *http.Request)
+}
+
+type socketController struct{}
+
+// socketRequest is a message of the client. Id is echoed in the reply,
+// Since resumes a topic after the change with that cursor
+type socketRequest struct {
+	Type  string `json:"type"`
+	Id    string `json:"id,omitempty"`
+	Topic string `json:"topic,omitempty"`
+	Since string `json:"since,omitempty"`
+}
+
+// socketMessage is a message sent to the client, either the reply to a request or a change of a topic
+type socketMessage struct {
+	Type   string         `json:"type"`
+	Id     string         `json:"id,omitempty"`
+	Topic  string         `json:"topic,omitempty"`
+	Change *models.Change `json:"change,omitempty"`
+	Status int            `json:"status,omitempty"`
+	Error  string         `json:"error,omitempty"`
+}
+
+// Connect upgrades the request to a websocket, the client then subscribes to
+// and unsubscribes from the changes of calendars and agendas with json requests
+func (c *socketController) Connect(w http.ResponseWriter, r *http.Request) {
+	if live.Changes == nil {
+		apiErr := NewApiError("unable to stream events", "streaming is not supported", http.StatusServiceUnavailable)
+		RespondError(w, apiErr)
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has responded already
+		logger.Logger.Infow("unable to upgrade connection", "err", err.Error(), "path", r.URL.Path)
+		return
+	}
+	session := &socketSession{
+		conn:     conn,
+		callerId: auth.UserId(r.Context()),
+		queue:    make(chan *socketMessage, socketQueueSize),
+		done:     make(chan struct{}),
+		topics:   make(map[string]*socketTopic),
+	}
+	session.wg.Add(1)
+	go session.write()
+	session.read()
+	session.end(websocket.CloseNormalClosure, "")
+	session.wg.Wait()
+	for topic := range session.topics {
+		session.unsubscribe(topic)
+	}
+}
+
+// socketSession is a websocket connection. Requests are handled one after the
+// other by read, which owns the topics, and messages are written by write
+type socketSession struct {
+	conn     *websocket.Conn
+	callerId string
+	queue    chan *socketMessage
+	topics   map[string]*socketTopic
+	wg       sync.WaitGroup
+
+	done      chan struct{}
+	endOnce   sync.Once
+	closeCode int
+	closeText string
+}
+
+// socketTopic is a subscription of the session, stop is closed on unsubscribe
+type socketTopic struct {
+	subscription *live.Subscription
+	stop         chan struct{}
+}
+
+// end makes write close the connection with the code given, the first call only counts
+func (s *socketSession) end(code int, text string) {
+	s.endOnce.Do(func() {
+		s.closeCode, s.closeText = code, text
+		close(s.done)
+	})
+}
+
+// send queues the message, waiting for room in the queue
+func (s *socketSession) send(msg *socketMessage) {
+	select {
+	case s.queue <- msg:
+	case <-s.done:
+	}
+}
+
+// push queues the message and ends the session of a client which does not keep up.
+// The client resubscribes with the cursor of the last change it got
+func (s *socketSession) push(msg *socketMessage) {
+	select {
+	case s.queue <- msg:
+	case <-s.done:
+	default:
+		logger.Logger.Infow("closing slow websocket", "user_id", s.callerId)
+		s.end(websocket.CloseTryAgainLater, "too slow, resubscribe with since")
+	}
+}
+
+func (s *socketSession) write() {
+	defer s.wg.Done()
+	defer s.conn.Close()
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-s.done:
+			closing := websocket.FormatCloseMessage(s.closeCode, s.closeText)
+			_ = s.conn.WriteControl(websocket.CloseMessage, closing, time.Now().Add(socketWriteWait))
+			return
+		case <-heartbeat.C:
+			if err := s.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(socketWriteWait)); err != nil {
+				s.end(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case msg := <-s.queue:
+			_ = s.conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+			if err := s.conn.WriteJSON(msg); err != nil {
+				s.end(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		}
+	}
+}
+
+func (s *socketSession) read() {
+	s.conn.SetReadLimit(socketMaxMessageSize)
+	_ = s.conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	s.conn.SetPongHandler(func(string) error {
+		return s.conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	})
+	for {
+		_, data, err := s.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				logger.Logger.Infow("websocket closed", "user_id", s.callerId, "err", err.Error())
+			}
+			return
+		}
+		_ = s.conn.SetReadDeadline(time.Now().Add(socketPongWait))
+
+		var req socketRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			s.send(&socketMessage{Type: socketError, Status: http.StatusBadRequest, Error: "invalid json body"})
+			continue
+		}
+		switch req.Type {
+		case socketSubscribe:
+			s.subscribe(&req)
+		case socketUnsubscribe:
+			if _, ok := s.topics[req.Topic]; !ok {
+				s.reject(&req, http.StatusNotFound, fmt.Sprintf("not subscribed to %s", req.Topic))
+				continue
+			}
+			s.unsubscribe(req.Topic)
+			s.send(&socketMessage{Type: socketUnsubscribed, Id: req.Id, Topic: req.Topic})
+		case socketPing:
+			s.send(&socketMessage{Type: socketPong, Id: req.Id})
+		default:
+			s.reject(&req, http.StatusBadRequest, fmt.Sprintf("unknown request type %s", req.Type))
+		}
+	}
+}
+
+func (s *socketSession) reject(req *socketRequest, status int, msg string) {
+	s.send(&socketMessage{Type: socketError, Id: req.Id, Topic: req.Topic, Status: status, Error: msg})
+}
+
+// subscribe sends the changes missed since req.Since, when set, then the changes of the topic as they are made
+func (s *socketSession) subscribe(req *socketRequest) {
+	if _, ok := s.topics[req.Topic]; ok {
+		s.reject(req, http.StatusConflict, fmt.Sprintf("already subscribed to %s", req.Topic))
+		return
+	}
+	if len(s.topics) >= MaxSocketTopics {
+		s.reject(req, http.StatusBadRequest, fmt.Sprintf("no more than %d topics can be subscribed to", MaxSocketTopics))
+		return
+	}
+	kind, id := parseTopic(req.Topic)
+	if !IsValidUUID(id) {
+		s.reject(req, http.StatusBadRequest, fmt.Sprintf("topic should be either %s:<calendar_id> or %s:<user_id>", calendarTopic, agendaTopic))
+		return
+	}
+	feed := models.ChangeFeed{UserId: s.callerId, Since: req.Since}
+	if err := feed.Validate(); err != nil {
+		s.reject(req, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var subscription *live.Subscription
+	var missed []*models.Change
+	var err error
+	if kind == calendarTopic {
+		subscription, missed, err = services.StreamService.Calendar(s.callerId, id, req.Since)
+	} else {
+		subscription, missed, err = services.StreamService.Agenda(s.callerId, id, req.Since)
+	}
+	if err != nil {
+		logger.Logger.Infow("unable to subscribe", "err", err.Error(), "topic", req.Topic)
+		s.reject(req, ErrorStatus(err, http.StatusNotFound), err.Error())
+		return
+	}
+	topic := &socketTopic{subscription: subscription, stop: make(chan struct{})}
+	s.topics[req.Topic] = topic
+
+	s.send(&socketMessage{Type: socketSubscribed, Id: req.Id, Topic: req.Topic})
+	var lastId int64
+	for _, change := range missed {
+		s.send(&socketMessage{Type: socketChange, Topic: req.Topic, Change: change})
+		lastId = change.ID
+	}
+	go func() {
+		for change := range subscription.Changes {
+			// changes replayed on subscription may be published as well
+			if change.ID <= lastId {
+				continue
+			}
+			s.push(&socketMessage{Type: socketChange, Topic: req.Topic, Change: change})
+		}
+		select {
+		case <-topic.stop:
+		default:
+			if errors.Is(subscription.Err(), live.EndedError) {
+				// the access to the topic may have changed, it is checked once more on resubscription
+				s.end(websocket.CloseTryAgainLater, "access changed, resubscribe with since")
+				return
+			}
+			// the broker dropped the subscription, changes were missed
+			s.end(websocket.CloseTryAgainLater, "too slow, resubscribe with since")
+		}
+	}()
+}
+
+func (s *socketSession) unsubscribe(topic string) {
+	t := s.topics[topic]
+	delete(s.topics, topic)
+	close(t.stop)
+	t.subscription.Close()
+}
+
+// parseTopic splits the topic into its kind and id, the kind is empty for unknown topics
+func parseTopic(topic string) (string, string) {
+	parts := strings.SplitN(topic, ":", 2)
+	if len(parts) != 2 || (parts[0] != calendarTopic && parts[0] != agendaTopic) {
+		return "", ""
+	}
+	return parts[0], parts[1]
+}
@@ -0,0 +1,118 @@
+package controllers
+
+import (
+	"calendar_service/src/auth"
+	"calendar_service/src/live"
+	"calendar_service/src/logger"
+	"calendar_service/src/models"
+	"calendar_service/src/services"
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"net/http"
+	"time"
+)
+
+// heartbeatInterval keeps proxies from closing idle streams
+const heartbeatInterval = 15 * time.Second
+
+var (
+	StreamController StreamControllerInterface = &streamController{}
+)
+
+type StreamControllerInterface interface {
+	Calendar(w http.ResponseWriter, r *http.Request)
+}
+
+type streamController struct{}
+
+// Calendar streams the changes of the calendar and of its appointments as
+// server-sent events. Reconnecting clients send the id of the last event they
+// got in the Last-Event-ID header and receive the events they missed first
+func (c *streamController) Calendar(w http.ResponseWriter, r *http.Request) {
+	calendarId := mux.Vars(r)["calendar_id"]
+	ok := IsValidUUID(calendarId)
+	if !ok {
+		logger.Logger.Infof("received invalid uuid=%s", calendarId)
+		apiErr := NewBadRequestApiError("invalid uuid")
+		RespondError(w, apiErr)
+		return
+	}
+	lastEventId := r.Header.Get("Last-Event-ID")
+	feed := models.ChangeFeed{CalendarId: calendarId, Since: lastEventId}
+	if err := feed.Validate(); err != nil {
+		logger.Logger.Infow("invalid last event id", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok || live.Changes == nil {
+		apiErr := NewApiError("unable to stream events", "streaming is not supported", http.StatusServiceUnavailable)
+		RespondError(w, apiErr)
+		return
+	}
+
+	subscription, missed, err := services.StreamService.Calendar(auth.UserId(r.Context()), calendarId, lastEventId)
+	if err != nil {
+		errorMsg := "unable to stream events"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusNotFound))
+		RespondError(w, apiErr)
+		return
+	}
+	defer subscription.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var lastId int64
+	for _, change := range missed {
+		if err := writeEvent(w, change); err != nil {
+			return
+		}
+		lastId = change.ID
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case change, ok := <-subscription.Changes:
+			if !ok {
+				// the client did not keep up or its access may have changed,
+				// it resumes from the last event once it reconnects
+				return
+			}
+			// changes replayed on connection may be published as well
+			if change.ID <= lastId {
+				continue
+			}
+			if err := writeEvent(w, change); err != nil {
+				return
+			}
+			lastId = change.ID
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, change *models.Change) error {
+	data, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", change.Cursor, change.Event, data)
+	return err
+}
@@ -1,6 +1,7 @@
 package controllers
 
 import (
+	"calendar_service/src/auth"
 	"calendar_service/src/logger"
 	"calendar_service/src/models"
 	"calendar_service/src/services"
@@ -19,6 +20,8 @@ type UserControllerInterface interface {
 	Read(w http.ResponseWriter, r *http.Request)
 	Update(w http.ResponseWriter, r *http.Request)
 	Delete(w http.ResponseWriter, r *http.Request)
+	Agenda(w http.ResponseWriter, r *http.Request)
+	List(w http.ResponseWriter, r *http.Request)
 }
 
 type userController struct{}
@@ -42,11 +45,11 @@ func (u *userController) Create(w http.ResponseWriter, r *http.Request) {
 		RespondError(w, apiErr)
 		return
 	}
-	resultUsr, err := services.UserService.Create(usr)
+	resultUsr, err := services.UserService.Create(auth.UserId(r.Context()), usr)
 	if err != nil {
 		errorMsg := "unable to crate user"
 		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
-		apiErr := NewApiError(errorMsg, err.Error(), http.StatusConflict)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusConflict))
 		RespondError(w, apiErr)
 		return
 	}
@@ -67,18 +70,31 @@ func (u *userController) Read(w http.ResponseWriter, r *http.Request) {
 		RespondError(w, apiErr)
 		return
 	}
-	response, err := services.UserService.Read(userId)
+	loc, err := ParseTimeZone(r)
+	if err != nil {
+		logger.Logger.Infow("invalid time zone", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+	response, err := services.UserService.Read(auth.UserId(r.Context()), userId)
 	if err != nil {
 		errorMsg := "unable to get user"
 		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
-		apiErr := NewApiError(errorMsg, err.Error(), http.StatusNotFound)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusNotFound))
 		RespondError(w, apiErr)
 		return
 	}
 
-	RespondJSON(w, http.StatusOK, response)
+	if loc == nil {
+		loc = response.Location()
+	}
+	response.In(loc)
+	RespondVersioned(w, r, http.StatusOK, response.Version, response)
 }
 
+// Update changes the fields set in the body. An If-Match header, or else a version
+// in the body, makes the update fail with 412 unless the user is at that version
 func (u *userController) Update(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userId := vars["id"]
@@ -89,6 +105,21 @@ func (u *userController) Update(w http.ResponseWriter, r *http.Request) {
 		RespondError(w, apiErr)
 		return
 	}
+	loc, err := ParseTimeZone(r)
+	if err != nil {
+		logger.Logger.Infow("invalid time zone", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+	version, err := ParseIfMatch(r)
+	if err != nil {
+		logger.Logger.Infow("invalid If-Match header", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError("unable to update user", err.Error(), ErrorStatus(err, http.StatusBadRequest))
+		RespondError(w, apiErr)
+		return
+	}
+
 	requestBody, err := ioutil.ReadAll(r.Body)
 	if err != nil {
 		errorMsg := "invalid request body"
@@ -108,17 +139,25 @@ func (u *userController) Update(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	usr.ID = userId
-	result, err := services.UserService.Update(usr)
+	if version != 0 {
+		usr.Version = version
+	}
+	result, err := services.UserService.Update(auth.UserId(r.Context()), usr)
 	if err != nil {
 		errorMsg := "unable to update user"
 		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
-		apiErr := NewApiError(errorMsg, err.Error(), http.StatusConflict)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusConflict))
 		RespondError(w, apiErr)
 		return
 	}
-	RespondJSON(w, http.StatusOK, result)
+	if loc != nil {
+		result.In(loc)
+	}
+	RespondVersioned(w, r, http.StatusOK, result.Version, result)
 }
 
+// Delete removes the user, an If-Match header makes it fail
+// with 412 unless the user is at the version of the etag
 func (u *userController) Delete(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	userId := vars["id"]
@@ -130,11 +169,19 @@ func (u *userController) Delete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	deletedId, err := services.UserService.Delete(userId)
+	version, err := ParseIfMatch(r)
+	if err != nil {
+		logger.Logger.Infow("invalid If-Match header", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError("unable to delete user", err.Error(), ErrorStatus(err, http.StatusBadRequest))
+		RespondError(w, apiErr)
+		return
+	}
+
+	deletedId, err := services.UserService.Delete(auth.UserId(r.Context()), userId, version)
 	if err != nil {
 		errorMsg := "unable to delete user"
 		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
-		apiErr := NewApiError(errorMsg, err.Error(), http.StatusNotFound)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusNotFound))
 		RespondError(w, apiErr)
 		return
 	}
@@ -144,3 +191,66 @@ func (u *userController) Delete(w http.ResponseWriter, r *http.Request) {
 	}
 	RespondJSON(w, http.StatusAccepted, response)
 }
+
+func (u *userController) Agenda(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	userId := vars["id"]
+	ok := IsValidUUID(userId)
+	if !ok {
+		logger.Logger.Infof("received invalid uuid=%s", userId)
+		apiErr := NewBadRequestApiError("invalid uuid")
+		RespondError(w, apiErr)
+		return
+	}
+	from, to, err := ParseTimeRange(r)
+	if err != nil {
+		logger.Logger.Infow("invalid time range", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+	loc, err := ParseTimeZone(r)
+	if err != nil {
+		logger.Logger.Infow("invalid time zone", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+
+	agenda, err := services.UserService.Agenda(auth.UserId(r.Context()), userId, from, to)
+	if err != nil {
+		errorMsg := "unable to get user agenda"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusNotFound))
+		RespondError(w, apiErr)
+		return
+	}
+	if loc == nil {
+		loc = agenda.Location()
+	}
+	agenda.In(loc)
+	RespondJSON(w, http.StatusOK, agenda)
+}
+
+// List reads the optional email and name filters and the page query parameters
+func (u *userController) List(w http.ResponseWriter, r *http.Request) {
+	page, err := ParsePageRequest(r)
+	if err != nil {
+		logger.Logger.Infow("invalid page request", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+	query := r.URL.Query()
+	filter := services.UserFilter{Email: query.Get("email"), Name: query.Get("name")}
+
+	result, err := services.UserService.List(filter, page)
+	if err != nil {
+		errorMsg := "unable to list users"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusBadRequest))
+		RespondError(w, apiErr)
+		return
+	}
+	RespondJSON(w, http.StatusOK, result)
+}
@@ -1,8 +1,84 @@
 package controllers
 
-import "github.com/google/uuid"
+import (
+	"calendar_service/src/models"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
 
 func IsValidUUID(u string) bool {
 	_, err := uuid.Parse(u)
 	return err == nil
 }
+
+// ParseTimeRange reads the required RFC 3339 from and to query parameters
+func ParseTimeRange(r *http.Request) (time.Time, time.Time, error) {
+	query := r.URL.Query()
+	from, err := time.Parse(time.RFC3339, query.Get("from"))
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("from should be a RFC 3339 timestamp")
+	}
+	to, err := time.Parse(time.RFC3339, query.Get("to"))
+	if err != nil {
+		return time.Time{}, time.Time{}, errors.New("to should be a RFC 3339 timestamp")
+	}
+	if !from.Before(to) {
+		return time.Time{}, time.Time{}, errors.New("from should be before to")
+	}
+	return from, to, nil
+}
+
+// ParseTimeZone reads the optional tz query parameter, the location
+// is nil when times should be rendered in their own zone
+func ParseTimeZone(r *http.Request) (*time.Location, error) {
+	name := r.URL.Query().Get("tz")
+	if name == "" {
+		return nil, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %s", name)
+	}
+	return loc, nil
+}
+
+// ParsePageRequest reads the optional limit, cursor, sort and order query parameters
+func ParsePageRequest(r *http.Request) (models.PageRequest, error) {
+	query := r.URL.Query()
+	page := models.PageRequest{
+		Cursor: query.Get("cursor"),
+		Sort:   query.Get("sort"),
+		Order:  models.SortOrder(query.Get("order")),
+	}
+	if limit := query.Get("limit"); limit != "" {
+		var err error
+		if page.Limit, err = strconv.Atoi(limit); err != nil || page.Limit <= 0 {
+			return page, errors.New("limit should be a positive number")
+		}
+	}
+	return page, page.Validate()
+}
+
+// ParseIfMatch reads the optional If-Match header and returns the version it
+// expects the entity at, 0 when any version will do. Etags which can not match
+// the etag of any version are reported as a version mismatch
+func ParseIfMatch(r *http.Request) (int64, error) {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return 0, nil
+	}
+	if strings.Contains(header, ",") {
+		return 0, errors.New("If-Match should be either * or a single etag")
+	}
+	// weak etags never match, versions are compared strongly
+	version, ok := models.VersionOfETag(header)
+	if !ok {
+		return 0, models.VersionMismatchError
+	}
+	return version, nil
+}
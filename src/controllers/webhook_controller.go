@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"calendar_service/src/auth"
+	"calendar_service/src/logger"
+	"calendar_service/src/models"
+	"calendar_service/src/services"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+var (
+	WebhookController WebhookControllerInterface = &webhookController{}
+)
+
+type WebhookControllerInterface interface {
+	Create(w http.ResponseWriter, r *http.Request)
+	List(w http.ResponseWriter, r *http.Request)
+	Delete(w http.ResponseWriter, r *http.Request)
+	Deliveries(w http.ResponseWriter, r *http.Request)
+}
+
+type webhookController struct{}
+
+// Create registers a webhook of the current user, the response holds the
+// secret deliveries are signed with, it is not returned afterwards
+func (c *webhookController) Create(w http.ResponseWriter, r *http.Request) {
+	requestBody, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		errorMsg := "invalid request body"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(errorMsg)
+		RespondError(w, apiErr)
+		return
+	}
+	defer r.Body.Close()
+	var webhook models.Webhook
+	err = json.Unmarshal(requestBody, &webhook)
+	if err != nil {
+		errorMsg := "invalid json body"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(errorMsg)
+		RespondError(w, apiErr)
+		return
+	}
+	webhook.UserId = auth.UserId(r.Context())
+	if err := webhook.Validate(); err != nil {
+		logger.Logger.Infow("invalid webhook", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+
+	result, err := services.WebhookService.Create(auth.UserId(r.Context()), webhook)
+	if err != nil {
+		errorMsg := "unable to create webhook"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusInternalServerError))
+		RespondError(w, apiErr)
+		return
+	}
+	RespondJSON(w, http.StatusCreated, result)
+}
+
+// List returns the webhooks of the current user
+func (c *webhookController) List(w http.ResponseWriter, r *http.Request) {
+	result, err := services.WebhookService.List(auth.UserId(r.Context()))
+	if err != nil {
+		errorMsg := "unable to get webhooks"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusInternalServerError))
+		RespondError(w, apiErr)
+		return
+	}
+	RespondJSON(w, http.StatusOK, result)
+}
+
+func (c *webhookController) Delete(w http.ResponseWriter, r *http.Request) {
+	webhookId := mux.Vars(r)["webhook_id"]
+	ok := IsValidUUID(webhookId)
+	if !ok {
+		logger.Logger.Infof("received invalid uuid=%s", webhookId)
+		apiErr := NewBadRequestApiError("invalid uuid")
+		RespondError(w, apiErr)
+		return
+	}
+
+	deletedId, err := services.WebhookService.Delete(auth.UserId(r.Context()), webhookId)
+	if err != nil {
+		errorMsg := "unable to delete webhook"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusNotFound))
+		RespondError(w, apiErr)
+		return
+	}
+	response := models.ResponseDeleted{
+		Message:   "webhook deleted",
+		DeletedId: deletedId,
+	}
+	RespondJSON(w, http.StatusAccepted, response)
+}
+
+// Deliveries returns the latest deliveries of the webhook, filtered
+// by the optional status query parameter and up to limit of them
+func (c *webhookController) Deliveries(w http.ResponseWriter, r *http.Request) {
+	webhookId := mux.Vars(r)["webhook_id"]
+	ok := IsValidUUID(webhookId)
+	if !ok {
+		logger.Logger.Infof("received invalid uuid=%s", webhookId)
+		apiErr := NewBadRequestApiError("invalid uuid")
+		RespondError(w, apiErr)
+		return
+	}
+	params := r.URL.Query()
+	query := models.DeliveryQuery{
+		WebhookId: webhookId,
+		Status:    models.DeliveryStatus(params.Get("status")),
+	}
+	if limit := params.Get("limit"); limit != "" {
+		var err error
+		if query.Limit, err = strconv.Atoi(limit); err != nil || query.Limit <= 0 {
+			logger.Logger.Infof("received invalid limit=%s", limit)
+			apiErr := NewBadRequestApiError("limit should be a positive number")
+			RespondError(w, apiErr)
+			return
+		}
+	}
+	if err := query.Validate(); err != nil {
+		logger.Logger.Infow("invalid delivery query", "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewBadRequestApiError(err.Error())
+		RespondError(w, apiErr)
+		return
+	}
+
+	result, err := services.WebhookService.Deliveries(auth.UserId(r.Context()), query)
+	if err != nil {
+		errorMsg := "unable to get webhook deliveries"
+		logger.Logger.Infow(errorMsg, "err", err.Error(), "path", r.URL.Path)
+		apiErr := NewApiError(errorMsg, err.Error(), ErrorStatus(err, http.StatusNotFound))
+		RespondError(w, apiErr)
+		return
+	}
+	RespondJSON(w, http.StatusOK, result)
+}
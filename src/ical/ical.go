@@ -0,0 +1,198 @@
+package ical
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	ProdId      = "-//calendar_service//calendar api//EN"
+	ContentType = "text/calendar; charset=utf-8"
+
+	dateLayout          = "20060102"
+	dateTimeLayout      = "20060102T150405Z"
+	localDateTimeLayout = "20060102T150405"
+	maxLineOctets       = 75
+)
+
+type Calendar struct {
+	Name   string
+	Events []*Event
+}
+
+// Attendee is an ATTENDEE property. Role and PartStat hold the
+// iCalendar parameter values and are left out when empty
+type Attendee struct {
+	Email      string
+	CommonName string
+	Role       string
+	PartStat   string
+}
+
+// Event is a VEVENT. Overrides of a recurring event share its Uid
+// and carry the original start of the occurrence in RecurrenceId.
+// Times of events with a TimeZone are written as local times of that zone,
+// which the calendar defines in a VTIMEZONE.
+// Err is set by Decode for events that could not be parsed
+type Event struct {
+	Uid          string
+	Stamp        time.Time
+	Summary      string
+	Description  string
+	WholeDay     bool
+	Start        time.Time
+	End          time.Time
+	RRule        string
+	ExDates      []time.Time
+	RecurrenceId time.Time
+	TimeZone     string
+	Attendees    []*Attendee
+	Err          error
+	duration     time.Duration
+}
+
+func (c *Calendar) Encode(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	lw := &lineWriter{w: bw}
+	lw.line("BEGIN", "VCALENDAR")
+	lw.line("VERSION", "2.0")
+	lw.line("PRODID", ProdId)
+	lw.line("CALSCALE", "GREGORIAN")
+	if c.Name != "" {
+		lw.line("X-WR-CALNAME", escapeText(c.Name))
+	}
+	// every TZID the events refer to is defined by a VTIMEZONE
+	for _, zone := range timeZones(c.Events) {
+		zone.encode(lw)
+	}
+	for _, e := range c.Events {
+		e.encode(lw)
+	}
+	lw.line("END", "VCALENDAR")
+	if lw.err != nil {
+		return lw.err
+	}
+	return bw.Flush()
+}
+
+func (e *Event) encode(lw *lineWriter) {
+	lw.line("BEGIN", "VEVENT")
+	lw.line("UID", escapeText(e.Uid))
+	stamp := e.Stamp
+	if stamp.IsZero() {
+		stamp = time.Now()
+	}
+	lw.line("DTSTAMP", stamp.UTC().Format(dateTimeLayout))
+	loc := e.location()
+	if !e.RecurrenceId.IsZero() {
+		lw.timeLine("RECURRENCE-ID", e.RecurrenceId, e.WholeDay, loc)
+	}
+	lw.timeLine("DTSTART", e.Start, e.WholeDay, loc)
+	if e.WholeDay {
+		end := e.End
+		if end.IsZero() {
+			end = e.Start.AddDate(0, 0, 1)
+		}
+		lw.timeLine("DTEND", end, true, loc)
+	} else if !e.End.IsZero() {
+		lw.timeLine("DTEND", e.End, false, loc)
+	}
+	lw.line("SUMMARY", escapeText(e.Summary))
+	if e.Description != "" {
+		lw.line("DESCRIPTION", escapeText(e.Description))
+	}
+	if e.RRule != "" {
+		lw.line("RRULE", e.RRule)
+	}
+	for _, exDate := range e.ExDates {
+		lw.timeLine("EXDATE", exDate, e.WholeDay, loc)
+	}
+	for _, a := range e.Attendees {
+		name := "ATTENDEE"
+		if cn := strings.Map(dropQuotes, a.CommonName); cn != "" {
+			name = fmt.Sprintf(`ATTENDEE;CN="%s"`, cn)
+		}
+		if a.Role != "" {
+			name += ";ROLE=" + a.Role
+		}
+		if a.PartStat != "" {
+			name += ";PARTSTAT=" + a.PartStat
+		}
+		lw.line(name, "mailto:"+a.Email)
+	}
+	lw.line("END", "VEVENT")
+}
+
+// location returns the zone of TimeZone, nil when times should be written in UTC
+func (e *Event) location() *time.Location {
+	if e.TimeZone == "" || e.TimeZone == "UTC" {
+		return nil
+	}
+	loc, err := time.LoadLocation(e.TimeZone)
+	if err != nil {
+		return nil
+	}
+	return loc
+}
+
+type lineWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func (lw *lineWriter) timeLine(name string, t time.Time, date bool, loc *time.Location) {
+	if date {
+		lw.line(name+";VALUE=DATE", t.Format(dateLayout))
+		return
+	}
+	if loc != nil {
+		lw.line(fmt.Sprintf("%s;TZID=%s", name, loc.String()), t.In(loc).Format(localDateTimeLayout))
+		return
+	}
+	lw.line(name, t.UTC().Format(dateTimeLayout))
+}
+
+// line writes a content line folding it at 75 octets as RFC 5545 requires
+func (lw *lineWriter) line(name, value string) {
+	if lw.err != nil {
+		return
+	}
+	content := name + ":" + value
+	limit := maxLineOctets
+	for len(content) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(content[cut]) {
+			cut--
+		}
+		if _, lw.err = lw.w.WriteString(content[:cut] + "\r\n "); lw.err != nil {
+			return
+		}
+		content = content[cut:]
+		// continuation lines start with a space that counts against the limit
+		limit = maxLineOctets - 1
+	}
+	_, lw.err = lw.w.WriteString(content + "\r\n")
+}
+
+var textEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+)
+
+func escapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+func dropQuotes(r rune) rune {
+	if r == '"' {
+		return -1
+	}
+	return r
+}
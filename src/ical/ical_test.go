@@ -0,0 +1,126 @@
+package ical
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalendar_Encode(t *testing.T) {
+	start := time.Date(2020, 1, 6, 9, 0, 0, 0, time.UTC)
+	cal := &Calendar{
+		Name: "John's personal calendar",
+		Events: []*Event{
+			{
+				Uid:         "4e7ca4b6-4da5-11ea-b1e0-c83a35cc61f1",
+				Stamp:       start,
+				Summary:     "Meet friends, family; colleagues",
+				Description: "first line\nsecond line",
+				Start:       start,
+				End:         start.Add(time.Hour),
+				RRule:       "FREQ=WEEKLY;COUNT=3",
+				ExDates:     []time.Time{start.AddDate(0, 0, 7)},
+				Attendees: []*Attendee{
+					{Email: "jhon@gmail.com", CommonName: "John Carmack"},
+					{Email: "kotlinjackson@gmail.com", Role: "CHAIR", PartStat: "ACCEPTED"},
+				},
+			},
+			{
+				Uid:      "33148505-7595-4c2a-9a45-bc885d0910a6",
+				Stamp:    start,
+				Summary:  "take a rest",
+				WholeDay: true,
+				Start:    start,
+			},
+		},
+	}
+
+	var buf bytes.Buffer
+	err := cal.Encode(&buf)
+	assert.Nil(t, err)
+	out := buf.String()
+	assert.True(t, strings.HasPrefix(out, "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n"))
+	assert.True(t, strings.HasSuffix(out, "END:VCALENDAR\r\n"))
+	assert.Contains(t, out, "SUMMARY:Meet friends\\, family\\; colleagues\r\n")
+	assert.Contains(t, out, "DESCRIPTION:first line\\nsecond line\r\n")
+	assert.Contains(t, out, "DTSTART:20200106T090000Z\r\n")
+	assert.Contains(t, out, "EXDATE:20200113T090000Z\r\n")
+	assert.Contains(t, out, "ATTENDEE;CN=\"John Carmack\":mailto:jhon@gmail.com\r\n")
+	assert.Contains(t, out, "ATTENDEE;ROLE=CHAIR;PARTSTAT=ACCEPTED:mailto:kotlinjackson@gmail.com\r\n")
+	assert.Contains(t, out, "DTSTART;VALUE=DATE:20200106\r\nDTEND;VALUE=DATE:20200107\r\n")
+}
+
+func TestCalendar_EncodeTimeZone(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone database is not available")
+	}
+	start := time.Date(2020, 3, 23, 9, 0, 0, 0, berlin)
+	cal := &Calendar{Events: []*Event{{
+		Uid:      "9a1d3c52-5b7e-11ea-8e2d-c83a35cc61f1",
+		Stamp:    start,
+		Summary:  "Weekly sync",
+		Start:    start.UTC(),
+		End:      start.Add(30 * time.Minute).UTC(),
+		RRule:    "FREQ=WEEKLY;COUNT=3",
+		TimeZone: "Europe/Berlin",
+	}}}
+
+	var buf bytes.Buffer
+	assert.Nil(t, cal.Encode(&buf))
+	out := buf.String()
+	assert.Contains(t, out, "DTSTART;TZID=Europe/Berlin:20200323T090000\r\n")
+	assert.Contains(t, out, "BEGIN:VTIMEZONE\r\nTZID:Europe/Berlin\r\n")
+	assert.Contains(t, out, "BEGIN:DAYLIGHT\r\nDTSTART:20190331T020000\r\nTZOFFSETFROM:+0100\r\nTZOFFSETTO:+0200\r\n"+
+		"TZNAME:CEST\r\nRRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU\r\nEND:DAYLIGHT\r\n")
+	assert.Contains(t, out, "BEGIN:STANDARD\r\nDTSTART:20191027T030000\r\nTZOFFSETFROM:+0200\r\nTZOFFSETTO:+0100\r\n"+
+		"TZNAME:CET\r\nRRULE:FREQ=YEARLY;BYMONTH=10;BYDAY=-1SU\r\nEND:STANDARD\r\n")
+	assert.Less(t, strings.Index(out, "END:VTIMEZONE"), strings.Index(out, "BEGIN:VEVENT"))
+
+	decoded, err := Decode(&buf)
+	assert.Nil(t, err)
+	assert.Equal(t, "Europe/Berlin", decoded.Events[0].TimeZone)
+	assert.True(t, start.Equal(decoded.Events[0].Start))
+}
+
+func TestLineWriter_Fold(t *testing.T) {
+	var buf bytes.Buffer
+	cal := &Calendar{Events: []*Event{{
+		Uid:         "1",
+		Summary:     "folded",
+		Description: strings.Repeat("ü", 100),
+		Start:       time.Date(2020, 1, 6, 9, 0, 0, 0, time.UTC),
+	}}}
+	assert.Nil(t, cal.Encode(&buf))
+	for _, line := range strings.Split(buf.String(), "\r\n") {
+		assert.True(t, len(line) <= maxLineOctets, "line is too long: %q", line)
+		assert.True(t, strings.ToValidUTF8(line, "") == line, "line splits a character: %q", line)
+	}
+}
+
+func TestCalendar_EncodeRuleChange(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("time zone database is not available")
+	}
+	start := time.Date(2006, 3, 23, 9, 0, 0, 0, newYork)
+	cal := &Calendar{Events: []*Event{{
+		Uid:      "1",
+		Start:    start.UTC(),
+		End:      start.Add(time.Hour).UTC(),
+		RRule:    "FREQ=YEARLY;COUNT=3",
+		ExDates:  []time.Time{start.AddDate(2, 0, 0)},
+		TimeZone: "America/New_York",
+	}}}
+
+	var buf bytes.Buffer
+	assert.Nil(t, cal.Encode(&buf))
+	out := buf.String()
+	// the rules of 2005 and 2006 end before the ones from 2007 on
+	assert.Contains(t, out, "RRULE:FREQ=YEARLY;BYMONTH=4;BYDAY=1SU;UNTIL=20060402T070000Z\r\n")
+	assert.Contains(t, out, "DTSTART:20070311T020000\r\nTZOFFSETFROM:-0500\r\nTZOFFSETTO:-0400\r\nTZNAME:EDT\r\n"+
+		"RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=2SU\r\n")
+	assert.Equal(t, 1, strings.Count(out, "BEGIN:VTIMEZONE"))
+}
@@ -0,0 +1,193 @@
+package ical
+
+import (
+	"calendar_service/src/models"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var attendeeRoles = map[models.AttendeeRole]string{
+	models.AttendeeRequired: "REQ-PARTICIPANT",
+	models.AttendeeOptional: "OPT-PARTICIPANT",
+	models.AttendeeChair:    "CHAIR",
+}
+
+// FromCalendar converts a calendar into a VCALENDAR. Appointments should be
+// preloaded together with their attendees and exceptions
+func FromCalendar(cal *models.Calendar) *Calendar {
+	result := &Calendar{Name: cal.Name, Events: make([]*Event, 0, len(cal.Appointments))}
+	for _, appt := range cal.Appointments {
+		result.Events = append(result.Events, FromAppointment(appt)...)
+	}
+	return result
+}
+
+// FromAppointment converts an appointment into its VEVENT followed
+// by a VEVENT per overridden occurrence
+func FromAppointment(appt *models.Appointment) []*Event {
+	attendees := make([]*Attendee, 0, len(appt.Attendees))
+	for _, usr := range appt.Attendees {
+		attendee := &Attendee{
+			Email:      usr.Email,
+			CommonName: strings.TrimSpace(usr.FirstName + " " + usr.LastName),
+		}
+		if p := usr.Participation; p != nil {
+			attendee.Role = attendeeRoles[p.Role]
+			attendee.PartStat = strings.ToUpper(string(p.Status))
+		}
+		attendees = append(attendees, attendee)
+	}
+	for _, e := range appt.ExternalAttendees {
+		attendees = append(attendees, &Attendee{
+			Email:      e.Email,
+			CommonName: e.Name,
+			Role:       attendeeRoles[e.Role],
+			PartStat:   strings.ToUpper(string(e.Status)),
+		})
+	}
+
+	uid := appt.Uid
+	if uid == "" {
+		uid = appt.ID
+	}
+	master := &Event{
+		Uid:         uid,
+		Stamp:       appt.UpdatedAt,
+		Summary:     appt.Subject,
+		Description: appt.Description,
+		WholeDay:    appt.WholeDay,
+		Start:       appt.Start,
+		End:         appt.End,
+		RRule:       recurrenceRule(appt),
+		TimeZone:    appt.TimeZone,
+		Attendees:   attendees,
+	}
+	events := []*Event{master}
+	if !appt.IsRecurring() {
+		return events
+	}
+	for _, e := range appt.Exceptions {
+		if e.Cancelled {
+			master.ExDates = append(master.ExDates, e.RecurrenceId)
+			continue
+		}
+		events = append(events, &Event{
+			Uid:          uid,
+			Stamp:        e.UpdatedAt,
+			Summary:      e.Subject,
+			Description:  e.Description,
+			WholeDay:     appt.WholeDay,
+			Start:        e.Start,
+			End:          e.End,
+			RecurrenceId: e.RecurrenceId,
+			TimeZone:     appt.TimeZone,
+			Attendees:    attendees,
+		})
+	}
+	return events
+}
+
+// recurrenceRule renders the appointment RRULE. UNTIL of whole day
+// series should be a DATE as their DTSTART is
+func recurrenceRule(appt *models.Appointment) string {
+	if !appt.IsRecurring() {
+		return ""
+	}
+	rule, err := models.ParseRecurrenceRule(appt.Recurrence)
+	if err != nil {
+		return ""
+	}
+	if appt.WholeDay && !rule.Until.IsZero() && !rule.UntilIsDate() {
+		rule.SetUntilDate(rule.Until)
+	}
+	return rule.String()
+}
+
+// ImportedEvent is a VEVENT with its overrides converted into an appointment.
+// AttendeeEmails are left for the caller to resolve into users,
+// AttendeeNames holds the common names given to them
+type ImportedEvent struct {
+	Uid            string
+	Appointment    *models.Appointment
+	AttendeeEmails []string
+	AttendeeNames  map[string]string
+	Err            error
+}
+
+// ToAppointments converts the events of the calendar into appointments,
+// attaching overrides and EXDATEs to their series as exceptions
+func ToAppointments(cal *Calendar) []*ImportedEvent {
+	result := make([]*ImportedEvent, 0, len(cal.Events))
+	byUid := make(map[string]*ImportedEvent)
+	overrides := make([]*Event, 0)
+
+	for _, e := range cal.Events {
+		if e.Err == nil && !e.RecurrenceId.IsZero() {
+			overrides = append(overrides, e)
+			continue
+		}
+		imported := &ImportedEvent{Uid: e.Uid, AttendeeNames: map[string]string{}, Err: e.Err}
+		result = append(result, imported)
+		if e.Err != nil {
+			continue
+		}
+		imported.Appointment = toAppointment(e)
+		for _, a := range e.Attendees {
+			imported.AttendeeEmails = append(imported.AttendeeEmails, a.Email)
+			if a.CommonName != "" {
+				imported.AttendeeNames[strings.ToLower(a.Email)] = a.CommonName
+			}
+		}
+		if e.Uid != "" {
+			byUid[e.Uid] = imported
+		}
+	}
+
+	for _, e := range overrides {
+		imported, ok := byUid[e.Uid]
+		if !ok {
+			result = append(result, &ImportedEvent{
+				Uid: e.Uid,
+				Err: fmt.Errorf("occurrence override of unknown event %s", e.Uid),
+			})
+			continue
+		}
+		override := toAppointment(e)
+		imported.Appointment.Exceptions = append(imported.Appointment.Exceptions, &models.AppointmentException{
+			RecurrenceId: e.RecurrenceId,
+			Subject:      override.Subject,
+			Description:  override.Description,
+			Start:        override.Start,
+			End:          override.End,
+		})
+	}
+	return result
+}
+
+func toAppointment(e *Event) *models.Appointment {
+	appt := &models.Appointment{
+		Uid:         e.Uid,
+		Subject:     e.Summary,
+		Description: e.Description,
+		WholeDay:    e.WholeDay,
+		Start:       e.Start,
+		End:         e.End,
+		Recurrence:  e.RRule,
+		TimeZone:    e.TimeZone,
+	}
+	// whole day appointments are stored without an end
+	if appt.WholeDay {
+		appt.End = time.Time{}
+	}
+	if !appt.WholeDay && appt.End.IsZero() {
+		appt.End = appt.Start
+	}
+	for _, exDate := range e.ExDates {
+		appt.Exceptions = append(appt.Exceptions, &models.AppointmentException{
+			RecurrenceId: exDate,
+			Cancelled:    true,
+		})
+	}
+	return appt
+}
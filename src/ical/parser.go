@@ -0,0 +1,257 @@
+package ical
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	InvalidCalendarError = errors.New("invalid icalendar data")
+
+	durationPattern = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+	lineUnfolder    = strings.NewReplacer("\r\n ", "", "\r\n\t", "", "\n ", "", "\n\t", "")
+	textUnescaper   = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+)
+
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// Decode parses the VEVENTs of a VCALENDAR. Malformed events do not fail
+// the whole calendar, their Err field is set instead
+func Decode(r io.Reader) (*Calendar, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(lineUnfolder.Replace(string(data)), "\n")
+
+	var cal *Calendar
+	var event *Event
+	depth := 0
+	for _, line := range lines {
+		line = strings.TrimRight(line, "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		prop, err := parseLine(line)
+		if err != nil {
+			if event != nil && event.Err == nil {
+				event.Err = err
+			}
+			continue
+		}
+
+		switch prop.name {
+		case "BEGIN":
+			depth++
+			switch {
+			case depth == 1 && strings.EqualFold(prop.value, "VCALENDAR"):
+				cal = &Calendar{Events: make([]*Event, 0)}
+			case depth == 2 && cal != nil && strings.EqualFold(prop.value, "VEVENT"):
+				event = &Event{}
+			}
+			continue
+		case "END":
+			if depth == 2 && event != nil {
+				event.finish()
+				cal.Events = append(cal.Events, event)
+				event = nil
+			}
+			depth--
+			continue
+		}
+
+		switch {
+		case depth == 1 && cal != nil && prop.name == "X-WR-CALNAME":
+			cal.Name = textUnescaper.Replace(prop.value)
+		case depth == 2 && event != nil:
+			if err := event.setProperty(prop); err != nil && event.Err == nil {
+				event.Err = err
+			}
+		}
+	}
+	if cal == nil {
+		return nil, InvalidCalendarError
+	}
+	return cal, nil
+}
+
+func (e *Event) setProperty(prop *property) error {
+	var err error
+	switch prop.name {
+	case "UID":
+		e.Uid = prop.value
+	case "SUMMARY":
+		e.Summary = textUnescaper.Replace(prop.value)
+	case "DESCRIPTION":
+		e.Description = textUnescaper.Replace(prop.value)
+	case "DTSTAMP":
+		e.Stamp, _, err = parseTime(prop)
+	case "DTSTART":
+		e.Start, e.WholeDay, err = parseTime(prop)
+		e.TimeZone = prop.params["TZID"]
+	case "DTEND":
+		e.End, _, err = parseTime(prop)
+	case "DURATION":
+		var d time.Duration
+		d, err = parseDuration(prop.value)
+		e.duration = d
+	case "RECURRENCE-ID":
+		e.RecurrenceId, _, err = parseTime(prop)
+	case "RRULE":
+		e.RRule = prop.value
+	case "EXDATE":
+		for _, value := range strings.Split(prop.value, ",") {
+			item := &property{name: prop.name, params: prop.params, value: value}
+			exDate, _, exErr := parseTime(item)
+			if exErr != nil {
+				return exErr
+			}
+			e.ExDates = append(e.ExDates, exDate)
+		}
+	case "ATTENDEE":
+		if !strings.HasPrefix(strings.ToLower(prop.value), "mailto:") {
+			return nil
+		}
+		e.Attendees = append(e.Attendees, &Attendee{
+			Email:      strings.TrimSpace(prop.value[len("mailto:"):]),
+			CommonName: prop.params["CN"],
+		})
+	}
+	return err
+}
+
+// finish resolves properties depending on each other once the whole VEVENT is read
+func (e *Event) finish() {
+	if e.Err != nil {
+		return
+	}
+	if e.Start.IsZero() {
+		e.Err = errors.New("event has no DTSTART")
+		return
+	}
+	if e.End.IsZero() && e.duration != 0 {
+		e.End = e.Start.Add(e.duration)
+	}
+}
+
+func parseLine(line string) (*property, error) {
+	inQuotes := false
+	nameEnd, valueStart := -1, -1
+	for i, r := range line {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+		case r == ';' && !inQuotes && nameEnd < 0:
+			nameEnd = i
+		case r == ':' && !inQuotes:
+			valueStart = i
+		}
+		if valueStart >= 0 {
+			break
+		}
+	}
+	if valueStart < 0 {
+		return nil, fmt.Errorf("invalid content line %q", line)
+	}
+	if nameEnd < 0 {
+		nameEnd = valueStart
+	}
+
+	prop := &property{
+		name:   strings.ToUpper(line[:nameEnd]),
+		params: make(map[string]string),
+		value:  line[valueStart+1:],
+	}
+	if nameEnd < valueStart {
+		for _, param := range splitParams(line[nameEnd+1 : valueStart]) {
+			kv := strings.SplitN(param, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			prop.params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], `"`)
+		}
+	}
+	return prop, nil
+}
+
+func splitParams(s string) []string {
+	params := make([]string, 0, 1)
+	inQuotes := false
+	start := 0
+	for i, r := range s {
+		switch {
+		case r == '"':
+			inQuotes = !inQuotes
+		case r == ';' && !inQuotes:
+			params = append(params, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(params, s[start:])
+}
+
+// parseTime reads a DATE or DATE-TIME value, honoring the TZID parameter.
+// The second result reports whether the value is a DATE
+func parseTime(prop *property) (time.Time, bool, error) {
+	value := strings.TrimSpace(prop.value)
+	if prop.params["VALUE"] == "DATE" || len(value) == len(dateLayout) {
+		t, err := time.Parse(dateLayout, value)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid %s value %s", prop.name, value)
+		}
+		return t, true, nil
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse(dateTimeLayout, value)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("invalid %s value %s", prop.name, value)
+		}
+		return t, false, nil
+	}
+	loc := time.UTC
+	if tzid := prop.params["TZID"]; tzid != "" {
+		var err error
+		loc, err = time.LoadLocation(tzid)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("unknown %s time zone %s", prop.name, tzid)
+		}
+	}
+	t, err := time.ParseInLocation(localDateTimeLayout, value, loc)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("invalid %s value %s", prop.name, value)
+	}
+	return t, false, nil
+}
+
+func parseDuration(value string) (time.Duration, error) {
+	match := durationPattern.FindStringSubmatch(strings.TrimSpace(value))
+	if match == nil {
+		return 0, fmt.Errorf("invalid DURATION value %s", value)
+	}
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var d time.Duration
+	for i, unit := range units {
+		if match[i+2] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(match[i+2])
+		if err != nil {
+			return 0, fmt.Errorf("invalid DURATION value %s", value)
+		}
+		d += time.Duration(n) * unit
+	}
+	if match[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
@@ -0,0 +1,95 @@
+package ical
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testCalendar = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"X-WR-CALNAME:Work\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:budget@example.com\r\n" +
+	"SUMMARY:Budget\\, Q3\r\n" +
+	"DESCRIPTION:a long description\r\n  folded in two lines\r\n" +
+	"DTSTART;TZID=Europe/Berlin:20200106T090000\r\n" +
+	"DURATION:PT1H30M\r\n" +
+	"RRULE:FREQ=WEEKLY;COUNT=4\r\n" +
+	"EXDATE;TZID=Europe/Berlin:20200113T090000,20200120T090000\r\n" +
+	"ATTENDEE;CN=\"Carmack; John\";ROLE=REQ-PARTICIPANT:mailto:jhon@gmail.com\r\n" +
+	"BEGIN:VALARM\r\n" +
+	"TRIGGER:-PT15M\r\n" +
+	"END:VALARM\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:budget@example.com\r\n" +
+	"RECURRENCE-ID;TZID=Europe/Berlin:20200127T090000\r\n" +
+	"SUMMARY:Budget moved\r\n" +
+	"DTSTART;TZID=Europe/Berlin:20200127T100000\r\n" +
+	"DTEND;TZID=Europe/Berlin:20200127T110000\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:holiday@example.com\r\n" +
+	"SUMMARY:Holiday\r\n" +
+	"DTSTART;VALUE=DATE:20200101\r\n" +
+	"DTEND;VALUE=DATE:20200102\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"UID:broken@example.com\r\n" +
+	"SUMMARY:broken\r\n" +
+	"DTSTART:2020XX\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestDecode(t *testing.T) {
+	cal, err := Decode(strings.NewReader(testCalendar))
+	assert.Nil(t, err)
+	assert.Equal(t, "Work", cal.Name)
+	assert.Len(t, cal.Events, 4)
+
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal("unable to load time zone", err)
+	}
+	budget := cal.Events[0]
+	assert.Nil(t, budget.Err)
+	assert.Equal(t, "Budget, Q3", budget.Summary)
+	assert.Equal(t, "a long description folded in two lines", budget.Description)
+	assert.True(t, time.Date(2020, 1, 6, 9, 0, 0, 0, berlin).Equal(budget.Start))
+	assert.Equal(t, 90*time.Minute, budget.End.Sub(budget.Start))
+	assert.Equal(t, "FREQ=WEEKLY;COUNT=4", budget.RRule)
+	assert.Len(t, budget.ExDates, 2)
+	assert.Equal(t, []*Attendee{{Email: "jhon@gmail.com", CommonName: "Carmack; John"}}, budget.Attendees)
+
+	assert.True(t, time.Date(2020, 1, 27, 9, 0, 0, 0, berlin).Equal(cal.Events[1].RecurrenceId))
+	assert.True(t, cal.Events[2].WholeDay)
+	assert.NotNil(t, cal.Events[3].Err)
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	_, err := Decode(strings.NewReader("hello world"))
+	assert.Equal(t, InvalidCalendarError, err)
+}
+
+func TestToAppointments(t *testing.T) {
+	cal, err := Decode(strings.NewReader(testCalendar))
+	if err != nil {
+		t.Fatal("unable to decode calendar", err)
+	}
+	imported := ToAppointments(cal)
+	assert.Len(t, imported, 3)
+
+	budget := imported[0].Appointment
+	assert.Equal(t, []string{"jhon@gmail.com"}, imported[0].AttendeeEmails)
+	assert.Len(t, budget.Exceptions, 3)
+	assert.True(t, budget.Exceptions[0].Cancelled)
+	assert.Equal(t, "Budget moved", budget.Exceptions[2].Subject)
+
+	holiday := imported[1].Appointment
+	assert.True(t, holiday.WholeDay)
+	assert.True(t, holiday.End.IsZero())
+
+	assert.NotNil(t, imported[2].Err)
+}
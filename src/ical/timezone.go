@@ -0,0 +1,215 @@
+package ical
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// maxTimeZoneYears bounds the years the observances of a VTIMEZONE are worked out for
+const maxTimeZoneYears = 50
+
+// transition is a change of the offset of a zone. Onset is the instant it
+// takes place, rule the yearly recurrence it is written with. Transitions
+// of different years with the same key are the same observance
+type transition struct {
+	onset    time.Time
+	from, to int
+	name     string
+	rule     string
+	key      string
+}
+
+// observance is a transition repeated yearly from its first to its last onset,
+// closed once the rules of the zone changed after the last one
+type observance struct {
+	first, last transition
+	daylight    bool
+	closed      bool
+}
+
+// zoneUse collects the times written in a zone, its VTIMEZONE
+// covers the years from the earliest to the latest of them
+type zoneUse struct {
+	loc      *time.Location
+	min, max time.Time
+}
+
+func (u *zoneUse) add(t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	if u.min.IsZero() || t.Before(u.min) {
+		u.min = t
+	}
+	if t.After(u.max) {
+		u.max = t
+	}
+}
+
+// timeZones returns the zones the events write their times in, sorted by name
+func timeZones(events []*Event) []*zoneUse {
+	byName := make(map[string]*zoneUse)
+	for _, e := range events {
+		loc := e.location()
+		if loc == nil || e.WholeDay {
+			continue
+		}
+		use, ok := byName[loc.String()]
+		if !ok {
+			use = &zoneUse{loc: loc}
+			byName[loc.String()] = use
+		}
+		use.add(e.Start)
+		use.add(e.End)
+		use.add(e.RecurrenceId)
+		for _, exDate := range e.ExDates {
+			use.add(exDate)
+		}
+	}
+	zones := make([]*zoneUse, 0, len(byName))
+	for _, use := range byName {
+		zones = append(zones, use)
+	}
+	sort.Slice(zones, func(i, j int) bool { return zones[i].loc.String() < zones[j].loc.String() })
+	return zones
+}
+
+// encode writes the VTIMEZONE of the zone. The transitions of every year are
+// written as yearly observances, starting over whenever the rules of the zone
+// change. The year before the earliest time is included so that every time
+// follows an onset, the observances of the latest year repeat for good
+func (u *zoneUse) encode(lw *lineWriter) {
+	lw.line("BEGIN", "VTIMEZONE")
+	lw.line("TZID", u.loc.String())
+
+	firstYear, lastYear := u.min.Year()-1, u.max.Year()
+	if lastYear-firstYear > maxTimeZoneYears {
+		firstYear = lastYear - maxTimeZoneYears
+	}
+	observances := make([]*observance, 0)
+	open := make(map[string]*observance)
+	for year := firstYear; year <= lastYear; year++ {
+		transitions := yearTransitions(u.loc, year)
+		same := len(transitions) == len(open)
+		for _, t := range transitions {
+			if _, ok := open[t.key]; !ok {
+				same = false
+			}
+		}
+		if !same {
+			for _, o := range open {
+				o.closed = true
+			}
+			open = make(map[string]*observance)
+		}
+		for _, t := range transitions {
+			if o, ok := open[t.key]; ok {
+				o.last = t
+				continue
+			}
+			o := &observance{first: t, last: t, daylight: t.to > t.from}
+			open[t.key] = o
+			observances = append(observances, o)
+		}
+	}
+	if len(observances) == 0 {
+		// the zone keeps the same offset all along
+		onset := time.Date(firstYear, 1, 1, 0, 0, 0, 0, u.loc)
+		name, offset := onset.Zone()
+		observances = append(observances, &observance{
+			first:  transition{onset: onset, from: offset, to: offset, name: name},
+			closed: true,
+		})
+	}
+	for _, o := range observances {
+		o.encode(lw)
+	}
+	lw.line("END", "VTIMEZONE")
+}
+
+func (o *observance) encode(lw *lineWriter) {
+	component := "STANDARD"
+	if o.daylight {
+		component = "DAYLIGHT"
+	}
+	lw.line("BEGIN", component)
+	lw.line("DTSTART", o.first.onset.Add(time.Duration(o.first.from)*time.Second).UTC().Format(localDateTimeLayout))
+	lw.line("TZOFFSETFROM", formatOffset(o.first.from))
+	lw.line("TZOFFSETTO", formatOffset(o.first.to))
+	if o.first.name != "" {
+		lw.line("TZNAME", escapeText(o.first.name))
+	}
+	switch {
+	case o.first.rule == "":
+	case !o.closed:
+		lw.line("RRULE", o.first.rule)
+	case o.last.onset.After(o.first.onset):
+		lw.line("RRULE", fmt.Sprintf("%s;UNTIL=%s", o.first.rule, o.last.onset.UTC().Format(dateTimeLayout)))
+	}
+	lw.line("END", component)
+}
+
+// yearTransitions finds the changes of the offset of the zone within the year,
+// looking at it day by day and narrowing every change down to the second
+func yearTransitions(loc *time.Location, year int) []transition {
+	transitions := make([]transition, 0, 2)
+	day := time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC)
+	end := day.AddDate(1, 0, 0)
+	_, offset := day.In(loc).Zone()
+	for day.Before(end) {
+		next := day.Add(24 * time.Hour)
+		_, nextOffset := next.In(loc).Zone()
+		if nextOffset != offset {
+			// the offset at lo is the former one, at hi the new one
+			lo, hi := day, next
+			for hi.Sub(lo) > time.Second {
+				mid := lo.Add(hi.Sub(lo) / 2)
+				if _, midOffset := mid.In(loc).Zone(); midOffset == offset {
+					lo = mid
+				} else {
+					hi = mid
+				}
+			}
+			name, _ := hi.In(loc).Zone()
+			local := hi.Add(time.Duration(offset) * time.Second).UTC()
+			rule := yearlyRule(local)
+			transitions = append(transitions, transition{
+				onset: hi,
+				from:  offset,
+				to:    nextOffset,
+				name:  name,
+				rule:  rule,
+				key:   fmt.Sprintf("%s %s %d %d %s", rule, local.Format("150405"), offset, nextOffset, name),
+			})
+			offset = nextOffset
+		}
+		day = next
+	}
+	return transitions
+}
+
+var weekdays = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// yearlyRule is the RRULE of a transition taking place at the local time
+// given, on the same weekday of the same week of the month every year
+func yearlyRule(local time.Time) string {
+	week := (local.Day()-1)/7 + 1
+	if local.AddDate(0, 0, 7).Month() != local.Month() {
+		week = -1
+	}
+	return fmt.Sprintf("FREQ=YEARLY;BYMONTH=%d;BYDAY=%d%s", int(local.Month()), week, weekdays[local.Weekday()])
+}
+
+func formatOffset(seconds int) string {
+	sign := "+"
+	if seconds < 0 {
+		sign = "-"
+		seconds = -seconds
+	}
+	offset := fmt.Sprintf("%s%02d%02d", sign, seconds/3600, seconds%3600/60)
+	if seconds%60 != 0 {
+		offset += fmt.Sprintf("%02d", seconds%60)
+	}
+	return offset
+}
@@ -0,0 +1,205 @@
+package live
+
+import (
+	"calendar_service/src/logger"
+	"calendar_service/src/models"
+	"errors"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"sync"
+	"time"
+)
+
+const (
+	// batchSize is the number of changes read at once
+	batchSize = 500
+	// SubscriptionBuffer is the number of changes a subscription holds before
+	// it is considered too slow and closed
+	SubscriptionBuffer = 256
+)
+
+var (
+	// Changes is the broker of the service, set up by the app
+	Changes *Broker
+
+	// SlowSubscriberError closes the subscriptions of the subscribers not keeping up
+	SlowSubscriberError = errors.New("subscriber did not keep up")
+	// EndedError closes the subscriptions after the change they end with
+	EndedError = errors.New("subscription ended by a change")
+)
+
+// Broker fans the changes of the outbox out to the subscriptions made on this
+// instance of the service. Every instance runs its own broker, woken up by the
+// notifications of the outbox channel, so changes made through any of them
+// reach the subscribers of all. The outbox is polled every pollInterval as
+// well, should a notification get lost while the listener reconnects
+type Broker struct {
+	db           *gorm.DB
+	connString   string
+	pollInterval time.Duration
+
+	mu            sync.Mutex
+	subscriptions map[*Subscription]struct{}
+	lastId        int64
+
+	listener *pq.Listener
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// Subscription receives the changes its match function accepts. Changes is
+// closed when the subscription is closed, either by the subscriber or by the
+// broker when the subscriber does not keep up or after the change it ends with
+type Subscription struct {
+	Changes <-chan *models.Change
+
+	changes chan *models.Change
+	match   func(*models.Change) bool
+	until   func(*models.Change) bool
+	err     error
+	broker  *Broker
+}
+
+func NewBroker(db *gorm.DB, connString string, pollInterval time.Duration) *Broker {
+	return &Broker{
+		db:            db,
+		connString:    connString,
+		pollInterval:  pollInterval,
+		subscriptions: make(map[*Subscription]struct{}),
+	}
+}
+
+// Start listens to the outbox channel, changes made before are not delivered
+func (b *Broker) Start() error {
+	var last models.Change
+	err := b.db.Select("id").Order("id DESC").Limit(1).Find(&last).Error
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		return err
+	}
+	b.lastId = last.ID
+
+	b.listener = pq.NewListener(b.connString, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			logger.Logger.Errorw("change listener failure", "event", event, "err", err.Error())
+		}
+	})
+	if err := b.listener.Listen(models.ChangesChannel); err != nil {
+		b.listener.Close()
+		return err
+	}
+
+	b.stop = make(chan struct{})
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		ticker := time.NewTicker(b.pollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-b.stop:
+				return
+			case <-b.listener.Notify:
+				// a nil notification follows a reconnect, the outbox is read in any case
+			case <-ticker.C:
+				go b.listener.Ping()
+			}
+			if _, err := b.Poll(); err != nil {
+				logger.Logger.Errorw("unable to read changes", "err", err.Error())
+			}
+		}
+	}()
+	return nil
+}
+
+// Stop closes the listener together with the subscriptions
+func (b *Broker) Stop() {
+	close(b.stop)
+	b.wg.Wait()
+	b.listener.Close()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for s := range b.subscriptions {
+		b.drop(s, nil)
+	}
+}
+
+// Subscribe returns a subscription to the changes match accepts
+func (b *Broker) Subscribe(match func(*models.Change) bool) *Subscription {
+	return b.SubscribeUntil(match, nil)
+}
+
+// SubscribeUntil returns a subscription to the changes match accepts, closed
+// right after the first of them until accepts. Both are called with the broker
+// locked, they should not block
+func (b *Broker) SubscribeUntil(match, until func(*models.Change) bool) *Subscription {
+	changes := make(chan *models.Change, SubscriptionBuffer)
+	s := &Subscription{Changes: changes, changes: changes, match: match, until: until, broker: b}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscriptions[s] = struct{}{}
+	return s
+}
+
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.drop(s, nil)
+}
+
+// Err tells why the broker closed the subscription, either SlowSubscriberError
+// or EndedError. It is nil while the subscription is open or when the subscriber closed it
+func (s *Subscription) Err() error {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	return s.err
+}
+
+// drop removes the subscription, b.mu should be held
+func (b *Broker) drop(s *Subscription, err error) {
+	if _, ok := b.subscriptions[s]; !ok {
+		return
+	}
+	delete(b.subscriptions, s)
+	s.err = err
+	close(s.changes)
+}
+
+// Poll delivers the changes made since the last poll and returns how many were read
+func (b *Broker) Poll() (int, error) {
+	read := 0
+	for {
+		changes := make([]*models.Change, 0, batchSize)
+		err := b.db.Where("id > ?", b.lastId).Order("id").Limit(batchSize).Find(&changes).Error
+		if err != nil {
+			return read, err
+		}
+		read += len(changes)
+		b.publish(changes)
+		if len(changes) < batchSize {
+			return read, nil
+		}
+	}
+}
+
+func (b *Broker) publish(changes []*models.Change) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, change := range changes {
+		b.lastId = change.ID
+		for s := range b.subscriptions {
+			if !s.match(change) {
+				continue
+			}
+			select {
+			case s.changes <- change:
+				if s.until != nil && s.until(change) {
+					b.drop(s, EndedError)
+				}
+			default:
+				// the subscriber resumes from the last change it got once it reconnects
+				logger.Logger.Infow("dropping slow subscription", "change_id", change.ID)
+				b.drop(s, SlowSubscriberError)
+			}
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package live
+
+import (
+	"calendar_service/src/config"
+	"calendar_service/src/models"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+	"time"
+)
+
+var (
+	db         *gorm.DB
+	connString string
+)
+
+func TestMain(m *testing.M) {
+	var err error
+	err = godotenv.Load("../../.env.test")
+	if err != nil {
+		fmt.Println("unable to load test env")
+		os.Exit(1)
+	}
+	if err := config.Load(); err != nil {
+		fmt.Println("unable to load config", err)
+		os.Exit(1)
+	}
+	db, err = models.InitDbConnection(
+		config.Config.CalendarDb.Host,
+		config.Config.CalendarDb.Port,
+		config.Config.CalendarDb.User,
+		config.Config.CalendarDb.Password,
+		config.Config.CalendarDb.DbName,
+		config.Config.CalendarDb.SslMode,
+		config.Config.CalendarDb.MaxOpenConnections,
+		config.Config.CalendarDb.MaxIdleConnections,
+		config.Config.CalendarDb.ConnectionMaxLifetime)
+	if err != nil {
+		fmt.Println("unable to connect to db", err)
+		os.Exit(1)
+	}
+	connString = models.ConnectString(
+		config.Config.CalendarDb.Host,
+		config.Config.CalendarDb.Port,
+		config.Config.CalendarDb.User,
+		config.Config.CalendarDb.Password,
+		config.Config.CalendarDb.DbName,
+		config.Config.CalendarDb.SslMode)
+	models.RecreateTables(db)
+	models.InitIndexes(db)
+	os.Exit(m.Run())
+}
+
+func ofCalendar(calendarId string) func(*models.Change) bool {
+	return func(change *models.Change) bool {
+		for _, id := range change.CalendarIds {
+			if id == calendarId {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func TestBroker_Poll(t *testing.T) {
+	err := models.MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(db)
+
+	broker := NewBroker(db, connString, time.Minute)
+	subscription := broker.Subscribe(ofCalendar(models.KnownCalendarId))
+	other := broker.Subscribe(ofCalendar("a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"))
+
+	start := time.Date(2020, 2, 3, 10, 0, 0, 0, time.UTC)
+	appt := &models.Appointment{Subject: "Broker review", CalendarId: models.KnownCalendarId, Start: start, End: start.Add(time.Hour)}
+	if err := appt.Create(db); err != nil {
+		t.Fatal("unable to create appointment", err)
+	}
+	read, err := broker.Poll()
+	assert.Nil(t, err)
+	assert.True(t, read > 0)
+
+	select {
+	case change := <-subscription.Changes:
+		assert.Equal(t, models.EventAppointmentCreated, change.Event)
+		assert.Equal(t, appt.ID, change.EntityId)
+	default:
+		t.Error("change not delivered")
+	}
+	assert.Len(t, other.Changes, 0)
+
+	// changes are delivered once
+	read, err = broker.Poll()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, read)
+
+	subscription.Close()
+	_, open := <-subscription.Changes
+	assert.False(t, open)
+	other.Close()
+}
+
+func TestBroker_DropsSlowSubscription(t *testing.T) {
+	err := models.MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(db)
+
+	broker := NewBroker(db, connString, time.Minute)
+	subscription := broker.Subscribe(ofCalendar(models.KnownCalendarId))
+	for i := 0; i <= SubscriptionBuffer; i++ {
+		broker.publish([]*models.Change{{ID: int64(i + 1), CalendarIds: []string{models.KnownCalendarId}}})
+	}
+	received := 0
+	for range subscription.Changes {
+		received++
+	}
+	assert.Equal(t, SubscriptionBuffer, received)
+	assert.Equal(t, SlowSubscriberError, subscription.Err())
+	// closing a dropped subscription is harmless
+	subscription.Close()
+}
+
+func TestBroker_SubscribeUntil(t *testing.T) {
+	broker := NewBroker(db, connString, time.Minute)
+	subscription := broker.SubscribeUntil(ofCalendar(models.KnownCalendarId), func(change *models.Change) bool {
+		return change.Event == models.EventSharesChanged
+	})
+	broker.publish([]*models.Change{
+		{ID: 1, Event: models.EventAppointmentCreated, CalendarIds: []string{models.KnownCalendarId}},
+		{ID: 2, Event: models.EventSharesChanged, CalendarIds: []string{models.KnownCalendarId}},
+		{ID: 3, Event: models.EventAppointmentCreated, CalendarIds: []string{models.KnownCalendarId}},
+	})
+	received := make([]int64, 0)
+	for change := range subscription.Changes {
+		received = append(received, change.ID)
+	}
+	// the change the subscription ends with is delivered
+	assert.Equal(t, []int64{1, 2}, received)
+	assert.Equal(t, EndedError, subscription.Err())
+}
+
+func TestBroker_Start(t *testing.T) {
+	err := models.MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(db)
+
+	broker := NewBroker(db, connString, time.Minute)
+	if err := broker.Start(); err != nil {
+		t.Fatal("unable to start broker", err)
+	}
+	defer broker.Stop()
+	subscription := broker.Subscribe(ofCalendar(models.KnownCalendarId))
+
+	// another instance of the service makes the change, the notification wakes the broker up
+	start := time.Date(2020, 2, 3, 10, 0, 0, 0, time.UTC)
+	appt := &models.Appointment{Subject: "Notified", CalendarId: models.KnownCalendarId, Start: start, End: start.Add(time.Hour)}
+	if err := appt.Create(db); err != nil {
+		t.Fatal("unable to create appointment", err)
+	}
+	select {
+	case change := <-subscription.Changes:
+		assert.Equal(t, appt.ID, change.EntityId)
+	case <-time.After(5 * time.Second):
+		t.Error("change not delivered")
+	}
+}
@@ -19,6 +19,18 @@ func main() {
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
 	r := app.InitApp()
+	broker := app.InitBroker()
+	if err := broker.Start(); err != nil {
+		panic(err)
+	}
+	scheduler := app.InitScheduler()
+	if scheduler != nil {
+		scheduler.Start()
+	}
+	dispatcher := app.InitDispatcher()
+	if dispatcher != nil {
+		dispatcher.Start()
+	}
 
 	logger.Logger.Infof("start listening on port %s", config.Config.Port)
 	go func() {
@@ -29,5 +41,12 @@ func main() {
 
 	<-done
 	logger.Logger.Info("shutting down gracefully")
+	broker.Stop()
+	if scheduler != nil {
+		scheduler.Stop()
+	}
+	if dispatcher != nil {
+		dispatcher.Stop()
+	}
 	logger.Logger.Sync()
 }
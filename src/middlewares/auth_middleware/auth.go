@@ -0,0 +1,116 @@
+package auth_middleware
+
+import (
+	"calendar_service/src/auth"
+	"calendar_service/src/controllers"
+	"calendar_service/src/logger"
+	"calendar_service/src/services"
+	"github.com/gorilla/websocket"
+	"net/http"
+	"strings"
+)
+
+// publicPaths are served without a token
+var publicPaths = map[string]bool{
+	"/":           true,
+	"/auth/token": true,
+}
+
+// isPublic tells whether the request is served without a token. Users
+// are created without one when registration is open
+func isPublic(r *http.Request) bool {
+	if r.Method == http.MethodPost && r.URL.Path == "/user" && auth.Registration.Open {
+		return true
+	}
+	return publicPaths[r.URL.Path]
+}
+
+// isCalDAV tells whether the request is made to the caldav endpoint, which
+// accepts app passwords over basic auth besides bearer tokens
+func isCalDAV(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/caldav/") || r.URL.Path == "/.well-known/caldav"
+}
+
+// queryTokenParam carries the token of clients that can not set headers, like EventSource
+const queryTokenParam = "access_token"
+
+// acceptsQueryToken tells whether the request may pass a short lived token in the query
+// instead of the Authorization header, which browsers can not set on event streams and websockets
+func acceptsQueryToken(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+	return isSocket(r) || (strings.HasPrefix(r.URL.Path, "/calendar/") && strings.HasSuffix(r.URL.Path, "/events/stream"))
+}
+
+func isSocket(r *http.Request) bool {
+	return r.URL.Path == "/events/ws"
+}
+
+// protocolToken returns the token a websocket client offered as a subprotocol
+func protocolToken(r *http.Request) string {
+	if r.Header.Get("Authorization") != "" || !isSocket(r) {
+		return ""
+	}
+	for _, protocol := range websocket.Subprotocols(r) {
+		if strings.HasPrefix(protocol, controllers.SocketTokenProtocol) {
+			return strings.TrimPrefix(protocol, controllers.SocketTokenProtocol)
+		}
+	}
+	return ""
+}
+
+// queryToken takes the token out of the query of the requests accepting one, so
+// that it is neither logged nor seen by the handlers. The Authorization header wins
+func queryToken(r *http.Request) string {
+	if r.Header.Get("Authorization") != "" || !acceptsQueryToken(r) {
+		return ""
+	}
+	query := r.URL.Query()
+	token := query.Get(queryTokenParam)
+	if token == "" {
+		return ""
+	}
+	query.Del(queryTokenParam)
+	r.URL.RawQuery = query.Encode()
+	r.RequestURI = r.URL.RequestURI()
+	return token
+}
+
+// AuthMw rejects requests without a valid bearer token, app password on caldav,
+// token offered as a websocket subprotocol or short lived token in the query
+// of event streams, and puts the id of the authenticated user into the request context
+func AuthMw(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isPublic(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		var userId string
+		var err error
+		if username, password, ok := r.BasicAuth(); ok && isCalDAV(r) {
+			userId, err = services.AppPasswordService.Authenticate(username, password)
+		} else if token := protocolToken(r); token != "" {
+			userId, err = auth.Tokens.Authenticate(token)
+		} else if token := queryToken(r); token != "" {
+			userId, err = auth.Tokens.AuthenticateShortLived(token, auth.MaxQueryTokenTTL)
+		} else {
+			token := ""
+			if header := r.Header.Get("Authorization"); len(header) > 7 && strings.EqualFold(header[:7], "bearer ") {
+				token = strings.TrimSpace(header[7:])
+			}
+			userId, err = auth.Tokens.Authenticate(token)
+		}
+		if err != nil {
+			logger.Logger.Infow("unauthenticated request", "err", err.Error(), "path", r.URL.Path)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="calendar"`)
+			if isCalDAV(r) {
+				w.Header().Add("WWW-Authenticate", `Basic realm="calendar", charset="UTF-8"`)
+			}
+			apiErr := controllers.NewApiError("unauthorized", err.Error(), http.StatusUnauthorized)
+			controllers.RespondError(w, apiErr)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(auth.WithUserId(r.Context(), userId)))
+	})
+}
@@ -5,6 +5,8 @@ import (
 	"net/http"
 )
 
+// LoggingMw logs the path of incoming requests, leaving out the query
+// as it may carry an access token
 func LoggingMw(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		logger.Logger.Infow("incoming request", "method", r.Method, "path", r.URL.Path)
@@ -0,0 +1,108 @@
+package models
+
+import (
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"sort"
+	"time"
+)
+
+type AgendaRole string
+
+const (
+	RoleOwner    AgendaRole = "owner"
+	RoleAttendee AgendaRole = "attendee"
+)
+
+// AgendaEntry is an occurrence in the agenda of a user. Role tells whether the
+// user owns the calendar of the appointment or attends it
+type AgendaEntry struct {
+	*Occurrence
+	CalendarName string     `json:"calendar_name"`
+	Role         AgendaRole `json:"role"`
+}
+
+type Agenda struct {
+	UserId  string         `json:"user_id"`
+	From    time.Time      `json:"from"`
+	To      time.Time      `json:"to"`
+	Entries []*AgendaEntry `json:"entries"`
+
+	location *time.Location
+}
+
+// Location is the time zone of the user the agenda belongs to
+func (a *Agenda) Location() *time.Location {
+	if a.location == nil {
+		return time.UTC
+	}
+	return a.location
+}
+
+// Agenda merges the occurrences within [from, to) of the appointments of the
+// user calendars and of the appointments the user attends, ordered by start
+func (u *User) Agenda(from, to time.Time, db *gorm.DB) (*Agenda, error) {
+	if u.EmptyID() {
+		return nil, EmptyIdError
+	}
+	if !from.Before(to) {
+		return nil, NewModeError("time range start should be before its end")
+	}
+	if to.Sub(from) > MaxFreeBusyRange {
+		return nil, NewModeError(fmt.Sprintf("time range can not be longer than %d days", MaxFreeBusyRange/(24*time.Hour)))
+	}
+	dbState := db.Find(u, "id = ?", u.ID)
+	if dbState.Error != nil {
+		return nil, dbState.Error
+	}
+	if dbState.RowsAffected == 0 {
+		return nil, NewModeError(fmt.Sprintf("user with id=%s not present in the db", u.ID))
+	}
+
+	appts, err := UserAppointments(u.ID, from, to, db)
+	if err != nil {
+		return nil, err
+	}
+	calendarIds := make([]string, 0, len(appts))
+	for _, appt := range appts {
+		calendarIds = append(calendarIds, appt.CalendarId)
+	}
+	cals := make([]*Calendar, 0)
+	if len(calendarIds) > 0 {
+		if err := db.Where("id IN (?)", calendarIds).Find(&cals).Error; err != nil {
+			return nil, err
+		}
+	}
+	calendars := make(map[string]*Calendar, len(cals))
+	for _, cal := range cals {
+		calendars[cal.ID] = cal
+	}
+
+	agenda := &Agenda{UserId: u.ID, From: from, To: to, Entries: make([]*AgendaEntry, 0), location: u.Location()}
+	for _, appt := range appts {
+		occurrences, err := appt.Occurrences(from, to)
+		if err != nil {
+			return nil, err
+		}
+		entry := AgendaEntry{Role: RoleAttendee}
+		if cal, ok := calendars[appt.CalendarId]; ok {
+			entry.CalendarName = cal.Name
+			if cal.UserId == u.ID {
+				entry.Role = RoleOwner
+			}
+		}
+		for _, occ := range occurrences {
+			e := entry
+			e.Occurrence = occ
+			agenda.Entries = append(agenda.Entries, &e)
+		}
+	}
+	sort.Slice(agenda.Entries, func(i, j int) bool {
+		a, b := agenda.Entries[i], agenda.Entries[j]
+		if !a.Start.Equal(b.Start) {
+			return a.Start.Before(b.Start)
+		}
+		return a.AppointmentId < b.AppointmentId
+	})
+	return agenda, nil
+}
@@ -0,0 +1,245 @@
+package models
+
+import (
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"time"
+)
+
+const (
+	// MaxAlarmOffset is the longest time before an occurrence an alarm can fire at
+	MaxAlarmOffset = 4 * 7 * 24 * 60
+	// alarmHorizon limits how far ahead the next occurrence of a series is looked for
+	alarmHorizon = 400 * 24 * time.Hour
+	// missedOccurrenceGrace is how long after its start an occurrence is still reminded of
+	missedOccurrenceGrace = time.Hour
+)
+
+// Alarm reminds a user of an appointment. Relative alarms fire OffsetMinutes
+// before every occurrence, absolute ones fire once At. NextFireAt is nil
+// when the alarm has nothing left to fire for
+type Alarm struct {
+	Base
+	AppointmentId string     `gorm:"type:uuid;not null" json:"appointment_id"`
+	UserId        string     `gorm:"type:uuid;not null" json:"user_id"`
+	OffsetMinutes *int       `json:"offset_minutes,omitempty"`
+	At            *time.Time `json:"at,omitempty"`
+	NextFireAt    *time.Time `gorm:"index" json:"next_fire_at"`
+	// NextOccurrence is the start of the occurrence NextFireAt reminds of
+	NextOccurrence *time.Time `json:"next_occurrence"`
+	LastFiredAt    *time.Time `json:"last_fired_at"`
+	LastOccurrence *time.Time `json:"-"`
+	// LockedUntil keeps other scheduler instances off an alarm being fired
+	LockedUntil *time.Time `json:"-"`
+}
+
+// alarmReadable holds for the alarms whose user can read their appointment, joined
+// as appointments: the owner of its calendar, the users the calendar is shared
+// with at the read level at least and its attendees. It expects the reader levels as its argument
+const alarmReadable = `(EXISTS (SELECT 1 FROM calendars
+		WHERE calendars.id = appointments.calendar_id AND calendars.user_id = alarms.user_id)
+	OR EXISTS (SELECT 1 FROM calendar_shares
+		WHERE calendar_shares.calendar_id = appointments.calendar_id AND calendar_shares.user_id = alarms.user_id
+		AND calendar_shares.level IN (?))
+	OR EXISTS (SELECT 1 FROM users_appointments
+		WHERE users_appointments.appointment_id = appointments.id AND users_appointments.user_id = alarms.user_id))`
+
+// Reminder is what a notifier receives when an alarm fires
+type Reminder struct {
+	Alarm           *Alarm       `json:"alarm"`
+	Appointment     *Appointment `json:"appointment"`
+	User            *User        `json:"user"`
+	OccurrenceStart time.Time    `json:"occurrence_start"`
+}
+
+func (al *Alarm) Validate() error {
+	if IdIsEmpty(al.AppointmentId) {
+		return NewModeError("alarm appointment_id can not be empty")
+	}
+	if IdIsEmpty(al.UserId) {
+		return NewModeError("alarm user_id can not be empty")
+	}
+	if (al.OffsetMinutes == nil) == (al.At == nil) {
+		return NewModeError("exactly one of offset_minutes and at should be set")
+	}
+	if al.OffsetMinutes != nil && (*al.OffsetMinutes < 0 || *al.OffsetMinutes > MaxAlarmOffset) {
+		return NewModeError(fmt.Sprintf("offset_minutes should be between 0 and %d", MaxAlarmOffset))
+	}
+	if al.At != nil && al.At.Before(time.Now()) {
+		return NewModeError("alarm time has already passed")
+	}
+	return nil
+}
+
+// schedule sets the next time the alarm fires at. Relative alarms fire for the
+// first occurrence after the last one fired for whose alarm time has not passed yet
+func (al *Alarm) schedule(appt *Appointment, now time.Time) error {
+	al.NextFireAt, al.NextOccurrence = nil, nil
+	if al.At != nil {
+		if al.LastFiredAt == nil {
+			at := *al.At
+			al.NextFireAt = &at
+		}
+		return nil
+	}
+
+	offset := time.Duration(*al.OffsetMinutes) * time.Minute
+	from := now.Add(offset)
+	occurrences, err := appt.Occurrences(from, from.Add(alarmHorizon))
+	if err != nil {
+		return err
+	}
+	for _, occ := range occurrences {
+		if occ.Start.Before(from) {
+			continue
+		}
+		if al.LastOccurrence != nil && !occ.Start.After(*al.LastOccurrence) {
+			continue
+		}
+		start := occ.Start
+		fireAt := start.Add(-offset)
+		al.NextFireAt, al.NextOccurrence = &fireAt, &start
+		return nil
+	}
+	return nil
+}
+
+// Create schedules the alarm for a user with access to the appointment
+func (al *Alarm) Create(db *gorm.DB) error {
+	if err := al.Validate(); err != nil {
+		return err
+	}
+	now := time.Now()
+	appt := &Appointment{Base: Base{ID: al.AppointmentId}}
+	if err := appt.Read(db); err != nil {
+		return err
+	}
+	al.LastFiredAt, al.LastOccurrence, al.LockedUntil = nil, nil, nil
+	if err := al.schedule(appt, now); err != nil {
+		return err
+	}
+	return db.Create(al).Error
+}
+
+// Delete removes the alarm of the user from the appointment
+func (al *Alarm) Delete(db *gorm.DB) error {
+	if al.EmptyID() {
+		return EmptyIdError
+	}
+	dbState := db.Where("id = ? AND appointment_id = ? AND user_id = ?", al.ID, al.AppointmentId, al.UserId).Delete(&Alarm{})
+	if dbState.Error != nil {
+		return dbState.Error
+	}
+	if dbState.RowsAffected == 0 {
+		return NewModeError(fmt.Sprintf("alarm with id=%s not present in the db", al.ID))
+	}
+	return nil
+}
+
+// deleteUnreadableAlarms removes the alarms matching the condition on alarms
+// and appointments whose user can no longer read their appointment
+func deleteUnreadableAlarms(tx *gorm.DB, where string, args ...interface{}) error {
+	args = append(args, readerLevels)
+	return tx.Exec(`DELETE FROM alarms USING appointments
+		WHERE appointments.id = alarms.appointment_id AND `+where+` AND NOT `+alarmReadable, args...).Error
+}
+
+// Readable tells whether the user of the alarm can still read its appointment
+func (al *Alarm) Readable(db *gorm.DB) (bool, error) {
+	var count int
+	err := db.Table("alarms").
+		Joins("JOIN appointments ON appointments.id = alarms.appointment_id").
+		Where("alarms.id = ? AND "+alarmReadable, al.ID, readerLevels).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// AlarmsOf lists the alarms the user set on the appointment
+func AlarmsOf(apptId, userId string, db *gorm.DB) ([]*Alarm, error) {
+	alarms := make([]*Alarm, 0)
+	err := db.Where("appointment_id = ? AND user_id = ?", apptId, userId).Order("created_at").Find(&alarms).Error
+	return alarms, err
+}
+
+// RescheduleAlarms follows changes of the times of the appointment
+func RescheduleAlarms(apptId string, db *gorm.DB) error {
+	alarms := make([]*Alarm, 0)
+	if err := db.Where("appointment_id = ? AND offset_minutes IS NOT NULL", apptId).Find(&alarms).Error; err != nil {
+		return err
+	}
+	if len(alarms) == 0 {
+		return nil
+	}
+	appt := &Appointment{Base: Base{ID: apptId}}
+	if err := appt.Read(db); err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, al := range alarms {
+		if err := al.schedule(appt, now); err != nil {
+			return err
+		}
+		err := db.Model(al).Updates(map[string]interface{}{
+			"next_fire_at":    al.NextFireAt,
+			"next_occurrence": al.NextOccurrence,
+		}).Error
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ClaimDueAlarms locks up to limit alarms due at now until lockedUntil.
+// Alarms locked by another scheduler are skipped, so are the ones whose lock has not expired
+func ClaimDueAlarms(now, lockedUntil time.Time, limit int, db *gorm.DB) ([]*Alarm, error) {
+	alarms := make([]*Alarm, 0)
+	dbState := db.Raw(`UPDATE alarms SET locked_until = ?
+		WHERE id IN (
+			SELECT id FROM alarms
+			WHERE next_fire_at <= ? AND (locked_until IS NULL OR locked_until <= ?)
+			ORDER BY next_fire_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED)
+		RETURNING *`, lockedUntil, now, now, limit).Scan(&alarms)
+	return alarms, dbState.Error
+}
+
+// Fired records that the alarm fired at now and schedules the next one
+func (al *Alarm) Fired(appt *Appointment, now time.Time, db *gorm.DB) error {
+	al.LastFiredAt = &now
+	al.LastOccurrence = al.NextOccurrence
+	al.LockedUntil = nil
+	if err := al.schedule(appt, now); err != nil {
+		return err
+	}
+	return db.Model(al).Updates(map[string]interface{}{
+		"last_fired_at":   al.LastFiredAt,
+		"last_occurrence": al.LastOccurrence,
+		"next_fire_at":    al.NextFireAt,
+		"next_occurrence": al.NextOccurrence,
+		"locked_until":    nil,
+	}).Error
+}
+
+// Stale tells whether the occurrence the alarm reminds of started too long
+// before now for the reminder to be of use, e.g. after the service was down
+func (al *Alarm) Stale(now time.Time) bool {
+	return al.NextOccurrence != nil && now.After(al.NextOccurrence.Add(missedOccurrenceGrace))
+}
+
+// Retry unlocks the alarm at retryAt, when it is claimed again
+func (al *Alarm) Retry(retryAt time.Time, db *gorm.DB) error {
+	al.LockedUntil = &retryAt
+	return db.Model(al).Update("locked_until", retryAt).Error
+}
+
+// MarkStale keeps the alarm from firing again, its user lost access to the appointment
+func (al *Alarm) MarkStale(db *gorm.DB) error {
+	al.NextFireAt, al.NextOccurrence, al.LockedUntil = nil, nil, nil
+	return db.Model(al).Updates(map[string]interface{}{
+		"next_fire_at":    nil,
+		"next_occurrence": nil,
+		"locked_until":    nil,
+	}).Error
+}
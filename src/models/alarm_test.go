@@ -0,0 +1,176 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestAlarm_Validate(t *testing.T) {
+	offset := 15
+	negative := -5
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+	tests := []struct {
+		name    string
+		alarm   Alarm
+		wantErr bool
+	}{
+		{name: "relative", alarm: Alarm{AppointmentId: AppointmentFixedTimeId, UserId: KnownUserId, OffsetMinutes: &offset}},
+		{name: "absolute", alarm: Alarm{AppointmentId: AppointmentFixedTimeId, UserId: KnownUserId, At: &future}},
+		{name: "both", alarm: Alarm{AppointmentId: AppointmentFixedTimeId, UserId: KnownUserId, OffsetMinutes: &offset, At: &future}, wantErr: true},
+		{name: "none", alarm: Alarm{AppointmentId: AppointmentFixedTimeId, UserId: KnownUserId}, wantErr: true},
+		{name: "negative offset", alarm: Alarm{AppointmentId: AppointmentFixedTimeId, UserId: KnownUserId, OffsetMinutes: &negative}, wantErr: true},
+		{name: "passed", alarm: Alarm{AppointmentId: AppointmentFixedTimeId, UserId: KnownUserId, At: &past}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.alarm.Validate()
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestAlarm_schedule(t *testing.T) {
+	appt := &Appointment{
+		Base:       Base{ID: AppointmentRecurringId},
+		Start:      time.Date(2020, 1, 6, 9, 0, 0, 0, time.UTC),
+		End:        time.Date(2020, 1, 6, 9, 30, 0, 0, time.UTC),
+		Recurrence: "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=3",
+	}
+	offset := 15
+	alarm := &Alarm{OffsetMinutes: &offset}
+
+	assert.Nil(t, alarm.schedule(appt, time.Date(2020, 1, 6, 8, 0, 0, 0, time.UTC)))
+	assert.Equal(t, time.Date(2020, 1, 6, 8, 45, 0, 0, time.UTC), alarm.NextFireAt.UTC())
+	assert.Equal(t, time.Date(2020, 1, 6, 9, 0, 0, 0, time.UTC), alarm.NextOccurrence.UTC())
+
+	// once fired the alarm moves on to the next occurrence
+	alarm.LastOccurrence = alarm.NextOccurrence
+	assert.Nil(t, alarm.schedule(appt, time.Date(2020, 1, 6, 8, 45, 0, 0, time.UTC)))
+	assert.Equal(t, time.Date(2020, 1, 8, 8, 45, 0, 0, time.UTC), alarm.NextFireAt.UTC())
+
+	// occurrences whose alarm time passed are skipped
+	alarm.LastOccurrence = nil
+	assert.Nil(t, alarm.schedule(appt, time.Date(2020, 1, 8, 8, 50, 0, 0, time.UTC)))
+	assert.Equal(t, time.Date(2020, 1, 13, 9, 0, 0, 0, time.UTC), alarm.NextOccurrence.UTC())
+
+	// nothing left after the last occurrence
+	assert.Nil(t, alarm.schedule(appt, time.Date(2020, 1, 14, 0, 0, 0, 0, time.UTC)))
+	assert.Nil(t, alarm.NextFireAt)
+	assert.Nil(t, alarm.NextOccurrence)
+}
+
+func TestClaimDueAlarms(t *testing.T) {
+	err := MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer DropAllData(db)
+
+	start := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+	appt := &Appointment{Subject: "Planning", CalendarId: KnownCalendarId, Start: start, End: start.Add(time.Hour)}
+	if err := appt.Create(db); err != nil {
+		t.Fatal("unable to create appointment", err)
+	}
+	offset := 30
+	alarm := &Alarm{AppointmentId: appt.ID, UserId: KnownUserId, OffsetMinutes: &offset}
+	assert.Nil(t, alarm.Create(db))
+	assert.True(t, start.Add(-30*time.Minute).Equal(*alarm.NextFireAt))
+
+	claimed, err := ClaimDueAlarms(time.Now(), time.Now().Add(time.Minute), 10, db)
+	assert.Nil(t, err)
+	assert.Len(t, claimed, 0)
+
+	fireAt := start.Add(-29 * time.Minute)
+	claimed, err = ClaimDueAlarms(fireAt, fireAt.Add(time.Minute), 10, db)
+	assert.Nil(t, err)
+	assert.Len(t, claimed, 1)
+	assert.Equal(t, alarm.ID, claimed[0].ID)
+
+	// a claimed alarm is locked
+	claimed2, err := ClaimDueAlarms(fireAt, fireAt.Add(time.Minute), 10, db)
+	assert.Nil(t, err)
+	assert.Len(t, claimed2, 0)
+
+	assert.Nil(t, appt.Read(db))
+	assert.Nil(t, claimed[0].Fired(appt, fireAt, db))
+	assert.Nil(t, claimed[0].NextFireAt)
+	alarms, err := AlarmsOf(appt.ID, KnownUserId, db)
+	assert.Nil(t, err)
+	assert.Len(t, alarms, 1)
+	assert.Nil(t, alarms[0].NextFireAt)
+	assert.NotNil(t, alarms[0].LastFiredAt)
+
+	// moving the appointment reschedules its alarms
+	appt.Start = start.Add(24 * time.Hour)
+	appt.End = appt.Start.Add(time.Hour)
+	assert.Nil(t, appt.Update(db))
+	assert.Nil(t, RescheduleAlarms(appt.ID, db))
+	alarms, err = AlarmsOf(appt.ID, KnownUserId, db)
+	assert.Nil(t, err)
+	assert.True(t, appt.Start.Add(-30*time.Minute).Equal(*alarms[0].NextFireAt))
+}
+
+func TestAlarm_lostAccess(t *testing.T) {
+	err := MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer DropAllData(db)
+
+	share := &CalendarShare{CalendarId: KnownCalendarId, UserId: SecondKnownUserId, Level: ShareRead}
+	if err := share.Save(db); err != nil {
+		t.Fatal("unable to share calendar", err)
+	}
+	at := time.Now().Add(time.Hour)
+	owners := &Alarm{AppointmentId: AppointmentWholeDayId, UserId: KnownUserId, At: &at}
+	shared := &Alarm{AppointmentId: AppointmentWholeDayId, UserId: SecondKnownUserId, At: &at}
+	attendees := &Alarm{AppointmentId: AppointmentWholeDayId, UserId: ThirdKnownUserId, At: &at}
+	for _, alarm := range []*Alarm{owners, shared, attendees} {
+		if err := alarm.Create(db); err != nil {
+			t.Fatal("unable to create alarm", err)
+		}
+		readable, err := alarm.Readable(db)
+		assert.Nil(t, err)
+		assert.True(t, readable)
+	}
+
+	// removed attendees lose their alarms
+	appt := &Appointment{Base: Base{ID: AppointmentWholeDayId}}
+	assert.Nil(t, appt.RemoveAttendees([]string{ThirdKnownUserId}, db))
+	alarms, err := AlarmsOf(AppointmentWholeDayId, ThirdKnownUserId, db)
+	assert.Nil(t, err)
+	assert.Len(t, alarms, 0)
+
+	// so do users the calendar is no longer shared with at the read level
+	share.Level = ShareFreeBusy
+	assert.Nil(t, share.Save(db))
+	alarms, err = AlarmsOf(AppointmentWholeDayId, SecondKnownUserId, db)
+	assert.Nil(t, err)
+	assert.Len(t, alarms, 0)
+
+	alarms, err = AlarmsOf(AppointmentWholeDayId, KnownUserId, db)
+	assert.Nil(t, err)
+	assert.Len(t, alarms, 1)
+
+	// an alarm whose user lost access some other way is not readable
+	if err := db.Exec("DELETE FROM calendar_shares").Error; err != nil {
+		t.Fatal("unable to delete shares", err)
+	}
+	stale := &Alarm{AppointmentId: AppointmentWholeDayId, UserId: SecondKnownUserId, At: &at}
+	if err := db.Create(stale).Error; err != nil {
+		t.Fatal("unable to create alarm", err)
+	}
+	readable, err := stale.Readable(db)
+	assert.Nil(t, err)
+	assert.False(t, readable)
+	assert.Nil(t, stale.MarkStale(db))
+	alarms, err = AlarmsOf(AppointmentWholeDayId, SecondKnownUserId, db)
+	assert.Nil(t, err)
+	assert.Nil(t, alarms[0].NextFireAt)
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	"strings"
+	"time"
+)
+
+var InvalidAppPasswordError = NewModeError("invalid username or app password")
+
+// AppPassword lets its user sign in with basic auth, from the clients which
+// can not send bearer tokens. Only the hash of the password is stored, the
+// password is generated and shown on creation only
+type AppPassword struct {
+	Base
+	UserId     string     `gorm:"type:uuid;not null" json:"user_id"`
+	Name       string     `gorm:"not null" json:"name"`
+	Hash       string     `gorm:"not null" json:"-"`
+	Password   string     `gorm:"-" json:"password,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+func hashAppPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+func (p *AppPassword) Validate() error {
+	if IdIsEmpty(p.UserId) {
+		return NewModeError("app password user_id can not be empty")
+	}
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return NewModeError("app password name can not be empty")
+	}
+	return nil
+}
+
+func (p *AppPassword) Create(db *gorm.DB) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	password := make([]byte, 32)
+	if _, err := rand.Read(password); err != nil {
+		return err
+	}
+	p.Password = hex.EncodeToString(password)
+	p.Hash = hashAppPassword(p.Password)
+	return db.Create(p).Error
+}
+
+// Delete revokes the app password of the user
+func (p *AppPassword) Delete(db *gorm.DB) error {
+	if p.EmptyID() {
+		return EmptyIdError
+	}
+	dbState := db.Where("id = ? AND user_id = ?", p.ID, p.UserId).Delete(&AppPassword{})
+	if dbState.Error != nil {
+		return dbState.Error
+	}
+	if dbState.RowsAffected == 0 {
+		return NewModeError(fmt.Sprintf("app password with id=%s not present in the db", p.ID))
+	}
+	return nil
+}
+
+// AppPasswordsOf lists the app passwords of the user
+func AppPasswordsOf(userId string, db *gorm.DB) ([]*AppPassword, error) {
+	passwords := make([]*AppPassword, 0)
+	err := db.Where("user_id = ?", userId).Order("created_at").Find(&passwords).Error
+	return passwords, err
+}
+
+// AuthenticateAppPassword returns the id of the user signing in with the
+// app password, username being either the id or the email of the user
+func AuthenticateAppPassword(username, password string, db *gorm.DB) (string, error) {
+	username = strings.TrimSpace(username)
+	if username == "" || password == "" {
+		return "", InvalidAppPasswordError
+	}
+	query := db.Table("users").Select("id")
+	if _, err := uuid.Parse(username); err == nil {
+		query = query.Where("id = ?", username)
+	} else {
+		query = query.Where("lower(email) = lower(?)", username)
+	}
+	var appPassword AppPassword
+	err := db.Where("user_id IN (?) AND hash = ?", query.QueryExpr(), hashAppPassword(password)).
+		First(&appPassword).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return "", InvalidAppPasswordError
+	}
+	if err != nil {
+		return "", err
+	}
+	db.Model(&appPassword).UpdateColumn("last_used_at", time.Now())
+	return appPassword.UserId, nil
+}
@@ -4,25 +4,62 @@ import (
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/jinzhu/gorm"
+	"sort"
 	"strings"
 	"time"
 )
 
 type Appointment struct {
 	Base
-	Subject     string    `gorm:"index;not null" json:"subject"`
-	Description string    `json:"description"`
-	WholeDay    bool      `json:"whole_day"`
-	Start       time.Time `json:"start"`
-	End         time.Time `json:"end"`
-	Attendees   []*User   `gorm:"many2many:users_appointments;" json:"attendees"`
-	CalendarId  string    `gorm:"type:uuid;not null;" json:"calendar_id"`
+	// Version is bumped by every change, updates and deletions setting it expect the stored appointment at that version
+	Version     int64                   `gorm:"not null;default:1" json:"version"`
+	Subject     string                  `gorm:"index;not null" json:"subject"`
+	Description string                  `json:"description"`
+	WholeDay    bool                    `json:"whole_day"`
+	Start       time.Time               `json:"start"`
+	End         time.Time               `json:"end"`
+	Recurrence  string                  `json:"recurrence"`
+	TimeZone    string                  `json:"time_zone"`
+	Exceptions  []*AppointmentException `json:"exceptions"`
+	ParentId    *string                 `gorm:"type:uuid" json:"parent_id,omitempty"`
+	Conflicts   []*Conflict             `gorm:"-" json:"conflicts,omitempty"`
+	Attendees   []*User                 `gorm:"many2many:users_appointments;" json:"attendees"`
+	// ExternalAttendees are invited by email without being registered users
+	ExternalAttendees []*ExternalAttendee `json:"external_attendees"`
+	CalendarId        string              `gorm:"type:uuid;not null;" json:"calendar_id"`
+	// Uid is the iCalendar UID the appointment was imported or written over caldav with, its id is used when empty
+	Uid string `json:"uid,omitempty"`
+	// ObjectName is the name of the caldav object a client wrote the appointment to, its id is used when empty
+	ObjectName string `json:"-"`
+	// DeletedAt keeps deleted appointments as tombstones for the clients syncing their calendar
+	DeletedAt *time.Time `sql:"index" json:"-"`
+}
+
+// Occurrence is a single instance of an appointment. Non recurring
+// appointments have exactly one occurrence. RecurrenceId is the start
+// the occurrence originally had in the series
+type Occurrence struct {
+	AppointmentId string    `json:"appointment_id"`
+	CalendarId    string    `json:"calendar_id"`
+	RecurrenceId  time.Time `json:"recurrence_id"`
+	Subject       string    `json:"subject"`
+	Description   string    `json:"description"`
+	WholeDay      bool      `json:"whole_day"`
+	Start         time.Time `json:"start"`
+	End           time.Time `json:"end"`
 }
 
 func (a *Appointment) AfterFind() (err error) {
 	if a.Attendees == nil {
 		a.Attendees = []*User{}
 	}
+	if a.ExternalAttendees == nil {
+		a.ExternalAttendees = []*ExternalAttendee{}
+	}
+	if a.Exceptions == nil {
+		a.Exceptions = []*AppointmentException{}
+	}
+	a.localize()
 	return
 }
 
@@ -58,65 +95,388 @@ func (a *Appointment) Validate() error {
 	if IdIsEmpty(a.CalendarId) {
 		return NewModeError("appointment calendar_id can not be empty")
 	}
-	return a.validateTime()
+	a.TimeZone = strings.TrimSpace(a.TimeZone)
+	if _, err := LoadTimeZone(a.TimeZone); err != nil {
+		return err
+	}
+	a.localize()
+	if err := a.validateTime(); err != nil {
+		return err
+	}
+	for _, e := range a.ExternalAttendees {
+		if err := e.Validate(); err != nil {
+			return err
+		}
+	}
+	return a.validateRecurrence()
+}
+
+func (a *Appointment) validateRecurrence() error {
+	a.Recurrence = strings.TrimSpace(a.Recurrence)
+	if a.Recurrence == "" {
+		return nil
+	}
+	rule, err := ParseRecurrenceRule(a.Recurrence)
+	if err != nil {
+		return err
+	}
+	if !rule.Until.IsZero() && rule.Until.Before(a.Start) && !rule.untilDate {
+		return NewModeError("recurrence rule UNTIL should not be before appointment start")
+	}
+	a.Recurrence = rule.String()
+	return nil
+}
+
+func (a *Appointment) IsRecurring() bool {
+	return a.Recurrence != ""
+}
+
+// span returns the time interval an occurrence starting at start takes.
+// Whole day appointments take the entire day of their start
+func (a *Appointment) span(start time.Time) (time.Time, time.Time) {
+	if a.WholeDay {
+		dayStart := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, start.Location())
+		return dayStart, dayStart.AddDate(0, 0, 1)
+	}
+	return start, start.Add(a.End.Sub(a.Start))
+}
+
+func (a *Appointment) newOccurrence(start time.Time) *Occurrence {
+	occ := &Occurrence{
+		AppointmentId: a.ID,
+		CalendarId:    a.CalendarId,
+		RecurrenceId:  start,
+		Subject:       a.Subject,
+		Description:   a.Description,
+		WholeDay:      a.WholeDay,
+		Start:         start,
+	}
+	if !a.WholeDay {
+		occ.End = start.Add(a.End.Sub(a.Start))
+	}
+	return occ
+}
+
+// Occurrences returns the occurrences of the appointment overlapping [from, to)
+// with the exceptions of the series applied. Exceptions should be preloaded
+func (a *Appointment) Occurrences(from, to time.Time) ([]*Occurrence, error) {
+	if !from.Before(to) {
+		return nil, NewModeError("time range start should be before its end")
+	}
+	// exceptions preloaded along with a parent are not localized by AfterFind
+	a.localize()
+	starts := []time.Time{a.Start}
+	if a.IsRecurring() {
+		rule, err := ParseRecurrenceRule(a.Recurrence)
+		if err != nil {
+			return nil, err
+		}
+		// widen the lower bound so that occurrences starting before the range
+		// but still lasting within it are not lost
+		lookBehind := 48 * time.Hour
+		if !a.WholeDay {
+			lookBehind += a.End.Sub(a.Start)
+		}
+		starts = rule.Between(a.Start, from.Add(-lookBehind), to)
+	}
+
+	result := make([]*Occurrence, 0, len(starts))
+	for _, start := range starts {
+		if a.exceptionFor(start) != nil {
+			continue
+		}
+		spanStart, spanEnd := a.span(start)
+		if spanStart.Before(to) && spanEnd.After(from) {
+			result = append(result, a.newOccurrence(start))
+		}
+	}
+	for _, e := range a.Exceptions {
+		if e.Cancelled || !a.hasOccurrence(e.RecurrenceId) {
+			continue
+		}
+		spanStart, spanEnd := a.span(e.Start)
+		if !a.WholeDay {
+			spanEnd = e.End
+		}
+		if spanStart.Before(to) && spanEnd.After(from) {
+			result = append(result, e.occurrence(a))
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Start.Before(result[j].Start)
+	})
+	return result, nil
 }
 
 func (a *Appointment) Create(db *gorm.DB) error {
 	if err := a.Validate(); err != nil {
 		return err
 	}
-	return db.Create(a).Error
+	a.Version = 1
+	attendeeIds, err := a.attendeeIds(db)
+	if err != nil {
+		return err
+	}
+
+	tx := db.Begin()
+	if err := a.lockBookings(attendeeIds, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	// attendees are existing users, they should not be overwritten
+	if err := tx.Set("gorm:association_autoupdate", false).Create(a).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := a.checkConflicts(attendeeIds, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := recordChange(EntityAppointment, a.ID, ChangeCreate, nil, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
 }
 
+// Delete marks the appointment as deleted. It is left out of every read but its
+// sync, its time is freed for other bookings and its alarms are removed
 func (a *Appointment) Delete(db *gorm.DB) error {
 	if a.EmptyID() {
 		return EmptyIdError
 	}
-	dbState := db.Delete(a)
+	tx := db.Begin()
+	if err := checkVersion(EntityAppointment, a.ID, a.Version, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	before, err := snapshot(EntityAppointment, a.ID, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if before == nil {
+		tx.Rollback()
+		return NewModeError(fmt.Sprintf("appointment with id=%s not present in the db", a.ID))
+	}
+	if err := recordChange(EntityAppointment, a.ID, ChangeDelete, before, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Delete(a).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Exec(`UPDATE appointments SET during = NULL WHERE id = ?`, a.ID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("appointment_id = ?", a.ID).Delete(&Alarm{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// fields maps the columns of the appointment itself to their values, the empty ones included
+func (a *Appointment) fields() map[string]interface{} {
+	return map[string]interface{}{
+		"subject":     a.Subject,
+		"description": a.Description,
+		"whole_day":   a.WholeDay,
+		"start":       a.Start,
+		"end":         a.End,
+		"recurrence":  a.Recurrence,
+		"time_zone":   a.TimeZone,
+		"updated_at":  time.Now(),
+	}
+}
+
+// Update overwrites the fields of the appointment, its attendees and exceptions are left as they are
+func (a *Appointment) Update(db *gorm.DB) error {
+	if err := a.Validate(); err != nil {
+		return err
+	}
+	if a.EmptyID() {
+		return EmptyIdError
+	}
+	attendeeIds, err := a.attendeeIds(db)
+	if err != nil {
+		return err
+	}
+
+	tx := db.Begin()
+	if err := checkVersion(EntityAppointment, a.ID, a.Version, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := a.lockBookings(attendeeIds, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	before, err := snapshot(EntityAppointment, a.ID, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	fields := a.fields()
+	fields["calendar_id"] = a.CalendarId
+	// attendees and exceptions are left as they are
+	dbState := tx.Model(&Appointment{}).Set("gorm:association_autoupdate", false).
+		Where("id = ?", a.ID).Updates(fields)
 	if dbState.Error != nil {
+		tx.Rollback()
 		return dbState.Error
 	}
 	if dbState.RowsAffected == 0 {
+		tx.Rollback()
 		return NewModeError(fmt.Sprintf("appointment with id=%s not present in the db", a.ID))
 	}
+	// conflicts are checked against the stored appointment, exceptions included
+	stored := &Appointment{Base: Base{ID: a.ID}}
+	if err := tx.Preload("Exceptions").Find(stored, "id = ?", a.ID).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := stored.checkConflicts(attendeeIds, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	// moved to another calendar, the appointment may not be readable by its former readers anymore
+	if err := deleteUnreadableAlarms(tx, "alarms.appointment_id = ?", a.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := recordChange(EntityAppointment, a.ID, ChangeUpdate, before, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if a.Version, err = versionOf(EntityAppointment, a.ID, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+	a.Conflicts = stored.Conflicts
+	if a.Attendees == nil {
+		a.Attendees = []*User{}
+	}
+	if a.ExternalAttendees == nil {
+		a.ExternalAttendees = []*ExternalAttendee{}
+	}
 	return nil
 }
 
-func (a *Appointment) Update(db *gorm.DB) error {
+// Replace overwrites every field of the appointment, including the ones
+// left empty, together with its attendees and exceptions
+func (a *Appointment) Replace(db *gorm.DB) error {
 	if err := a.Validate(); err != nil {
 		return err
 	}
 	if a.EmptyID() {
 		return EmptyIdError
 	}
-	dbState := db.Model(&Appointment{}).Updates(a)
+
+	tx := db.Begin()
+	if err := checkVersion(EntityAppointment, a.ID, a.Version, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	before, err := snapshot(EntityAppointment, a.ID, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	dbState := tx.Model(&Appointment{}).Where("id = ?", a.ID).Updates(a.fields())
 	if dbState.Error != nil {
+		tx.Rollback()
 		return dbState.Error
 	}
 	if dbState.RowsAffected == 0 {
+		tx.Rollback()
 		return NewModeError(fmt.Sprintf("appointment with id=%s not present in the db", a.ID))
 	}
+	if err := tx.Where("appointment_id = ?", a.ID).Delete(&AppointmentException{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, e := range a.Exceptions {
+		e.ID = ""
+		e.AppointmentId = a.ID
+		if err := tx.Create(e).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
 	if a.Attendees == nil {
 		a.Attendees = []*User{}
 	}
-	return nil
+	if err := tx.Model(a).Association("Attendees").Replace(a.Attendees).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("appointment_id = ?", a.ID).Delete(&ExternalAttendee{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, e := range a.ExternalAttendees {
+		e.ID = ""
+		e.AppointmentId = a.ID
+		if err := tx.Create(e).Error; err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if a.ExternalAttendees == nil {
+		a.ExternalAttendees = []*ExternalAttendee{}
+	}
+	attendeeIds, err := a.attendeeIds(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := a.lockBookings(attendeeIds, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := a.checkConflicts(attendeeIds, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	// the users no longer attending may have lost access
+	if err := deleteUnreadableAlarms(tx, "alarms.appointment_id = ?", a.ID); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := recordChange(EntityAppointment, a.ID, ChangeUpdate, before, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if a.Version, err = versionOf(EntityAppointment, a.ID, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
 }
 
 func (a *Appointment) Read(db *gorm.DB) error {
 	if a.EmptyID() {
 		return EmptyIdError
 	}
-	dbState := db.Preload("Attendees").Find(a, "id = ?", a.ID)
+	dbState := db.Preload("Attendees").Preload("ExternalAttendees").Preload("Exceptions").Find(a, "id = ?", a.ID)
 	if dbState.Error != nil {
 		return dbState.Error
 	}
 	if dbState.RowsAffected == 0 {
 		return NewModeError(fmt.Sprintf("appointment with with id=%s not present in the db", a.ID))
 	}
-	return nil
+	return loadParticipation([]*Appointment{a}, db)
 }
 
-func (a *Appointment) AddAttendees(userIds []string, db *gorm.DB) error {
+// AddAttendees invites the users to the appointment. A non empty role is
+// given to the new attendees and to the users already attending
+func (a *Appointment) AddAttendees(userIds []string, role AttendeeRole, db *gorm.DB) error {
 	usrs := make([]*User, 0, 2)
 	for _, userId := range userIds {
 		_, err := uuid.Parse(userId)
@@ -125,7 +485,40 @@ func (a *Appointment) AddAttendees(userIds []string, db *gorm.DB) error {
 		}
 		usrs = append(usrs, &User{Base: Base{ID: userId}})
 	}
-	return db.Model(a).Association("Attendees").Append(usrs).Error
+	if role != "" {
+		if _, err := ParseAttendeeRole(string(role)); err != nil {
+			return err
+		}
+	}
+
+	tx := db.Begin()
+	before, err := versionedSnapshot(EntityAppointment, a.ID, a.Version, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Model(a).Association("Attendees").Append(usrs).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if role != "" {
+		err := tx.Table("users_appointments").
+			Where("appointment_id = ? AND user_id IN (?)", a.ID, userIds).
+			Update("role", role).Error
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := recordAttendeesChange(a.ID, before, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if a.Version, err = versionOf(EntityAppointment, a.ID, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
 }
 
 func (a *Appointment) RemoveAttendees(userIds []string, db *gorm.DB) error {
@@ -137,9 +530,28 @@ func (a *Appointment) RemoveAttendees(userIds []string, db *gorm.DB) error {
 		}
 		usrs = append(usrs, &User{Base: Base{ID: userId}})
 	}
-	res := db.Model(a).Association("Attendees").Delete(usrs)
-	if res.Error != nil {
-		return res.Error
+	tx := db.Begin()
+	before, err := versionedSnapshot(EntityAppointment, a.ID, a.Version, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
 	}
-	return nil
+	if err := tx.Model(a).Association("Attendees").Delete(usrs).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	err = deleteUnreadableAlarms(tx, "alarms.appointment_id = ? AND alarms.user_id IN (?)", a.ID, userIds)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := recordAttendeesChange(a.ID, before, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if a.Version, err = versionOf(EntityAppointment, a.ID, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
 }
@@ -0,0 +1,498 @@
+package models
+
+import (
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"strings"
+	"time"
+)
+
+// OccurrenceScope tells which occurrences of a recurring appointment
+// an edit or a cancellation applies to
+type OccurrenceScope string
+
+const (
+	ScopeThis      OccurrenceScope = "this"
+	ScopeFollowing OccurrenceScope = "following"
+	ScopeAll       OccurrenceScope = "all"
+)
+
+func ParseOccurrenceScope(value string) (OccurrenceScope, error) {
+	switch scope := OccurrenceScope(strings.ToLower(strings.TrimSpace(value))); scope {
+	case "":
+		return ScopeThis, nil
+	case ScopeThis, ScopeFollowing, ScopeAll:
+		return scope, nil
+	}
+	return "", NewModeError(fmt.Sprintf("unknown occurrence scope %s", value))
+}
+
+// AppointmentException cancels or overrides a single occurrence of a recurring
+// appointment. RecurrenceId is the original start of the occurrence
+type AppointmentException struct {
+	Base
+	AppointmentId string    `gorm:"type:uuid;not null;" json:"appointment_id"`
+	RecurrenceId  time.Time `gorm:"not null" json:"recurrence_id"`
+	Cancelled     bool      `json:"cancelled"`
+	Subject       string    `json:"subject"`
+	Description   string    `json:"description"`
+	Start         time.Time `json:"start"`
+	End           time.Time `json:"end"`
+}
+
+// OccurrenceChanges holds the new values of an edited occurrence.
+// Empty fields are left unchanged
+type OccurrenceChanges struct {
+	Subject     string    `json:"subject"`
+	Description string    `json:"description"`
+	Start       time.Time `json:"start"`
+	End         time.Time `json:"end"`
+}
+
+func (c *OccurrenceChanges) apply(occ *Occurrence) {
+	duration := occ.End.Sub(occ.Start)
+	if subject := strings.TrimSpace(c.Subject); subject != "" {
+		occ.Subject = subject
+	}
+	if c.Description != "" {
+		occ.Description = c.Description
+	}
+	if !c.Start.IsZero() {
+		occ.Start = c.Start
+		if !occ.WholeDay {
+			occ.End = c.Start.Add(duration)
+		}
+	}
+	if !c.End.IsZero() && !occ.WholeDay {
+		occ.End = c.End
+	}
+}
+
+func (e *AppointmentException) Validate() error {
+	if IdIsEmpty(e.AppointmentId) {
+		return NewModeError("exception appointment_id can not be empty")
+	}
+	if e.RecurrenceId.IsZero() {
+		return NewModeError("exception recurrence_id can not be empty")
+	}
+	if e.Cancelled {
+		return nil
+	}
+	if strings.TrimSpace(e.Subject) == "" {
+		return NewModeError("exception subject can not be empty")
+	}
+	if !e.End.IsZero() && e.End.Before(e.Start) {
+		return NewModeError("occurrence start time should be before end time")
+	}
+	return nil
+}
+
+func (e *AppointmentException) occurrence(a *Appointment) *Occurrence {
+	return &Occurrence{
+		AppointmentId: a.ID,
+		CalendarId:    a.CalendarId,
+		RecurrenceId:  e.RecurrenceId,
+		Subject:       e.Subject,
+		Description:   e.Description,
+		WholeDay:      a.WholeDay,
+		Start:         e.Start,
+		End:           e.End,
+	}
+}
+
+// saveException stores the exception of the series and records the change of the series.
+// Moved occurrences are checked for conflicts, cancelled ones only free their time
+func (a *Appointment) saveException(e *AppointmentException, db *gorm.DB) error {
+	tx := db.Begin()
+	before, err := versionedSnapshot(EntityAppointment, a.ID, a.Version, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	var attendeeIds []string
+	if !e.Cancelled {
+		if attendeeIds, err = a.lockSeriesBookings(tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := e.save(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if !e.Cancelled {
+		if a.Conflicts, err = checkStoredConflicts(a.ID, attendeeIds, tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := recordChange(EntityAppointment, a.ID, ChangeUpdate, before, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if a.Version, err = versionOf(EntityAppointment, a.ID, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// lockSeriesBookings locks the bookings of the calendar and the attendees of the
+// series, see lockBookings, and returns the attendees
+func (a *Appointment) lockSeriesBookings(tx *gorm.DB) ([]string, error) {
+	attendeeIds, err := a.attendeeIds(tx)
+	if err != nil {
+		return nil, err
+	}
+	return attendeeIds, a.lockBookings(attendeeIds, tx)
+}
+
+// checkStoredConflicts applies AppointmentConflictPolicy to the series as it is
+// stored within the transaction, exceptions included, and returns its conflicts
+func checkStoredConflicts(id string, attendeeIds []string, tx *gorm.DB) ([]*Conflict, error) {
+	stored := &Appointment{}
+	if err := tx.Preload("Exceptions").Find(stored, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	if err := stored.checkConflicts(attendeeIds, tx); err != nil {
+		return nil, err
+	}
+	return stored.Conflicts, nil
+}
+
+// save creates the exception or replaces the one already stored
+// for the same occurrence
+func (e *AppointmentException) save(db *gorm.DB) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	var existing AppointmentException
+	dbState := db.Where("appointment_id = ? AND recurrence_id = ?", e.AppointmentId, e.RecurrenceId).
+		Limit(1).Find(&existing)
+	if dbState.Error != nil && !dbState.RecordNotFound() {
+		return dbState.Error
+	}
+	if dbState.RecordNotFound() {
+		return db.Create(e).Error
+	}
+	e.ID = existing.ID
+	return db.Model(&AppointmentException{}).Where("id = ?", e.ID).Updates(map[string]interface{}{
+		"cancelled":   e.Cancelled,
+		"subject":     e.Subject,
+		"description": e.Description,
+		"start":       e.Start,
+		"end":         e.End,
+	}).Error
+}
+
+func (a *Appointment) exceptionFor(recurrenceId time.Time) *AppointmentException {
+	for _, e := range a.Exceptions {
+		if e.RecurrenceId.Equal(recurrenceId) {
+			return e
+		}
+	}
+	return nil
+}
+
+// hasOccurrence reports whether the series has an occurrence originally
+// starting at recurrenceId
+func (a *Appointment) hasOccurrence(recurrenceId time.Time) bool {
+	if !a.IsRecurring() {
+		return recurrenceId.Equal(a.Start)
+	}
+	rule, err := ParseRecurrenceRule(a.Recurrence)
+	if err != nil {
+		return false
+	}
+	starts := rule.Between(a.Start, recurrenceId, recurrenceId.Add(time.Nanosecond))
+	return len(starts) == 1 && starts[0].Equal(recurrenceId)
+}
+
+// occurrenceAt resolves the current state of the occurrence originally starting at recurrenceId
+func (a *Appointment) occurrenceAt(recurrenceId time.Time) (*Occurrence, error) {
+	if !a.IsRecurring() {
+		return nil, NewModeError(fmt.Sprintf("appointment with id=%s is not recurring", a.ID))
+	}
+	if !a.hasOccurrence(recurrenceId) {
+		return nil, NewModeError(fmt.Sprintf("appointment with id=%s has no occurrence starting at %s",
+			a.ID, recurrenceId.Format(time.RFC3339)))
+	}
+	if e := a.exceptionFor(recurrenceId); e != nil && !e.Cancelled {
+		return e.occurrence(a), nil
+	}
+	return a.newOccurrence(recurrenceId), nil
+}
+
+// UpdateOccurrence edits the occurrence originally starting at recurrenceId.
+// ScopeThis stores an exception, ScopeFollowing splits the series into two
+// and ScopeAll shifts the whole series. The returned appointment is the series
+// holding the edited occurrence
+func (a *Appointment) UpdateOccurrence(recurrenceId time.Time, changes OccurrenceChanges, scope OccurrenceScope, db *gorm.DB) (*Appointment, error) {
+	occ, err := a.occurrenceAt(recurrenceId)
+	if err != nil {
+		return nil, err
+	}
+	changes.apply(occ)
+
+	switch scope {
+	case ScopeThis:
+		e := &AppointmentException{
+			AppointmentId: a.ID,
+			RecurrenceId:  recurrenceId,
+			Subject:       occ.Subject,
+			Description:   occ.Description,
+			Start:         occ.Start,
+			End:           occ.End,
+		}
+		if err := a.saveException(e, db); err != nil {
+			return nil, err
+		}
+		return a, a.Read(db)
+	case ScopeAll:
+		return a, a.shiftSeries(occ, recurrenceId, db)
+	case ScopeFollowing:
+		if recurrenceId.Equal(a.Start) {
+			return a, a.shiftSeries(occ, recurrenceId, db)
+		}
+		return a.splitSeries(occ, recurrenceId, db)
+	}
+	return nil, NewModeError(fmt.Sprintf("unknown occurrence scope %s", scope))
+}
+
+// CancelOccurrence removes the occurrence originally starting at recurrenceId.
+// ScopeFollowing ends the series right before it and ScopeAll deletes the appointment
+func (a *Appointment) CancelOccurrence(recurrenceId time.Time, scope OccurrenceScope, db *gorm.DB) error {
+	if _, err := a.occurrenceAt(recurrenceId); err != nil {
+		return err
+	}
+
+	switch scope {
+	case ScopeThis:
+		e := &AppointmentException{AppointmentId: a.ID, RecurrenceId: recurrenceId, Cancelled: true}
+		return a.saveException(e, db)
+	case ScopeAll:
+		return a.Delete(db)
+	case ScopeFollowing:
+		if recurrenceId.Equal(a.Start) {
+			return a.Delete(db)
+		}
+		tx := db.Begin()
+		before, err := versionedSnapshot(EntityAppointment, a.ID, a.Version, tx)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := a.truncateSeries(recurrenceId, tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := recordChange(EntityAppointment, a.ID, ChangeUpdate, before, tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if a.Version, err = versionOf(EntityAppointment, a.ID, tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+		return tx.Commit().Error
+	}
+	return NewModeError(fmt.Sprintf("unknown occurrence scope %s", scope))
+}
+
+// shiftSeries applies the changes made to the occurrence at recurrenceId to every occurrence
+func (a *Appointment) shiftSeries(occ *Occurrence, recurrenceId time.Time, db *gorm.DB) error {
+	delta := occ.Start.Sub(recurrenceId)
+	a.Subject = occ.Subject
+	a.Description = occ.Description
+	a.Start = a.Start.Add(delta)
+	if !a.WholeDay {
+		a.End = a.Start.Add(occ.End.Sub(occ.Start))
+	}
+	if err := a.Validate(); err != nil {
+		return err
+	}
+
+	tx := db.Begin()
+	before, err := versionedSnapshot(EntityAppointment, a.ID, a.Version, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	attendeeIds, err := a.lockSeriesBookings(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	dbState := tx.Model(&Appointment{}).Where("id = ?", a.ID).Updates(map[string]interface{}{
+		"subject":     a.Subject,
+		"description": a.Description,
+		"start":       a.Start,
+		"end":         a.End,
+	})
+	if dbState.Error != nil {
+		tx.Rollback()
+		return dbState.Error
+	}
+	if delta != 0 {
+		dbState = tx.Model(&AppointmentException{}).Where("appointment_id = ?", a.ID).
+			Update("recurrence_id", gorm.Expr("recurrence_id + ?::interval", fmt.Sprintf("%d microseconds", delta.Microseconds())))
+		if dbState.Error != nil {
+			tx.Rollback()
+			return dbState.Error
+		}
+	}
+	if a.Conflicts, err = checkStoredConflicts(a.ID, attendeeIds, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := recordChange(EntityAppointment, a.ID, ChangeUpdate, before, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if a.Version, err = versionOf(EntityAppointment, a.ID, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+	return a.Read(db)
+}
+
+// splitSeries ends the series right before recurrenceId and starts a new
+// series from the edited occurrence, moving the exceptions that follow it.
+// Relative alarms are copied to the new series, absolute ones stay as they are
+func (a *Appointment) splitSeries(occ *Occurrence, recurrenceId time.Time, db *gorm.DB) (*Appointment, error) {
+	rule, err := ParseRecurrenceRule(a.Recurrence)
+	if err != nil {
+		return nil, err
+	}
+	if rule.Count > 0 {
+		passed := len(rule.Between(a.Start, a.Start, recurrenceId))
+		rule.Count -= passed
+	}
+	parentId := a.ID
+	if a.ParentId != nil {
+		parentId = *a.ParentId
+	}
+	next := &Appointment{
+		Subject:     occ.Subject,
+		Description: occ.Description,
+		WholeDay:    a.WholeDay,
+		Start:       occ.Start,
+		End:         occ.End,
+		Recurrence:  rule.String(),
+		TimeZone:    a.TimeZone,
+		CalendarId:  a.CalendarId,
+		ParentId:    &parentId,
+		Uid:         a.splitUid(recurrenceId),
+	}
+	if err := next.Validate(); err != nil {
+		return nil, err
+	}
+
+	tx := db.Begin()
+	before, err := versionedSnapshot(EntityAppointment, a.ID, a.Version, tx)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	// the new series has the calendar and the attendees of the series it is split off
+	attendeeIds, err := a.lockSeriesBookings(tx)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Create(next).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	dbState := tx.Exec(`INSERT INTO users_appointments (user_id, appointment_id, status, role, rsvp_at, comment)
+		SELECT user_id, ?, status, role, rsvp_at, comment FROM users_appointments WHERE appointment_id = ?`, next.ID, a.ID)
+	if dbState.Error != nil {
+		tx.Rollback()
+		return nil, dbState.Error
+	}
+	dbState = tx.Exec(`INSERT INTO external_attendees (created_at, updated_at, appointment_id, email, name, status, role)
+		SELECT now(), now(), ?, email, name, status, role FROM external_attendees WHERE appointment_id = ?`, next.ID, a.ID)
+	if dbState.Error != nil {
+		tx.Rollback()
+		return nil, dbState.Error
+	}
+	dbState = tx.Exec(`INSERT INTO alarms (created_at, updated_at, appointment_id, user_id, offset_minutes, last_fired_at, last_occurrence)
+		SELECT now(), now(), ?, user_id, offset_minutes, last_fired_at, last_occurrence FROM alarms
+		WHERE appointment_id = ? AND offset_minutes IS NOT NULL`, next.ID, a.ID)
+	if dbState.Error != nil {
+		tx.Rollback()
+		return nil, dbState.Error
+	}
+	delta := occ.Start.Sub(recurrenceId)
+	dbState = tx.Model(&AppointmentException{}).
+		Where("appointment_id = ? AND recurrence_id > ?", a.ID, recurrenceId).
+		Updates(map[string]interface{}{
+			"appointment_id": next.ID,
+			"recurrence_id":  gorm.Expr("recurrence_id + ?::interval", fmt.Sprintf("%d microseconds", delta.Microseconds())),
+		})
+	if dbState.Error != nil {
+		tx.Rollback()
+		return nil, dbState.Error
+	}
+	if err := a.truncateSeries(recurrenceId, tx); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := RescheduleAlarms(a.ID, tx); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := RescheduleAlarms(next.ID, tx); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if next.Conflicts, err = checkStoredConflicts(next.ID, attendeeIds, tx); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := recordChange(EntityAppointment, a.ID, ChangeUpdate, before, tx); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if a.Version, err = versionOf(EntityAppointment, a.ID, tx); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := recordChange(EntityAppointment, next.ID, ChangeCreate, nil, tx); err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+	return next, next.Read(db)
+}
+
+// splitUid is the iCalendar UID of the series split off at recurrenceId,
+// the UID of the series followed by the time it is split at
+func (a *Appointment) splitUid(recurrenceId time.Time) string {
+	uid := a.Uid
+	if uid == "" {
+		uid = a.ID
+	}
+	return fmt.Sprintf("%s-%s", uid, recurrenceId.UTC().Format("20060102T150405Z"))
+}
+
+// truncateSeries makes the occurrence before recurrenceId the last one of the series
+func (a *Appointment) truncateSeries(recurrenceId time.Time, db *gorm.DB) error {
+	rule, err := ParseRecurrenceRule(a.Recurrence)
+	if err != nil {
+		return err
+	}
+	rule.SetUntil(recurrenceId.Add(-time.Second))
+	a.Recurrence = rule.String()
+	dbState := db.Model(&Appointment{}).Where("id = ?", a.ID).Update("recurrence", a.Recurrence)
+	if dbState.Error != nil {
+		return dbState.Error
+	}
+	return db.Where("appointment_id = ? AND recurrence_id >= ?", a.ID, recurrenceId).
+		Delete(&AppointmentException{}).Error
+}
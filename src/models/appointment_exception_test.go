@@ -0,0 +1,186 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseOccurrenceScope(t *testing.T) {
+	scope, err := ParseOccurrenceScope("")
+	assert.Nil(t, err)
+	assert.Equal(t, ScopeThis, scope)
+
+	scope, err = ParseOccurrenceScope("Following")
+	assert.Nil(t, err)
+	assert.Equal(t, ScopeFollowing, scope)
+
+	_, err = ParseOccurrenceScope("some")
+	assert.NotNil(t, err)
+}
+
+func TestAppointment_UpdateOccurrence(t *testing.T) {
+	err := MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer DropAllData(db)
+
+	secondOccurrence := time.Date(2020, 1, 8, 9, 0, 0, 0, time.UTC)
+	thirdOccurrence := time.Date(2020, 1, 13, 9, 0, 0, 0, time.UTC)
+	januaryStart := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	januaryEnd := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("success this occurrence", func(tt *testing.T) {
+		appt := &Appointment{Base: Base{ID: AppointmentRecurringId}}
+		assert.Nil(tt, appt.Read(db))
+		changes := OccurrenceChanges{Subject: "moved sync", Start: secondOccurrence.Add(2 * time.Hour)}
+		res, err := appt.UpdateOccurrence(secondOccurrence, changes, ScopeThis, db)
+		assert.Nil(tt, err)
+		assert.Len(tt, res.Exceptions, 1)
+
+		occurrences, err := res.Occurrences(januaryStart, januaryEnd)
+		assert.Nil(tt, err)
+		assert.Len(tt, occurrences, 8)
+		assert.Equal(tt, "moved sync", occurrences[1].Subject)
+		assert.Equal(tt, secondOccurrence.Add(150*time.Minute), occurrences[1].End.UTC())
+	})
+
+	t.Run("success following occurrences", func(tt *testing.T) {
+		appt := &Appointment{Base: Base{ID: AppointmentRecurringId}}
+		assert.Nil(tt, appt.Read(db))
+		changes := OccurrenceChanges{Start: thirdOccurrence.Add(time.Hour)}
+		next, err := appt.UpdateOccurrence(thirdOccurrence, changes, ScopeFollowing, db)
+		assert.Nil(tt, err)
+		assert.NotEqual(tt, AppointmentRecurringId, next.ID)
+		assert.Equal(tt, "Weekly sync", next.Subject)
+
+		previous := &Appointment{Base: Base{ID: AppointmentRecurringId}}
+		assert.Nil(tt, previous.Read(db))
+		occurrences, err := previous.Occurrences(januaryStart, januaryEnd)
+		assert.Nil(tt, err)
+		assert.Len(tt, occurrences, 2)
+
+		occurrences, err = next.Occurrences(januaryStart, januaryEnd)
+		assert.Nil(tt, err)
+		assert.Len(tt, occurrences, 6)
+		assert.Equal(tt, thirdOccurrence.Add(time.Hour), occurrences[0].Start.UTC())
+	})
+
+	t.Run("success following occurrences keep their alarms", func(tt *testing.T) {
+		start := time.Now().AddDate(0, 0, 7).Truncate(time.Hour).UTC()
+		appt := &Appointment{
+			Subject:    "Daily standup",
+			CalendarId: KnownCalendarId,
+			Start:      start,
+			End:        start.Add(15 * time.Minute),
+			Recurrence: "FREQ=DAILY;COUNT=5",
+		}
+		if err := appt.Create(db); err != nil {
+			tt.Fatal("unable to create appointment", err)
+		}
+		offset := 10
+		alarm := &Alarm{AppointmentId: appt.ID, UserId: KnownUserId, OffsetMinutes: &offset}
+		if err := alarm.Create(db); err != nil {
+			tt.Fatal("unable to create alarm", err)
+		}
+		assert.Nil(tt, appt.Read(db))
+		third := start.AddDate(0, 0, 2)
+		next, err := appt.UpdateOccurrence(third, OccurrenceChanges{Start: third.Add(time.Hour)}, ScopeFollowing, db)
+		assert.Nil(tt, err)
+
+		alarms, err := AlarmsOf(appt.ID, KnownUserId, db)
+		assert.Nil(tt, err)
+		assert.Len(tt, alarms, 1)
+		assert.Equal(tt, start, alarms[0].NextOccurrence.UTC())
+		alarms, err = AlarmsOf(next.ID, KnownUserId, db)
+		assert.Nil(tt, err)
+		assert.Len(tt, alarms, 1)
+		assert.Equal(tt, third.Add(time.Hour), alarms[0].NextOccurrence.UTC())
+		assert.Equal(tt, third.Add(50*time.Minute), alarms[0].NextFireAt.UTC())
+	})
+
+	t.Run("success following occurrences keep the time zone", func(tt *testing.T) {
+		berlin, _ := time.LoadLocation("Europe/Berlin")
+		start := time.Date(2020, 3, 16, 9, 0, 0, 0, berlin)
+		appt := &Appointment{
+			Subject:    "Berlin sync",
+			CalendarId: KnownCalendarId,
+			Start:      start,
+			End:        start.Add(time.Hour),
+			Recurrence: "FREQ=WEEKLY;COUNT=4",
+			TimeZone:   "Europe/Berlin",
+			Uid:        "berlin-sync@example.com",
+		}
+		if err := appt.Create(db); err != nil {
+			tt.Fatal("unable to create appointment", err)
+		}
+		assert.Nil(tt, appt.Read(db))
+		second := start.AddDate(0, 0, 7)
+		next, err := appt.UpdateOccurrence(second, OccurrenceChanges{Subject: "Berlin retro"}, ScopeFollowing, db)
+		assert.Nil(tt, err)
+		assert.Equal(tt, "Europe/Berlin", next.TimeZone)
+		assert.Equal(tt, "berlin-sync@example.com-20200323T080000Z", next.Uid)
+
+		// the occurrence after the switch to summer time still starts at 9 in Berlin
+		occurrences, err := next.Occurrences(second, second.AddDate(0, 1, 0))
+		assert.Nil(tt, err)
+		if assert.Len(tt, occurrences, 3) {
+			assert.Equal(tt, time.Date(2020, 3, 30, 7, 0, 0, 0, time.UTC), occurrences[1].Start.UTC())
+		}
+	})
+
+	t.Run("fail not an occurrence", func(tt *testing.T) {
+		appt := &Appointment{Base: Base{ID: AppointmentRecurringId}}
+		assert.Nil(tt, appt.Read(db))
+		_, err := appt.UpdateOccurrence(secondOccurrence.Add(time.Minute), OccurrenceChanges{}, ScopeThis, db)
+		assert.NotNil(tt, err)
+	})
+
+	t.Run("fail not recurring", func(tt *testing.T) {
+		appt := &Appointment{Base: Base{ID: AppointmentFixedTimeId}}
+		assert.Nil(tt, appt.Read(db))
+		_, err := appt.UpdateOccurrence(appt.Start, OccurrenceChanges{}, ScopeThis, db)
+		assert.NotNil(tt, err)
+	})
+}
+
+func TestAppointment_CancelOccurrence(t *testing.T) {
+	err := MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer DropAllData(db)
+
+	secondOccurrence := time.Date(2020, 1, 8, 9, 0, 0, 0, time.UTC)
+	fifthOccurrence := time.Date(2020, 1, 20, 9, 0, 0, 0, time.UTC)
+	januaryStart := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	januaryEnd := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("success this occurrence", func(tt *testing.T) {
+		appt := &Appointment{Base: Base{ID: AppointmentRecurringId}}
+		assert.Nil(tt, appt.Read(db))
+		assert.Nil(tt, appt.CancelOccurrence(secondOccurrence, ScopeThis, db))
+		assert.Nil(tt, appt.Read(db))
+		occurrences, err := appt.Occurrences(januaryStart, januaryEnd)
+		assert.Nil(tt, err)
+		assert.Len(tt, occurrences, 7)
+	})
+
+	t.Run("success following occurrences", func(tt *testing.T) {
+		appt := &Appointment{Base: Base{ID: AppointmentRecurringId}}
+		assert.Nil(tt, appt.Read(db))
+		assert.Nil(tt, appt.CancelOccurrence(fifthOccurrence, ScopeFollowing, db))
+		assert.Nil(tt, appt.Read(db))
+		occurrences, err := appt.Occurrences(januaryStart, januaryEnd)
+		assert.Nil(tt, err)
+		assert.Len(tt, occurrences, 3)
+	})
+
+	t.Run("success all occurrences", func(tt *testing.T) {
+		appt := &Appointment{Base: Base{ID: AppointmentRecurringId}}
+		assert.Nil(tt, appt.Read(db))
+		assert.Nil(tt, appt.CancelOccurrence(appt.Start, ScopeAll, db))
+		assert.NotNil(tt, appt.Read(db))
+	})
+}
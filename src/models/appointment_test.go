@@ -386,29 +386,45 @@ func TestAppointment_AddAttendees(t *testing.T) {
 	t.Run("success", func(tt *testing.T) {
 		userIds := []string{KnownUserId, SecondKnownUserId}
 		apt := &Appointment{Base: Base{ID: AppointmentWholeDayId}}
-		err := apt.AddAttendees(userIds, db)
+		err := apt.AddAttendees(userIds, "", db)
 		assert.Nil(tt, err)
 		assert.Len(tt, apt.Attendees, 2)
 	})
 
+	t.Run("success with role", func(tt *testing.T) {
+		apt := &Appointment{Base: Base{ID: AppointmentFixedTimeId}}
+		err := apt.AddAttendees([]string{SecondKnownUserId}, AttendeeChair, db)
+		assert.Nil(tt, err)
+		assert.Nil(tt, apt.Read(db))
+		assert.Len(tt, apt.Attendees, 1)
+		assert.Equal(tt, AttendeeChair, apt.Attendees[0].Participation.Role)
+		assert.Equal(tt, StatusNeedsAction, apt.Attendees[0].Participation.Status)
+	})
+
+	t.Run("fail unknown role", func(tt *testing.T) {
+		apt := &Appointment{Base: Base{ID: AppointmentFixedTimeId}}
+		err := apt.AddAttendees([]string{ThirdKnownUserId}, AttendeeRole("guest"), db)
+		assert.NotNil(tt, err)
+	})
+
 	t.Run("fail unexisting appointment id", func(tt *testing.T) {
 		userIds := []string{KnownUserId, SecondKnownUserId}
 		apt := &Appointment{Base: Base{ID: UnexistingId}}
-		err := apt.AddAttendees(userIds, db)
+		err := apt.AddAttendees(userIds, "", db)
 		assert.NotNil(tt, err)
 	})
 
 	t.Run("fail unexisting user ids", func(tt *testing.T) {
 		userIds := []string{UnexistingId}
 		apt := &Appointment{Base: Base{ID: UnexistingId}}
-		err := apt.AddAttendees(userIds, db)
+		err := apt.AddAttendees(userIds, "", db)
 		assert.NotNil(tt, err)
 	})
 
 	t.Run("fail invalid user ids", func(tt *testing.T) {
 		userIds := []string{"ha-ha-ha"}
 		apt := &Appointment{Base: Base{ID: UnexistingId}}
-		err := apt.AddAttendees(userIds, db)
+		err := apt.AddAttendees(userIds, "", db)
 		assert.NotNil(tt, err)
 	})
 }
@@ -434,3 +450,42 @@ func TestAppointment_RemoveAttendees(t *testing.T) {
 		assert.Len(tt, appt.Attendees, 0)
 	})
 }
+
+func TestAppointment_Occurrences(t *testing.T) {
+	err := MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer DropAllData(db)
+
+	t.Run("success recurring", func(tt *testing.T) {
+		appt := &Appointment{Base: Base{ID: AppointmentRecurringId}}
+		err := appt.Read(db)
+		assert.Nil(tt, err)
+		occurrences, err := appt.Occurrences(
+			time.Date(2020, 1, 7, 0, 0, 0, 0, time.UTC),
+			time.Date(2020, 1, 14, 0, 0, 0, 0, time.UTC))
+		assert.Nil(tt, err)
+		assert.Len(tt, occurrences, 2)
+		assert.Equal(tt, time.Date(2020, 1, 8, 9, 30, 0, 0, time.UTC), occurrences[0].End.UTC())
+	})
+
+	t.Run("success single", func(tt *testing.T) {
+		appt := &Appointment{Base: Base{ID: AppointmentFixedTimeId}}
+		err := appt.Read(db)
+		assert.Nil(tt, err)
+		occurrences, err := appt.Occurrences(
+			time.Date(2020, 1, 17, 21, 0, 0, 0, time.UTC),
+			time.Date(2020, 1, 18, 0, 0, 0, 0, time.UTC))
+		assert.Nil(tt, err)
+		assert.Len(tt, occurrences, 1)
+	})
+
+	t.Run("fail invalid range", func(tt *testing.T) {
+		appt := &Appointment{Base: Base{ID: AppointmentFixedTimeId}}
+		_, err := appt.Occurrences(
+			time.Date(2020, 1, 18, 0, 0, 0, 0, time.UTC),
+			time.Date(2020, 1, 17, 0, 0, 0, 0, time.UTC))
+		assert.NotNil(tt, err)
+	})
+}
@@ -3,11 +3,15 @@ package models
 import (
 	"fmt"
 	"github.com/jinzhu/gorm"
+	"sort"
 	"strings"
+	"time"
 )
 
 type Calendar struct {
 	Base
+	// Version is bumped by every change, updates and deletions setting it expect the stored calendar at that version
+	Version      int64          `gorm:"not null;default:1" json:"version"`
 	Name         string         `gorm:"unique_index;not null" json:"name"`
 	UserId       string         `gorm:"type:uuid;not null;" json:"user_id"`
 	Appointments []*Appointment `json:"appointments"`
@@ -35,21 +39,51 @@ func (c *Calendar) Create(db *gorm.DB) error {
 	if err := c.Validate(); err != nil {
 		return err
 	}
-	return db.Debug().Create(c).Error
+	c.Version = 1
+	tx := db.Begin()
+	if err := tx.Create(c).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := recordChange(EntityCalendar, c.ID, ChangeCreate, nil, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
 }
 
+// Delete removes the calendar together with its appointments
 func (c *Calendar) Delete(db *gorm.DB) error {
 	if c.EmptyID() {
 		return EmptyIdError
 	}
-	dbState := db.Delete(c)
-	if dbState.Error != nil {
-		return dbState.Error
+	tx := db.Begin()
+	if err := checkVersion(EntityCalendar, c.ID, c.Version, tx); err != nil {
+		tx.Rollback()
+		return err
 	}
-	if dbState.RowsAffected == 0 {
+	if err := lockCalendars([]string{c.ID}, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	var count int
+	if err := tx.Model(&Calendar{}).Where("id = ?", c.ID).Count(&count).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if count == 0 {
+		tx.Rollback()
 		return NewModeError(fmt.Sprintf("calendar with id=%s not present in the db", c.ID))
 	}
-	return nil
+	if err := recordCalendarDeletion(c.ID, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Delete(c).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
 }
 
 func (c *Calendar) Update(db *gorm.DB) error {
@@ -59,14 +93,34 @@ func (c *Calendar) Update(db *gorm.DB) error {
 	if c.EmptyID() {
 		return EmptyIdError
 	}
-	dbState := db.Model(&Calendar{}).Updates(c)
+	tx := db.Begin()
+	if err := checkVersion(EntityCalendar, c.ID, c.Version, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	before, err := snapshot(EntityCalendar, c.ID, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	dbState := tx.Model(&Calendar{}).Updates(c)
 	if dbState.Error != nil {
+		tx.Rollback()
 		return dbState.Error
 	}
 	if dbState.RowsAffected == 0 {
+		tx.Rollback()
 		return NewModeError(fmt.Sprintf("calendar with id=%s not present in the db", c.ID))
 	}
-	return nil
+	if err := recordChange(EntityCalendar, c.ID, ChangeUpdate, before, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if c.Version, err = versionOf(EntityCalendar, c.ID, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
 }
 
 func (c *Calendar) Read(db *gorm.DB) error {
@@ -82,3 +136,138 @@ func (c *Calendar) Read(db *gorm.DB) error {
 	}
 	return nil
 }
+
+// ReadDetailed reads the calendar together with the attendees
+// and exceptions of its appointments
+func (c *Calendar) ReadDetailed(db *gorm.DB) error {
+	if c.EmptyID() {
+		return EmptyIdError
+	}
+	dbState := db.Preload("Appointments").
+		Preload("Appointments.Attendees").
+		Preload("Appointments.ExternalAttendees").
+		Preload("Appointments.Exceptions").
+		Find(c, "id = ?", c.ID)
+	if dbState.Error != nil {
+		return dbState.Error
+	}
+	if dbState.RowsAffected == 0 {
+		return NewModeError(fmt.Sprintf("calendar with id=%s not present in the db", c.ID))
+	}
+	return loadParticipation(c.Appointments, db)
+}
+
+type CalendarPage struct {
+	Calendars  []*Calendar `json:"calendars"`
+	NextCursor string      `json:"next_cursor,omitempty"`
+}
+
+type OccurrencePage struct {
+	Occurrences []*Occurrence `json:"occurrences"`
+	NextCursor  string        `json:"next_cursor,omitempty"`
+}
+
+// HideDetails leaves only the times of the occurrences
+func (p *OccurrencePage) HideDetails() {
+	for _, occ := range p.Occurrences {
+		occ.Subject = ""
+		occ.Description = ""
+	}
+}
+
+// cursorTimeLayout has a fixed width so that formatted times sort as strings
+const cursorTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// occurrenceCursor is the sort key of an occurrence within a listing
+func occurrenceCursor(occ *Occurrence) []string {
+	return []string{
+		occ.Start.UTC().Format(cursorTimeLayout),
+		occ.AppointmentId,
+		occ.RecurrenceId.UTC().Format(cursorTimeLayout),
+	}
+}
+
+func compareOccurrences(a, b []string) int {
+	for i := range a {
+		if c := strings.Compare(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+// Occurrences lists a page of the occurrences of the calendar appointments
+// overlapping [from, to) ordered by start
+func (c *Calendar) Occurrences(from, to time.Time, page PageRequest, db *gorm.DB) (*OccurrencePage, error) {
+	if c.EmptyID() {
+		return nil, EmptyIdError
+	}
+	if !from.Before(to) {
+		return nil, NewModeError("time range start should be before its end")
+	}
+	if err := page.Validate(); err != nil {
+		return nil, err
+	}
+	var after []string
+	if page.Cursor != "" {
+		var err error
+		if after, err = DecodeCursor(page.Cursor, 3); err != nil {
+			return nil, err
+		}
+	}
+	dbState := db.Find(c, "id = ?", c.ID)
+	if dbState.Error != nil {
+		return nil, dbState.Error
+	}
+	if dbState.RowsAffected == 0 {
+		return nil, NewModeError(fmt.Sprintf("calendar with id=%s not present in the db", c.ID))
+	}
+
+	appts := make([]*Appointment, 0)
+	// whole day appointments may start up to a day later in UTC than the day they take
+	dbState = db.Preload("Exceptions").
+		Where("calendar_id = ?", c.ID).
+		Where(`COALESCE(recurrence, '') <> '' OR (start < ? AND (whole_day OR "end" > ?))`,
+			to.Add(24*time.Hour), from.Add(-24*time.Hour)).
+		Find(&appts)
+	if dbState.Error != nil {
+		return nil, dbState.Error
+	}
+
+	occurrences := make([]*Occurrence, 0)
+	for _, appt := range appts {
+		result, err := appt.Occurrences(from, to)
+		if err != nil {
+			return nil, err
+		}
+		occurrences = append(occurrences, result...)
+	}
+	keys := make(map[*Occurrence][]string, len(occurrences))
+	for _, occ := range occurrences {
+		keys[occ] = occurrenceCursor(occ)
+	}
+	sort.Slice(occurrences, func(i, j int) bool {
+		cmp := compareOccurrences(keys[occurrences[i]], keys[occurrences[j]])
+		if page.Order == SortDesc {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+
+	result := &OccurrencePage{Occurrences: make([]*Occurrence, 0, page.Limit)}
+	for _, occ := range occurrences {
+		if after != nil {
+			cmp := compareOccurrences(keys[occ], after)
+			if (page.Order == SortAsc && cmp <= 0) || (page.Order == SortDesc && cmp >= 0) {
+				continue
+			}
+		}
+		if len(result.Occurrences) == page.Limit {
+			last := result.Occurrences[len(result.Occurrences)-1]
+			result.NextCursor = EncodeCursor(keys[last]...)
+			break
+		}
+		result.Occurrences = append(result.Occurrences, occ)
+	}
+	return result, nil
+}
@@ -2,7 +2,9 @@ package models
 
 import (
 	"github.com/jinzhu/gorm"
+	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestCalendar_Create(t *testing.T) {
@@ -254,3 +256,60 @@ func TestCalendar_Read(t *testing.T) {
 		})
 	}
 }
+
+func TestCalendar_Occurrences(t *testing.T) {
+	err := MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer DropAllData(db)
+
+	from := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Run("success paginated", func(tt *testing.T) {
+		cal := &Calendar{Base: Base{ID: KnownCalendarId}}
+		seen := make([]*Occurrence, 0)
+		page := PageRequest{Limit: 4}
+		for i := 0; i < 3; i++ {
+			res, err := cal.Occurrences(from, to, page, db)
+			assert.Nil(tt, err)
+			seen = append(seen, res.Occurrences...)
+			page.Cursor = res.NextCursor
+			if i < 2 {
+				assert.Len(tt, res.Occurrences, 4)
+				assert.NotEmpty(tt, res.NextCursor)
+			} else {
+				assert.Len(tt, res.Occurrences, 2)
+				assert.Empty(tt, res.NextCursor)
+			}
+		}
+		for i := 1; i < len(seen); i++ {
+			assert.False(tt, seen[i].Start.Before(seen[i-1].Start))
+		}
+		assert.Equal(tt, AppointmentFixedTimeId, seen[4].AppointmentId)
+		assert.Equal(tt, AppointmentWholeDayId, seen[5].AppointmentId)
+	})
+
+	t.Run("success descending window", func(tt *testing.T) {
+		cal := &Calendar{Base: Base{ID: KnownCalendarId}}
+		res, err := cal.Occurrences(time.Date(2020, 1, 17, 0, 0, 0, 0, time.UTC), time.Date(2020, 1, 21, 0, 0, 0, 0, time.UTC),
+			PageRequest{Order: SortDesc}, db)
+		assert.Nil(tt, err)
+		assert.Len(tt, res.Occurrences, 3)
+		assert.Equal(tt, AppointmentRecurringId, res.Occurrences[0].AppointmentId)
+		assert.Equal(tt, AppointmentFixedTimeId, res.Occurrences[2].AppointmentId)
+	})
+
+	t.Run("fail invalid cursor", func(tt *testing.T) {
+		cal := &Calendar{Base: Base{ID: KnownCalendarId}}
+		_, err := cal.Occurrences(from, to, PageRequest{Cursor: "garbage"}, db)
+		assert.NotNil(tt, err)
+	})
+
+	t.Run("fail no such calendar", func(tt *testing.T) {
+		cal := &Calendar{Base: Base{ID: UnexistingId}}
+		_, err := cal.Occurrences(from, to, PageRequest{}, db)
+		assert.NotNil(tt, err)
+	})
+}
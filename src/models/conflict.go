@@ -0,0 +1,215 @@
+package models
+
+import (
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"sort"
+	"strings"
+	"time"
+)
+
+type ConflictPolicy string
+
+const (
+	ConflictAllow  ConflictPolicy = "allow"
+	ConflictWarn   ConflictPolicy = "warn"
+	ConflictReject ConflictPolicy = "reject"
+
+	// ConflictHorizon limits how far ahead occurrences of recurring appointments are checked
+	ConflictHorizon = 366 * 24 * time.Hour
+	MaxConflicts    = 50
+
+	exclusionViolationCode = "23P01"
+)
+
+// AppointmentConflictPolicy decides what happens when an appointment is created
+// or updated over another one of the same calendar or of one of its attendees
+var AppointmentConflictPolicy = ConflictWarn
+
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch policy := ConflictPolicy(strings.ToLower(strings.TrimSpace(s))); policy {
+	case ConflictAllow, ConflictWarn, ConflictReject:
+		return policy, nil
+	}
+	return "", NewModeError(fmt.Sprintf("unknown conflict policy %s", s))
+}
+
+// Conflict is an occurrence of another appointment overlapping the appointment.
+// UserIds lists the attendees booked twice, it is empty when the conflict is
+// within the calendar of the appointment only
+type Conflict struct {
+	AppointmentId string    `json:"appointment_id"`
+	CalendarId    string    `json:"calendar_id"`
+	Subject       string    `json:"subject"`
+	Start         time.Time `json:"start"`
+	End           time.Time `json:"end"`
+	UserIds       []string  `json:"user_ids,omitempty"`
+}
+
+// attendeeIds returns the ids of the given attendees together with the stored ones
+func (a *Appointment) attendeeIds(db *gorm.DB) ([]string, error) {
+	ids := make([]string, 0, len(a.Attendees))
+	if !a.EmptyID() {
+		if err := db.Table("users_appointments").Where("appointment_id = ?", a.ID).Pluck("user_id", &ids).Error; err != nil {
+			return nil, err
+		}
+	}
+	for _, usr := range a.Attendees {
+		ids = append(ids, usr.ID)
+	}
+	sort.Strings(ids)
+	unique := ids[:0]
+	for i, id := range ids {
+		if i == 0 || id != ids[i-1] {
+			unique = append(unique, id)
+		}
+	}
+	return unique, nil
+}
+
+// lockBookings serializes the bookings of the calendar and the attendees
+// until the end of the transaction db is in
+func (a *Appointment) lockBookings(attendeeIds []string, db *gorm.DB) error {
+	keys := append([]string{a.CalendarId}, attendeeIds...)
+	for _, key := range keys {
+		if err := db.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", key).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindConflicts returns the occurrences of other appointments of the calendar or
+// of the attendees overlapping the occurrences of the appointment.
+// Recurring appointments are checked up to ConflictHorizon after their start
+func (a *Appointment) FindConflicts(attendeeIds []string, db *gorm.DB) ([]*Conflict, error) {
+	from, to := a.span(a.Start)
+	from = from.Add(-24 * time.Hour)
+	if a.IsRecurring() {
+		to = a.Start.Add(ConflictHorizon)
+	}
+	own, err := a.Occurrences(from, to)
+	if err != nil {
+		return nil, err
+	}
+	if len(own) == 0 {
+		return nil, nil
+	}
+	from, to = own[0].Interval().Start, own[len(own)-1].Interval().End
+	for _, occ := range own {
+		if end := occ.Interval().End; end.After(to) {
+			to = end
+		}
+	}
+
+	query := db.Preload("Exceptions").Preload("Attendees").Where("id <> ?", a.ID)
+	if len(attendeeIds) > 0 {
+		query = query.Where("calendar_id = ? OR id IN (SELECT appointment_id FROM users_appointments WHERE user_id IN (?))",
+			a.CalendarId, attendeeIds)
+	} else {
+		query = query.Where("calendar_id = ?", a.CalendarId)
+	}
+	candidates := make([]*Appointment, 0)
+	dbState := query.
+		Where(`COALESCE(recurrence, '') <> '' OR (start < ? AND (whole_day OR "end" > ?))`, to.Add(24*time.Hour), from).
+		Find(&candidates)
+	if dbState.Error != nil {
+		return nil, dbState.Error
+	}
+
+	attending := make(map[string]bool, len(attendeeIds))
+	for _, id := range attendeeIds {
+		attending[id] = true
+	}
+	conflicts := make([]*Conflict, 0)
+	for _, other := range candidates {
+		shared := make([]string, 0)
+		for _, usr := range other.Attendees {
+			if attending[usr.ID] {
+				shared = append(shared, usr.ID)
+			}
+		}
+		if other.CalendarId != a.CalendarId && len(shared) == 0 {
+			continue
+		}
+		occurrences, err := other.Occurrences(from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, occ := range occurrences {
+			if !overlapsAny(occ.Interval(), own) {
+				continue
+			}
+			interval := occ.Interval()
+			conflicts = append(conflicts, &Conflict{
+				AppointmentId: other.ID,
+				CalendarId:    other.CalendarId,
+				Subject:       occ.Subject,
+				Start:         interval.Start,
+				End:           interval.End,
+				UserIds:       shared,
+			})
+			if len(conflicts) == MaxConflicts {
+				return sortConflicts(conflicts), nil
+			}
+		}
+	}
+	return sortConflicts(conflicts), nil
+}
+
+func overlapsAny(interval *Interval, occurrences []*Occurrence) bool {
+	for _, occ := range occurrences {
+		own := occ.Interval()
+		if own.Start.Before(interval.End) && interval.Start.Before(own.End) {
+			return true
+		}
+	}
+	return false
+}
+
+func sortConflicts(conflicts []*Conflict) []*Conflict {
+	sort.Slice(conflicts, func(i, j int) bool {
+		return conflicts[i].Start.Before(conflicts[j].Start)
+	})
+	return conflicts
+}
+
+// checkConflicts applies AppointmentConflictPolicy to the stored appointment.
+// It should run in the transaction that wrote the appointment
+func (a *Appointment) checkConflicts(attendeeIds []string, tx *gorm.DB) error {
+	a.Conflicts = nil
+	if AppointmentConflictPolicy == ConflictAllow {
+		return a.book(tx)
+	}
+	conflicts, err := a.FindConflicts(attendeeIds, tx)
+	if err != nil {
+		return err
+	}
+	if len(conflicts) > 0 && AppointmentConflictPolicy == ConflictReject {
+		first := conflicts[0]
+		return NewModeError(fmt.Sprintf("appointment overlaps %s (id=%s) starting at %s",
+			first.Subject, first.AppointmentId, first.Start.Format(time.RFC3339)))
+	}
+	if len(conflicts) > 0 {
+		a.Conflicts = conflicts
+	}
+	return a.book(tx)
+}
+
+// book stores the time range the appointment takes when conflicts are rejected,
+// the exclusion constraint on the range then keeps concurrent bookings of the
+// calendar apart. Recurring appointments are only checked by FindConflicts
+func (a *Appointment) book(tx *gorm.DB) error {
+	var dbState *gorm.DB
+	if AppointmentConflictPolicy == ConflictReject && !a.IsRecurring() {
+		start, end := a.span(a.Start)
+		dbState = tx.Exec(`UPDATE appointments SET during = tstzrange(?, ?, '[)') WHERE id = ?`, start, end, a.ID)
+	} else {
+		dbState = tx.Exec(`UPDATE appointments SET during = NULL WHERE id = ?`, a.ID)
+	}
+	if pqErr, ok := dbState.Error.(*pq.Error); ok && pqErr.Code == exclusionViolationCode {
+		return NewModeError("appointment overlaps another appointment of the calendar")
+	}
+	return dbState.Error
+}
@@ -0,0 +1,120 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseConflictPolicy(t *testing.T) {
+	policy, err := ParseConflictPolicy("Reject")
+	assert.Nil(t, err)
+	assert.Equal(t, ConflictReject, policy)
+
+	_, err = ParseConflictPolicy("ignore")
+	assert.NotNil(t, err)
+}
+
+func TestAppointment_Conflicts(t *testing.T) {
+	err := MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer DropAllData(db)
+	defer func(policy ConflictPolicy) { AppointmentConflictPolicy = policy }(AppointmentConflictPolicy)
+
+	overlapping := func(subject string) *Appointment {
+		return &Appointment{
+			Subject:    subject,
+			CalendarId: KnownCalendarId,
+			Start:      time.Date(2020, 1, 17, 21, 0, 0, 0, time.UTC),
+			End:        time.Date(2020, 1, 17, 23, 0, 0, 0, time.UTC),
+		}
+	}
+
+	t.Run("warn lists conflicts", func(tt *testing.T) {
+		AppointmentConflictPolicy = ConflictWarn
+		appt := overlapping("late dinner")
+		assert.Nil(tt, appt.Create(db))
+		assert.Len(tt, appt.Conflicts, 1)
+		assert.Equal(tt, AppointmentFixedTimeId, appt.Conflicts[0].AppointmentId)
+		assert.Empty(tt, appt.Conflicts[0].UserIds)
+		assert.Nil(tt, appt.Delete(db))
+	})
+
+	t.Run("reject overlapping appointment", func(tt *testing.T) {
+		AppointmentConflictPolicy = ConflictReject
+		appt := overlapping("late dinner")
+		assert.NotNil(tt, appt.Create(db))
+
+		var count int
+		db.Model(&Appointment{}).Where("subject = ?", "late dinner").Count(&count)
+		assert.Equal(tt, 0, count)
+	})
+
+	t.Run("reject recurring occurrence overlap", func(tt *testing.T) {
+		AppointmentConflictPolicy = ConflictReject
+		appt := &Appointment{
+			Subject:    "standup",
+			CalendarId: KnownCalendarId,
+			Start:      time.Date(2020, 1, 1, 9, 15, 0, 0, time.UTC),
+			End:        time.Date(2020, 1, 1, 9, 45, 0, 0, time.UTC),
+			Recurrence: "FREQ=DAILY;COUNT=7",
+		}
+		assert.NotNil(tt, appt.Create(db))
+	})
+
+	t.Run("reject attendee booked twice", func(tt *testing.T) {
+		AppointmentConflictPolicy = ConflictReject
+		var kotlinsCalendar Calendar
+		assert.Nil(tt, db.Where("user_id = ?", SecondKnownUserId).First(&kotlinsCalendar).Error)
+		appt := &Appointment{
+			Subject:    "day off",
+			CalendarId: kotlinsCalendar.ID,
+			Start:      time.Date(2020, 1, 18, 15, 0, 0, 0, time.UTC),
+			End:        time.Date(2020, 1, 18, 16, 0, 0, 0, time.UTC),
+			Attendees:  []*User{{Base: Base{ID: ThirdKnownUserId}}},
+		}
+		assert.NotNil(tt, appt.Create(db))
+
+		appt.Attendees = nil
+		assert.Nil(tt, appt.Create(db))
+	})
+
+	t.Run("update checks the stored appointment", func(tt *testing.T) {
+		AppointmentConflictPolicy = ConflictReject
+		appt := &Appointment{
+			Subject:    "early dinner",
+			CalendarId: KnownCalendarId,
+			Start:      time.Date(2020, 1, 17, 18, 0, 0, 0, time.UTC),
+			End:        time.Date(2020, 1, 17, 19, 0, 0, 0, time.UTC),
+		}
+		assert.Nil(tt, appt.Create(db))
+
+		appt.End = time.Date(2020, 1, 17, 20, 30, 0, 0, time.UTC)
+		assert.NotNil(tt, appt.Update(db))
+
+		appt.End = time.Date(2020, 1, 17, 20, 0, 0, 0, time.UTC)
+		assert.Nil(tt, appt.Update(db))
+	})
+
+	t.Run("exclusion constraint keeps bookings apart", func(tt *testing.T) {
+		AppointmentConflictPolicy = ConflictReject
+		appt := &Appointment{
+			Subject:    "booked",
+			CalendarId: KnownCalendarId,
+			Start:      time.Date(2020, 3, 2, 10, 0, 0, 0, time.UTC),
+			End:        time.Date(2020, 3, 2, 11, 0, 0, 0, time.UTC),
+		}
+		assert.Nil(tt, appt.Create(db))
+
+		other := &Appointment{
+			Subject:    "booked concurrently",
+			CalendarId: KnownCalendarId,
+			Start:      time.Date(2020, 3, 2, 10, 30, 0, 0, time.UTC),
+			End:        time.Date(2020, 3, 2, 11, 30, 0, 0, time.UTC),
+		}
+		assert.Nil(tt, db.Create(other).Error)
+		assert.NotNil(tt, other.book(db))
+	})
+}
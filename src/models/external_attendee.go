@@ -0,0 +1,191 @@
+package models
+
+import (
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"strings"
+)
+
+// ExternalAttendee attends an appointment without being a registered user.
+// It is turned into a regular attendee once a user registers with its email
+type ExternalAttendee struct {
+	Base
+	AppointmentId string              `gorm:"type:uuid;not null" json:"appointment_id"`
+	Email         string              `gorm:"not null" json:"email"`
+	Name          string              `json:"name"`
+	Status        ParticipationStatus `gorm:"not null;default:'needs-action'" json:"status"`
+	Role          AttendeeRole        `gorm:"not null;default:'required'" json:"role"`
+}
+
+func (e *ExternalAttendee) Validate() error {
+	e.Email = strings.ToLower(strings.TrimSpace(e.Email))
+	if e.Email == "" {
+		return NewModeError("attendee email can not be empty")
+	}
+	if !emailRegexp.MatchString(e.Email) {
+		return NewModeError(fmt.Sprintf("%s is not a valid email", e.Email))
+	}
+	e.Name = strings.TrimSpace(e.Name)
+	role, err := ParseAttendeeRole(string(e.Role))
+	if err != nil {
+		return err
+	}
+	e.Role = role
+	if e.Status == "" {
+		e.Status = StatusNeedsAction
+	}
+	return nil
+}
+
+// AddExternalAttendees invites people by email. Emails of registered users
+// invite the users themselves, the others are stored as external attendees.
+// A non empty role overrides the roles of the attendees
+func (a *Appointment) AddExternalAttendees(attendees []*ExternalAttendee, role AttendeeRole, db *gorm.DB) error {
+	if a.EmptyID() {
+		return EmptyIdError
+	}
+	if len(attendees) == 0 {
+		return nil
+	}
+	emails := make([]string, 0, len(attendees))
+	for _, e := range attendees {
+		if role != "" {
+			e.Role = role
+		}
+		if err := e.Validate(); err != nil {
+			return err
+		}
+		emails = append(emails, e.Email)
+	}
+	usrs, _, err := UsersByEmail(emails, db)
+	if err != nil {
+		return err
+	}
+	registered := make(map[string]*User, len(usrs))
+	for _, usr := range usrs {
+		registered[strings.ToLower(usr.Email)] = usr
+	}
+
+	tx := db.Begin()
+	before, err := versionedSnapshot(EntityAppointment, a.ID, a.Version, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, e := range attendees {
+		if usr, ok := registered[e.Email]; ok {
+			if err := tx.Model(a).Association("Attendees").Append(usr).Error; err != nil {
+				tx.Rollback()
+				return err
+			}
+			err := tx.Table("users_appointments").
+				Where("appointment_id = ? AND user_id = ?", a.ID, usr.ID).
+				Update("role", e.Role).Error
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+			continue
+		}
+		if err := e.save(a.ID, tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := recordAttendeesChange(a.ID, before, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if a.Version, err = versionOf(EntityAppointment, a.ID, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// save creates the attendee or updates the name and the role of the one with the same email
+func (e *ExternalAttendee) save(apptId string, db *gorm.DB) error {
+	e.AppointmentId = apptId
+	existing := ExternalAttendee{}
+	err := db.Where("appointment_id = ? AND email = ?", apptId, e.Email).First(&existing).Error
+	if gorm.IsRecordNotFoundError(err) {
+		e.ID = ""
+		return db.Create(e).Error
+	}
+	if err != nil {
+		return err
+	}
+	e.Base = existing.Base
+	e.Status = existing.Status
+	return db.Model(e).Updates(map[string]interface{}{"name": e.Name, "role": e.Role}).Error
+}
+
+// RemoveExternalAttendees takes the external attendees with the emails off the appointment
+func (a *Appointment) RemoveExternalAttendees(emails []string, db *gorm.DB) error {
+	if a.EmptyID() {
+		return EmptyIdError
+	}
+	if len(emails) == 0 {
+		return nil
+	}
+	lowered := make([]string, 0, len(emails))
+	for _, email := range emails {
+		lowered = append(lowered, strings.ToLower(strings.TrimSpace(email)))
+	}
+	tx := db.Begin()
+	before, err := versionedSnapshot(EntityAppointment, a.ID, a.Version, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Where("appointment_id = ? AND email IN (?)", a.ID, lowered).Delete(&ExternalAttendee{}).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := recordAttendeesChange(a.ID, before, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if a.Version, err = versionOf(EntityAppointment, a.ID, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// claimExternalAttendance turns the external attendees with the email of the
+// user into attendances of the user, recording the change of every appointment
+func (u *User) claimExternalAttendance(tx *gorm.DB) error {
+	email := strings.ToLower(u.Email)
+	var apptIds []string
+	err := tx.Model(&ExternalAttendee{}).Where("email = ?", email).Order("appointment_id").Pluck("appointment_id", &apptIds).Error
+	if err != nil || len(apptIds) == 0 {
+		return err
+	}
+	// every appointment is locked before the first change is recorded
+	befores := make([]interface{}, len(apptIds))
+	for i, apptId := range apptIds {
+		if befores[i], err = lockedSnapshot(EntityAppointment, apptId, tx); err != nil {
+			return err
+		}
+	}
+	err = tx.Exec(`INSERT INTO users_appointments (user_id, appointment_id, status, role)
+		SELECT ?, appointment_id, status, role FROM external_attendees WHERE email = ?
+		ON CONFLICT DO NOTHING`, u.ID, email).Error
+	if err != nil {
+		return err
+	}
+	if err := tx.Where("email = ?", email).Delete(&ExternalAttendee{}).Error; err != nil {
+		return err
+	}
+	for i, apptId := range apptIds {
+		if befores[i] == nil {
+			// deleted appointments are left as they were
+			continue
+		}
+		if err := recordAttendeesChange(apptId, befores[i], tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestAppointment_AddExternalAttendees(t *testing.T) {
+	err := MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer DropAllData(db)
+
+	t.Run("success", func(tt *testing.T) {
+		appt := &Appointment{Base: Base{ID: AppointmentFixedTimeId}}
+		err := appt.AddExternalAttendees([]*ExternalAttendee{
+			{Email: " Customer@Example.com ", Name: "Jane Customer"},
+			{Email: "kotlinjackson@gmail.com", Role: AttendeeOptional},
+		}, "", db)
+		assert.Nil(tt, err)
+		assert.Nil(tt, appt.Read(db))
+		assert.Len(tt, appt.ExternalAttendees, 1)
+		assert.Equal(tt, "customer@example.com", appt.ExternalAttendees[0].Email)
+		assert.Equal(tt, "Jane Customer", appt.ExternalAttendees[0].Name)
+		assert.Equal(tt, StatusNeedsAction, appt.ExternalAttendees[0].Status)
+		// emails of registered users invite the users
+		assert.Len(tt, appt.Attendees, 1)
+		assert.Equal(tt, SecondKnownUserId, appt.Attendees[0].ID)
+		assert.Equal(tt, AttendeeOptional, appt.Attendees[0].Participation.Role)
+	})
+
+	t.Run("success invite again", func(tt *testing.T) {
+		appt := &Appointment{Base: Base{ID: AppointmentFixedTimeId}}
+		err := appt.AddExternalAttendees([]*ExternalAttendee{{Email: "customer@example.com", Name: "Jane"}}, AttendeeChair, db)
+		assert.Nil(tt, err)
+		assert.Nil(tt, appt.Read(db))
+		assert.Len(tt, appt.ExternalAttendees, 1)
+		assert.Equal(tt, "Jane", appt.ExternalAttendees[0].Name)
+		assert.Equal(tt, AttendeeChair, appt.ExternalAttendees[0].Role)
+	})
+
+	t.Run("success matched on registration", func(tt *testing.T) {
+		invited := &Appointment{Base: Base{ID: AppointmentFixedTimeId}}
+		assert.Nil(tt, invited.Read(db))
+		usr := &User{FirstName: "Jane", LastName: "Customer", Email: "customer@example.com"}
+		assert.Nil(tt, usr.Create(db))
+
+		appt := &Appointment{Base: Base{ID: AppointmentFixedTimeId}}
+		assert.Nil(tt, appt.Read(db))
+		assert.Equal(tt, invited.Version+1, appt.Version)
+		assert.Len(tt, appt.ExternalAttendees, 0)
+		assert.Len(tt, appt.Attendees, 2)
+		for _, attendee := range appt.Attendees {
+			if attendee.ID == usr.ID {
+				assert.Equal(tt, AttendeeChair, attendee.Participation.Role)
+			}
+		}
+		// the new attendee finds the appointment in the change feed
+		feed := ChangeFeed{UserId: usr.ID}
+		page, err := feed.Run(db)
+		assert.Nil(tt, err)
+		if assert.Len(tt, page.Changes, 2) {
+			assert.Equal(tt, EventAttendeesChanged, page.Changes[0].Event)
+			assert.Equal(tt, AppointmentFixedTimeId, page.Changes[0].EntityId)
+			assert.Equal(tt, EventUserCreated, page.Changes[1].Event)
+		}
+	})
+
+	t.Run("success remove", func(tt *testing.T) {
+		appt := &Appointment{Base: Base{ID: AppointmentWholeDayId}}
+		err := appt.AddExternalAttendees([]*ExternalAttendee{{Email: "guest@example.com"}}, "", db)
+		assert.Nil(tt, err)
+		assert.Nil(tt, appt.RemoveExternalAttendees([]string{"Guest@example.com"}, db))
+		assert.Nil(tt, appt.Read(db))
+		assert.Len(tt, appt.ExternalAttendees, 0)
+	})
+
+	t.Run("fail invalid email", func(tt *testing.T) {
+		appt := &Appointment{Base: Base{ID: AppointmentFixedTimeId}}
+		err := appt.AddExternalAttendees([]*ExternalAttendee{{Email: "not an email"}}, "", db)
+		assert.NotNil(tt, err)
+	})
+
+	t.Run("fail unexisting appointment id", func(tt *testing.T) {
+		appt := &Appointment{Base: Base{ID: UnexistingId}}
+		err := appt.AddExternalAttendees([]*ExternalAttendee{{Email: "guest@example.com"}}, "", db)
+		assert.NotNil(tt, err)
+	})
+}
@@ -12,6 +12,7 @@ const (
 	KnownCalendarId        = "b09b7b26-4d83-11ea-b1e0-c83a35cc61f1"
 	AppointmentFixedTimeId = "4e7ca4b6-4da5-11ea-b1e0-c83a35cc61f1"
 	AppointmentWholeDayId  = "33148505-7595-4c2a-9a45-bc885d0910a6"
+	AppointmentRecurringId = "9a1d3c52-5b7e-11ea-8e2d-c83a35cc61f1"
 
 	UnexistingId = "12345678-1234-5678-1234-567812345678"
 )
@@ -50,8 +51,19 @@ func MockDbData(db *gorm.DB) error {
 		Attendees:   []*User{thirdUser},
 	}
 
+	jonsRecurringAppointment := &Appointment{
+		Base:        Base{ID: AppointmentRecurringId},
+		Subject:     "Weekly sync",
+		Description: "monday and wednesday team sync",
+		CalendarId:  KnownCalendarId,
+		Start:       time.Date(2020, 1, 6, 9, 0, 0, 0, time.UTC),
+		End:         time.Date(2020, 1, 6, 9, 30, 0, 0, time.UTC),
+		Recurrence:  "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10",
+	}
+
 	db.Create(jonsFixedTimeAppointment)
 	db.Create(jonsWholeDayAppointment)
+	db.Create(jonsRecurringAppointment)
 
 	return nil
 }
@@ -0,0 +1,163 @@
+package models
+
+import (
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"sort"
+	"time"
+)
+
+// MaxFreeBusyRange limits the time range of a single free/busy query
+const MaxFreeBusyRange = 366 * 24 * time.Hour
+
+type Interval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+type FreeBusyQuery struct {
+	UserIds []string  `json:"user_ids"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	// ViewerId, when set, limits the busy time to the calendars the viewer
+	// owns or has been shared at any level and to the appointments they attend
+	ViewerId string `json:"-"`
+}
+
+type UserBusy struct {
+	UserId string      `json:"user_id"`
+	Busy   []*Interval `json:"busy"`
+}
+
+type FreeBusy struct {
+	From  time.Time   `json:"from"`
+	To    time.Time   `json:"to"`
+	Users []*UserBusy `json:"users"`
+}
+
+func (q *FreeBusyQuery) Validate() error {
+	if len(q.UserIds) == 0 {
+		return NewModeError("user_ids can not be empty")
+	}
+	if q.From.IsZero() || q.To.IsZero() {
+		return NewModeError("from and to can not be empty")
+	}
+	if !q.From.Before(q.To) {
+		return NewModeError("from should be before to")
+	}
+	if q.To.Sub(q.From) > MaxFreeBusyRange {
+		return NewModeError(fmt.Sprintf("time range can not be longer than %d days", MaxFreeBusyRange/(24*time.Hour)))
+	}
+	return nil
+}
+
+// Interval returns the time the occurrence takes.
+// Whole day occurrences take the entire day of their start
+func (o *Occurrence) Interval() *Interval {
+	if o.WholeDay {
+		dayStart := time.Date(o.Start.Year(), o.Start.Month(), o.Start.Day(), 0, 0, 0, 0, o.Start.Location())
+		return &Interval{Start: dayStart, End: dayStart.AddDate(0, 0, 1)}
+	}
+	return &Interval{Start: o.Start, End: o.End}
+}
+
+// Run reads the busy time of every requested user. A user is busy during
+// the appointments of all of their calendars and the ones they attend
+// that the viewer may see
+func (q *FreeBusyQuery) Run(db *gorm.DB) (*FreeBusy, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	result := &FreeBusy{From: q.From, To: q.To, Users: make([]*UserBusy, 0, len(q.UserIds))}
+	for _, userId := range q.UserIds {
+		usr := User{Base: Base{ID: userId}}
+		if err := db.First(&usr).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return nil, NewModeError(fmt.Sprintf("user with id=%s not present in the db", userId))
+			}
+			return nil, err
+		}
+		busy, err := BusyIntervals(userId, q.ViewerId, q.From, q.To, db)
+		if err != nil {
+			return nil, err
+		}
+		result.Users = append(result.Users, &UserBusy{UserId: userId, Busy: busy})
+	}
+	return result, nil
+}
+
+// UserAppointments selects the appointments a user owns or attends that may
+// have occurrences in [from, to). Recurring series are always selected
+func UserAppointments(userId string, from, to time.Time, db *gorm.DB) ([]*Appointment, error) {
+	appts := make([]*Appointment, 0)
+	// whole day appointments may start up to a day later in UTC than the day they take
+	dbState := db.Preload("Exceptions").
+		Where("calendar_id IN (SELECT id FROM calendars WHERE user_id = ?) OR "+
+			"id IN (SELECT appointment_id FROM users_appointments WHERE user_id = ?)", userId, userId).
+		Where(`COALESCE(recurrence, '') <> '' OR (start < ? AND (whole_day OR "end" > ?))`,
+			to.Add(24*time.Hour), from).
+		Find(&appts)
+	if dbState.Error != nil {
+		return nil, dbState.Error
+	}
+	return appts, nil
+}
+
+// BusyIntervals returns the merged busy time of a user within [from, to)
+// as seen by the viewer. An empty viewerId sees all of it
+func BusyIntervals(userId, viewerId string, from, to time.Time, db *gorm.DB) ([]*Interval, error) {
+	if viewerId != "" {
+		db = db.Where("calendar_id IN (SELECT id FROM calendars WHERE user_id = ?) OR "+
+			"calendar_id IN (SELECT calendar_id FROM calendar_shares WHERE user_id = ?) OR "+
+			"id IN (SELECT appointment_id FROM users_appointments WHERE user_id = ?)", viewerId, viewerId, viewerId)
+	}
+	appts, err := UserAppointments(userId, from, to, db)
+	if err != nil {
+		return nil, err
+	}
+	intervals := make([]*Interval, 0)
+	for _, appt := range appts {
+		occurrences, err := appt.Occurrences(from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, occ := range occurrences {
+			intervals = append(intervals, occ.Interval())
+		}
+	}
+	return MergeIntervals(intervals, from, to), nil
+}
+
+// MergeIntervals clips the intervals to [from, to) and merges the
+// overlapping and adjacent ones, the result is sorted by start
+func MergeIntervals(intervals []*Interval, from, to time.Time) []*Interval {
+	clipped := make([]*Interval, 0, len(intervals))
+	for _, i := range intervals {
+		start, end := i.Start.UTC(), i.End.UTC()
+		if start.Before(from) {
+			start = from.UTC()
+		}
+		if end.After(to) {
+			end = to.UTC()
+		}
+		if start.Before(end) {
+			clipped = append(clipped, &Interval{Start: start, End: end})
+		}
+	}
+	sort.Slice(clipped, func(i, j int) bool {
+		return clipped[i].Start.Before(clipped[j].Start)
+	})
+
+	merged := make([]*Interval, 0, len(clipped))
+	for _, i := range clipped {
+		last := len(merged) - 1
+		if last >= 0 && !i.Start.After(merged[last].End) {
+			if i.End.After(merged[last].End) {
+				merged[last].End = i.End
+			}
+			continue
+		}
+		merged = append(merged, i)
+	}
+	return merged
+}
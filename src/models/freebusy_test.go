@@ -0,0 +1,90 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestMergeIntervals(t *testing.T) {
+	at := func(hour, min int) time.Time {
+		return time.Date(2020, 1, 6, hour, min, 0, 0, time.UTC)
+	}
+	intervals := []*Interval{
+		{Start: at(13, 0), End: at(14, 0)},
+		{Start: at(7, 0), End: at(9, 30)},
+		{Start: at(9, 30), End: at(10, 0)},
+		{Start: at(13, 30), End: at(13, 45)},
+		{Start: at(20, 0), End: at(23, 0)},
+		{Start: at(23, 30), End: at(23, 45)},
+	}
+	merged := MergeIntervals(intervals, at(8, 0), at(22, 0))
+	assert.Equal(t, []*Interval{
+		{Start: at(8, 0), End: at(10, 0)},
+		{Start: at(13, 0), End: at(14, 0)},
+		{Start: at(20, 0), End: at(22, 0)},
+	}, merged)
+}
+
+func TestFreeBusyQuery_Run(t *testing.T) {
+	err := MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer DropAllData(db)
+
+	from := time.Date(2020, 1, 17, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2020, 1, 21, 0, 0, 0, 0, time.UTC)
+
+	t.Run("success owned and attended appointments", func(tt *testing.T) {
+		query := FreeBusyQuery{UserIds: []string{KnownUserId, ThirdKnownUserId, SecondKnownUserId}, From: from, To: to}
+		res, err := query.Run(db)
+		assert.Nil(tt, err)
+		assert.Len(tt, res.Users, 3)
+
+		assert.Equal(tt, KnownUserId, res.Users[0].UserId)
+		assert.Equal(tt, []*Interval{
+			{Start: time.Date(2020, 1, 17, 20, 0, 0, 0, time.UTC), End: time.Date(2020, 1, 17, 22, 30, 0, 0, time.UTC)},
+			{Start: time.Date(2020, 1, 18, 0, 0, 0, 0, time.UTC), End: time.Date(2020, 1, 19, 0, 0, 0, 0, time.UTC)},
+			{Start: time.Date(2020, 1, 20, 9, 0, 0, 0, time.UTC), End: time.Date(2020, 1, 20, 9, 30, 0, 0, time.UTC)},
+		}, res.Users[0].Busy)
+
+		assert.Equal(tt, []*Interval{
+			{Start: time.Date(2020, 1, 18, 0, 0, 0, 0, time.UTC), End: time.Date(2020, 1, 19, 0, 0, 0, 0, time.UTC)},
+		}, res.Users[1].Busy)
+		assert.Empty(tt, res.Users[2].Busy)
+	})
+
+	t.Run("success limited to the calendars the viewer can see", func(tt *testing.T) {
+		query := FreeBusyQuery{UserIds: []string{KnownUserId}, From: from, To: to, ViewerId: SecondKnownUserId}
+		res, err := query.Run(db)
+		assert.Nil(tt, err)
+		assert.Empty(tt, res.Users[0].Busy)
+
+		share := &CalendarShare{CalendarId: KnownCalendarId, UserId: SecondKnownUserId, Level: ShareFreeBusy}
+		if err := db.Create(share).Error; err != nil {
+			tt.Fatal("unable to share calendar", err)
+		}
+		defer db.Delete(share)
+		res, err = query.Run(db)
+		assert.Nil(tt, err)
+		assert.Len(tt, res.Users[0].Busy, 3)
+
+		query = FreeBusyQuery{UserIds: []string{ThirdKnownUserId}, From: from, To: to, ViewerId: ThirdKnownUserId}
+		res, err = query.Run(db)
+		assert.Nil(tt, err)
+		assert.Len(tt, res.Users[0].Busy, 1)
+	})
+
+	t.Run("fail unknown user", func(tt *testing.T) {
+		query := FreeBusyQuery{UserIds: []string{UnexistingId}, From: from, To: to}
+		_, err := query.Run(db)
+		assert.NotNil(tt, err)
+	})
+
+	t.Run("fail invalid range", func(tt *testing.T) {
+		query := FreeBusyQuery{UserIds: []string{KnownUserId}, From: to, To: from}
+		_, err := query.Run(db)
+		assert.NotNil(tt, err)
+	})
+}
@@ -0,0 +1,94 @@
+package models
+
+import (
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"time"
+)
+
+type ImportStatus string
+
+const (
+	ImportCreated ImportStatus = "created"
+	ImportSkipped ImportStatus = "skipped"
+	ImportFailed  ImportStatus = "failed"
+
+	uniqueViolationCode = "23505"
+)
+
+// ImportItem is the outcome of importing a single event
+type ImportItem struct {
+	Uid           string       `json:"uid"`
+	Subject       string       `json:"subject"`
+	Status        ImportStatus `json:"status"`
+	AppointmentId string       `json:"appointment_id,omitempty"`
+	Error         string       `json:"error,omitempty"`
+	Warnings      []string     `json:"warnings,omitempty"`
+}
+
+type ImportReport struct {
+	Created int           `json:"created"`
+	Skipped int           `json:"skipped"`
+	Failed  int           `json:"failed"`
+	Items   []*ImportItem `json:"items"`
+}
+
+func (r *ImportReport) Add(item *ImportItem) {
+	switch item.Status {
+	case ImportCreated:
+		r.Created++
+	case ImportSkipped:
+		r.Skipped++
+	default:
+		r.Failed++
+	}
+	r.Items = append(r.Items, item)
+}
+
+// Import creates the appointment, resolving attendee
+// emails into existing users. An appointment with the same subject in the
+// calendar makes the import skip the event instead of failing it
+func (a *Appointment) Import(uid string, attendeeEmails []string, db *gorm.DB) *ImportItem {
+	item := &ImportItem{Uid: uid, Subject: a.Subject, Status: ImportFailed}
+	if err := a.Validate(); err != nil {
+		item.Error = err.Error()
+		return item
+	}
+
+	var duplicates int
+	dbState := db.Model(&Appointment{}).
+		Where("calendar_id = ? AND subject = ? AND parent_id IS NULL", a.CalendarId, a.Subject).
+		Count(&duplicates)
+	if dbState.Error != nil {
+		item.Error = dbState.Error.Error()
+		return item
+	}
+	if duplicates > 0 {
+		item.Status = ImportSkipped
+		item.Error = "appointment with the same subject already exists"
+		return item
+	}
+
+	attendees, warnings, err := UsersByEmail(attendeeEmails, db)
+	if err != nil {
+		item.Error = err.Error()
+		return item
+	}
+	item.Warnings = warnings
+	a.Attendees = attendees
+
+	if err := a.Create(db); err != nil {
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == uniqueViolationCode {
+			item.Status = ImportSkipped
+		}
+		item.Error = err.Error()
+		return item
+	}
+	item.Status = ImportCreated
+	item.AppointmentId = a.ID
+	for _, c := range a.Conflicts {
+		item.Warnings = append(item.Warnings, fmt.Sprintf("overlaps %s starting at %s", c.Subject, c.Start.Format(time.RFC3339)))
+	}
+	return item
+}
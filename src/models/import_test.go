@@ -0,0 +1,66 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestAppointment_Import(t *testing.T) {
+	err := MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer DropAllData(db)
+
+	t.Run("success", func(tt *testing.T) {
+		appt := &Appointment{
+			Subject:    "imported",
+			CalendarId: KnownCalendarId,
+			Start:      time.Date(2020, 2, 1, 10, 0, 0, 0, time.UTC),
+			End:        time.Date(2020, 2, 1, 11, 0, 0, 0, time.UTC),
+		}
+		item := appt.Import("imported@example.com", []string{"Jhon@gmail.com", "stranger@example.com"}, db)
+		assert.Equal(tt, ImportCreated, item.Status)
+		assert.NotEmpty(tt, item.AppointmentId)
+		assert.Len(tt, item.Warnings, 1)
+
+		stored := &Appointment{Base: Base{ID: item.AppointmentId}}
+		assert.Nil(tt, stored.Read(db))
+		assert.Len(tt, stored.Attendees, 1)
+		assert.Equal(tt, "John", stored.Attendees[0].FirstName)
+	})
+
+	t.Run("skipped duplicate", func(tt *testing.T) {
+		appt := &Appointment{
+			Subject:    "Meet friends",
+			CalendarId: KnownCalendarId,
+			Start:      time.Date(2020, 2, 1, 10, 0, 0, 0, time.UTC),
+			WholeDay:   true,
+		}
+		item := appt.Import("duplicate@example.com", nil, db)
+		assert.Equal(tt, ImportSkipped, item.Status)
+	})
+
+	t.Run("failed invalid", func(tt *testing.T) {
+		appt := &Appointment{
+			Subject:    "invalid",
+			CalendarId: KnownCalendarId,
+		}
+		item := appt.Import("invalid@example.com", nil, db)
+		assert.Equal(tt, ImportFailed, item.Status)
+		assert.NotEmpty(tt, item.Error)
+	})
+}
+
+func TestImportReport_Add(t *testing.T) {
+	report := &ImportReport{}
+	report.Add(&ImportItem{Status: ImportCreated})
+	report.Add(&ImportItem{Status: ImportSkipped})
+	report.Add(&ImportItem{Status: ImportFailed})
+	report.Add(&ImportItem{Status: ImportCreated})
+	assert.Equal(t, 2, report.Created)
+	assert.Equal(t, 1, report.Skipped)
+	assert.Equal(t, 1, report.Failed)
+	assert.Len(t, report.Items, 4)
+}
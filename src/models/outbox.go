@@ -0,0 +1,362 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	"github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/lib/pq"
+	"strconv"
+	"time"
+)
+
+const (
+	DefaultChangeLimit = 100
+	MaxChangeLimit     = 1000
+)
+
+type EntityType string
+
+const (
+	EntityUser        EntityType = "user"
+	EntityCalendar    EntityType = "calendar"
+	EntityAppointment EntityType = "appointment"
+)
+
+type ChangeOperation string
+
+const (
+	ChangeCreate ChangeOperation = "create"
+	ChangeUpdate ChangeOperation = "update"
+	ChangeDelete ChangeOperation = "delete"
+
+	// ChangesChannel is notified with the id of every change once its transaction commits
+	ChangesChannel = "outbox"
+)
+
+var changeEvents = map[EntityType]map[ChangeOperation]EventType{
+	EntityUser:        {ChangeCreate: EventUserCreated, ChangeUpdate: EventUserUpdated, ChangeDelete: EventUserDeleted},
+	EntityCalendar:    {ChangeCreate: EventCalendarCreated, ChangeUpdate: EventCalendarUpdated, ChangeDelete: EventCalendarDeleted},
+	EntityAppointment: {ChangeCreate: EventAppointmentCreated, ChangeUpdate: EventAppointmentUpdated, ChangeDelete: EventAppointmentDeleted},
+}
+
+// Change is an entry of the outbox, written in the transaction changing the
+// entity. Before is null for created entities and After for deleted ones.
+// Audience lists the users who could read the entity before or after the change,
+// CalendarIds the calendars the entity belonged to before or after it
+type Change struct {
+	ID          int64           `gorm:"primary_key" json:"-"`
+	Cursor      string          `gorm:"-" json:"cursor"`
+	Event       EventType       `gorm:"not null" json:"event"`
+	Entity      EntityType      `gorm:"not null" json:"entity"`
+	EntityId    string          `gorm:"type:uuid;not null" json:"entity_id"`
+	Operation   ChangeOperation `gorm:"not null" json:"operation"`
+	Before      *postgres.Jsonb `json:"before"`
+	After       *postgres.Jsonb `json:"after"`
+	Audience    pq.StringArray  `gorm:"type:text[]" json:"-"`
+	CalendarIds pq.StringArray  `gorm:"type:text[]" json:"-"`
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+func (Change) TableName() string {
+	return "outbox"
+}
+
+func (c *Change) AfterFind() (err error) {
+	c.Cursor = strconv.FormatInt(c.ID, 10)
+	return
+}
+
+// ChangeFeed reads the changes made after the one Since points to, in the
+// order they were made. An empty Since starts from the first change.
+// The changes are the ones UserId is in the audience of when it is set
+// and the ones of the calendar with CalendarId when that is set
+type ChangeFeed struct {
+	UserId     string
+	CalendarId string
+	Since      string
+	Limit      int
+}
+
+// ChangePage is a page of the change feed, NextCursor resumes the feed after
+// its last change and is Since when no change was made since
+type ChangePage struct {
+	Changes    []*Change `json:"changes"`
+	NextCursor string    `json:"next_cursor"`
+}
+
+func (f *ChangeFeed) Validate() error {
+	if f.UserId == "" && f.CalendarId == "" {
+		return NewModeError("change feed needs either a user or a calendar")
+	}
+	if f.Since != "" {
+		if id, err := strconv.ParseInt(f.Since, 10, 64); err != nil || id < 0 {
+			return InvalidCursorError
+		}
+	}
+	if f.Limit == 0 {
+		f.Limit = DefaultChangeLimit
+	}
+	if f.Limit < 0 || f.Limit > MaxChangeLimit {
+		return NewModeError(fmt.Sprintf("limit should be between 1 and %d", MaxChangeLimit))
+	}
+	return nil
+}
+
+// Run returns the changes the user is in the audience of
+func (f *ChangeFeed) Run(db *gorm.DB) (*ChangePage, error) {
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	var since int64
+	if f.Since != "" {
+		since, _ = strconv.ParseInt(f.Since, 10, 64)
+	}
+	changes := make([]*Change, 0, f.Limit)
+	query := db.Where("id > ?", since)
+	if f.UserId != "" {
+		query = query.Where("? = ANY(audience)", f.UserId)
+	}
+	if f.CalendarId != "" {
+		query = query.Where("? = ANY(calendar_ids)", f.CalendarId)
+	}
+	err := query.Order("id").Limit(f.Limit).Find(&changes).Error
+	if err != nil {
+		return nil, err
+	}
+	page := &ChangePage{Changes: changes, NextCursor: f.Since}
+	if len(changes) > 0 {
+		page.NextCursor = changes[len(changes)-1].Cursor
+	}
+	return page, nil
+}
+
+// snapshot reads the entity as it is within the transaction, nil when it does not exist.
+// Appointments come with their attendees and exceptions, the other entities alone
+func snapshot(entity EntityType, id string, tx *gorm.DB) (interface{}, error) {
+	var value interface{}
+	query := tx
+	switch entity {
+	case EntityUser:
+		value = &User{}
+	case EntityCalendar:
+		value = &Calendar{}
+	case EntityAppointment:
+		value = &Appointment{}
+		query = tx.Preload("Attendees").Preload("ExternalAttendees").Preload("Exceptions")
+	default:
+		return nil, NewModeError(fmt.Sprintf("unknown entity %s", entity))
+	}
+	err := query.Where("id = ?", id).First(value).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if appt, ok := value.(*Appointment); ok {
+		if err := loadParticipation([]*Appointment{appt}, tx); err != nil {
+			return nil, err
+		}
+	}
+	return value, nil
+}
+
+// lockedSnapshot locks the entity, see lockRow, and takes its snapshot. Writers take
+// it first thing in their transaction as the before state of their change
+func lockedSnapshot(entity EntityType, id string, tx *gorm.DB) (interface{}, error) {
+	if _, err := lockRow(entity, id, tx); err != nil {
+		return nil, err
+	}
+	return snapshot(entity, id, tx)
+}
+
+// versionedSnapshot is lockedSnapshot for the writers expecting the entity at a version, see checkVersion
+func versionedSnapshot(entity EntityType, id string, version int64, tx *gorm.DB) (interface{}, error) {
+	if err := checkVersion(entity, id, version, tx); err != nil {
+		return nil, err
+	}
+	return snapshot(entity, id, tx)
+}
+
+// CalendarReaders returns the owner of the calendar and the users it is shared with at the read level at least
+func CalendarReaders(calendarId string, db *gorm.DB) ([]string, error) {
+	rows := make([]*struct{ UserId string }, 0)
+	err := db.Raw(`SELECT user_id FROM calendars WHERE id = ?
+		UNION SELECT user_id FROM calendar_shares WHERE calendar_id = ? AND level IN (?)`,
+		calendarId, calendarId, readerLevels).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	readers := make([]string, 0, len(rows))
+	for _, row := range rows {
+		readers = append(readers, row.UserId)
+	}
+	return readers, nil
+}
+
+// calendarOf returns the calendar the entity in the state given belongs to
+func calendarOf(value interface{}) string {
+	switch v := value.(type) {
+	case *Calendar:
+		return v.ID
+	case *Appointment:
+		return v.CalendarId
+	}
+	return ""
+}
+
+// audienceOf returns the users who can read the entity in the state given
+func audienceOf(value interface{}, tx *gorm.DB) ([]string, error) {
+	switch v := value.(type) {
+	case *User:
+		return []string{v.ID}, nil
+	case *Calendar:
+		return CalendarReaders(v.ID, tx)
+	case *Appointment:
+		readers, err := CalendarReaders(v.CalendarId, tx)
+		if err != nil {
+			return nil, err
+		}
+		for _, usr := range v.Attendees {
+			readers = append(readers, usr.ID)
+		}
+		return readers, nil
+	}
+	return nil, nil
+}
+
+func toJsonb(value interface{}) (*postgres.Jsonb, error) {
+	if value == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	return &postgres.Jsonb{RawMessage: data}, nil
+}
+
+// recordChange adds the change of the entity to the outbox. It is called within
+// the transaction making the change, as its last step or, for deletions, right
+// before the entity is deleted. before is the snapshot taken when the transaction
+// started. The entity should be locked since then, see lockRow. Writers of the
+// outbox are serialized until they commit, so changes become visible in the order of their ids
+func recordChange(entity EntityType, id string, operation ChangeOperation, before interface{}, tx *gorm.DB) error {
+	return writeChange(changeEvents[entity][operation], entity, id, operation, before, nil, tx)
+}
+
+// recordAttendeesChange records the change of the attendees of the appointment or of their participation
+func recordAttendeesChange(apptId string, before interface{}, tx *gorm.DB) error {
+	return writeChange(EventAttendeesChanged, EntityAppointment, apptId, ChangeUpdate, before, nil, tx)
+}
+
+// recordSharesChange records the change of the users the calendar is shared with.
+// formerReaders are the users who could read the calendar before the change
+func recordSharesChange(calendarId string, before interface{}, formerReaders []string, tx *gorm.DB) error {
+	return writeChange(EventSharesChanged, EntityCalendar, calendarId, ChangeUpdate, before, formerReaders, tx)
+}
+
+// writeChange adds the change to the outbox, its audience being the users who could read
+// the entity before or after it, together with formerReaders when the access to it changed.
+// The deliveries of the change to the webhooks of the audience are enqueued along with it
+func writeChange(event EventType, entity EntityType, id string, operation ChangeOperation, before interface{}, formerReaders []string, tx *gorm.DB) error {
+	if operation == ChangeUpdate {
+		if err := bumpVersion(entity, id, tx); err != nil {
+			return err
+		}
+	}
+	var after interface{}
+	if operation != ChangeDelete {
+		var err error
+		if after, err = snapshot(entity, id, tx); err != nil {
+			return err
+		}
+	}
+
+	seen := make(map[string]bool)
+	audience := pq.StringArray{}
+	for _, userId := range formerReaders {
+		if !seen[userId] {
+			seen[userId] = true
+			audience = append(audience, userId)
+		}
+	}
+	calendarIds := pq.StringArray{}
+	for _, value := range []interface{}{before, after} {
+		if value == nil {
+			continue
+		}
+		if calendarId := calendarOf(value); calendarId != "" && (len(calendarIds) == 0 || calendarIds[0] != calendarId) {
+			calendarIds = append(calendarIds, calendarId)
+		}
+		userIds, err := audienceOf(value, tx)
+		if err != nil {
+			return err
+		}
+		for _, userId := range userIds {
+			if !seen[userId] {
+				seen[userId] = true
+				audience = append(audience, userId)
+			}
+		}
+	}
+
+	change := &Change{
+		Event:       event,
+		Entity:      entity,
+		EntityId:    id,
+		Operation:   operation,
+		Audience:    audience,
+		CalendarIds: calendarIds,
+	}
+	var err error
+	if change.Before, err = toJsonb(before); err != nil {
+		return err
+	}
+	if change.After, err = toJsonb(after); err != nil {
+		return err
+	}
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext('outbox'))").Error; err != nil {
+		return err
+	}
+	if err := tx.Create(change).Error; err != nil {
+		return err
+	}
+	// webhooks get the change in the same transaction, the entity as it is after
+	// the change or, for deletions, as it was before
+	data := after
+	if operation == ChangeDelete {
+		data = before
+	}
+	webhookEvent := &Event{ID: uuid.New().String(), Type: event, OccurredAt: change.CreatedAt, Data: data}
+	if err := EnqueueEvent(webhookEvent, change.Audience, tx); err != nil {
+		return err
+	}
+	return tx.Exec("SELECT pg_notify(?, ?)", ChangesChannel, strconv.FormatInt(change.ID, 10)).Error
+}
+
+// recordCalendarDeletion records the deletion of the calendar together with the appointments
+// deleted along with it. It is called before the calendar is deleted, once locked with lockCalendars
+func recordCalendarDeletion(calendarId string, tx *gorm.DB) error {
+	var apptIds []string
+	if err := tx.Model(&Appointment{}).Where("calendar_id = ?", calendarId).Pluck("id", &apptIds).Error; err != nil {
+		return err
+	}
+	for _, apptId := range apptIds {
+		before, err := snapshot(EntityAppointment, apptId, tx)
+		if err != nil {
+			return err
+		}
+		if err := recordChange(EntityAppointment, apptId, ChangeDelete, before, tx); err != nil {
+			return err
+		}
+	}
+	before, err := snapshot(EntityCalendar, calendarId, tx)
+	if err != nil {
+		return err
+	}
+	return recordChange(EntityCalendar, calendarId, ChangeDelete, before, tx)
+}
@@ -0,0 +1,214 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestChangeFeed_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		feed    ChangeFeed
+		wantErr bool
+	}{
+		{name: "from the start", feed: ChangeFeed{UserId: KnownUserId}},
+		{name: "of a calendar", feed: ChangeFeed{CalendarId: KnownCalendarId}},
+		{name: "of nothing", feed: ChangeFeed{}, wantErr: true},
+		{name: "since", feed: ChangeFeed{UserId: KnownUserId, Since: "42", Limit: 10}},
+		{name: "invalid cursor", feed: ChangeFeed{UserId: KnownUserId, Since: "abc"}, wantErr: true},
+		{name: "negative cursor", feed: ChangeFeed{UserId: KnownUserId, Since: "-1"}, wantErr: true},
+		{name: "limit too big", feed: ChangeFeed{UserId: KnownUserId, Limit: MaxChangeLimit + 1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.feed.Validate()
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestRecordChange(t *testing.T) {
+	err := MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer DropAllData(db)
+
+	cal := &Calendar{Name: "Outbox calendar", UserId: KnownUserId}
+	if err := cal.Create(db); err != nil {
+		t.Fatal("unable to create calendar", err)
+	}
+	start := time.Date(2020, 2, 3, 10, 0, 0, 0, time.UTC)
+	appt := &Appointment{Subject: "Outbox review", CalendarId: cal.ID, Start: start, End: start.Add(time.Hour)}
+	if err := appt.Create(db); err != nil {
+		t.Fatal("unable to create appointment", err)
+	}
+	if err := appt.AddAttendees([]string{SecondKnownUserId}, "", db); err != nil {
+		t.Fatal("unable to add attendee", err)
+	}
+	appt.Subject = "Outbox retro"
+	if err := appt.Update(db); err != nil {
+		t.Fatal("unable to update appointment", err)
+	}
+	if err := cal.Delete(db); err != nil {
+		t.Fatal("unable to delete calendar", err)
+	}
+
+	feed := ChangeFeed{UserId: KnownUserId}
+	page, err := feed.Run(db)
+	assert.Nil(t, err)
+	if !assert.Len(t, page.Changes, 6) {
+		return
+	}
+	expected := []struct {
+		event     EventType
+		operation ChangeOperation
+	}{
+		{EventCalendarCreated, ChangeCreate},
+		{EventAppointmentCreated, ChangeCreate},
+		{EventAttendeesChanged, ChangeUpdate},
+		{EventAppointmentUpdated, ChangeUpdate},
+		{EventAppointmentDeleted, ChangeDelete},
+		{EventCalendarDeleted, ChangeDelete},
+	}
+	for i, e := range expected {
+		assert.Equal(t, e.event, page.Changes[i].Event)
+		assert.Equal(t, e.operation, page.Changes[i].Operation)
+		assert.Equal(t, []string{cal.ID}, []string(page.Changes[i].CalendarIds))
+	}
+	assert.Nil(t, page.Changes[0].Before)
+	assert.Nil(t, page.Changes[5].After)
+
+	update := page.Changes[3]
+	var before, after Appointment
+	assert.Nil(t, json.Unmarshal(update.Before.RawMessage, &before))
+	assert.Nil(t, json.Unmarshal(update.After.RawMessage, &after))
+	assert.Equal(t, "Outbox review", before.Subject)
+	assert.Equal(t, "Outbox retro", after.Subject)
+	assert.Equal(t, page.Changes[5].Cursor, page.NextCursor)
+
+	// the feed resumes after the cursor
+	feed = ChangeFeed{UserId: KnownUserId, Since: page.Changes[3].Cursor}
+	resumed, err := feed.Run(db)
+	assert.Nil(t, err)
+	assert.Len(t, resumed.Changes, 2)
+
+	feed = ChangeFeed{CalendarId: cal.ID, Since: page.Changes[3].Cursor}
+	resumed, err = feed.Run(db)
+	assert.Nil(t, err)
+	assert.Len(t, resumed.Changes, 2)
+
+	feed = ChangeFeed{UserId: KnownUserId, Since: page.NextCursor}
+	empty, err := feed.Run(db)
+	assert.Nil(t, err)
+	assert.Len(t, empty.Changes, 0)
+	assert.Equal(t, page.NextCursor, empty.NextCursor)
+
+	// the attendee sees the appointment from the invitation on, not the calendar
+	feed = ChangeFeed{UserId: SecondKnownUserId}
+	attendee, err := feed.Run(db)
+	assert.Nil(t, err)
+	if assert.Len(t, attendee.Changes, 3) {
+		assert.Equal(t, EventAttendeesChanged, attendee.Changes[0].Event)
+		assert.Equal(t, EventAppointmentUpdated, attendee.Changes[1].Event)
+		assert.Equal(t, EventAppointmentDeleted, attendee.Changes[2].Event)
+	}
+
+	feed = ChangeFeed{UserId: ThirdKnownUserId}
+	other, err := feed.Run(db)
+	assert.Nil(t, err)
+	assert.Len(t, other.Changes, 0)
+}
+
+func TestRecordSharesChange(t *testing.T) {
+	err := MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer DropAllData(db)
+
+	share := &CalendarShare{CalendarId: KnownCalendarId, UserId: ThirdKnownUserId, Level: ShareRead}
+	if err := share.Save(db); err != nil {
+		t.Fatal("unable to share calendar", err)
+	}
+	if err := share.Delete(db); err != nil {
+		t.Fatal("unable to unshare calendar", err)
+	}
+
+	// the user learns about the share and about its end
+	feed := ChangeFeed{UserId: ThirdKnownUserId}
+	page, err := feed.Run(db)
+	assert.Nil(t, err)
+	if assert.Len(t, page.Changes, 2) {
+		for _, change := range page.Changes {
+			assert.Equal(t, EventSharesChanged, change.Event)
+			assert.Equal(t, EntityCalendar, change.Entity)
+			assert.Equal(t, []string{KnownCalendarId}, []string(change.CalendarIds))
+		}
+	}
+
+	// freebusy shares do not let the user read the calendar
+	share.Level = ShareFreeBusy
+	if err := share.Save(db); err != nil {
+		t.Fatal("unable to share calendar", err)
+	}
+	page, err = feed.Run(db)
+	assert.Nil(t, err)
+	assert.Len(t, page.Changes, 2)
+}
+
+func TestRecordChange_webhooks(t *testing.T) {
+	err := MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer DropAllData(db)
+
+	webhook := &Webhook{UserId: SecondKnownUserId, Url: "https://example.com/hook"}
+	if err := webhook.Create(db); err != nil {
+		t.Fatal("unable to create webhook", err)
+	}
+	start := time.Date(2020, 2, 3, 10, 0, 0, 0, time.UTC)
+	appt := &Appointment{Subject: "Webhook review", CalendarId: KnownCalendarId, Start: start, End: start.Add(time.Hour)}
+	if err := appt.Create(db); err != nil {
+		t.Fatal("unable to create appointment", err)
+	}
+	// the change made by a transaction rolled back is not delivered either
+	tx := db.Begin()
+	if err := recordChange(EntityAppointment, appt.ID, ChangeUpdate, appt, tx); err != nil {
+		t.Fatal("unable to record change", err)
+	}
+	tx.Rollback()
+	if err := appt.AddAttendees([]string{SecondKnownUserId}, "", db); err != nil {
+		t.Fatal("unable to add attendee", err)
+	}
+	if err := appt.Delete(db); err != nil {
+		t.Fatal("unable to delete appointment", err)
+	}
+
+	// the webhook gets the changes from the invitation on, along with the entity
+	query := DeliveryQuery{WebhookId: webhook.ID}
+	deliveries, err := query.Run(db)
+	assert.Nil(t, err)
+	if !assert.Len(t, deliveries, 2) {
+		return
+	}
+	events := []EventType{deliveries[0].Event, deliveries[1].Event}
+	assert.ElementsMatch(t, []EventType{EventAttendeesChanged, EventAppointmentDeleted}, events)
+	for _, delivery := range deliveries {
+		var event struct {
+			Type EventType   `json:"type"`
+			Data Appointment `json:"data"`
+		}
+		assert.Nil(t, json.Unmarshal(delivery.Payload.RawMessage, &event))
+		assert.Equal(t, delivery.Event, event.Type)
+		assert.Equal(t, appt.ID, event.Data.ID)
+		assert.Len(t, event.Data.Attendees, 1)
+	}
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+type SortOrder string
+
+const (
+	SortAsc  SortOrder = "asc"
+	SortDesc SortOrder = "desc"
+
+	DefaultPageLimit = 50
+	MaxPageLimit     = 500
+
+	cursorSeparator = "\x1f"
+)
+
+var InvalidCursorError = NewModeError("invalid cursor")
+
+// PageRequest selects a page of a listing. Cursor is the next_cursor of the
+// previous page, empty for the first page. Sort names the field to order by
+// for listings that can be ordered by more than one field
+type PageRequest struct {
+	Limit  int
+	Cursor string
+	Sort   string
+	Order  SortOrder
+}
+
+func (p *PageRequest) Validate() error {
+	if p.Limit == 0 {
+		p.Limit = DefaultPageLimit
+	}
+	if p.Limit < 0 || p.Limit > MaxPageLimit {
+		return NewModeError(fmt.Sprintf("limit should be between 1 and %d", MaxPageLimit))
+	}
+	p.Sort = strings.ToLower(strings.TrimSpace(p.Sort))
+	p.Order = SortOrder(strings.ToLower(string(p.Order)))
+	if p.Order == "" {
+		p.Order = SortAsc
+	}
+	if p.Order != SortAsc && p.Order != SortDesc {
+		return NewModeError(fmt.Sprintf("unknown sort order %s", p.Order))
+	}
+	return nil
+}
+
+// EncodeCursor packs the sort key of the last item of a page into an opaque cursor
+func EncodeCursor(values ...string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strings.Join(values, cursorSeparator)))
+}
+
+// DecodeCursor unpacks a cursor holding n values
+func DecodeCursor(cursor string, n int) ([]string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, InvalidCursorError
+	}
+	values := strings.Split(string(data), cursorSeparator)
+	if len(values) != n {
+		return nil, InvalidCursorError
+	}
+	return values, nil
+}
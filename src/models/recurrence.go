@@ -0,0 +1,494 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxOccurrences limits the number of occurrences a single expansion may produce
+	MaxOccurrences = 1000
+	// maxPeriods limits the periods a single expansion walks through, so that
+	// rules matching rarely or never do not run on until the end of the range
+	maxPeriods = 100 * MaxOccurrences
+)
+
+type Frequency string
+
+const (
+	FrequencyDaily   Frequency = "DAILY"
+	FrequencyWeekly  Frequency = "WEEKLY"
+	FrequencyMonthly Frequency = "MONTHLY"
+	FrequencyYearly  Frequency = "YEARLY"
+)
+
+const (
+	untilDateTimeLayout = "20060102T150405Z"
+	untilDateLayout     = "20060102"
+)
+
+var weekdayCodes = map[string]time.Weekday{
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+	"SU": time.Sunday,
+}
+
+// WeekdayNum is a BYDAY entry. N selects the n-th weekday of the month
+// (negative values count from the end), zero means every such weekday
+type WeekdayNum struct {
+	Weekday time.Weekday
+	N       int
+}
+
+func (w WeekdayNum) String() string {
+	code := strings.ToUpper(w.Weekday.String()[:2])
+	if w.N == 0 {
+		return code
+	}
+	return fmt.Sprintf("%d%s", w.N, code)
+}
+
+// RecurrenceRule is the subset of the RFC 5545 RRULE supported by the service:
+// FREQ, INTERVAL, BYDAY, BYMONTHDAY, COUNT and UNTIL
+type RecurrenceRule struct {
+	Freq       Frequency
+	Interval   int
+	ByDay      []WeekdayNum
+	ByMonthDay []int
+	Count      int
+	Until      time.Time
+	untilDate  bool
+}
+
+func ParseRecurrenceRule(value string) (*RecurrenceRule, error) {
+	value = strings.TrimSpace(value)
+	value = strings.TrimPrefix(strings.ToUpper(value), "RRULE:")
+	if value == "" {
+		return nil, NewModeError("recurrence rule can not be empty")
+	}
+
+	rule := &RecurrenceRule{Interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return nil, NewModeError(fmt.Sprintf("invalid recurrence rule part %q", part))
+		}
+		var err error
+		switch kv[0] {
+		case "FREQ":
+			err = rule.parseFreq(kv[1])
+		case "INTERVAL":
+			rule.Interval, err = parsePositiveInt(kv[0], kv[1])
+		case "COUNT":
+			rule.Count, err = parsePositiveInt(kv[0], kv[1])
+		case "UNTIL":
+			err = rule.parseUntil(kv[1])
+		case "BYDAY":
+			err = rule.parseByDay(kv[1])
+		case "BYMONTHDAY":
+			err = rule.parseByMonthDay(kv[1])
+		default:
+			err = NewModeError(fmt.Sprintf("unsupported recurrence rule part %s", kv[0]))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := rule.Validate(); err != nil {
+		return nil, err
+	}
+	return rule, nil
+}
+
+func (r *RecurrenceRule) Validate() error {
+	switch r.Freq {
+	case FrequencyDaily, FrequencyWeekly, FrequencyMonthly, FrequencyYearly:
+	case "":
+		return NewModeError("recurrence rule FREQ is required")
+	default:
+		return NewModeError(fmt.Sprintf("unsupported recurrence frequency %s", r.Freq))
+	}
+	if r.Interval < 1 {
+		return NewModeError("recurrence rule INTERVAL should be positive")
+	}
+	if r.Count != 0 && !r.Until.IsZero() {
+		return NewModeError("recurrence rule COUNT and UNTIL can not be used together")
+	}
+	if r.Freq == FrequencyYearly && (len(r.ByDay) > 0 || len(r.ByMonthDay) > 0) {
+		return NewModeError("BYDAY and BYMONTHDAY are not supported for YEARLY recurrence")
+	}
+	if r.Freq != FrequencyMonthly {
+		for _, wd := range r.ByDay {
+			if wd.N != 0 {
+				return NewModeError("numeric BYDAY values are supported for MONTHLY recurrence only")
+			}
+		}
+	}
+	return nil
+}
+
+func (r *RecurrenceRule) String() string {
+	parts := []string{"FREQ=" + string(r.Freq)}
+	if r.Interval > 1 {
+		parts = append(parts, fmt.Sprintf("INTERVAL=%d", r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		days := make([]string, 0, len(r.ByDay))
+		for _, wd := range r.ByDay {
+			days = append(days, wd.String())
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		days := make([]string, 0, len(r.ByMonthDay))
+		for _, d := range r.ByMonthDay {
+			days = append(days, strconv.Itoa(d))
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, fmt.Sprintf("COUNT=%d", r.Count))
+	}
+	if !r.Until.IsZero() {
+		if r.untilDate {
+			parts = append(parts, "UNTIL="+r.Until.Format(untilDateLayout))
+		} else {
+			parts = append(parts, "UNTIL="+r.Until.UTC().Format(untilDateTimeLayout))
+		}
+	}
+	return strings.Join(parts, ";")
+}
+
+// SetUntil ends the series at t (inclusive), dropping COUNT if present
+func (r *RecurrenceRule) SetUntil(t time.Time) {
+	r.Count = 0
+	r.Until = t.UTC()
+	r.untilDate = false
+}
+
+// SetUntilDate ends the series on the day of t (inclusive), dropping COUNT if present
+func (r *RecurrenceRule) SetUntilDate(t time.Time) {
+	r.Count = 0
+	r.Until = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	r.untilDate = true
+}
+
+// UntilIsDate reports whether UNTIL was given as a DATE value
+func (r *RecurrenceRule) UntilIsDate() bool {
+	return r.untilDate
+}
+
+// Between returns the starts of the series beginning at dtstart that fall
+// into [from, to). DTSTART is always the first occurrence of the series.
+// Series are walked through from the period before from on, the occurrences
+// of the periods skipped are counted when COUNT is set
+func (r *RecurrenceRule) Between(dtstart, from, to time.Time) []time.Time {
+	result := make([]time.Time, 0)
+	until := r.untilTime(dtstart.Location())
+	emitted := 0
+
+	emit := func(t time.Time) bool {
+		if !until.IsZero() && t.After(until) {
+			return false
+		}
+		if !t.Before(to) {
+			return false
+		}
+		emitted++
+		if !t.Before(from) {
+			result = append(result, t)
+		}
+		if len(result) >= MaxOccurrences {
+			return false
+		}
+		return r.Count == 0 || emitted < r.Count
+	}
+
+	if !emit(dtstart) {
+		return result
+	}
+	first := r.firstPeriod(dtstart, from)
+	if r.Count != 0 && first > 0 {
+		emitted = r.countBefore(dtstart, first)
+		if emitted >= r.Count {
+			return result
+		}
+	}
+	for period := first; period < first+maxPeriods; period++ {
+		periodStart, candidates := r.periodCandidates(dtstart, period)
+		if !periodStart.Before(to) || (!until.IsZero() && periodStart.After(until)) {
+			return result
+		}
+		for _, candidate := range candidates {
+			if !candidate.After(dtstart) {
+				continue
+			}
+			if !emit(candidate) {
+				return result
+			}
+		}
+	}
+	return result
+}
+
+// firstPeriod returns the period the expansion of the series starts at, one
+// beginning before from
+func (r *RecurrenceRule) firstPeriod(dtstart, from time.Time) int {
+	if !from.After(dtstart) {
+		return 0
+	}
+	var elapsed int
+	switch r.Freq {
+	case FrequencyDaily:
+		elapsed = int((from.Unix() - dtstart.Unix()) / (24 * 60 * 60))
+	case FrequencyWeekly:
+		elapsed = int((from.Unix() - dtstart.Unix()) / (7 * 24 * 60 * 60))
+	case FrequencyMonthly:
+		elapsed = (from.Year()-dtstart.Year())*12 + int(from.Month()) - int(dtstart.Month())
+	default:
+		elapsed = from.Year() - dtstart.Year()
+	}
+	// one period more is left for the hours daylight saving time takes away
+	if period := elapsed/r.Interval - 1; period > 0 {
+		return period
+	}
+	return 0
+}
+
+// countBefore counts the occurrences of the series in the periods before the n-th one,
+// DTSTART included. Whole cycles of periods are counted at once
+func (r *RecurrenceRule) countBefore(dtstart time.Time, n int) int {
+	count := 1
+	_, candidates := r.periodCandidates(dtstart, 0)
+	for _, candidate := range candidates {
+		if candidate.After(dtstart) {
+			count++
+		}
+	}
+	// candidates of the periods after the first one all follow dtstart
+	periods := n - 1
+	cycle := r.cyclePeriods(dtstart)
+	if cycles := periods / cycle; cycles > 0 {
+		count += cycles * r.countPeriods(dtstart, 1, cycle)
+	}
+	return count + r.countPeriods(dtstart, n-periods%cycle, periods%cycle)
+}
+
+// cyclePeriods returns the number of periods after which the candidates of the series repeat.
+// The calendar repeats itself, weekdays included, every 400 years
+func (r *RecurrenceRule) cyclePeriods(dtstart time.Time) int {
+	units := 1
+	switch r.Freq {
+	case FrequencyDaily:
+		if len(r.ByMonthDay) > 0 {
+			units = 146097
+		} else if len(r.ByDay) > 0 {
+			units = 7
+		}
+	case FrequencyWeekly:
+		if len(r.ByMonthDay) > 0 {
+			units = 146097 / 7
+		}
+	case FrequencyMonthly:
+		if len(r.ByDay) > 0 || len(r.ByMonthDay) > 0 || dtstart.Day() > 28 {
+			units = 400 * 12
+		}
+	default:
+		if dtstart.Month() == time.February && dtstart.Day() == 29 {
+			units = 400
+		}
+	}
+	return units / gcd(units, r.Interval)
+}
+
+// countPeriods counts the candidates of n periods starting at the given one
+func (r *RecurrenceRule) countPeriods(dtstart time.Time, period, n int) int {
+	count := 0
+	for i := period; i < period+n; i++ {
+		_, candidates := r.periodCandidates(dtstart, i)
+		count += len(candidates)
+	}
+	return count
+}
+
+func (r *RecurrenceRule) untilTime(loc *time.Location) time.Time {
+	if r.Until.IsZero() || !r.untilDate {
+		return r.Until
+	}
+	// a date UNTIL includes the whole day in the series time zone
+	return time.Date(r.Until.Year(), r.Until.Month(), r.Until.Day(), 0, 0, 0, 0, loc).AddDate(0, 0, 1).Add(-time.Nanosecond)
+}
+
+// periodCandidates returns the beginning of the n-th period of the series
+// and the sorted occurrence candidates within that period
+func (r *RecurrenceRule) periodCandidates(dtstart time.Time, n int) (time.Time, []time.Time) {
+	loc := dtstart.Location()
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, dtstart.Hour(), dtstart.Minute(), dtstart.Second(), dtstart.Nanosecond(), loc)
+	}
+	step := n * r.Interval
+	candidates := make([]time.Time, 0, 1)
+
+	switch r.Freq {
+	case FrequencyDaily:
+		day := at(dtstart.Year(), dtstart.Month(), dtstart.Day()+step)
+		if r.matchesWeekday(day) && r.matchesMonthDay(day) {
+			candidates = append(candidates, day)
+		}
+		return day, candidates
+	case FrequencyWeekly:
+		offset := (int(dtstart.Weekday()) + 6) % 7
+		monday := at(dtstart.Year(), dtstart.Month(), dtstart.Day()-offset+7*step)
+		for i := 0; i < 7; i++ {
+			day := at(monday.Year(), monday.Month(), monday.Day()+i)
+			if len(r.ByDay) == 0 && day.Weekday() != dtstart.Weekday() {
+				continue
+			}
+			if r.matchesWeekday(day) && r.matchesMonthDay(day) {
+				candidates = append(candidates, day)
+			}
+		}
+		return monday, candidates
+	case FrequencyMonthly:
+		first := at(dtstart.Year(), dtstart.Month()+time.Month(step), 1)
+		days := daysIn(first.Year(), first.Month())
+		for d := 1; d <= days; d++ {
+			day := at(first.Year(), first.Month(), d)
+			if len(r.ByDay) == 0 && len(r.ByMonthDay) == 0 && d != dtstart.Day() {
+				continue
+			}
+			if r.matchesWeekday(day) && r.matchesMonthDay(day) {
+				candidates = append(candidates, day)
+			}
+		}
+		return first, candidates
+	default:
+		year := dtstart.Year() + step
+		day := at(year, dtstart.Month(), dtstart.Day())
+		if day.Month() == dtstart.Month() {
+			candidates = append(candidates, day)
+		}
+		return at(year, time.January, 1), candidates
+	}
+}
+
+func (r *RecurrenceRule) matchesWeekday(day time.Time) bool {
+	if len(r.ByDay) == 0 {
+		return true
+	}
+	days := daysIn(day.Year(), day.Month())
+	for _, wd := range r.ByDay {
+		if wd.Weekday != day.Weekday() {
+			continue
+		}
+		if wd.N == 0 {
+			return true
+		}
+		if wd.N > 0 && (day.Day()-1)/7+1 == wd.N {
+			return true
+		}
+		if wd.N < 0 && -((days-day.Day())/7+1) == wd.N {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *RecurrenceRule) matchesMonthDay(day time.Time) bool {
+	if len(r.ByMonthDay) == 0 {
+		return true
+	}
+	days := daysIn(day.Year(), day.Month())
+	for _, d := range r.ByMonthDay {
+		if d == day.Day() || (d < 0 && days+1+d == day.Day()) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *RecurrenceRule) parseFreq(value string) error {
+	r.Freq = Frequency(value)
+	switch r.Freq {
+	case FrequencyDaily, FrequencyWeekly, FrequencyMonthly, FrequencyYearly:
+		return nil
+	}
+	return NewModeError(fmt.Sprintf("unsupported recurrence frequency %s", value))
+}
+
+func (r *RecurrenceRule) parseUntil(value string) error {
+	if t, err := time.Parse(untilDateTimeLayout, value); err == nil {
+		r.Until = t
+		return nil
+	}
+	t, err := time.Parse(untilDateLayout, value)
+	if err != nil {
+		return NewModeError(fmt.Sprintf("invalid recurrence rule UNTIL value %s", value))
+	}
+	r.Until = t
+	r.untilDate = true
+	return nil
+}
+
+func (r *RecurrenceRule) parseByDay(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if len(item) < 2 {
+			return NewModeError(fmt.Sprintf("invalid recurrence rule BYDAY value %s", item))
+		}
+		weekday, ok := weekdayCodes[item[len(item)-2:]]
+		if !ok {
+			return NewModeError(fmt.Sprintf("invalid recurrence rule BYDAY value %s", item))
+		}
+		wd := WeekdayNum{Weekday: weekday}
+		if prefix := item[:len(item)-2]; prefix != "" {
+			n, err := strconv.Atoi(prefix)
+			if err != nil || n == 0 || n > 5 || n < -5 {
+				return NewModeError(fmt.Sprintf("invalid recurrence rule BYDAY value %s", item))
+			}
+			wd.N = n
+		}
+		r.ByDay = append(r.ByDay, wd)
+	}
+	return nil
+}
+
+func (r *RecurrenceRule) parseByMonthDay(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		d, err := strconv.Atoi(item)
+		if err != nil || d == 0 || d > 31 || d < -31 {
+			return NewModeError(fmt.Sprintf("invalid recurrence rule BYMONTHDAY value %s", item))
+		}
+		r.ByMonthDay = append(r.ByMonthDay, d)
+	}
+	sort.Ints(r.ByMonthDay)
+	return nil
+}
+
+func parsePositiveInt(name, value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, NewModeError(fmt.Sprintf("recurrence rule %s should be a positive integer", name))
+	}
+	return n, nil
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
@@ -0,0 +1,176 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestParseRecurrenceRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{name: "success weekly", value: "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10", want: "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10"},
+		{name: "success lower case with prefix", value: "rrule:freq=daily;interval=2", want: "FREQ=DAILY;INTERVAL=2"},
+		{name: "success monthly last friday", value: "FREQ=MONTHLY;BYDAY=-1FR;UNTIL=20201231T000000Z", want: "FREQ=MONTHLY;BYDAY=-1FR;UNTIL=20201231T000000Z"},
+		{name: "success until date", value: "FREQ=DAILY;UNTIL=20200301", want: "FREQ=DAILY;UNTIL=20200301"},
+		{name: "failure empty", value: "", wantErr: true},
+		{name: "failure no freq", value: "COUNT=3", wantErr: true},
+		{name: "failure unsupported freq", value: "FREQ=HOURLY", wantErr: true},
+		{name: "failure unsupported part", value: "FREQ=DAILY;BYHOUR=10", wantErr: true},
+		{name: "failure count and until", value: "FREQ=DAILY;COUNT=3;UNTIL=20200301", wantErr: true},
+		{name: "failure invalid byday", value: "FREQ=WEEKLY;BYDAY=XX", wantErr: true},
+		{name: "failure numeric byday for weekly", value: "FREQ=WEEKLY;BYDAY=1MO", wantErr: true},
+		{name: "failure invalid bymonthday", value: "FREQ=MONTHLY;BYMONTHDAY=32", wantErr: true},
+		{name: "failure zero interval", value: "FREQ=DAILY;INTERVAL=0", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ParseRecurrenceRule(tt.value)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRecurrenceRule() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil {
+				assert.Equal(t, tt.want, rule.String())
+			}
+		})
+	}
+}
+
+func TestRecurrenceRule_Between(t *testing.T) {
+	monday := time.Date(2020, 1, 6, 9, 0, 0, 0, time.UTC)
+	farFuture := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		value   string
+		dtstart time.Time
+		from    time.Time
+		to      time.Time
+		want    []time.Time
+	}{
+		{
+			name:    "weekly by day with count",
+			value:   "FREQ=WEEKLY;BYDAY=MO,WE;COUNT=4",
+			dtstart: monday,
+			from:    monday,
+			to:      farFuture,
+			want: []time.Time{
+				monday,
+				time.Date(2020, 1, 8, 9, 0, 0, 0, time.UTC),
+				time.Date(2020, 1, 13, 9, 0, 0, 0, time.UTC),
+				time.Date(2020, 1, 15, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:    "daily with interval until date",
+			value:   "FREQ=DAILY;INTERVAL=3;UNTIL=20200112",
+			dtstart: monday,
+			from:    monday,
+			to:      farFuture,
+			want: []time.Time{
+				monday,
+				time.Date(2020, 1, 9, 9, 0, 0, 0, time.UTC),
+				time.Date(2020, 1, 12, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:    "monthly skips short months",
+			value:   "FREQ=MONTHLY;COUNT=3",
+			dtstart: time.Date(2020, 1, 31, 9, 0, 0, 0, time.UTC),
+			from:    monday,
+			to:      farFuture,
+			want: []time.Time{
+				time.Date(2020, 1, 31, 9, 0, 0, 0, time.UTC),
+				time.Date(2020, 3, 31, 9, 0, 0, 0, time.UTC),
+				time.Date(2020, 5, 31, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:    "monthly last friday",
+			value:   "FREQ=MONTHLY;BYDAY=-1FR;COUNT=3",
+			dtstart: time.Date(2020, 1, 31, 9, 0, 0, 0, time.UTC),
+			from:    monday,
+			to:      farFuture,
+			want: []time.Time{
+				time.Date(2020, 1, 31, 9, 0, 0, 0, time.UTC),
+				time.Date(2020, 2, 28, 9, 0, 0, 0, time.UTC),
+				time.Date(2020, 3, 27, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:    "yearly leap day",
+			value:   "FREQ=YEARLY;COUNT=2",
+			dtstart: time.Date(2020, 2, 29, 9, 0, 0, 0, time.UTC),
+			from:    monday,
+			to:      farFuture,
+			want: []time.Time{
+				time.Date(2020, 2, 29, 9, 0, 0, 0, time.UTC),
+				time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:    "unbounded weekly limited by range",
+			value:   "FREQ=WEEKLY;INTERVAL=2",
+			dtstart: monday,
+			from:    time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC),
+			to:      time.Date(2020, 3, 20, 0, 0, 0, 0, time.UTC),
+			want: []time.Time{
+				time.Date(2020, 3, 2, 9, 0, 0, 0, time.UTC),
+				time.Date(2020, 3, 16, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:    "daily started long ago",
+			value:   "FREQ=DAILY;INTERVAL=2",
+			dtstart: time.Date(1, 1, 1, 9, 0, 0, 0, time.UTC),
+			from:    farFuture,
+			to:      farFuture.AddDate(0, 0, 4),
+			want: []time.Time{
+				time.Date(2030, 1, 2, 9, 0, 0, 0, time.UTC),
+				time.Date(2030, 1, 4, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:    "daily count queried far from its start",
+			value:   "FREQ=DAILY;COUNT=200000",
+			dtstart: monday,
+			from:    time.Date(2567, 8, 4, 0, 0, 0, 0, time.UTC),
+			to:      time.Date(2567, 8, 15, 0, 0, 0, 0, time.UTC),
+			want: []time.Time{
+				time.Date(2567, 8, 4, 9, 0, 0, 0, time.UTC),
+				time.Date(2567, 8, 5, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:    "monthly count queried far from its start",
+			value:   "FREQ=MONTHLY;BYMONTHDAY=31;COUNT=3000",
+			dtstart: time.Date(2020, 1, 31, 9, 0, 0, 0, time.UTC),
+			from:    time.Date(2448, 5, 1, 0, 0, 0, 0, time.UTC),
+			to:      time.Date(2450, 1, 1, 0, 0, 0, 0, time.UTC),
+			want: []time.Time{
+				time.Date(2448, 5, 31, 9, 0, 0, 0, time.UTC),
+				time.Date(2448, 7, 31, 9, 0, 0, 0, time.UTC),
+			},
+		},
+		{
+			name:    "never matching rule",
+			value:   "FREQ=MONTHLY;BYMONTHDAY=31;BYDAY=MO;INTERVAL=12",
+			dtstart: time.Date(2020, 2, 1, 9, 0, 0, 0, time.UTC),
+			from:    monday,
+			to:      time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC),
+			want:    []time.Time{time.Date(2020, 2, 1, 9, 0, 0, 0, time.UTC)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := ParseRecurrenceRule(tt.value)
+			if err != nil {
+				t.Fatal("unable to parse rule", err)
+			}
+			assert.Equal(t, tt.want, rule.Between(tt.dtstart, tt.from, tt.to))
+		})
+	}
+}
@@ -1,8 +1,9 @@
 package models
 
 type ResponseCreated struct {
-	Message   string `json:"message"`
-	CreatedId string `json:"created_id"`
+	Message   string      `json:"message"`
+	CreatedId string      `json:"created_id"`
+	Conflicts []*Conflict `json:"conflicts,omitempty"`
 }
 
 type ResponseDeleted struct {
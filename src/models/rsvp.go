@@ -0,0 +1,151 @@
+package models
+
+import (
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"strings"
+	"time"
+)
+
+type ParticipationStatus string
+
+const (
+	StatusNeedsAction ParticipationStatus = "needs-action"
+	StatusAccepted    ParticipationStatus = "accepted"
+	StatusDeclined    ParticipationStatus = "declined"
+	StatusTentative   ParticipationStatus = "tentative"
+)
+
+type AttendeeRole string
+
+const (
+	AttendeeRequired AttendeeRole = "required"
+	AttendeeOptional AttendeeRole = "optional"
+	// AttendeeChair leads the appointment
+	AttendeeChair AttendeeRole = "chair"
+)
+
+func ParseAttendeeRole(s string) (AttendeeRole, error) {
+	role := AttendeeRole(strings.ToLower(strings.TrimSpace(s)))
+	switch role {
+	case "":
+		return AttendeeRequired, nil
+	case AttendeeRequired, AttendeeOptional, AttendeeChair:
+		return role, nil
+	}
+	return "", NewModeError(fmt.Sprintf("unknown attendee role %s", s))
+}
+
+// Participation is how an attendee takes part in an appointment.
+// RsvpAt is nil until the attendee answers the invitation
+type Participation struct {
+	Status  ParticipationStatus `json:"status"`
+	Role    AttendeeRole        `json:"role"`
+	RsvpAt  *time.Time          `json:"rsvp_at"`
+	Comment string              `json:"comment"`
+}
+
+// Rsvp is the answer of an attendee to an invitation
+type Rsvp struct {
+	Status  ParticipationStatus `json:"status"`
+	Comment string              `json:"comment"`
+}
+
+func (r *Rsvp) Validate() error {
+	r.Status = ParticipationStatus(strings.ToLower(strings.TrimSpace(string(r.Status))))
+	switch r.Status {
+	case StatusAccepted, StatusDeclined, StatusTentative:
+	default:
+		return NewModeError(fmt.Sprintf("rsvp status should be one of %s, %s, %s",
+			StatusAccepted, StatusDeclined, StatusTentative))
+	}
+	r.Comment = strings.TrimSpace(r.Comment)
+	return nil
+}
+
+// attendance is a row of users_appointments
+type attendance struct {
+	UserId        string
+	AppointmentId string
+	Status        ParticipationStatus
+	Role          AttendeeRole
+	RsvpAt        *time.Time
+	Comment       string
+}
+
+// Respond records the answer of the user to the invitation to the appointment
+func (a *Appointment) Respond(userId string, rsvp Rsvp, db *gorm.DB) error {
+	if a.EmptyID() {
+		return EmptyIdError
+	}
+	if err := rsvp.Validate(); err != nil {
+		return err
+	}
+	tx := db.Begin()
+	before, err := versionedSnapshot(EntityAppointment, a.ID, a.Version, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	dbState := tx.Table("users_appointments").
+		Where("appointment_id = ? AND user_id = ?", a.ID, userId).
+		Updates(map[string]interface{}{
+			"status":  rsvp.Status,
+			"comment": rsvp.Comment,
+			"rsvp_at": time.Now(),
+		})
+	if dbState.Error != nil {
+		tx.Rollback()
+		return dbState.Error
+	}
+	if dbState.RowsAffected == 0 {
+		tx.Rollback()
+		return NewModeError(fmt.Sprintf("user with id=%s does not attend appointment with id=%s", userId, a.ID))
+	}
+	if err := recordAttendeesChange(a.ID, before, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if a.Version, err = versionOf(EntityAppointment, a.ID, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit().Error; err != nil {
+		return err
+	}
+	return a.Read(db)
+}
+
+// loadParticipation sets the participation of the preloaded attendees of the appointments
+func loadParticipation(appts []*Appointment, db *gorm.DB) error {
+	if len(appts) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(appts))
+	for _, appt := range appts {
+		ids = append(ids, appt.ID)
+	}
+	rows := make([]*attendance, 0)
+	if err := db.Table("users_appointments").Where("appointment_id IN (?)", ids).Scan(&rows).Error; err != nil {
+		return err
+	}
+	byKey := make(map[[2]string]*attendance, len(rows))
+	for _, row := range rows {
+		byKey[[2]string{row.AppointmentId, row.UserId}] = row
+	}
+	for _, appt := range appts {
+		for _, usr := range appt.Attendees {
+			row, ok := byKey[[2]string{appt.ID, usr.ID}]
+			if !ok {
+				continue
+			}
+			usr.Participation = &Participation{
+				Status:  row.Status,
+				Role:    row.Role,
+				RsvpAt:  row.RsvpAt,
+				Comment: row.Comment,
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRsvp_Validate(t *testing.T) {
+	rsvp := Rsvp{Status: " Accepted ", Comment: " see you "}
+	assert.Nil(t, rsvp.Validate())
+	assert.Equal(t, StatusAccepted, rsvp.Status)
+	assert.Equal(t, "see you", rsvp.Comment)
+
+	rsvp = Rsvp{Status: StatusNeedsAction}
+	assert.NotNil(t, rsvp.Validate())
+	rsvp = Rsvp{}
+	assert.NotNil(t, rsvp.Validate())
+}
+
+func TestAppointment_Respond(t *testing.T) {
+	err := MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer DropAllData(db)
+
+	t.Run("success", func(tt *testing.T) {
+		appt := &Appointment{Base: Base{ID: AppointmentWholeDayId}}
+		err := appt.Respond(ThirdKnownUserId, Rsvp{Status: StatusTentative, Comment: "maybe later"}, db)
+		assert.Nil(tt, err)
+		assert.Len(tt, appt.Attendees, 1)
+		participation := appt.Attendees[0].Participation
+		assert.Equal(tt, StatusTentative, participation.Status)
+		assert.Equal(tt, AttendeeRequired, participation.Role)
+		assert.Equal(tt, "maybe later", participation.Comment)
+		assert.NotNil(tt, participation.RsvpAt)
+	})
+
+	t.Run("fail not an attendee", func(tt *testing.T) {
+		appt := &Appointment{Base: Base{ID: AppointmentWholeDayId}}
+		err := appt.Respond(SecondKnownUserId, Rsvp{Status: StatusAccepted}, db)
+		assert.NotNil(tt, err)
+	})
+
+	t.Run("fail invalid status", func(tt *testing.T) {
+		appt := &Appointment{Base: Base{ID: AppointmentWholeDayId}}
+		err := appt.Respond(ThirdKnownUserId, Rsvp{Status: "maybe"}, db)
+		assert.NotNil(tt, err)
+	})
+}
@@ -0,0 +1,156 @@
+package models
+
+import (
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"strings"
+)
+
+const (
+	DefaultSearchLimit = 20
+	MaxSearchLimit     = 100
+
+	// searchConfig is the text search configuration the search_vector column is built with
+	searchConfig = "english"
+	// searchHeadline marks the matched words in the highlights
+	searchHeadline = "StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, MaxFragments=3"
+)
+
+// SearchQuery looks for the appointments matching Text in their subject or
+// description. Exactly one of UserId and CalendarId scopes the search, a user
+// scope covers the calendars of the user and the appointments they attend
+type SearchQuery struct {
+	Text       string
+	UserId     string
+	CalendarId string
+	Limit      int
+}
+
+// SearchResult is a matching appointment. The highlights are the subject and
+// fragments of the description with the matched words within <mark></mark>
+type SearchResult struct {
+	*Appointment
+	Rank                 float64 `json:"rank"`
+	SubjectHighlight     string  `json:"subject_highlight"`
+	DescriptionHighlight string  `json:"description_highlight"`
+}
+
+type SearchResults struct {
+	Query   string          `json:"query"`
+	Results []*SearchResult `json:"results"`
+}
+
+type searchHit struct {
+	ID                   string
+	Rank                 float64
+	SubjectHighlight     string
+	DescriptionHighlight string
+}
+
+func (q *SearchQuery) Validate() error {
+	q.Text = strings.TrimSpace(q.Text)
+	if q.Text == "" {
+		return NewModeError("search text can not be empty")
+	}
+	if IdIsEmpty(q.UserId) == IdIsEmpty(q.CalendarId) {
+		return NewModeError("search should be scoped to either a user or a calendar")
+	}
+	if q.Limit == 0 {
+		q.Limit = DefaultSearchLimit
+	}
+	if q.Limit < 0 || q.Limit > MaxSearchLimit {
+		return NewModeError(fmt.Sprintf("limit should be between 1 and %d", MaxSearchLimit))
+	}
+	return nil
+}
+
+// Run returns up to Limit appointments ordered by relevance, matches in the
+// subject weigh more than the ones in the description
+func (q *SearchQuery) Run(db *gorm.DB) (*SearchResults, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	var scope string
+	var scopeArgs []interface{}
+	if !IdIsEmpty(q.CalendarId) {
+		if err := existsById(&Calendar{}, "calendar", q.CalendarId, db); err != nil {
+			return nil, err
+		}
+		scope = "a.calendar_id = ?"
+		scopeArgs = []interface{}{q.CalendarId}
+	} else {
+		if err := existsById(&User{}, "user", q.UserId, db); err != nil {
+			return nil, err
+		}
+		scope = "(a.calendar_id IN (SELECT id FROM calendars WHERE user_id = ?) OR " +
+			"a.id IN (SELECT appointment_id FROM users_appointments WHERE user_id = ?))"
+		scopeArgs = []interface{}{q.UserId, q.UserId}
+	}
+
+	// headlines are costly, they are only built for the selected page
+	args := append([]interface{}{searchConfig, searchConfig, searchConfig, q.Text}, scopeArgs...)
+	args = append(args, q.Limit)
+	hits := make([]*searchHit, 0, q.Limit)
+	dbState := db.Raw(fmt.Sprintf(`
+		SELECT a.id, hit.rank,
+			ts_headline(?::regconfig, a.subject, hit.query, '%[1]s') AS subject_highlight,
+			ts_headline(?::regconfig, COALESCE(a.description, ''), hit.query, '%[1]s') AS description_highlight
+		FROM (
+			SELECT a.id, q AS query, ts_rank(a.search_vector, q) AS rank
+			FROM appointments a, plainto_tsquery(?::regconfig, ?) q
+			WHERE a.search_vector @@ q AND a.deleted_at IS NULL AND %[2]s
+			ORDER BY rank DESC, a.start, a.id
+			LIMIT ?
+		) hit JOIN appointments a ON a.id = hit.id
+		ORDER BY hit.rank DESC, a.start, a.id`, searchHeadline, scope), args...).Scan(&hits)
+	if dbState.Error != nil {
+		return nil, dbState.Error
+	}
+
+	results := &SearchResults{Query: q.Text, Results: make([]*SearchResult, 0, len(hits))}
+	if len(hits) == 0 {
+		return results, nil
+	}
+	ids := make([]string, 0, len(hits))
+	for _, hit := range hits {
+		ids = append(ids, hit.ID)
+	}
+	appts := make([]*Appointment, 0, len(hits))
+	if err := db.Preload("Attendees").Preload("ExternalAttendees").Preload("Exceptions").Where("id IN (?)", ids).Find(&appts).Error; err != nil {
+		return nil, err
+	}
+	if err := loadParticipation(appts, db); err != nil {
+		return nil, err
+	}
+	byId := make(map[string]*Appointment, len(appts))
+	for _, appt := range appts {
+		byId[appt.ID] = appt
+	}
+	for _, hit := range hits {
+		appt, ok := byId[hit.ID]
+		if !ok {
+			continue
+		}
+		results.Results = append(results.Results, &SearchResult{
+			Appointment:          appt,
+			Rank:                 hit.Rank,
+			SubjectHighlight:     hit.SubjectHighlight,
+			DescriptionHighlight: hit.DescriptionHighlight,
+		})
+	}
+	return results, nil
+}
+
+func existsById(model interface{}, name, id string, db *gorm.DB) error {
+	dbState := db.Find(model, "id = ?", id)
+	if dbState.Error != nil {
+		if gorm.IsRecordNotFoundError(dbState.Error) {
+			return NewModeError(fmt.Sprintf("%s with id=%s not present in the db", name, id))
+		}
+		return dbState.Error
+	}
+	if dbState.RowsAffected == 0 {
+		return NewModeError(fmt.Sprintf("%s with id=%s not present in the db", name, id))
+	}
+	return nil
+}
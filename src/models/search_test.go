@@ -0,0 +1,70 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestSearchQuery_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   SearchQuery
+		wantErr bool
+	}{
+		{name: "calendar scope", query: SearchQuery{Text: "sync", CalendarId: KnownCalendarId}},
+		{name: "user scope", query: SearchQuery{Text: "sync", UserId: KnownUserId}},
+		{name: "empty text", query: SearchQuery{Text: "  ", CalendarId: KnownCalendarId}, wantErr: true},
+		{name: "no scope", query: SearchQuery{Text: "sync"}, wantErr: true},
+		{name: "both scopes", query: SearchQuery{Text: "sync", UserId: KnownUserId, CalendarId: KnownCalendarId}, wantErr: true},
+		{name: "limit too big", query: SearchQuery{Text: "sync", UserId: KnownUserId, Limit: MaxSearchLimit + 1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.query.Validate()
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, DefaultSearchLimit, tt.query.Limit)
+		})
+	}
+}
+
+func TestSearchQuery_Run(t *testing.T) {
+	err := MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer DropAllData(db)
+
+	query := SearchQuery{Text: "sync", CalendarId: KnownCalendarId}
+	results, err := query.Run(db)
+	assert.Nil(t, err)
+	assert.Len(t, results.Results, 1)
+	assert.Equal(t, AppointmentRecurringId, results.Results[0].ID)
+	assert.Equal(t, "Weekly <mark>sync</mark>", results.Results[0].SubjectHighlight)
+	assert.Contains(t, results.Results[0].DescriptionHighlight, "<mark>sync</mark>")
+
+	// only the appointment the third user attends is in their scope
+	query = SearchQuery{Text: "fun", UserId: ThirdKnownUserId}
+	results, err = query.Run(db)
+	assert.Nil(t, err)
+	assert.Len(t, results.Results, 1)
+	assert.Equal(t, AppointmentWholeDayId, results.Results[0].ID)
+
+	// the search vector follows updates of the subject
+	appt := &Appointment{Base: Base{ID: AppointmentFixedTimeId}}
+	assert.Nil(t, appt.Read(db))
+	appt.Subject = "Q3 budget review"
+	assert.Nil(t, appt.Update(db))
+	query = SearchQuery{Text: "budgets", CalendarId: KnownCalendarId}
+	results, err = query.Run(db)
+	assert.Nil(t, err)
+	assert.Len(t, results.Results, 1)
+	assert.Equal(t, AppointmentFixedTimeId, results.Results[0].ID)
+
+	query = SearchQuery{Text: "sync", CalendarId: UnexistingId}
+	_, err = query.Run(db)
+	assert.NotNil(t, err)
+}
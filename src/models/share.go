@@ -0,0 +1,191 @@
+package models
+
+import (
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"strings"
+)
+
+type ShareLevel string
+
+const (
+	// ShareFreeBusy exposes when the appointments of the calendar take place, not what they are
+	ShareFreeBusy ShareLevel = "freebusy"
+	ShareRead     ShareLevel = "read"
+	// ShareWrite allows to create, change and delete the appointments of the calendar
+	ShareWrite ShareLevel = "write"
+	// ShareManage additionally allows to change the calendar and to share it further
+	ShareManage ShareLevel = "manage"
+)
+
+// readerLevels are the levels the appointments of a shared calendar can be read at
+var readerLevels = []ShareLevel{ShareRead, ShareWrite, ShareManage}
+
+var shareLevelRanks = map[ShareLevel]int{
+	ShareFreeBusy: 1,
+	ShareRead:     2,
+	ShareWrite:    3,
+	ShareManage:   4,
+}
+
+func ParseShareLevel(s string) (ShareLevel, error) {
+	level := ShareLevel(strings.ToLower(strings.TrimSpace(s)))
+	if _, ok := shareLevelRanks[level]; !ok {
+		return "", NewModeError(fmt.Sprintf("unknown share level %s", s))
+	}
+	return level, nil
+}
+
+// Includes tells whether the level grants at least the access of the other level
+func (l ShareLevel) Includes(other ShareLevel) bool {
+	rank, ok := shareLevelRanks[l]
+	return ok && rank >= shareLevelRanks[other]
+}
+
+// CalendarShare grants a user other than the owner access to a calendar
+type CalendarShare struct {
+	Base
+	CalendarId string     `gorm:"type:uuid;not null" json:"calendar_id"`
+	UserId     string     `gorm:"type:uuid;not null" json:"user_id"`
+	Level      ShareLevel `gorm:"not null" json:"level"`
+}
+
+// SharedCalendar is a calendar of another user the user has access to
+type SharedCalendar struct {
+	CalendarId string     `json:"calendar_id"`
+	Name       string     `json:"name"`
+	OwnerId    string     `json:"owner_id"`
+	Level      ShareLevel `json:"level"`
+}
+
+func (s *CalendarShare) Validate() error {
+	if IdIsEmpty(s.CalendarId) {
+		return NewModeError("calendar_id can not be empty")
+	}
+	if IdIsEmpty(s.UserId) {
+		return NewModeError("user_id can not be empty")
+	}
+	level, err := ParseShareLevel(string(s.Level))
+	if err != nil {
+		return err
+	}
+	s.Level = level
+	return nil
+}
+
+// Save shares the calendar with the user, replacing the level of an existing share
+func (s *CalendarShare) Save(db *gorm.DB) error {
+	if err := s.Validate(); err != nil {
+		return err
+	}
+	var count int
+	if err := db.Model(&User{}).Where("id = ?", s.UserId).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return NewModeError(fmt.Sprintf("user with id=%s not present in the db", s.UserId))
+	}
+
+	tx := db.Begin()
+	before, readers, err := s.lockCalendar(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if before.(*Calendar).UserId == s.UserId {
+		tx.Rollback()
+		return NewModeError("a calendar can not be shared with its owner")
+	}
+	existing := CalendarShare{}
+	err = tx.Where("calendar_id = ? AND user_id = ?", s.CalendarId, s.UserId).First(&existing).Error
+	switch {
+	case gorm.IsRecordNotFoundError(err):
+		err = tx.Create(s).Error
+	case err == nil:
+		s.Base = existing.Base
+		err = tx.Model(s).Update("level", s.Level).Error
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	// the user loses read access when the share is lowered to freebusy
+	err = deleteUnreadableAlarms(tx, "appointments.calendar_id = ? AND alarms.user_id = ?", s.CalendarId, s.UserId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := recordSharesChange(s.CalendarId, before, readers, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// Delete removes the share of the calendar with the user
+func (s *CalendarShare) Delete(db *gorm.DB) error {
+	tx := db.Begin()
+	before, readers, err := s.lockCalendar(tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	dbState := tx.Where("calendar_id = ? AND user_id = ?", s.CalendarId, s.UserId).Delete(&CalendarShare{})
+	if dbState.Error != nil {
+		tx.Rollback()
+		return dbState.Error
+	}
+	if dbState.RowsAffected == 0 {
+		tx.Rollback()
+		return NewModeError(fmt.Sprintf("calendar with id=%s is not shared with user with id=%s", s.CalendarId, s.UserId))
+	}
+	err = deleteUnreadableAlarms(tx, "appointments.calendar_id = ? AND alarms.user_id = ?", s.CalendarId, s.UserId)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := recordSharesChange(s.CalendarId, before, readers, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// lockCalendar locks the shared calendar and returns its snapshot
+// together with the users who can read it before the share changes
+func (s *CalendarShare) lockCalendar(tx *gorm.DB) (interface{}, []string, error) {
+	before, err := lockedSnapshot(EntityCalendar, s.CalendarId, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if before == nil {
+		return nil, nil, NewModeError(fmt.Sprintf("calendar with id=%s not present in the db", s.CalendarId))
+	}
+	readers, err := CalendarReaders(s.CalendarId, tx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return before, readers, nil
+}
+
+// ShareLevelOf returns the level the calendar is shared with the user at, empty when it is not
+func ShareLevelOf(calendarId, userId string, db *gorm.DB) (ShareLevel, error) {
+	share := CalendarShare{}
+	err := db.Where("calendar_id = ? AND user_id = ?", calendarId, userId).First(&share).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return "", nil
+	}
+	return share.Level, err
+}
+
+// SharedCalendars lists the calendars of other users shared with the user
+func SharedCalendars(userId string, db *gorm.DB) ([]*SharedCalendar, error) {
+	shared := make([]*SharedCalendar, 0)
+	dbState := db.Table("calendar_shares").
+		Select("calendars.id AS calendar_id, calendars.name, calendars.user_id AS owner_id, calendar_shares.level").
+		Joins("JOIN calendars ON calendars.id = calendar_shares.calendar_id").
+		Where("calendar_shares.user_id = ?", userId).
+		Order("calendars.name").
+		Scan(&shared)
+	return shared, dbState.Error
+}
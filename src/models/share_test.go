@@ -0,0 +1,61 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestShareLevel_Includes(t *testing.T) {
+	assert.True(t, ShareManage.Includes(ShareWrite))
+	assert.True(t, ShareRead.Includes(ShareRead))
+	assert.True(t, ShareRead.Includes(ShareFreeBusy))
+	assert.False(t, ShareFreeBusy.Includes(ShareRead))
+	assert.False(t, ShareLevel("owner").Includes(ShareFreeBusy))
+
+	level, err := ParseShareLevel(" Write ")
+	assert.Nil(t, err)
+	assert.Equal(t, ShareWrite, level)
+	_, err = ParseShareLevel("admin")
+	assert.NotNil(t, err)
+}
+
+func TestCalendarShare_Save(t *testing.T) {
+	err := MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer DropAllData(db)
+
+	share := &CalendarShare{CalendarId: KnownCalendarId, UserId: SecondKnownUserId, Level: ShareRead}
+	assert.Nil(t, share.Save(db))
+	assert.NotEmpty(t, share.ID)
+
+	// sharing again changes the level of the existing share
+	again := &CalendarShare{CalendarId: KnownCalendarId, UserId: SecondKnownUserId, Level: ShareManage}
+	assert.Nil(t, again.Save(db))
+	assert.Equal(t, share.ID, again.ID)
+	level, err := ShareLevelOf(KnownCalendarId, SecondKnownUserId, db)
+	assert.Nil(t, err)
+	assert.Equal(t, ShareManage, level)
+
+	shared, err := SharedCalendars(SecondKnownUserId, db)
+	assert.Nil(t, err)
+	assert.Len(t, shared, 1)
+	assert.Equal(t, KnownCalendarId, shared[0].CalendarId)
+	assert.Equal(t, "John's personal calendar", shared[0].Name)
+	assert.Equal(t, KnownUserId, shared[0].OwnerId)
+	assert.Equal(t, ShareManage, shared[0].Level)
+
+	owner := &CalendarShare{CalendarId: KnownCalendarId, UserId: KnownUserId, Level: ShareRead}
+	assert.NotNil(t, owner.Save(db))
+	unknownUser := &CalendarShare{CalendarId: KnownCalendarId, UserId: UnexistingId, Level: ShareRead}
+	assert.NotNil(t, unknownUser.Save(db))
+	unknownCalendar := &CalendarShare{CalendarId: UnexistingId, UserId: SecondKnownUserId, Level: ShareRead}
+	assert.NotNil(t, unknownCalendar.Save(db))
+
+	assert.Nil(t, share.Delete(db))
+	assert.NotNil(t, share.Delete(db))
+	level, err = ShareLevelOf(KnownCalendarId, SecondKnownUserId, db)
+	assert.Nil(t, err)
+	assert.Equal(t, ShareLevel(""), level)
+}
@@ -0,0 +1,204 @@
+package models
+
+import (
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultSlotCount       = 5
+	MaxSlotCount           = 50
+	DefaultSlotGranularity = 15
+	clockLayout            = "15:04"
+)
+
+// WorkingHours restricts suggested slots to a daily time window
+// on the given weekdays, evaluated in the given time zone
+type WorkingHours struct {
+	Start    string   `json:"start"`
+	End      string   `json:"end"`
+	Days     []string `json:"days"`
+	TimeZone string   `json:"time_zone"`
+
+	start    time.Duration
+	end      time.Duration
+	weekdays map[time.Weekday]bool
+	location *time.Location
+}
+
+// SlotQuery looks for the earliest slots of Duration minutes within [From, To)
+// where all of the users are free. Slot starts are aligned to Granularity minutes
+type SlotQuery struct {
+	UserIds      []string      `json:"user_ids"`
+	From         time.Time     `json:"from"`
+	To           time.Time     `json:"to"`
+	Duration     int           `json:"duration"`
+	Count        int           `json:"count"`
+	Granularity  int           `json:"granularity"`
+	WorkingHours *WorkingHours `json:"working_hours"`
+	// ViewerId limits the busy time like FreeBusyQuery.ViewerId
+	ViewerId string `json:"-"`
+}
+
+type Slots struct {
+	Duration int         `json:"duration"`
+	Slots    []*Interval `json:"slots"`
+}
+
+func (wh *WorkingHours) Validate() error {
+	start, err := time.Parse(clockLayout, wh.Start)
+	if err != nil {
+		return NewModeError("working hours start should be formatted as HH:MM")
+	}
+	end, err := time.Parse(clockLayout, wh.End)
+	if err != nil {
+		return NewModeError("working hours end should be formatted as HH:MM")
+	}
+	if !start.Before(end) {
+		return NewModeError("working hours start should be before their end")
+	}
+	wh.start = start.Sub(start.Truncate(24 * time.Hour))
+	wh.end = end.Sub(end.Truncate(24 * time.Hour))
+
+	days := wh.Days
+	if len(days) == 0 {
+		days = []string{"MO", "TU", "WE", "TH", "FR"}
+	}
+	wh.weekdays = make(map[time.Weekday]bool, len(days))
+	for _, day := range days {
+		weekday, ok := weekdayCodes[strings.ToUpper(strings.TrimSpace(day))]
+		if !ok {
+			return NewModeError(fmt.Sprintf("invalid working day %s", day))
+		}
+		wh.weekdays[weekday] = true
+	}
+
+	wh.location, err = LoadTimeZone(wh.TimeZone)
+	return err
+}
+
+// windows returns the working time within [from, to)
+func (wh *WorkingHours) windows(from, to time.Time) []*Interval {
+	windows := make([]*Interval, 0)
+	local := from.In(wh.location)
+	day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, wh.location)
+	for day.Before(to) {
+		if wh.weekdays[day.Weekday()] {
+			windows = append(windows, &Interval{Start: wh.clock(day, wh.start), End: wh.clock(day, wh.end)})
+		}
+		day = time.Date(day.Year(), day.Month(), day.Day()+1, 0, 0, 0, 0, wh.location)
+	}
+	return MergeIntervals(windows, from, to)
+}
+
+// clock returns the wall clock time of day, honoring daylight saving changes
+func (wh *WorkingHours) clock(day time.Time, offset time.Duration) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, int(offset/time.Minute), 0, 0, wh.location)
+}
+
+func (q *SlotQuery) Validate() error {
+	freeBusy := FreeBusyQuery{UserIds: q.UserIds, From: q.From, To: q.To}
+	if err := freeBusy.Validate(); err != nil {
+		return err
+	}
+	if q.Duration <= 0 {
+		return NewModeError("duration should be a positive number of minutes")
+	}
+	if q.Count == 0 {
+		q.Count = DefaultSlotCount
+	}
+	if q.Count < 0 || q.Count > MaxSlotCount {
+		return NewModeError(fmt.Sprintf("count should be between 1 and %d", MaxSlotCount))
+	}
+	if q.Granularity == 0 {
+		q.Granularity = DefaultSlotGranularity
+	}
+	if q.Granularity < 0 {
+		return NewModeError("granularity should be a positive number of minutes")
+	}
+	if q.WorkingHours != nil {
+		return q.WorkingHours.Validate()
+	}
+	return nil
+}
+
+// Run suggests up to Count slots ordered by start
+func (q *SlotQuery) Run(db *gorm.DB) (*Slots, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	freeBusy := FreeBusyQuery{UserIds: q.UserIds, From: q.From, To: q.To, ViewerId: q.ViewerId}
+	busy, err := freeBusy.Run(db)
+	if err != nil {
+		return nil, err
+	}
+	intervals := make([]*Interval, 0)
+	for _, usr := range busy.Users {
+		intervals = append(intervals, usr.Busy...)
+	}
+	free := FreeIntervals(MergeIntervals(intervals, q.From, q.To), q.From, q.To)
+	if q.WorkingHours != nil {
+		free = IntersectIntervals(free, q.WorkingHours.windows(q.From, q.To))
+	}
+
+	duration := time.Duration(q.Duration) * time.Minute
+	granularity := time.Duration(q.Granularity) * time.Minute
+	result := &Slots{Duration: q.Duration, Slots: make([]*Interval, 0, q.Count)}
+	for _, window := range free {
+		start := window.Start.Truncate(granularity)
+		if start.Before(window.Start) {
+			start = start.Add(granularity)
+		}
+		for ; !start.Add(duration).After(window.End); start = start.Add(granularity) {
+			result.Slots = append(result.Slots, &Interval{Start: start, End: start.Add(duration)})
+			if len(result.Slots) == q.Count {
+				return result, nil
+			}
+		}
+	}
+	return result, nil
+}
+
+// FreeIntervals returns the gaps between merged busy intervals within [from, to)
+func FreeIntervals(busy []*Interval, from, to time.Time) []*Interval {
+	free := make([]*Interval, 0, len(busy)+1)
+	cursor := from.UTC()
+	for _, i := range busy {
+		if cursor.Before(i.Start) {
+			free = append(free, &Interval{Start: cursor, End: i.Start})
+		}
+		if i.End.After(cursor) {
+			cursor = i.End
+		}
+	}
+	if cursor.Before(to) {
+		free = append(free, &Interval{Start: cursor, End: to.UTC()})
+	}
+	return free
+}
+
+// IntersectIntervals returns the time covered by both lists of sorted, merged intervals
+func IntersectIntervals(a, b []*Interval) []*Interval {
+	result := make([]*Interval, 0)
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		start, end := a[i].Start, a[i].End
+		if b[j].Start.After(start) {
+			start = b[j].Start
+		}
+		if b[j].End.Before(end) {
+			end = b[j].End
+		}
+		if start.Before(end) {
+			result = append(result, &Interval{Start: start.UTC(), End: end.UTC()})
+		}
+		if a[i].End.Before(b[j].End) {
+			i++
+		} else {
+			j++
+		}
+	}
+	return result
+}
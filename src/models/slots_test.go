@@ -0,0 +1,93 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestFreeIntervals(t *testing.T) {
+	at := func(hour int) time.Time {
+		return time.Date(2020, 1, 6, hour, 0, 0, 0, time.UTC)
+	}
+	busy := []*Interval{{Start: at(8), End: at(10)}, {Start: at(12), End: at(13)}}
+	assert.Equal(t, []*Interval{
+		{Start: at(10), End: at(12)},
+		{Start: at(13), End: at(18)},
+	}, FreeIntervals(busy, at(8), at(18)))
+
+	working := []*Interval{{Start: at(9), End: at(11)}, {Start: at(14), End: at(17)}}
+	assert.Equal(t, []*Interval{
+		{Start: at(10), End: at(11)},
+		{Start: at(14), End: at(17)},
+	}, IntersectIntervals(FreeIntervals(busy, at(8), at(18)), working))
+}
+
+func TestSlotQuery_Run(t *testing.T) {
+	err := MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer DropAllData(db)
+
+	users := []string{KnownUserId, ThirdKnownUserId}
+
+	t.Run("success earliest slots", func(tt *testing.T) {
+		query := SlotQuery{
+			UserIds:     users,
+			From:        time.Date(2020, 1, 17, 18, 0, 0, 0, time.UTC),
+			To:          time.Date(2020, 1, 17, 23, 0, 0, 0, time.UTC),
+			Duration:    60,
+			Granularity: 30,
+		}
+		res, err := query.Run(db)
+		assert.Nil(tt, err)
+		assert.Equal(tt, []*Interval{
+			{Start: time.Date(2020, 1, 17, 18, 0, 0, 0, time.UTC), End: time.Date(2020, 1, 17, 19, 0, 0, 0, time.UTC)},
+			{Start: time.Date(2020, 1, 17, 18, 30, 0, 0, time.UTC), End: time.Date(2020, 1, 17, 19, 30, 0, 0, time.UTC)},
+			{Start: time.Date(2020, 1, 17, 19, 0, 0, 0, time.UTC), End: time.Date(2020, 1, 17, 20, 0, 0, 0, time.UTC)},
+		}, res.Slots)
+	})
+
+	t.Run("success working hours", func(tt *testing.T) {
+		query := SlotQuery{
+			UserIds:      users,
+			From:         time.Date(2020, 1, 17, 0, 0, 0, 0, time.UTC),
+			To:           time.Date(2020, 1, 21, 0, 0, 0, 0, time.UTC),
+			Duration:     30,
+			Count:        2,
+			WorkingHours: &WorkingHours{Start: "09:00", End: "17:00"},
+		}
+		res, err := query.Run(db)
+		assert.Nil(tt, err)
+		assert.Equal(tt, []*Interval{
+			{Start: time.Date(2020, 1, 17, 9, 0, 0, 0, time.UTC), End: time.Date(2020, 1, 17, 9, 30, 0, 0, time.UTC)},
+			{Start: time.Date(2020, 1, 17, 9, 15, 0, 0, time.UTC), End: time.Date(2020, 1, 17, 9, 45, 0, 0, time.UTC)},
+		}, res.Slots)
+	})
+
+	t.Run("success no free slot", func(tt *testing.T) {
+		query := SlotQuery{
+			UserIds:      users,
+			From:         time.Date(2020, 1, 17, 0, 0, 0, 0, time.UTC),
+			To:           time.Date(2020, 1, 19, 0, 0, 0, 0, time.UTC),
+			Duration:     30,
+			WorkingHours: &WorkingHours{Start: "09:00", End: "17:00", Days: []string{"SA"}},
+		}
+		res, err := query.Run(db)
+		assert.Nil(tt, err)
+		assert.Empty(tt, res.Slots)
+	})
+
+	t.Run("fail invalid working hours", func(tt *testing.T) {
+		query := SlotQuery{
+			UserIds:      users,
+			From:         time.Date(2020, 1, 17, 0, 0, 0, 0, time.UTC),
+			To:           time.Date(2020, 1, 19, 0, 0, 0, 0, time.UTC),
+			Duration:     30,
+			WorkingHours: &WorkingHours{Start: "17:00", End: "09:00"},
+		}
+		_, err := query.Run(db)
+		assert.NotNil(tt, err)
+	})
+}
@@ -0,0 +1,176 @@
+package models
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jinzhu/gorm"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultSyncLimit = 100
+	MaxSyncLimit     = MaxChangeLimit
+)
+
+var InvalidSyncTokenError = NewModeError("invalid sync token")
+
+// CalendarSync brings a copy of the appointments of a calendar up to date.
+// Token is the sync_token of the previous sync, an empty Token syncs the whole
+// calendar. Tokens are cursors of the change feed, so they stay valid for good.
+// The pages of a whole calendar sync are read with the cursor the sync started
+// at followed by the id of the last appointment sent, "<cursor>:<id>"
+type CalendarSync struct {
+	CalendarId string
+	Token      string
+	Limit      int
+}
+
+// Tombstone is an appointment deleted or moved to another calendar since the previous sync
+type Tombstone struct {
+	ID        string    `json:"id"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// SyncResult holds the appointments added or changed since the previous sync
+// in their current state and the ones removed as tombstones. More is set when
+// changes are left, they are read with SyncToken as the following token
+type SyncResult struct {
+	SyncToken    string         `json:"sync_token"`
+	Appointments []*Appointment `json:"appointments"`
+	Deleted      []*Tombstone   `json:"deleted"`
+	More         bool           `json:"more"`
+}
+
+func (s *CalendarSync) Validate() error {
+	if IdIsEmpty(s.CalendarId) {
+		return NewModeError("calendar_id can not be empty")
+	}
+	if s.Token != "" {
+		cursor, after := s.splitToken()
+		if id, err := strconv.ParseInt(cursor, 10, 64); err != nil || id < 0 {
+			return InvalidSyncTokenError
+		}
+		if _, err := uuid.Parse(after); after != "" && err != nil {
+			return InvalidSyncTokenError
+		}
+	}
+	if s.Limit == 0 {
+		s.Limit = DefaultSyncLimit
+	}
+	if s.Limit < 0 || s.Limit > MaxSyncLimit {
+		return NewModeError(fmt.Sprintf("limit should be between 1 and %d", MaxSyncLimit))
+	}
+	return nil
+}
+
+// splitToken returns the cursor of the change feed the token holds and the
+// id of the last appointment sent when it is a page of a whole calendar sync
+func (s *CalendarSync) splitToken() (cursor string, after string) {
+	parts := strings.SplitN(s.Token, ":", 2)
+	if len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	return parts[0], ""
+}
+
+func (s *CalendarSync) Run(db *gorm.DB) (*SyncResult, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	cursor, after := s.splitToken()
+	if cursor == "" || after != "" {
+		return s.full(cursor, after, db)
+	}
+
+	feed := ChangeFeed{CalendarId: s.CalendarId, Since: cursor, Limit: s.Limit}
+	page, err := feed.Run(db)
+	if err != nil {
+		return nil, err
+	}
+	result := &SyncResult{
+		SyncToken:    page.NextCursor,
+		Appointments: make([]*Appointment, 0),
+		Deleted:      make([]*Tombstone, 0),
+		More:         len(page.Changes) == s.Limit,
+	}
+	// changed appointments are reported once, in their current state
+	ids := make([]string, 0, len(page.Changes))
+	changedAt := make(map[string]time.Time, len(page.Changes))
+	for _, change := range page.Changes {
+		if change.Entity != EntityAppointment {
+			continue
+		}
+		if _, ok := changedAt[change.EntityId]; !ok {
+			ids = append(ids, change.EntityId)
+		}
+		changedAt[change.EntityId] = change.CreatedAt
+	}
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	appts := make([]*Appointment, 0, len(ids))
+	err = db.Unscoped().Preload("Attendees").Preload("ExternalAttendees").Preload("Exceptions").
+		Where("id IN (?)", ids).Find(&appts).Error
+	if err != nil {
+		return nil, err
+	}
+	byId := make(map[string]*Appointment, len(appts))
+	for _, appt := range appts {
+		byId[appt.ID] = appt
+	}
+	for _, id := range ids {
+		appt, ok := byId[id]
+		switch {
+		case ok && appt.DeletedAt == nil && appt.CalendarId == s.CalendarId:
+			result.Appointments = append(result.Appointments, appt)
+		case ok && appt.DeletedAt != nil:
+			result.Deleted = append(result.Deleted, &Tombstone{ID: id, DeletedAt: *appt.DeletedAt})
+		default:
+			// moved to another calendar, or deleted along with that calendar since
+			result.Deleted = append(result.Deleted, &Tombstone{ID: id, DeletedAt: changedAt[id]})
+		}
+	}
+	if err := loadParticipation(result.Appointments, db); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// full pages through every appointment of the calendar by id, the ones after the
+// id of after. The cursor is read on the first page, changes made meanwhile may
+// be found in the pages and again in the sync following the last page
+func (s *CalendarSync) full(cursor, after string, db *gorm.DB) (*SyncResult, error) {
+	if cursor == "" {
+		var last Change
+		err := db.Select("id").Order("id DESC").Limit(1).Find(&last).Error
+		if err != nil && !gorm.IsRecordNotFoundError(err) {
+			return nil, err
+		}
+		cursor = strconv.FormatInt(last.ID, 10)
+	}
+	appts := make([]*Appointment, 0, s.Limit)
+	query := db.Preload("Attendees").Preload("ExternalAttendees").Preload("Exceptions").
+		Where("calendar_id = ?", s.CalendarId)
+	if after != "" {
+		query = query.Where("id > ?", after)
+	}
+	if err := query.Order("id").Limit(s.Limit).Find(&appts).Error; err != nil {
+		return nil, err
+	}
+	if err := loadParticipation(appts, db); err != nil {
+		return nil, err
+	}
+	result := &SyncResult{
+		SyncToken:    cursor,
+		Appointments: appts,
+		Deleted:      make([]*Tombstone, 0),
+		More:         len(appts) == s.Limit,
+	}
+	if result.More {
+		result.SyncToken = fmt.Sprintf("%s:%s", cursor, appts[len(appts)-1].ID)
+	}
+	return result, nil
+}
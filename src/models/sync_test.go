@@ -0,0 +1,117 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestCalendarSync_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		sync    CalendarSync
+		wantErr bool
+	}{
+		{name: "full", sync: CalendarSync{CalendarId: KnownCalendarId}},
+		{name: "since token", sync: CalendarSync{CalendarId: KnownCalendarId, Token: "42", Limit: 10}},
+		{name: "no calendar", sync: CalendarSync{Token: "42"}, wantErr: true},
+		{name: "invalid token", sync: CalendarSync{CalendarId: KnownCalendarId, Token: "abc"}, wantErr: true},
+		{name: "limit too big", sync: CalendarSync{CalendarId: KnownCalendarId, Limit: MaxSyncLimit + 1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.sync.Validate()
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestCalendarSync_Run(t *testing.T) {
+	err := MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer DropAllData(db)
+
+	cal := &Calendar{Name: "Sync calendar", UserId: KnownUserId}
+	if err := cal.Create(db); err != nil {
+		t.Fatal("unable to create calendar", err)
+	}
+	start := time.Date(2020, 2, 3, 10, 0, 0, 0, time.UTC)
+	create := func(subject string) *Appointment {
+		appt := &Appointment{Subject: subject, CalendarId: cal.ID, Start: start, End: start.Add(time.Hour)}
+		if err := appt.Create(db); err != nil {
+			t.Fatal("unable to create appointment", err)
+		}
+		return appt
+	}
+	kept, deleted := create("Kept"), create("Deleted")
+
+	full := CalendarSync{CalendarId: cal.ID}
+	result, err := full.Run(db)
+	if !assert.Nil(t, err) {
+		return
+	}
+	assert.Len(t, result.Appointments, 2)
+	assert.Empty(t, result.Deleted)
+	assert.NotEmpty(t, result.SyncToken)
+	token := result.SyncToken
+
+	kept.Subject = "Kept and changed"
+	if err := kept.Update(db); err != nil {
+		t.Fatal("unable to update appointment", err)
+	}
+	if err := deleted.Delete(db); err != nil {
+		t.Fatal("unable to delete appointment", err)
+	}
+	// the subject of a deleted appointment is free again
+	added := create("Deleted")
+
+	t.Run("changes since token", func(tt *testing.T) {
+		sync := CalendarSync{CalendarId: cal.ID, Token: token}
+		result, err := sync.Run(db)
+		if !assert.Nil(tt, err) {
+			return
+		}
+		assert.False(tt, result.More)
+		if assert.Len(tt, result.Appointments, 2) {
+			assert.Equal(tt, kept.ID, result.Appointments[0].ID)
+			assert.Equal(tt, "Kept and changed", result.Appointments[0].Subject)
+			assert.Equal(tt, added.ID, result.Appointments[1].ID)
+		}
+		if assert.Len(tt, result.Deleted, 1) {
+			assert.Equal(tt, deleted.ID, result.Deleted[0].ID)
+			assert.False(tt, result.Deleted[0].DeletedAt.IsZero())
+		}
+
+		sync = CalendarSync{CalendarId: cal.ID, Token: result.SyncToken}
+		result, err = sync.Run(db)
+		assert.Nil(tt, err)
+		assert.Empty(tt, result.Appointments)
+		assert.Empty(tt, result.Deleted)
+		assert.Equal(tt, sync.Token, result.SyncToken)
+	})
+
+	t.Run("changes page by page", func(tt *testing.T) {
+		sync := CalendarSync{CalendarId: cal.ID, Token: token, Limit: 1}
+		result, err := sync.Run(db)
+		if !assert.Nil(tt, err) {
+			return
+		}
+		assert.True(tt, result.More)
+		assert.Len(tt, result.Appointments, 1)
+		assert.NotEqual(tt, token, result.SyncToken)
+	})
+
+	t.Run("deleted appointment is gone from reads", func(tt *testing.T) {
+		appt := &Appointment{Base: Base{ID: deleted.ID}}
+		assert.NotNil(tt, appt.Read(db))
+		result, err := full.Run(db)
+		assert.Nil(tt, err)
+		assert.Len(tt, result.Appointments, 2)
+	})
+}
@@ -0,0 +1,138 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// LoadTimeZone resolves an IANA time zone name, the empty name is UTC
+func LoadTimeZone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, NewModeError(fmt.Sprintf("unknown time zone %s", name))
+	}
+	return loc, nil
+}
+
+// inZone moves t into loc leaving zero times as they are
+func inZone(t time.Time, loc *time.Location) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return t.In(loc)
+}
+
+// Location is the time zone the appointment was authored in. Recurrences
+// are expanded and whole day appointments take their days in this zone
+func (a *Appointment) Location() *time.Location {
+	loc, err := LoadTimeZone(a.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// localize moves the times of the appointment and its exceptions into its time zone
+func (a *Appointment) localize() {
+	loc := a.Location()
+	a.Start = inZone(a.Start, loc)
+	a.End = inZone(a.End, loc)
+	for _, e := range a.Exceptions {
+		e.RecurrenceId = inZone(e.RecurrenceId, loc)
+		e.Start = inZone(e.Start, loc)
+		e.End = inZone(e.End, loc)
+	}
+}
+
+// In renders the times of the appointment in loc. Whole day appointments
+// keep the times of their own zone so that their dates do not change
+func (a *Appointment) In(loc *time.Location) {
+	for _, c := range a.Conflicts {
+		c.Start = inZone(c.Start, loc)
+		c.End = inZone(c.End, loc)
+	}
+	if a.WholeDay {
+		return
+	}
+	a.Start = inZone(a.Start, loc)
+	a.End = inZone(a.End, loc)
+	for _, e := range a.Exceptions {
+		e.RecurrenceId = inZone(e.RecurrenceId, loc)
+		e.Start = inZone(e.Start, loc)
+		e.End = inZone(e.End, loc)
+	}
+}
+
+func (o *Occurrence) In(loc *time.Location) {
+	if o.WholeDay {
+		return
+	}
+	o.RecurrenceId = inZone(o.RecurrenceId, loc)
+	o.Start = inZone(o.Start, loc)
+	o.End = inZone(o.End, loc)
+}
+
+func (p *OccurrencePage) In(loc *time.Location) {
+	for _, occ := range p.Occurrences {
+		occ.In(loc)
+	}
+}
+
+func (a *Agenda) In(loc *time.Location) {
+	a.From = inZone(a.From, loc)
+	a.To = inZone(a.To, loc)
+	for _, e := range a.Entries {
+		e.In(loc)
+	}
+}
+
+func (s *SearchResults) In(loc *time.Location) {
+	for _, result := range s.Results {
+		result.In(loc)
+	}
+}
+
+func (c *Calendar) In(loc *time.Location) {
+	for _, appt := range c.Appointments {
+		appt.In(loc)
+	}
+}
+
+func (u *User) In(loc *time.Location) {
+	for _, appt := range u.Appointments {
+		appt.In(loc)
+	}
+	for _, cal := range u.Calendars {
+		cal.In(loc)
+	}
+}
+
+func (f *FreeBusy) In(loc *time.Location) {
+	f.From = inZone(f.From, loc)
+	f.To = inZone(f.To, loc)
+	for _, usr := range f.Users {
+		for _, i := range usr.Busy {
+			i.Start = inZone(i.Start, loc)
+			i.End = inZone(i.End, loc)
+		}
+	}
+}
+
+func (s *Slots) In(loc *time.Location) {
+	for _, i := range s.Slots {
+		i.Start = inZone(i.Start, loc)
+		i.End = inZone(i.End, loc)
+	}
+}
+
+// Location is the default time zone times are displayed to the user in
+func (u *User) Location() *time.Location {
+	loc, err := LoadTimeZone(u.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestAppointment_OccurrencesAcrossDST(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip("time zone database is not available")
+	}
+
+	t.Run("recurrence keeps the wall clock time", func(tt *testing.T) {
+		appt := &Appointment{
+			Subject:    "Weekly sync",
+			CalendarId: KnownCalendarId,
+			Start:      time.Date(2020, 3, 23, 8, 0, 0, 0, time.UTC),
+			End:        time.Date(2020, 3, 23, 8, 30, 0, 0, time.UTC),
+			Recurrence: "FREQ=WEEKLY;COUNT=2",
+			TimeZone:   "Europe/Berlin",
+		}
+		assert.Nil(tt, appt.Validate())
+		occurrences, err := appt.Occurrences(time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC))
+		assert.Nil(tt, err)
+		assert.Len(tt, occurrences, 2)
+		assert.Equal(tt, time.Date(2020, 3, 30, 7, 0, 0, 0, time.UTC), occurrences[1].Start.UTC())
+		assert.Equal(tt, 9, occurrences[1].Start.Hour())
+	})
+
+	t.Run("whole day takes the day of its zone", func(tt *testing.T) {
+		appt := &Appointment{
+			Subject:    "day off",
+			CalendarId: KnownCalendarId,
+			Start:      time.Date(2020, 3, 29, 0, 0, 0, 0, berlin),
+			WholeDay:   true,
+			TimeZone:   "Europe/Berlin",
+		}
+		assert.Nil(tt, appt.Validate())
+		occurrences, err := appt.Occurrences(time.Date(2020, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 5, 1, 0, 0, 0, 0, time.UTC))
+		assert.Nil(tt, err)
+		assert.Len(tt, occurrences, 1)
+		interval := occurrences[0].Interval()
+		assert.Equal(tt, time.Date(2020, 3, 28, 23, 0, 0, 0, time.UTC), interval.Start.UTC())
+		assert.Equal(tt, 23*time.Hour, interval.End.Sub(interval.Start))
+	})
+
+	t.Run("fail unknown time zone", func(tt *testing.T) {
+		appt := &Appointment{
+			Subject:    "somewhere",
+			CalendarId: KnownCalendarId,
+			Start:      time.Date(2020, 3, 23, 8, 0, 0, 0, time.UTC),
+			End:        time.Date(2020, 3, 23, 8, 30, 0, 0, time.UTC),
+			TimeZone:   "Mars/Olympus",
+		}
+		assert.NotNil(tt, appt.Validate())
+	})
+}
@@ -5,8 +5,11 @@ import (
 	"github.com/jinzhu/gorm"
 	"regexp"
 	"strings"
+	"time"
 )
 
+var emailRegexp = regexp.MustCompile(`^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,4}$`)
+
 type UserInterface interface {
 	Validate() error
 	Create(db *gorm.DB) error
@@ -17,11 +20,23 @@ type UserInterface interface {
 
 type User struct {
 	Base
+	// Version is bumped by every change, updates and deletions setting it expect the stored user at that version
+	Version      int64          `gorm:"not null;default:1" json:"version"`
 	FirstName    string         `sql:"not null" json:"first_name"`
 	LastName     string         `sql:"not null" json:"last_name"`
 	Email        string         `sql:"unique_index; not null" json:"email"`
+	TimeZone     string         `json:"time_zone"`
 	Appointments []*Appointment `gorm:"many2many:users_appointments;" json:"appointments"`
 	Calendars    []*Calendar    `json:"calendars"`
+	// SharedCalendars are the calendars of other users shared with the user
+	SharedCalendars []*SharedCalendar `gorm:"-" json:"shared_calendars"`
+	// Participation is set for users listed as attendees of an appointment
+	Participation *Participation `gorm:"-" json:"participation,omitempty"`
+}
+
+type UserPage struct {
+	Users      []*User `json:"users"`
+	NextCursor string  `json:"next_cursor,omitempty"`
 }
 
 func (u *User) AfterFind() (err error) {
@@ -31,11 +46,13 @@ func (u *User) AfterFind() (err error) {
 	if u.Appointments == nil {
 		u.Appointments = []*Appointment{}
 	}
+	if u.SharedCalendars == nil {
+		u.SharedCalendars = []*SharedCalendar{}
+	}
 	return
 }
 
 func (u *User) Validate() error {
-	const emailValidatePattern = `^[a-z0-9._%+\-]+@[a-z0-9.\-]+\.[a-z]{2,4}$`
 	u.FirstName = strings.TrimSpace(u.FirstName)
 	if u.FirstName == "" {
 		return NewModeError("first name can not be empty")
@@ -48,10 +65,13 @@ func (u *User) Validate() error {
 	if u.Email == "" {
 		return NewModeError("email can not be empty")
 	}
-	re := regexp.MustCompile(emailValidatePattern)
-	if !re.MatchString(u.Email) {
+	if !emailRegexp.MatchString(u.Email) {
 		return NewModeError(fmt.Sprintf("%s is not a valid email", u.Email))
 	}
+	u.TimeZone = strings.TrimSpace(u.TimeZone)
+	if _, err := LoadTimeZone(u.TimeZone); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -59,22 +79,77 @@ func (u *User) Create(db *gorm.DB) error {
 	if err := u.Validate(); err != nil {
 		return err
 	}
-	err := db.Create(u).Error
-	return err
+	u.Version = 1
+	tx := db.Begin()
+	if err := tx.Create(u).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := u.claimExternalAttendance(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := recordChange(EntityUser, u.ID, ChangeCreate, nil, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
 }
 
 func (u *User) Delete(db *gorm.DB) error {
 	if u.EmptyID() {
 		return EmptyIdError
 	}
-	dbState := db.Delete(u)
-	if dbState.Error != nil {
-		return nil
+	tx := db.Begin()
+	if err := checkVersion(EntityUser, u.ID, u.Version, tx); err != nil {
+		tx.Rollback()
+		return err
 	}
-	if dbState.RowsAffected == 0 {
+	before, err := snapshot(EntityUser, u.ID, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if before == nil {
+		tx.Rollback()
 		return NewModeError(fmt.Sprintf("user with id=%s not present in the db", u.ID))
 	}
-	return nil
+	// the calendars of the user are deleted along with it
+	var calendarIds []string
+	if err := tx.Model(&Calendar{}).Where("user_id = ?", u.ID).Pluck("id", &calendarIds).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := lockCalendars(calendarIds, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, calendarId := range calendarIds {
+		if err := recordCalendarDeletion(calendarId, tx); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := recordChange(EntityUser, u.ID, ChangeDelete, before, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Delete(u).Error; err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+// fields maps the columns of the user itself to their values, the empty ones included
+func (u *User) fields() map[string]interface{} {
+	return map[string]interface{}{
+		"first_name": u.FirstName,
+		"last_name":  u.LastName,
+		"email":      u.Email,
+		"time_zone":  u.TimeZone,
+		"updated_at": time.Now(),
+	}
 }
 
 func (u *User) Update(db *gorm.DB) error {
@@ -84,14 +159,39 @@ func (u *User) Update(db *gorm.DB) error {
 	if u.EmptyID() {
 		return EmptyIdError
 	}
-	dbState := db.Model(&User{}).Updates(u)
+	tx := db.Begin()
+	if err := checkVersion(EntityUser, u.ID, u.Version, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	before, err := snapshot(EntityUser, u.ID, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	dbState := tx.Model(&User{}).Where("id = ?", u.ID).Updates(u.fields())
 	if dbState.Error != nil {
+		tx.Rollback()
 		return dbState.Error
 	}
 	if dbState.RowsAffected == 0 {
+		tx.Rollback()
 		return NewModeError(fmt.Sprintf("user with id=%s not present in the db", u.ID))
 	}
-	return nil
+	// a changed email may match invitations sent to it
+	if err := u.claimExternalAttendance(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := recordChange(EntityUser, u.ID, ChangeUpdate, before, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if u.Version, err = versionOf(EntityUser, u.ID, tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
 }
 
 func (u *User) Read(db *gorm.DB) error {
@@ -108,5 +208,39 @@ func (u *User) Read(db *gorm.DB) error {
 	if u.Appointments == nil {
 		u.Appointments = []*Appointment{}
 	}
+	shared, err := SharedCalendars(u.ID, db)
+	if err != nil {
+		return err
+	}
+	u.SharedCalendars = shared
 	return nil
 }
+
+// UsersByEmail returns the users registered with the emails and
+// a warning for every email no user has
+func UsersByEmail(emails []string, db *gorm.DB) ([]*User, []string, error) {
+	usrs := make([]*User, 0, len(emails))
+	warnings := make([]string, 0)
+	if len(emails) == 0 {
+		return usrs, warnings, nil
+	}
+	lowered := make([]string, 0, len(emails))
+	for _, email := range emails {
+		lowered = append(lowered, strings.ToLower(strings.TrimSpace(email)))
+	}
+	if err := db.Where("lower(email) IN (?)", lowered).Find(&usrs).Error; err != nil {
+		return nil, nil, err
+	}
+
+	known := make(map[string]bool, len(usrs))
+	for _, usr := range usrs {
+		known[strings.ToLower(usr.Email)] = true
+	}
+	for _, email := range lowered {
+		if !known[email] {
+			warnings = append(warnings, fmt.Sprintf("attendee %s is not a registered user", email))
+			known[email] = true
+		}
+	}
+	return usrs, warnings, nil
+}
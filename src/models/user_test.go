@@ -5,6 +5,7 @@ import (
 	"github.com/jinzhu/gorm"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestUser_Validate(t *testing.T) {
@@ -152,6 +153,15 @@ func TestUser_Update(t *testing.T) {
 	db.Find(&user2, "id = ?", user.ID)
 	assert.Equal(t, user.FirstName, user2.FirstName)
 
+	// a time zone once set can be cleared again
+	user.TimeZone = "Europe/Berlin"
+	assert.Nil(t, user.Update(db))
+	user.TimeZone = ""
+	assert.Nil(t, user.Update(db))
+	var user3 User
+	db.Find(&user3, "id = ?", user.ID)
+	assert.Equal(t, "", user3.TimeZone)
+
 	user.Email = "adf"
 	err = user.Update(db)
 	assert.NotNil(t, err)
@@ -178,3 +188,41 @@ func TestUser_Read(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, user.FirstName, user2.FirstName)
 }
+
+func TestUser_Agenda(t *testing.T) {
+	err := MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer DropAllData(db)
+
+	from := time.Date(2020, 1, 17, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2020, 1, 21, 0, 0, 0, 0, time.UTC)
+
+	owner := &User{Base: Base{ID: KnownUserId}}
+	agenda, err := owner.Agenda(from, to, db)
+	assert.Nil(t, err)
+	assert.Len(t, agenda.Entries, 3)
+	assert.Equal(t, AppointmentFixedTimeId, agenda.Entries[0].AppointmentId)
+	assert.Equal(t, AppointmentWholeDayId, agenda.Entries[1].AppointmentId)
+	assert.Equal(t, AppointmentRecurringId, agenda.Entries[2].AppointmentId)
+	for _, entry := range agenda.Entries {
+		assert.Equal(t, RoleOwner, entry.Role)
+		assert.Equal(t, KnownCalendarId, entry.CalendarId)
+		assert.Equal(t, "John's personal calendar", entry.CalendarName)
+	}
+
+	attendee := &User{Base: Base{ID: ThirdKnownUserId}}
+	agenda, err = attendee.Agenda(from, to, db)
+	assert.Nil(t, err)
+	assert.Len(t, agenda.Entries, 1)
+	assert.Equal(t, AppointmentWholeDayId, agenda.Entries[0].AppointmentId)
+	assert.Equal(t, RoleAttendee, agenda.Entries[0].Role)
+
+	missing := &User{Base: Base{ID: UnexistingId}}
+	_, err = missing.Agenda(from, to, db)
+	assert.NotNil(t, err)
+
+	_, err = owner.Agenda(to, from, db)
+	assert.NotNil(t, err)
+}
@@ -6,10 +6,14 @@ import (
 	"time"
 )
 
-func InitDbConnection(host, port, user, password, dbname, sslmode string, maxOpenConn, maxIdleConn, connTimeout int) (*gorm.DB, error) {
-	connectString := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+// ConnectString returns the postgres connection string, also used by listeners of notifications
+func ConnectString(host, port, user, password, dbname, sslmode string) string {
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
 		host, port, user, password, dbname, sslmode)
-	db, err := gorm.Open("postgres", connectString)
+}
+
+func InitDbConnection(host, port, user, password, dbname, sslmode string, maxOpenConn, maxIdleConn, connTimeout int) (*gorm.DB, error) {
+	db, err := gorm.Open("postgres", ConnectString(host, port, user, password, dbname, sslmode))
 	if err != nil {
 		return nil, err
 	}
@@ -21,13 +25,29 @@ func InitDbConnection(host, port, user, password, dbname, sslmode string, maxOpe
 }
 
 func RecreateTables(db *gorm.DB) {
+	db.DropTableIfExists(&Change{})
+	db.DropTableIfExists(&WebhookDelivery{})
+	db.DropTableIfExists(&Webhook{})
+	db.DropTableIfExists(&AppPassword{})
+	db.DropTableIfExists(&CalendarShare{})
+	db.DropTableIfExists(&ExternalAttendee{})
+	db.DropTableIfExists(&Alarm{})
 	db.DropTableIfExists("users_appointments")
+	db.DropTableIfExists(&AppointmentException{})
 	db.DropTableIfExists(&Appointment{})
 	db.DropTableIfExists(&Calendar{})
 	db.DropTableIfExists(&User{})
 	db.CreateTable(&User{})
 	db.CreateTable(&Calendar{})
 	db.CreateTable(&Appointment{})
+	db.CreateTable(&AppointmentException{})
+	db.CreateTable(&CalendarShare{})
+	db.CreateTable(&ExternalAttendee{})
+	db.CreateTable(&Alarm{})
+	db.CreateTable(&AppPassword{})
+	db.CreateTable(&Webhook{})
+	db.CreateTable(&WebhookDelivery{})
+	db.CreateTable(&Change{})
 }
 
 func InitIndexes(db *gorm.DB) {
@@ -36,12 +56,76 @@ func InitIndexes(db *gorm.DB) {
 	db.Model(&Appointment{}).AddForeignKey("calendar_id", "calendars(id)", "CASCADE", "CASCADE")
 	db.Table("users_appointments").AddForeignKey("user_id", "users(id)", "CASCADE", "CASCADE")
 	db.Table("users_appointments").AddForeignKey("appointment_id", "appointments(id)", "CASCADE", "CASCADE")
-	db.Model(&Appointment{}).AddUniqueIndex("idx_calendar_id_subject_unique", "calendar_id", "subject")
+	// participation of the attendees
+	db.Exec(`ALTER TABLE users_appointments
+		ADD COLUMN IF NOT EXISTS status text NOT NULL DEFAULT 'needs-action',
+		ADD COLUMN IF NOT EXISTS role text NOT NULL DEFAULT 'required',
+		ADD COLUMN IF NOT EXISTS rsvp_at timestamp with time zone,
+		ADD COLUMN IF NOT EXISTS comment text NOT NULL DEFAULT ''`)
+	db.Model(&Appointment{}).AddForeignKey("parent_id", "appointments(id)", "SET NULL", "CASCADE")
+	// series split off another one keep the subject of their parent
+	db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_calendar_id_subject_unique
+		ON appointments (calendar_id, subject) WHERE parent_id IS NULL AND deleted_at IS NULL`)
+	// caldav clients address appointments by their object name and tell them apart by their uid
+	db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_appointments_calendar_id_object_name_unique
+		ON appointments (calendar_id, object_name) WHERE object_name <> '' AND deleted_at IS NULL`)
+	db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_appointments_calendar_id_uid_unique
+		ON appointments (calendar_id, uid) WHERE uid <> '' AND deleted_at IS NULL`)
+	db.Model(&Appointment{}).AddIndex("idx_appointments_calendar_id_start_end", "calendar_id", "start", "end")
+	db.Model(&AppointmentException{}).AddForeignKey("appointment_id", "appointments(id)", "CASCADE", "CASCADE")
+	db.Model(&AppointmentException{}).AddUniqueIndex("idx_appointment_id_recurrence_id_unique", "appointment_id", "recurrence_id")
+	// appointments booked under the reject conflict policy can not overlap within a calendar
+	db.Exec(`CREATE EXTENSION IF NOT EXISTS btree_gist`)
+	db.Exec(`ALTER TABLE appointments ADD COLUMN IF NOT EXISTS during tstzrange`)
+	db.Exec(`ALTER TABLE appointments ADD CONSTRAINT appointments_calendar_id_during_excl
+		EXCLUDE USING gist (calendar_id WITH =, during WITH &&) WHERE (during IS NOT NULL)`)
+	db.Model(&CalendarShare{}).AddForeignKey("calendar_id", "calendars(id)", "CASCADE", "CASCADE")
+	db.Model(&CalendarShare{}).AddForeignKey("user_id", "users(id)", "CASCADE", "CASCADE")
+	db.Model(&CalendarShare{}).AddUniqueIndex("idx_calendar_shares_calendar_id_user_id_unique", "calendar_id", "user_id")
+	db.Model(&CalendarShare{}).AddIndex("idx_calendar_shares_user_id", "user_id")
+	db.Model(&ExternalAttendee{}).AddForeignKey("appointment_id", "appointments(id)", "CASCADE", "CASCADE")
+	db.Model(&ExternalAttendee{}).AddUniqueIndex("idx_external_attendees_appointment_id_email_unique", "appointment_id", "email")
+	db.Model(&ExternalAttendee{}).AddIndex("idx_external_attendees_email", "email")
+	db.Model(&Alarm{}).AddForeignKey("appointment_id", "appointments(id)", "CASCADE", "CASCADE")
+	db.Model(&Alarm{}).AddForeignKey("user_id", "users(id)", "CASCADE", "CASCADE")
+	db.Model(&Alarm{}).AddIndex("idx_alarms_appointment_id_user_id", "appointment_id", "user_id")
+	db.Model(&AppPassword{}).AddForeignKey("user_id", "users(id)", "CASCADE", "CASCADE")
+	db.Model(&AppPassword{}).AddIndex("idx_app_passwords_user_id_hash", "user_id", "hash")
+	db.Model(&Webhook{}).AddForeignKey("user_id", "users(id)", "CASCADE", "CASCADE")
+	db.Model(&WebhookDelivery{}).AddForeignKey("webhook_id", "webhooks(id)", "CASCADE", "CASCADE")
+	db.Model(&WebhookDelivery{}).AddIndex("idx_webhook_deliveries_status_next_attempt_at", "status", "next_attempt_at")
+	db.Model(&WebhookDelivery{}).AddIndex("idx_webhook_deliveries_webhook_id_created_at", "webhook_id", "created_at")
+	// full text search over the subject and the description
+	db.Exec(`ALTER TABLE appointments ADD COLUMN IF NOT EXISTS search_vector tsvector`)
+	db.Exec(appointmentsSearchVectorFunction)
+	db.Exec(`DROP TRIGGER IF EXISTS appointments_search_vector_update ON appointments`)
+	db.Exec(`CREATE TRIGGER appointments_search_vector_update
+		BEFORE INSERT OR UPDATE OF subject, description ON appointments
+		FOR EACH ROW EXECUTE PROCEDURE appointments_search_vector_update()`)
+	db.Exec(`CREATE INDEX IF NOT EXISTS idx_appointments_search_vector ON appointments USING gin (search_vector)`)
 }
 
+const appointmentsSearchVectorFunction = `
+CREATE OR REPLACE FUNCTION appointments_search_vector_update() RETURNS trigger AS $$
+BEGIN
+	NEW.search_vector :=
+		setweight(to_tsvector('english', COALESCE(NEW.subject, '')), 'A') ||
+		setweight(to_tsvector('english', COALESCE(NEW.description, '')), 'B');
+	RETURN NEW;
+END
+$$ LANGUAGE plpgsql`
+
 func DropAllData(db *gorm.DB) {
+	db.Where("true").Delete(&Change{})
+	db.Where("true").Delete(&WebhookDelivery{})
+	db.Where("true").Delete(&Webhook{})
+	db.Where("true").Delete(&AppPassword{})
+	db.Where("true").Delete(&CalendarShare{})
+	db.Where("true").Delete(&ExternalAttendee{})
+	db.Where("true").Delete(&Alarm{})
 	db.Where("true").Delete("users_appointments")
-	db.Where("true").Delete(&Appointment{})
+	db.Where("true").Delete(&AppointmentException{})
+	db.Unscoped().Where("true").Delete(&Appointment{})
 	db.Where("true").Delete(&Calendar{})
 	db.Where("true").Delete(&User{})
 }
@@ -0,0 +1,90 @@
+package models
+
+import (
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"strconv"
+	"strings"
+)
+
+// VersionMismatchError is returned when a change expects an entity at another version than the stored one
+var VersionMismatchError = NewModeError("version mismatch, the entity was changed meanwhile")
+
+var versionedTables = map[EntityType]string{
+	EntityUser:        "users",
+	EntityCalendar:    "calendars",
+	EntityAppointment: "appointments",
+}
+
+// checkVersion locks the entity until the end of the transaction and makes sure it
+// is at the expected version, 0 expects any version. Missing entities are left to
+// the change to report
+func checkVersion(entity EntityType, id string, expected int64, tx *gorm.DB) error {
+	version, err := lockRow(entity, id, tx)
+	if err != nil {
+		return err
+	}
+	if expected != 0 && version != 0 && version != expected {
+		return VersionMismatchError
+	}
+	return nil
+}
+
+// lockRow locks the entity until the end of the transaction and returns its version,
+// 0 when it does not exist. Writers lock the entity they change before anything else,
+// the outbox above all, so that they wait for each other in the same order
+func lockRow(entity EntityType, id string, tx *gorm.DB) (int64, error) {
+	rows := make([]*struct{ Version int64 }, 0, 1)
+	query := fmt.Sprintf("SELECT version FROM %s WHERE id = ? FOR UPDATE", versionedTables[entity])
+	if err := tx.Raw(query, id).Scan(&rows).Error; err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	return rows[0].Version, nil
+}
+
+// lockCalendars locks the calendars and their appointments ahead of their deletion
+func lockCalendars(calendarIds []string, tx *gorm.DB) error {
+	if len(calendarIds) == 0 {
+		return nil
+	}
+	if err := tx.Exec("SELECT id FROM calendars WHERE id IN (?) FOR UPDATE", calendarIds).Error; err != nil {
+		return err
+	}
+	return tx.Exec("SELECT id FROM appointments WHERE calendar_id IN (?) AND deleted_at IS NULL ORDER BY id FOR UPDATE", calendarIds).Error
+}
+
+// bumpVersion moves the entity to its next version. Every update of an
+// entity recorded in the outbox bumps its version
+func bumpVersion(entity EntityType, id string, tx *gorm.DB) error {
+	return tx.Exec(fmt.Sprintf("UPDATE %s SET version = version + 1 WHERE id = ?", versionedTables[entity]), id).Error
+}
+
+// versionOf reads the version of the entity
+func versionOf(entity EntityType, id string, db *gorm.DB) (int64, error) {
+	rows := make([]*struct{ Version int64 }, 0, 1)
+	query := fmt.Sprintf("SELECT version FROM %s WHERE id = ?", versionedTables[entity])
+	if err := db.Raw(query, id).Scan(&rows).Error; err != nil {
+		return 0, err
+	}
+	if len(rows) == 0 {
+		return 0, NewModeError(fmt.Sprintf("%s with id=%s not present in the db", entity, id))
+	}
+	return rows[0].Version, nil
+}
+
+// VersionOfETag returns the version the strong etag was made at, etags start with
+// the version followed by an optional dash. ok is false for weak and foreign etags
+func VersionOfETag(etag string) (version int64, ok bool) {
+	etag = strings.TrimSpace(etag)
+	if len(etag) < 2 || !strings.HasPrefix(etag, `"`) || !strings.HasSuffix(etag, `"`) {
+		return 0, false
+	}
+	version, err := strconv.ParseInt(strings.SplitN(strings.Trim(etag, `"`), "-", 2)[0], 10, 64)
+	if err != nil || version <= 0 {
+		return 0, false
+	}
+	return version, true
+}
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestVersions(t *testing.T) {
+	err := MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer DropAllData(db)
+
+	calendar := &Calendar{Base: Base{ID: KnownCalendarId}}
+	if err := calendar.Read(db); err != nil {
+		t.Fatal("unable to read calendar", err)
+	}
+	stale := calendar.Version
+
+	t.Run("update bumps the version", func(tt *testing.T) {
+		update := &Calendar{Base: Base{ID: KnownCalendarId}, Name: "versioned", UserId: KnownUserId, Version: stale}
+		if assert.NoError(tt, update.Update(db)) {
+			assert.Equal(tt, stale+1, update.Version)
+		}
+	})
+
+	t.Run("fail update at a stale version", func(tt *testing.T) {
+		update := &Calendar{Base: Base{ID: KnownCalendarId}, Name: "stale", UserId: KnownUserId, Version: stale}
+		assert.Equal(tt, VersionMismatchError, update.Update(db))
+	})
+
+	t.Run("fail delete at a stale version", func(tt *testing.T) {
+		deleted := &Calendar{Base: Base{ID: KnownCalendarId}, Version: stale}
+		assert.Equal(tt, VersionMismatchError, deleted.Delete(db))
+	})
+
+	t.Run("update without a version", func(tt *testing.T) {
+		update := &Calendar{Base: Base{ID: KnownCalendarId}, Name: "any version", UserId: KnownUserId}
+		if assert.NoError(tt, update.Update(db)) {
+			assert.Equal(tt, stale+2, update.Version)
+		}
+	})
+}
+
+func TestAppointment_ReplaceVersion(t *testing.T) {
+	err := MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer DropAllData(db)
+
+	appt := &Appointment{Base: Base{ID: AppointmentFixedTimeId}}
+	if err := appt.Read(db); err != nil {
+		t.Fatal("unable to read appointment", err)
+	}
+	stale := appt.Version
+	appt.TimeZone = "Europe/Berlin"
+	if assert.NoError(t, appt.Replace(db)) {
+		assert.Equal(t, stale+1, appt.Version)
+	}
+
+	stored := &Appointment{Base: Base{ID: AppointmentFixedTimeId}}
+	if assert.NoError(t, stored.Read(db)) {
+		assert.Equal(t, "Europe/Berlin", stored.TimeZone)
+	}
+
+	appt.Version = stale
+	assert.Equal(t, VersionMismatchError, appt.Replace(db))
+}
@@ -0,0 +1,357 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/lib/pq"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultDeliveryLimit = 50
+	MaxDeliveryLimit     = 100
+)
+
+type EventType string
+
+const (
+	EventAppointmentCreated EventType = "appointment.created"
+	EventAppointmentUpdated EventType = "appointment.updated"
+	EventAppointmentDeleted EventType = "appointment.deleted"
+	// EventAttendeesChanged is sent when attendees are added or removed and when they answer invitations
+	EventAttendeesChanged EventType = "appointment.attendees_changed"
+	EventCalendarCreated  EventType = "calendar.created"
+	EventCalendarUpdated  EventType = "calendar.updated"
+	EventCalendarDeleted  EventType = "calendar.deleted"
+	// EventSharesChanged is sent when the calendar is shared with a user, at another level or no more
+	EventSharesChanged EventType = "calendar.shares_changed"
+	EventUserCreated   EventType = "user.created"
+	EventUserUpdated   EventType = "user.updated"
+	// EventUserDeleted is found in the change feed only, the webhooks of the user are gone with it
+	EventUserDeleted EventType = "user.deleted"
+
+	// AllEvents subscribes a webhook to every event type
+	AllEvents = "*"
+)
+
+// AllowPrivateWebhooks lets webhooks deliver to private, loopback and link local
+// addresses, for local development only. It is set up by the app configuration
+var AllowPrivateWebhooks bool
+
+// nonPublicNetworks are the networks webhooks can not deliver to, besides
+// the loopback, link local, multicast and unspecified addresses
+var nonPublicNetworks = parseNetworks(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"240.0.0.0/4",
+	"fc00::/7",
+)
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// IsPublicIP tells whether webhooks may deliver to the address
+func IsPublicIP(ip net.IP) bool {
+	if AllowPrivateWebhooks {
+		return true
+	}
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+var eventTypes = map[EventType]bool{
+	EventAppointmentCreated: true,
+	EventAppointmentUpdated: true,
+	EventAppointmentDeleted: true,
+	EventAttendeesChanged:   true,
+	EventCalendarCreated:    true,
+	EventCalendarUpdated:    true,
+	EventCalendarDeleted:    true,
+	EventSharesChanged:      true,
+	EventUserCreated:        true,
+	EventUserUpdated:        true,
+}
+
+// Event is a change made through the api
+type Event struct {
+	ID         string      `json:"id"`
+	Type       EventType   `json:"type"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Data       interface{} `json:"data"`
+}
+
+// Webhook delivers the events concerning its user to Url. Deliveries are
+// signed with Secret, which is generated when left empty and shown on creation only
+type Webhook struct {
+	Base
+	UserId string         `gorm:"type:uuid;not null" json:"user_id"`
+	Url    string         `gorm:"not null" json:"url"`
+	Secret string         `gorm:"not null" json:"secret,omitempty"`
+	Events pq.StringArray `gorm:"type:text[]" json:"events"`
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	DeliveryFailed    DeliveryStatus = "failed"
+)
+
+// WebhookDelivery is an event sent or to be sent to a webhook. Pending
+// deliveries are attempted at NextAttemptAt
+type WebhookDelivery struct {
+	Base
+	WebhookId      string         `gorm:"type:uuid;not null" json:"webhook_id"`
+	EventId        string         `gorm:"type:uuid;not null" json:"event_id"`
+	Event          EventType      `gorm:"not null" json:"event"`
+	Payload        postgres.Jsonb `gorm:"not null" json:"payload"`
+	Status         DeliveryStatus `gorm:"not null" json:"status"`
+	Attempts       int            `json:"attempts"`
+	NextAttemptAt  *time.Time     `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time     `json:"last_attempt_at"`
+	ResponseStatus int            `json:"response_status,omitempty"`
+	Error          string         `json:"error,omitempty"`
+	LockedUntil    *time.Time     `json:"-"`
+}
+
+func (w *Webhook) Validate() error {
+	if IdIsEmpty(w.UserId) {
+		return NewModeError("webhook user_id can not be empty")
+	}
+	w.Url = strings.TrimSpace(w.Url)
+	parsed, err := url.Parse(w.Url)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Hostname() == "" {
+		return NewModeError(fmt.Sprintf("%s is not a valid http url", w.Url))
+	}
+	// host names are checked once more on every delivery, they may resolve elsewhere by then
+	host := strings.TrimSuffix(strings.ToLower(parsed.Hostname()), ".")
+	ip := net.ParseIP(host)
+	if (ip != nil && !IsPublicIP(ip)) || (!AllowPrivateWebhooks && (host == "localhost" || strings.HasSuffix(host, ".localhost"))) {
+		return NewModeError(fmt.Sprintf("%s is not a public address", parsed.Hostname()))
+	}
+	for i, event := range w.Events {
+		event = strings.ToLower(strings.TrimSpace(event))
+		if event != AllEvents && !eventTypes[EventType(event)] {
+			return NewModeError(fmt.Sprintf("unknown event type %s", event))
+		}
+		w.Events[i] = event
+	}
+	return nil
+}
+
+// Accepts tells whether the webhook subscribed to the event type. Webhooks
+// without event types get every event
+func (w *Webhook) Accepts(event EventType) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == AllEvents || EventType(e) == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Webhook) Create(db *gorm.DB) error {
+	if err := w.Validate(); err != nil {
+		return err
+	}
+	if w.Secret == "" {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+		w.Secret = hex.EncodeToString(secret)
+	}
+	if w.Events == nil {
+		w.Events = pq.StringArray{}
+	}
+	return db.Create(w).Error
+}
+
+// Read loads the webhook of the user
+func (w *Webhook) Read(db *gorm.DB) error {
+	if w.EmptyID() {
+		return EmptyIdError
+	}
+	err := db.Where("id = ? AND user_id = ?", w.ID, w.UserId).First(w).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return NewModeError(fmt.Sprintf("webhook with id=%s not present in the db", w.ID))
+	}
+	return err
+}
+
+// Delete removes the webhook of the user together with its deliveries
+func (w *Webhook) Delete(db *gorm.DB) error {
+	if w.EmptyID() {
+		return EmptyIdError
+	}
+	dbState := db.Where("id = ? AND user_id = ?", w.ID, w.UserId).Delete(&Webhook{})
+	if dbState.Error != nil {
+		return dbState.Error
+	}
+	if dbState.RowsAffected == 0 {
+		return NewModeError(fmt.Sprintf("webhook with id=%s not present in the db", w.ID))
+	}
+	return nil
+}
+
+// WebhooksOf lists the webhooks of the user, secrets left out
+func WebhooksOf(userId string, db *gorm.DB) ([]*Webhook, error) {
+	webhooks := make([]*Webhook, 0)
+	if err := db.Where("user_id = ?", userId).Order("created_at").Find(&webhooks).Error; err != nil {
+		return nil, err
+	}
+	for _, w := range webhooks {
+		w.Secret = ""
+	}
+	return webhooks, nil
+}
+
+// EnqueueEvent schedules the delivery of the event to the webhooks of the users
+func EnqueueEvent(event *Event, userIds []string, db *gorm.DB) error {
+	if len(userIds) == 0 {
+		return nil
+	}
+	webhooks := make([]*Webhook, 0)
+	if err := db.Where("user_id IN (?)", userIds).Find(&webhooks).Error; err != nil {
+		return err
+	}
+	var payload []byte
+	now := time.Now()
+	for _, w := range webhooks {
+		if !w.Accepts(event.Type) {
+			continue
+		}
+		if payload == nil {
+			var err error
+			if payload, err = json.Marshal(event); err != nil {
+				return err
+			}
+		}
+		delivery := &WebhookDelivery{
+			WebhookId:     w.ID,
+			EventId:       event.ID,
+			Event:         event.Type,
+			Payload:       postgres.Jsonb{RawMessage: payload},
+			Status:        DeliveryPending,
+			NextAttemptAt: &now,
+		}
+		if err := db.Create(delivery).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeliveryQuery looks up the latest deliveries of a webhook, the ones with Status only when set
+type DeliveryQuery struct {
+	WebhookId string
+	Status    DeliveryStatus
+	Limit     int
+}
+
+func (q *DeliveryQuery) Validate() error {
+	if IdIsEmpty(q.WebhookId) {
+		return NewModeError("webhook_id can not be empty")
+	}
+	switch q.Status {
+	case "", DeliveryPending, DeliverySucceeded, DeliveryFailed:
+	default:
+		return NewModeError(fmt.Sprintf("delivery status should be one of %s, %s, %s",
+			DeliveryPending, DeliverySucceeded, DeliveryFailed))
+	}
+	if q.Limit == 0 {
+		q.Limit = DefaultDeliveryLimit
+	}
+	if q.Limit < 0 || q.Limit > MaxDeliveryLimit {
+		return NewModeError(fmt.Sprintf("limit should be between 1 and %d", MaxDeliveryLimit))
+	}
+	return nil
+}
+
+// Run returns the deliveries, latest first
+func (q *DeliveryQuery) Run(db *gorm.DB) ([]*WebhookDelivery, error) {
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	deliveries := make([]*WebhookDelivery, 0, q.Limit)
+	query := db.Where("webhook_id = ?", q.WebhookId)
+	if q.Status != "" {
+		query = query.Where("status = ?", q.Status)
+	}
+	err := query.Order("created_at DESC").Limit(q.Limit).Find(&deliveries).Error
+	return deliveries, err
+}
+
+// ClaimDueDeliveries locks up to limit pending deliveries due at now until lockedUntil
+func ClaimDueDeliveries(now, lockedUntil time.Time, limit int, db *gorm.DB) ([]*WebhookDelivery, error) {
+	deliveries := make([]*WebhookDelivery, 0)
+	dbState := db.Raw(`UPDATE webhook_deliveries SET locked_until = ?
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = ? AND next_attempt_at <= ? AND (locked_until IS NULL OR locked_until <= ?)
+			ORDER BY next_attempt_at
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED)
+		RETURNING *`, lockedUntil, DeliveryPending, now, now, limit).Scan(&deliveries)
+	return deliveries, dbState.Error
+}
+
+// Attempted records an attempt to deliver made at now. Failed deliveries are
+// attempted again at retryAt, a nil retryAt gives the delivery up
+func (d *WebhookDelivery) Attempted(now time.Time, responseStatus int, failure error, retryAt *time.Time, db *gorm.DB) error {
+	d.Attempts++
+	d.LastAttemptAt = &now
+	d.ResponseStatus = responseStatus
+	d.LockedUntil = nil
+	d.Error = ""
+	switch {
+	case failure == nil:
+		d.Status, d.NextAttemptAt = DeliverySucceeded, nil
+	case retryAt == nil:
+		d.Status, d.NextAttemptAt, d.Error = DeliveryFailed, nil, failure.Error()
+	default:
+		d.NextAttemptAt, d.Error = retryAt, failure.Error()
+	}
+	return db.Model(d).Updates(map[string]interface{}{
+		"attempts":        d.Attempts,
+		"last_attempt_at": d.LastAttemptAt,
+		"response_status": d.ResponseStatus,
+		"status":          d.Status,
+		"next_attempt_at": d.NextAttemptAt,
+		"error":           d.Error,
+		"locked_until":    nil,
+	}).Error
+}
@@ -0,0 +1,134 @@
+package models
+
+import (
+	"errors"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestWebhook_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		webhook Webhook
+		wantErr bool
+	}{
+		{name: "every event", webhook: Webhook{UserId: KnownUserId, Url: "https://example.com/hook"}},
+		{name: "some events", webhook: Webhook{UserId: KnownUserId, Url: "http://example.com/hook", Events: pq.StringArray{"appointment.created", " Calendar.Deleted "}}},
+		{name: "wildcard", webhook: Webhook{UserId: KnownUserId, Url: "https://example.com/hook", Events: pq.StringArray{"*"}}},
+		{name: "no user", webhook: Webhook{Url: "https://example.com/hook"}, wantErr: true},
+		{name: "no url", webhook: Webhook{UserId: KnownUserId}, wantErr: true},
+		{name: "not http", webhook: Webhook{UserId: KnownUserId, Url: "ftp://example.com/hook"}, wantErr: true},
+		{name: "unknown event", webhook: Webhook{UserId: KnownUserId, Url: "https://example.com/hook", Events: pq.StringArray{"appointment.moved"}}, wantErr: true},
+		{name: "link local", webhook: Webhook{UserId: KnownUserId, Url: "http://169.254.169.254/latest/meta-data"}, wantErr: true},
+		{name: "loopback", webhook: Webhook{UserId: KnownUserId, Url: "http://[::1]:8080/hook"}, wantErr: true},
+		{name: "private", webhook: Webhook{UserId: KnownUserId, Url: "https://192.168.1.10/hook"}, wantErr: true},
+		{name: "localhost", webhook: Webhook{UserId: KnownUserId, Url: "http://LocalHost./hook"}, wantErr: true},
+		{name: "public address", webhook: Webhook{UserId: KnownUserId, Url: "https://93.184.216.34/hook"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.webhook.Validate()
+			if tt.wantErr {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func TestWebhook_Accepts(t *testing.T) {
+	all := Webhook{}
+	assert.True(t, all.Accepts(EventCalendarCreated))
+
+	some := Webhook{Events: pq.StringArray{"appointment.created", "appointment.deleted"}}
+	assert.True(t, some.Accepts(EventAppointmentDeleted))
+	assert.False(t, some.Accepts(EventAppointmentUpdated))
+
+	wildcard := Webhook{Events: pq.StringArray{"*"}}
+	assert.True(t, wildcard.Accepts(EventUserUpdated))
+}
+
+func TestEnqueueEvent(t *testing.T) {
+	err := MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer DropAllData(db)
+
+	subscribed := &Webhook{UserId: KnownUserId, Url: "https://example.com/all"}
+	filtered := &Webhook{UserId: KnownUserId, Url: "https://example.com/calendars", Events: pq.StringArray{"calendar.created"}}
+	other := &Webhook{UserId: SecondKnownUserId, Url: "https://example.com/other"}
+	for _, w := range []*Webhook{subscribed, filtered, other} {
+		if err := w.Create(db); err != nil {
+			t.Fatal("unable to create webhook", err)
+		}
+		assert.Len(t, w.Secret, 64)
+	}
+
+	event := &Event{ID: "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11", Type: EventAppointmentCreated, OccurredAt: time.Now(), Data: map[string]string{"id": AppointmentFixedTimeId}}
+	assert.Nil(t, EnqueueEvent(event, []string{KnownUserId}, db))
+
+	query := DeliveryQuery{WebhookId: subscribed.ID}
+	deliveries, err := query.Run(db)
+	assert.Nil(t, err)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, DeliveryPending, deliveries[0].Status)
+	assert.Equal(t, EventAppointmentCreated, deliveries[0].Event)
+
+	for _, w := range []*Webhook{filtered, other} {
+		query := DeliveryQuery{WebhookId: w.ID}
+		deliveries, err := query.Run(db)
+		assert.Nil(t, err)
+		assert.Len(t, deliveries, 0)
+	}
+}
+
+func TestClaimDueDeliveries(t *testing.T) {
+	err := MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer DropAllData(db)
+
+	webhook := &Webhook{UserId: KnownUserId, Url: "https://example.com/hook"}
+	if err := webhook.Create(db); err != nil {
+		t.Fatal("unable to create webhook", err)
+	}
+	event := &Event{ID: "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11", Type: EventUserUpdated, OccurredAt: time.Now()}
+	if err := EnqueueEvent(event, []string{KnownUserId}, db); err != nil {
+		t.Fatal("unable to enqueue event", err)
+	}
+
+	now := time.Now()
+	claimed, err := ClaimDueDeliveries(now, now.Add(time.Minute), 10, db)
+	assert.Nil(t, err)
+	assert.Len(t, claimed, 1)
+
+	// a claimed delivery is not claimed again until its lock expires
+	again, err := ClaimDueDeliveries(now, now.Add(time.Minute), 10, db)
+	assert.Nil(t, err)
+	assert.Len(t, again, 0)
+
+	retryAt := now.Add(time.Hour)
+	assert.Nil(t, claimed[0].Attempted(now, 500, errors.New("webhook responded with status 500"), &retryAt, db))
+	again, err = ClaimDueDeliveries(now.Add(2*time.Minute), now.Add(3*time.Minute), 10, db)
+	assert.Nil(t, err)
+	assert.Len(t, again, 0)
+
+	again, err = ClaimDueDeliveries(retryAt, retryAt.Add(time.Minute), 10, db)
+	assert.Nil(t, err)
+	assert.Len(t, again, 1)
+	assert.Equal(t, 1, again[0].Attempts)
+	assert.Equal(t, 500, again[0].ResponseStatus)
+
+	assert.Nil(t, again[0].Attempted(retryAt, 200, nil, nil, db))
+	query := DeliveryQuery{WebhookId: webhook.ID, Status: DeliverySucceeded}
+	deliveries, err := query.Run(db)
+	assert.Nil(t, err)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, 2, deliveries[0].Attempts)
+	assert.Nil(t, deliveries[0].NextAttemptAt)
+}
@@ -0,0 +1,42 @@
+package services
+
+import (
+	"calendar_service/src/datasources/postgres/calendardb"
+	"calendar_service/src/models"
+)
+
+var (
+	AlarmService AlarmServiceInterface = &alarmService{}
+)
+
+// AlarmServiceInterface manages the alarms of the caller, users
+// set alarms on the appointments they can read
+type AlarmServiceInterface interface {
+	Create(callerId string, alarm models.Alarm) (*models.Alarm, error)
+	List(callerId, apptId string) ([]*models.Alarm, error)
+	Delete(callerId, apptId, alarmId string) (string, error)
+}
+
+type alarmService struct{}
+
+func (s *alarmService) Create(callerId string, alarm models.Alarm) (*models.Alarm, error) {
+	if err := authorizeAppointment(callerId, alarm.AppointmentId, readAccess); err != nil {
+		return nil, err
+	}
+	alarm.UserId = callerId
+	err := alarm.Create(calendardb.DB)
+	return &alarm, err
+}
+
+func (s *alarmService) List(callerId, apptId string) ([]*models.Alarm, error) {
+	if err := authorizeAppointment(callerId, apptId, readAccess); err != nil {
+		return nil, err
+	}
+	return models.AlarmsOf(apptId, callerId, calendardb.DB)
+}
+
+func (s *alarmService) Delete(callerId, apptId, alarmId string) (string, error) {
+	alarm := models.Alarm{Base: models.Base{ID: alarmId}, AppointmentId: apptId, UserId: callerId}
+	err := alarm.Delete(calendardb.DB)
+	return alarm.ID, err
+}
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"calendar_service/src/datasources/postgres/calendardb"
+	"calendar_service/src/models"
+)
+
+var (
+	AppPasswordService AppPasswordServiceInterface = &appPasswordService{}
+)
+
+// AppPasswordServiceInterface manages the app passwords of the caller,
+// which sign in over basic auth where bearer tokens can not be sent
+type AppPasswordServiceInterface interface {
+	Create(callerId string, appPassword models.AppPassword) (*models.AppPassword, error)
+	List(callerId string) ([]*models.AppPassword, error)
+	Delete(callerId, appPasswordId string) (string, error)
+	Authenticate(username, password string) (string, error)
+}
+
+type appPasswordService struct{}
+
+func (s *appPasswordService) Create(callerId string, appPassword models.AppPassword) (*models.AppPassword, error) {
+	appPassword.UserId = callerId
+	err := appPassword.Create(calendardb.DB)
+	return &appPassword, err
+}
+
+func (s *appPasswordService) List(callerId string) ([]*models.AppPassword, error) {
+	return models.AppPasswordsOf(callerId, calendardb.DB)
+}
+
+func (s *appPasswordService) Delete(callerId, appPasswordId string) (string, error) {
+	appPassword := models.AppPassword{Base: models.Base{ID: appPasswordId}, UserId: callerId}
+	err := appPassword.Delete(calendardb.DB)
+	return appPassword.ID, err
+}
+
+func (s *appPasswordService) Authenticate(username, password string) (string, error) {
+	return models.AuthenticateAppPassword(username, password, calendardb.DB)
+}
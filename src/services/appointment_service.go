@@ -3,6 +3,7 @@ package services
 import (
 	"calendar_service/src/datasources/postgres/calendardb"
 	"calendar_service/src/models"
+	"time"
 )
 
 var (
@@ -10,44 +11,199 @@ var (
 )
 
 type AppointmentServiceInterface interface {
-	Create(appt models.Appointment) (*models.Appointment, error)
-	Read(apptId string) (*models.Appointment, error)
-	Update(appt models.Appointment) (*models.Appointment, error)
-	Delete(apptId string) (string, error)
-	AddAttendees(appt models.Appointment, userIds []string) (*models.Appointment, error)
-	RemoveAttendees(appt models.Appointment, userIds []string) (*models.Appointment, error)
+	Create(callerId string, appt models.Appointment) (*models.Appointment, error)
+	Read(callerId, apptId string) (*models.Appointment, error)
+	Update(callerId string, appt models.Appointment) (*models.Appointment, error)
+	Replace(callerId string, appt models.Appointment) (*models.Appointment, error)
+	Delete(callerId, apptId string, version int64) (string, error)
+	AddAttendees(callerId string, appt models.Appointment, userIds []string, externals []*models.ExternalAttendee, role models.AttendeeRole) (*models.Appointment, error)
+	RemoveAttendees(callerId string, appt models.Appointment, userIds []string, emails []string) (*models.Appointment, error)
+	Occurrences(callerId, apptId string, from, to time.Time) ([]*models.Occurrence, error)
+	UpdateOccurrence(callerId, apptId string, recurrenceId time.Time, changes models.OccurrenceChanges, scope models.OccurrenceScope, version int64) (*models.Appointment, error)
+	CancelOccurrence(callerId, apptId string, recurrenceId time.Time, scope models.OccurrenceScope, version int64) (string, error)
+	Search(callerId string, query models.SearchQuery) (*models.SearchResults, error)
+	Respond(callerId, apptId string, rsvp models.Rsvp, version int64) (*models.Appointment, error)
 }
 
 type appointmentService struct{}
 
-func (a *appointmentService) Create(appt models.Appointment) (*models.Appointment, error) {
+func (a *appointmentService) Create(callerId string, appt models.Appointment) (*models.Appointment, error) {
+	if err := authorizeCalendar(callerId, appt.CalendarId, writeAccess); err != nil {
+		return nil, err
+	}
 	err := appt.Create(calendardb.DB)
 	return &appt, err
 }
 
-func (a *appointmentService) Read(apptId string) (*models.Appointment, error) {
+func (a *appointmentService) Read(callerId, apptId string) (*models.Appointment, error) {
+	if err := authorizeAppointment(callerId, apptId, readAccess); err != nil {
+		return nil, err
+	}
 	appt := models.Appointment{Base: models.Base{ID: apptId}}
 	err := appt.Read(calendardb.DB)
 	return &appt, err
 }
 
-func (a *appointmentService) Update(appt models.Appointment) (*models.Appointment, error) {
-	err := appt.Update(calendardb.DB)
-	return &appt, err
+func (a *appointmentService) Update(callerId string, appt models.Appointment) (*models.Appointment, error) {
+	if err := authorizeMove(callerId, appt); err != nil {
+		return nil, err
+	}
+	appt.Exceptions = nil // exceptions are managed through the occurrence api
+	appt.ExternalAttendees = nil
+	if err := appt.Update(calendardb.DB); err != nil {
+		return nil, err
+	}
+	if err := models.RescheduleAlarms(appt.ID, calendardb.DB); err != nil {
+		return &appt, err
+	}
+	return storedAppointment(&appt)
 }
 
-func (a *appointmentService) Delete(apptId string) (string, error) {
-	appt := models.Appointment{Base: models.Base{ID: apptId}}
+func (a *appointmentService) Replace(callerId string, appt models.Appointment) (*models.Appointment, error) {
+	if err := authorizeMove(callerId, appt); err != nil {
+		return nil, err
+	}
+	if err := appt.Replace(calendardb.DB); err != nil {
+		return nil, err
+	}
+	if err := models.RescheduleAlarms(appt.ID, calendardb.DB); err != nil {
+		return &appt, err
+	}
+	return storedAppointment(&appt)
+}
+
+// storedAppointment reads the appointment back as it was written, along with the conflicts found writing it
+func storedAppointment(appt *models.Appointment) (*models.Appointment, error) {
+	result := &models.Appointment{Base: models.Base{ID: appt.ID}}
+	if err := result.Read(calendardb.DB); err != nil {
+		return appt, err
+	}
+	result.Conflicts = appt.Conflicts
+	return result, nil
+}
+
+// Delete removes the appointment, provided it is at the version given unless the version is 0
+func (a *appointmentService) Delete(callerId, apptId string, version int64) (string, error) {
+	if err := authorizeAppointment(callerId, apptId, writeAccess); err != nil {
+		return "", err
+	}
+	appt := models.Appointment{Base: models.Base{ID: apptId}, Version: version}
 	err := appt.Delete(calendardb.DB)
 	return appt.ID, err
 }
 
-func (a *appointmentService) AddAttendees(appt models.Appointment, userIds []string) (*models.Appointment, error) {
-	err := appt.AddAttendees(userIds, calendardb.DB)
+// AddAttendees invites registered users by id and anyone else by email
+func (a *appointmentService) AddAttendees(callerId string, appt models.Appointment, userIds []string, externals []*models.ExternalAttendee, role models.AttendeeRole) (*models.Appointment, error) {
+	if err := authorizeAppointment(callerId, appt.ID, writeAccess); err != nil {
+		return nil, err
+	}
+	if len(userIds) > 0 {
+		if err := appt.AddAttendees(userIds, role, calendardb.DB); err != nil {
+			return nil, err
+		}
+	}
+	if err := appt.AddExternalAttendees(externals, role, calendardb.DB); err != nil {
+		return nil, err
+	}
+	err := appt.Read(calendardb.DB)
 	return &appt, err
 }
 
-func (a *appointmentService) RemoveAttendees(appt models.Appointment, userIds []string) (*models.Appointment, error) {
-	err := appt.RemoveAttendees(userIds, calendardb.DB)
+// RemoveAttendees takes users off the appointment by id and external attendees by email
+func (a *appointmentService) RemoveAttendees(callerId string, appt models.Appointment, userIds []string, emails []string) (*models.Appointment, error) {
+	if err := authorizeAppointment(callerId, appt.ID, writeAccess); err != nil {
+		return nil, err
+	}
+	if len(userIds) > 0 {
+		if err := appt.RemoveAttendees(userIds, calendardb.DB); err != nil {
+			return nil, err
+		}
+	}
+	if err := appt.RemoveExternalAttendees(emails, calendardb.DB); err != nil {
+		return nil, err
+	}
+	err := appt.Read(calendardb.DB)
 	return &appt, err
 }
+
+func (a *appointmentService) Occurrences(callerId, apptId string, from, to time.Time) ([]*models.Occurrence, error) {
+	if err := authorizeAppointment(callerId, apptId, readAccess); err != nil {
+		return nil, err
+	}
+	appt := models.Appointment{Base: models.Base{ID: apptId}}
+	if err := appt.Read(calendardb.DB); err != nil {
+		return nil, err
+	}
+	return appt.Occurrences(from, to)
+}
+
+// UpdateOccurrence edits an occurrence, provided the series is at the version given unless the version is 0
+func (a *appointmentService) UpdateOccurrence(callerId, apptId string, recurrenceId time.Time, changes models.OccurrenceChanges, scope models.OccurrenceScope, version int64) (*models.Appointment, error) {
+	if err := authorizeAppointment(callerId, apptId, writeAccess); err != nil {
+		return nil, err
+	}
+	appt := models.Appointment{Base: models.Base{ID: apptId}}
+	if err := appt.Read(calendardb.DB); err != nil {
+		return nil, err
+	}
+	appt.Version = version
+	result, err := appt.UpdateOccurrence(recurrenceId, changes, scope, calendardb.DB)
+	if err != nil {
+		return nil, err
+	}
+	err = models.RescheduleAlarms(apptId, calendardb.DB)
+	return result, err
+}
+
+// CancelOccurrence removes an occurrence, provided the series is at the version given unless the version is 0
+func (a *appointmentService) CancelOccurrence(callerId, apptId string, recurrenceId time.Time, scope models.OccurrenceScope, version int64) (string, error) {
+	if err := authorizeAppointment(callerId, apptId, writeAccess); err != nil {
+		return "", err
+	}
+	appt := models.Appointment{Base: models.Base{ID: apptId}}
+	if err := appt.Read(calendardb.DB); err != nil {
+		return "", err
+	}
+	appt.Version = version
+	if err := appt.CancelOccurrence(recurrenceId, scope, calendardb.DB); err != nil {
+		return "", err
+	}
+	err := models.RescheduleAlarms(apptId, calendardb.DB)
+	return appt.ID, err
+}
+
+func (a *appointmentService) Search(callerId string, query models.SearchQuery) (*models.SearchResults, error) {
+	var err error
+	if query.CalendarId != "" {
+		err = authorizeCalendar(callerId, query.CalendarId, readAccess)
+	} else {
+		err = authorizeUser(callerId, query.UserId)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return query.Run(calendardb.DB)
+}
+
+// Respond records the answer of the caller to the invitation to the appointment,
+// provided the appointment is at the version given unless the version is 0
+func (a *appointmentService) Respond(callerId, apptId string, rsvp models.Rsvp, version int64) (*models.Appointment, error) {
+	if err := authorizeAppointment(callerId, apptId, readAccess); err != nil {
+		return nil, err
+	}
+	appt := models.Appointment{Base: models.Base{ID: apptId}, Version: version}
+	err := appt.Respond(callerId, rsvp, calendardb.DB)
+	return &appt, err
+}
+
+// authorizeMove checks the caller manages the appointment and, when the
+// appointment is moved to another calendar, the target calendar as well
+func authorizeMove(callerId string, appt models.Appointment) error {
+	if err := authorizeAppointment(callerId, appt.ID, writeAccess); err != nil {
+		return err
+	}
+	if appt.CalendarId == "" {
+		return nil
+	}
+	return authorizeCalendar(callerId, appt.CalendarId, writeAccess)
+}
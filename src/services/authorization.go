@@ -0,0 +1,113 @@
+package services
+
+import (
+	"calendar_service/src/datasources/postgres/calendardb"
+	"calendar_service/src/models"
+	"errors"
+	"fmt"
+	"github.com/jinzhu/gorm"
+)
+
+// ForbiddenError is returned when the caller is not allowed to access an existing resource
+var ForbiddenError = errors.New("forbidden")
+
+// access is what the caller may do with a calendar, each access includes the lower ones
+type access int
+
+const (
+	noAccess access = iota
+	freeBusyAccess
+	readAccess
+	writeAccess
+	manageAccess
+	ownerAccess
+)
+
+var shareAccess = map[models.ShareLevel]access{
+	models.ShareFreeBusy: freeBusyAccess,
+	models.ShareRead:     readAccess,
+	models.ShareWrite:    writeAccess,
+	models.ShareManage:   manageAccess,
+}
+
+func forbidden(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ForbiddenError, fmt.Sprintf(format, args...))
+}
+
+// authorizeUser lets users manage themselves only
+func authorizeUser(callerId, userId string) error {
+	if callerId == userId {
+		return nil
+	}
+	var count int
+	if err := calendardb.DB.Model(&models.User{}).Where("id = ?", userId).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return models.NewModeError(fmt.Sprintf("user with id=%s not present in the db", userId))
+	}
+	return forbidden("user %s can not access user %s", callerId, userId)
+}
+
+func calendarOwner(calendarId string) (string, error) {
+	cal := models.Calendar{}
+	err := calendardb.DB.Select("user_id").Where("id = ?", calendarId).First(&cal).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return "", models.NewModeError(fmt.Sprintf("calendar with id=%s not present in the db", calendarId))
+	}
+	return cal.UserId, err
+}
+
+// calendarAccess returns the access the caller has to the calendar, the owner
+// has full access and the users the calendar is shared with the one of their share
+func calendarAccess(callerId, calendarId string) (access, error) {
+	ownerId, err := calendarOwner(calendarId)
+	if err != nil {
+		return noAccess, err
+	}
+	if ownerId == callerId {
+		return ownerAccess, nil
+	}
+	level, err := models.ShareLevelOf(calendarId, callerId, calendardb.DB)
+	return shareAccess[level], err
+}
+
+// authorizeCalendar checks the caller has at least the required access to the calendar
+func authorizeCalendar(callerId, calendarId string, required access) error {
+	granted, err := calendarAccess(callerId, calendarId)
+	if err != nil {
+		return err
+	}
+	if granted < required {
+		return forbidden("user %s has no sufficient access to calendar %s", callerId, calendarId)
+	}
+	return nil
+}
+
+// authorizeAppointment checks the caller has at least the required access
+// to the calendar of the appointment. Attendees may read it as well
+func authorizeAppointment(callerId, apptId string, required access) error {
+	appt := models.Appointment{}
+	err := calendardb.DB.Select("calendar_id").Where("id = ?", apptId).First(&appt).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return models.NewModeError(fmt.Sprintf("appointment with id=%s not present in the db", apptId))
+	}
+	if err != nil {
+		return err
+	}
+	err = authorizeCalendar(callerId, appt.CalendarId, required)
+	if required > readAccess || !errors.Is(err, ForbiddenError) {
+		return err
+	}
+	var count int
+	dbState := calendardb.DB.Table("users_appointments").
+		Where("appointment_id = ? AND user_id = ?", apptId, callerId).
+		Count(&count)
+	if dbState.Error != nil {
+		return dbState.Error
+	}
+	if count == 0 {
+		return forbidden("user %s neither has access to nor attends appointment %s", callerId, apptId)
+	}
+	return nil
+}
@@ -2,7 +2,11 @@ package services
 
 import (
 	"calendar_service/src/datasources/postgres/calendardb"
+	"calendar_service/src/ical"
 	"calendar_service/src/models"
+	"fmt"
+	"strings"
+	"time"
 )
 
 var (
@@ -10,19 +14,35 @@ var (
 )
 
 type CalendarServiceInterface interface {
-	Create(cal models.Calendar) (*models.Calendar, error)
-	Read(calendarId string) (*models.Calendar, error)
-	Update(cal models.Calendar) (*models.Calendar, error)
-	Delete(calendarId string) (string, error)
+	Create(callerId string, cal models.Calendar) (*models.Calendar, error)
+	Read(callerId, calendarId string) (*models.Calendar, error)
+	Update(callerId string, cal models.Calendar) (*models.Calendar, error)
+	Delete(callerId, calendarId string, version int64) (string, error)
+	ReadDetailed(callerId, calendarId string) (*models.Calendar, error)
+	Export(callerId, calendarId string) (*ical.Calendar, error)
+	Import(callerId, calendarId string, data *ical.Calendar) (*models.ImportReport, error)
+	Appointments(callerId, calendarId string, from, to time.Time, page models.PageRequest) (*models.OccurrencePage, error)
+	Sync(callerId string, sync models.CalendarSync) (*models.SyncResult, error)
+	List(callerId, userId string, filter CalendarFilter, page models.PageRequest) (*models.CalendarPage, error)
+	Share(callerId string, share models.CalendarShare) (*models.CalendarShare, error)
+	Unshare(callerId, calendarId, userId string) error
+}
+
+// CalendarFilter narrows a calendar listing. Name matches the start of the calendar name
+type CalendarFilter struct {
+	Name string
 }
 
 type calendarService struct{}
 
-func (c *calendarService) Create(cal models.Calendar) (*models.Calendar, error) {
+func (c *calendarService) Create(callerId string, cal models.Calendar) (*models.Calendar, error) {
 	err := cal.Validate()
 	if err != nil {
 		return nil, err
 	}
+	if err := authorizeUser(callerId, cal.UserId); err != nil {
+		return nil, err
+	}
 	err = cal.Create(calendardb.DB)
 	if err != nil {
 		return nil, err
@@ -30,19 +50,176 @@ func (c *calendarService) Create(cal models.Calendar) (*models.Calendar, error)
 	return &cal, nil
 }
 
-func (c *calendarService) Read(calendarId string) (*models.Calendar, error) {
+func (c *calendarService) Read(callerId, calendarId string) (*models.Calendar, error) {
+	if err := authorizeCalendar(callerId, calendarId, readAccess); err != nil {
+		return nil, err
+	}
 	cal := models.Calendar{Base: models.Base{ID: calendarId}}
 	err := cal.Read(calendardb.DB)
 	return &cal, err
 }
 
-func (c *calendarService) Update(cal models.Calendar) (*models.Calendar, error) {
-	err := cal.Update(calendardb.DB)
-	return &cal, err
+// Update lets the owner hand the calendar over to another user by changing its user_id
+func (c *calendarService) Update(callerId string, cal models.Calendar) (*models.Calendar, error) {
+	if err := authorizeCalendar(callerId, cal.ID, manageAccess); err != nil {
+		return nil, err
+	}
+	ownerId, err := calendarOwner(cal.ID)
+	if err != nil {
+		return nil, err
+	}
+	if cal.UserId != ownerId && callerId != ownerId {
+		return nil, forbidden("only the owner can hand calendar %s over", cal.ID)
+	}
+	if err := cal.Update(calendardb.DB); err != nil {
+		return &cal, err
+	}
+	// the response is the stored calendar rather than the fields given
+	if err := cal.Read(calendardb.DB); err != nil {
+		return &cal, err
+	}
+	return &cal, nil
 }
 
-func (c *calendarService) Delete(calendarId string) (string, error) {
-	cal := models.Calendar{Base: models.Base{ID: calendarId}}
+// Delete removes the calendar, provided it is at the version given unless the version is 0
+func (c *calendarService) Delete(callerId, calendarId string, version int64) (string, error) {
+	if err := authorizeCalendar(callerId, calendarId, ownerAccess); err != nil {
+		return "", err
+	}
+	cal := models.Calendar{Base: models.Base{ID: calendarId}, Version: version}
 	err := cal.Delete(calendardb.DB)
 	return cal.ID, err
 }
+
+func (c *calendarService) ReadDetailed(callerId, calendarId string) (*models.Calendar, error) {
+	if err := authorizeCalendar(callerId, calendarId, readAccess); err != nil {
+		return nil, err
+	}
+	cal := models.Calendar{Base: models.Base{ID: calendarId}}
+	err := cal.ReadDetailed(calendardb.DB)
+	return &cal, err
+}
+
+func (c *calendarService) Export(callerId, calendarId string) (*ical.Calendar, error) {
+	cal, err := c.ReadDetailed(callerId, calendarId)
+	if err != nil {
+		return nil, err
+	}
+	return ical.FromCalendar(cal), nil
+}
+
+func (c *calendarService) Import(callerId, calendarId string, data *ical.Calendar) (*models.ImportReport, error) {
+	if err := authorizeCalendar(callerId, calendarId, writeAccess); err != nil {
+		return nil, err
+	}
+	cal := models.Calendar{Base: models.Base{ID: calendarId}}
+	if err := cal.Read(calendardb.DB); err != nil {
+		return nil, err
+	}
+
+	report := &models.ImportReport{Items: make([]*models.ImportItem, 0, len(data.Events))}
+	for _, imported := range ical.ToAppointments(data) {
+		if imported.Err != nil {
+			report.Add(&models.ImportItem{
+				Uid:    imported.Uid,
+				Status: models.ImportFailed,
+				Error:  imported.Err.Error(),
+			})
+			continue
+		}
+		appt := imported.Appointment
+		appt.CalendarId = cal.ID
+		report.Add(appt.Import(imported.Uid, imported.AttendeeEmails, calendardb.DB))
+	}
+	return report, nil
+}
+
+// Appointments lists the occurrences within [from, to). Users the calendar is
+// shared with at the free/busy level only learn when the occurrences take place
+func (c *calendarService) Appointments(callerId, calendarId string, from, to time.Time, page models.PageRequest) (*models.OccurrencePage, error) {
+	granted, err := calendarAccess(callerId, calendarId)
+	if err != nil {
+		return nil, err
+	}
+	if granted < freeBusyAccess {
+		return nil, forbidden("user %s has no access to calendar %s", callerId, calendarId)
+	}
+	cal := models.Calendar{Base: models.Base{ID: calendarId}}
+	result, err := cal.Occurrences(from, to, page, calendardb.DB)
+	if err != nil {
+		return nil, err
+	}
+	if granted == freeBusyAccess {
+		result.HideDetails()
+	}
+	return result, nil
+}
+
+// Sync returns the appointments of the calendar changed since the sync token to callers who can read it
+func (c *calendarService) Sync(callerId string, sync models.CalendarSync) (*models.SyncResult, error) {
+	if err := authorizeCalendar(callerId, sync.CalendarId, readAccess); err != nil {
+		return nil, err
+	}
+	return sync.Run(calendardb.DB)
+}
+
+// List pages through the calendars of a user, sorted by name
+// unless page.Sort is created_at
+func (c *calendarService) List(callerId, userId string, filter CalendarFilter, page models.PageRequest) (*models.CalendarPage, error) {
+	if err := page.Validate(); err != nil {
+		return nil, err
+	}
+	if err := authorizeUser(callerId, userId); err != nil {
+		return nil, err
+	}
+	if page.Sort == "" {
+		page.Sort = "name"
+	}
+	query, err := paginate(calendardb.DB.Where("user_id = ?", userId), page, "name", createdAtSort)
+	if err != nil {
+		return nil, err
+	}
+	dbState := calendardb.DB.Find(&models.User{}, "id = ?", userId)
+	if dbState.Error != nil {
+		return nil, dbState.Error
+	}
+	if dbState.RowsAffected == 0 {
+		return nil, models.NewModeError(fmt.Sprintf("user with id=%s not present in the db", userId))
+	}
+	if name := strings.TrimSpace(filter.Name); name != "" {
+		query = query.Where("name ILIKE ?", likePrefix(name))
+	}
+	cals := make([]*models.Calendar, 0, page.Limit+1)
+	if err := query.Find(&cals).Error; err != nil {
+		return nil, err
+	}
+
+	result := &models.CalendarPage{Calendars: cals}
+	if len(cals) > page.Limit {
+		result.Calendars = cals[:page.Limit]
+		last := result.Calendars[page.Limit-1]
+		key := last.Name
+		if page.Sort == createdAtSort {
+			key = timeSortKey(last.CreatedAt)
+		}
+		result.NextCursor = pageCursor(page, key, last.ID)
+	}
+	return result, nil
+}
+
+// Share grants the user access to the calendar or changes the level of an existing share
+func (c *calendarService) Share(callerId string, share models.CalendarShare) (*models.CalendarShare, error) {
+	if err := authorizeCalendar(callerId, share.CalendarId, manageAccess); err != nil {
+		return nil, err
+	}
+	err := share.Save(calendardb.DB)
+	return &share, err
+}
+
+func (c *calendarService) Unshare(callerId, calendarId, userId string) error {
+	if err := authorizeCalendar(callerId, calendarId, manageAccess); err != nil {
+		return err
+	}
+	share := models.CalendarShare{CalendarId: calendarId, UserId: userId}
+	return share.Delete(calendardb.DB)
+}
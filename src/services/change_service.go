@@ -0,0 +1,22 @@
+package services
+
+import (
+	"calendar_service/src/datasources/postgres/calendardb"
+	"calendar_service/src/models"
+)
+
+var (
+	ChangeService ChangeServiceInterface = &changeService{}
+)
+
+type ChangeServiceInterface interface {
+	Feed(callerId string, feed models.ChangeFeed) (*models.ChangePage, error)
+}
+
+type changeService struct{}
+
+// Feed lists the changes of the users, calendars and appointments the caller could read
+func (s *changeService) Feed(callerId string, feed models.ChangeFeed) (*models.ChangePage, error) {
+	feed.UserId = callerId
+	return feed.Run(calendardb.DB)
+}
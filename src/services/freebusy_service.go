@@ -0,0 +1,29 @@
+package services
+
+import (
+	"calendar_service/src/datasources/postgres/calendardb"
+	"calendar_service/src/models"
+)
+
+var (
+	FreeBusyService FreeBusyServiceInterface = &freeBusyService{}
+)
+
+type FreeBusyServiceInterface interface {
+	Query(callerId string, query models.FreeBusyQuery) (*models.FreeBusy, error)
+	Slots(callerId string, query models.SlotQuery) (*models.Slots, error)
+}
+
+type freeBusyService struct{}
+
+// Query reads the busy time of the users within the calendars the caller
+// can see at the free/busy level at least
+func (f *freeBusyService) Query(callerId string, query models.FreeBusyQuery) (*models.FreeBusy, error) {
+	query.ViewerId = callerId
+	return query.Run(calendardb.DB)
+}
+
+func (f *freeBusyService) Slots(callerId string, query models.SlotQuery) (*models.Slots, error) {
+	query.ViewerId = callerId
+	return query.Run(calendardb.DB)
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"calendar_service/src/models"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"strings"
+	"time"
+)
+
+const createdAtSort = "created_at"
+
+// paginate orders query by page.Sort, one of the columns, and the id and starts
+// it after the cursor. One record more than the limit is selected so that the
+// caller can tell whether there is a next page
+func paginate(query *gorm.DB, page models.PageRequest, columns ...string) (*gorm.DB, error) {
+	if !containsString(columns, page.Sort) {
+		return nil, models.NewModeError(fmt.Sprintf("unknown sort field %s", page.Sort))
+	}
+	direction, comparison := "ASC", ">"
+	if page.Order == models.SortDesc {
+		direction, comparison = "DESC", "<"
+	}
+	if page.Cursor != "" {
+		after, err := models.DecodeCursor(page.Cursor, 3)
+		if err != nil {
+			return nil, err
+		}
+		if after[0] != page.Sort {
+			return nil, models.InvalidCursorError
+		}
+		var value interface{} = after[1]
+		if page.Sort == createdAtSort {
+			if value, err = time.Parse(time.RFC3339Nano, after[1]); err != nil {
+				return nil, models.InvalidCursorError
+			}
+		}
+		query = query.Where(fmt.Sprintf("(%s, id) %s (?, ?)", page.Sort, comparison), value, after[2])
+	}
+	return query.Order(fmt.Sprintf("%s %s, id %s", page.Sort, direction, direction)).Limit(page.Limit + 1), nil
+}
+
+// pageCursor points after the record with the given sort key and id
+func pageCursor(page models.PageRequest, key, id string) string {
+	return models.EncodeCursor(page.Sort, key, id)
+}
+
+func timeSortKey(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// likePrefix escapes s to be matched as a prefix by LIKE and ILIKE
+func likePrefix(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s) + "%"
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
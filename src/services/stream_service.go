@@ -0,0 +1,124 @@
+package services
+
+import (
+	"calendar_service/src/datasources/postgres/calendardb"
+	"calendar_service/src/live"
+	"calendar_service/src/models"
+	"errors"
+)
+
+// MaxReplayedChanges is the number of missed changes sent on subscription at most
+const MaxReplayedChanges = models.MaxChangeLimit
+
+var (
+	StreamService StreamServiceInterface = &streamService{}
+
+	// ResyncError is returned when more than MaxReplayedChanges were missed,
+	// the client reads its data anew and subscribes without a cursor
+	ResyncError = errors.New("too many changes missed, resync")
+)
+
+// StreamServiceInterface subscribes callers to the changes made as they happen
+type StreamServiceInterface interface {
+	Calendar(callerId, calendarId, lastEventId string) (*live.Subscription, []*models.Change, error)
+	Agenda(callerId, userId, lastEventId string) (*live.Subscription, []*models.Change, error)
+}
+
+type streamService struct{}
+
+// Calendar subscribes the caller to the changes of the calendar and of its appointments.
+// The changes made after lastEventId, when it is set, are returned to be sent first.
+// Access is checked on subscription, the subscription ends with the changes of the
+// calendar which may change it so that the caller subscribes anew
+func (s *streamService) Calendar(callerId, calendarId, lastEventId string) (*live.Subscription, []*models.Change, error) {
+	if err := authorizeCalendar(callerId, calendarId, readAccess); err != nil {
+		return nil, nil, err
+	}
+	ofCalendar := func(change *models.Change) bool {
+		for _, id := range change.CalendarIds {
+			if id == calendarId {
+				return true
+			}
+		}
+		return false
+	}
+	changesAccess := func(change *models.Change) bool {
+		if change.Entity != models.EntityCalendar || change.EntityId != calendarId {
+			return false
+		}
+		switch change.Event {
+		case models.EventSharesChanged, models.EventCalendarUpdated, models.EventCalendarDeleted:
+			return true
+		}
+		return false
+	}
+	subscription := live.Changes.SubscribeUntil(ofCalendar, changesAccess)
+	if lastEventId == "" {
+		return subscription, nil, nil
+	}
+	missed, err := replay(models.ChangeFeed{CalendarId: calendarId, Since: lastEventId})
+	if err != nil {
+		subscription.Close()
+		return nil, nil, err
+	}
+	return subscription, missed, nil
+}
+
+// Agenda subscribes the caller to the changes of the appointments in the agenda of the user,
+// the ones of the calendars the user can read and the ones the user attends. The audience
+// of every change holds the users who could read it when it was made, so that access is
+// checked change by change
+func (s *streamService) Agenda(callerId, userId, lastEventId string) (*live.Subscription, []*models.Change, error) {
+	if err := authorizeUser(callerId, userId); err != nil {
+		return nil, nil, err
+	}
+	inAgenda := func(change *models.Change) bool {
+		if change.Entity != models.EntityAppointment {
+			return false
+		}
+		for _, id := range change.Audience {
+			if id == userId {
+				return true
+			}
+		}
+		return false
+	}
+	subscription := live.Changes.Subscribe(inAgenda)
+	if lastEventId == "" {
+		return subscription, nil, nil
+	}
+	changes, err := replay(models.ChangeFeed{UserId: userId, Since: lastEventId})
+	if err != nil {
+		subscription.Close()
+		return nil, nil, err
+	}
+	missed := make([]*models.Change, 0, len(changes))
+	for _, change := range changes {
+		if inAgenda(change) {
+			missed = append(missed, change)
+		}
+	}
+	return subscription, missed, nil
+}
+
+// replay reads the feed, failing with ResyncError when it holds more than MaxReplayedChanges
+func replay(feed models.ChangeFeed) ([]*models.Change, error) {
+	feed.Limit = MaxReplayedChanges
+	page, err := feed.Run(calendardb.DB)
+	if err != nil {
+		return nil, err
+	}
+	if len(page.Changes) < feed.Limit {
+		return page.Changes, nil
+	}
+	feed.Since = page.NextCursor
+	feed.Limit = 1
+	next, err := feed.Run(calendardb.DB)
+	if err != nil {
+		return nil, err
+	}
+	if len(next.Changes) > 0 {
+		return nil, ResyncError
+	}
+	return page.Changes, nil
+}
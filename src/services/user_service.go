@@ -1,8 +1,11 @@
 package services
 
 import (
+	"calendar_service/src/auth"
 	"calendar_service/src/datasources/postgres/calendardb"
 	"calendar_service/src/models"
+	"strings"
+	"time"
 )
 
 var (
@@ -10,15 +13,29 @@ var (
 )
 
 type UserServiceInterface interface {
-	Create(usr models.User) (*models.User, error)
-	Read(userId string) (*models.User, error)
-	Delete(userId string) (string, error)
-	Update(usr models.User) (*models.User, error)
+	Create(callerId string, usr models.User) (*models.User, error)
+	Read(callerId, userId string) (*models.User, error)
+	Delete(callerId, userId string, version int64) (string, error)
+	Update(callerId string, usr models.User) (*models.User, error)
+	ReadByEmails(emails []string) ([]*models.User, error)
+	Agenda(callerId, userId string, from, to time.Time) (*models.Agenda, error)
+	List(filter UserFilter, page models.PageRequest) (*models.UserPage, error)
+}
+
+// UserFilter narrows a user listing. Email matches ignoring case, Name matches
+// the start of the first name, of the last name or of the full name
+type UserFilter struct {
+	Email string
+	Name  string
 }
 
 type userService struct{}
 
-func (s *userService) Create(usr models.User) (*models.User, error) {
+// Create registers the user, callerId is empty when registration is open and no token was given
+func (s *userService) Create(callerId string, usr models.User) (*models.User, error) {
+	if !auth.Registration.MayRegister(callerId) {
+		return nil, forbidden("only admins can create users")
+	}
 	err := usr.Create(calendardb.DB)
 	if err != nil {
 		return nil, err
@@ -26,14 +43,21 @@ func (s *userService) Create(usr models.User) (*models.User, error) {
 	return &usr, nil
 }
 
-func (s *userService) Read(userId string) (*models.User, error) {
+func (s *userService) Read(callerId, userId string) (*models.User, error) {
+	if err := authorizeUser(callerId, userId); err != nil {
+		return nil, err
+	}
 	usr := models.User{Base: models.Base{ID: userId}}
 	err := usr.Read(calendardb.DB)
 	return &usr, err
 }
 
-func (s *userService) Delete(userId string) (string, error) {
-	usr := models.User{Base: models.Base{ID: userId}}
+// Delete removes the user, provided it is at the version given unless the version is 0
+func (s *userService) Delete(callerId, userId string, version int64) (string, error) {
+	if err := authorizeUser(callerId, userId); err != nil {
+		return "", err
+	}
+	usr := models.User{Base: models.Base{ID: userId}, Version: version}
 	err := usr.Delete(calendardb.DB)
 	if err != nil {
 		return "", err
@@ -41,8 +65,76 @@ func (s *userService) Delete(userId string) (string, error) {
 	return usr.ID, nil
 }
 
-func (s *userService) Update(usr models.User) (*models.User, error) {
+func (s *userService) Update(callerId string, usr models.User) (*models.User, error) {
+	if err := authorizeUser(callerId, usr.ID); err != nil {
+		return nil, err
+	}
 	usr.Appointments = nil // we do not update appointments using this api
-	err := usr.Update(calendardb.DB)
-	return &usr, err
+	if err := usr.Update(calendardb.DB); err != nil {
+		return &usr, err
+	}
+	// the response is the stored user rather than the fields given
+	if err := usr.Read(calendardb.DB); err != nil {
+		return &usr, err
+	}
+	return &usr, nil
+}
+
+// ReadByEmails returns the registered users among emails, unknown emails are ignored
+func (s *userService) ReadByEmails(emails []string) ([]*models.User, error) {
+	usrs, _, err := models.UsersByEmail(emails, calendardb.DB)
+	return usrs, err
+}
+
+func (s *userService) Agenda(callerId, userId string, from, to time.Time) (*models.Agenda, error) {
+	if err := authorizeUser(callerId, userId); err != nil {
+		return nil, err
+	}
+	usr := models.User{Base: models.Base{ID: userId}}
+	return usr.Agenda(from, to, calendardb.DB)
+}
+
+// List pages through the users, sorted by email unless page.Sort is
+// one of first_name, last_name or created_at
+func (s *userService) List(filter UserFilter, page models.PageRequest) (*models.UserPage, error) {
+	if err := page.Validate(); err != nil {
+		return nil, err
+	}
+	if page.Sort == "" {
+		page.Sort = "email"
+	}
+	query := calendardb.DB.Model(&models.User{})
+	if email := strings.TrimSpace(filter.Email); email != "" {
+		query = query.Where("lower(email) = lower(?)", email)
+	}
+	if name := strings.TrimSpace(filter.Name); name != "" {
+		prefix := likePrefix(name)
+		query = query.Where("first_name ILIKE ? OR last_name ILIKE ? OR first_name || ' ' || last_name ILIKE ?",
+			prefix, prefix, prefix)
+	}
+	query, err := paginate(query, page, "email", "first_name", "last_name", createdAtSort)
+	if err != nil {
+		return nil, err
+	}
+	usrs := make([]*models.User, 0, page.Limit+1)
+	if err := query.Find(&usrs).Error; err != nil {
+		return nil, err
+	}
+
+	result := &models.UserPage{Users: usrs}
+	if len(usrs) > page.Limit {
+		result.Users = usrs[:page.Limit]
+		last := result.Users[page.Limit-1]
+		key := last.Email
+		switch page.Sort {
+		case "first_name":
+			key = last.FirstName
+		case "last_name":
+			key = last.LastName
+		case createdAtSort:
+			key = timeSortKey(last.CreatedAt)
+		}
+		result.NextCursor = pageCursor(page, key, last.ID)
+	}
+	return result, nil
 }
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"calendar_service/src/datasources/postgres/calendardb"
+	"calendar_service/src/models"
+)
+
+var (
+	WebhookService WebhookServiceInterface = &webhookService{}
+)
+
+// WebhookServiceInterface manages the webhooks of the caller. A webhook
+// receives the events about the data its user can read
+type WebhookServiceInterface interface {
+	Create(callerId string, webhook models.Webhook) (*models.Webhook, error)
+	List(callerId string) ([]*models.Webhook, error)
+	Delete(callerId, webhookId string) (string, error)
+	Deliveries(callerId string, query models.DeliveryQuery) ([]*models.WebhookDelivery, error)
+}
+
+type webhookService struct{}
+
+func (s *webhookService) Create(callerId string, webhook models.Webhook) (*models.Webhook, error) {
+	webhook.UserId = callerId
+	err := webhook.Create(calendardb.DB)
+	return &webhook, err
+}
+
+func (s *webhookService) List(callerId string) ([]*models.Webhook, error) {
+	return models.WebhooksOf(callerId, calendardb.DB)
+}
+
+func (s *webhookService) Delete(callerId, webhookId string) (string, error) {
+	webhook := models.Webhook{Base: models.Base{ID: webhookId}, UserId: callerId}
+	err := webhook.Delete(calendardb.DB)
+	return webhook.ID, err
+}
+
+func (s *webhookService) Deliveries(callerId string, query models.DeliveryQuery) ([]*models.WebhookDelivery, error) {
+	webhook := models.Webhook{Base: models.Base{ID: query.WebhookId}, UserId: callerId}
+	if err := webhook.Read(calendardb.DB); err != nil {
+		return nil, err
+	}
+	return query.Run(calendardb.DB)
+}
@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"calendar_service/src/datasources/postgres/calendardb"
+	"calendar_service/src/models"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAlarmController(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+
+	var created models.Alarm
+
+	t.Run("success create relative", func(tt *testing.T) {
+		res, err := client.Post(fmt.Sprintf("%s/appointment/%s/alarm", testServer.URL, models.AppointmentRecurringId),
+			"application/json", strings.NewReader(`{"offset_minutes": 15}`))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		err = json.Unmarshal(bodyBytes, &created)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 201, res.StatusCode)
+		assert.Equal(tt, models.KnownUserId, created.UserId)
+		assert.Equal(tt, 15, *created.OffsetMinutes)
+		// every occurrence of the series is over
+		assert.Nil(tt, created.NextFireAt)
+	})
+
+	t.Run("success create absolute as attendee", func(tt *testing.T) {
+		at := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+		res, err := clientAs(models.ThirdKnownUserId).Post(fmt.Sprintf("%s/appointment/%s/alarm", testServer.URL, models.AppointmentWholeDayId),
+			"application/json", strings.NewReader(fmt.Sprintf(`{"at": "%s"}`, at)))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var alarm models.Alarm
+		err = json.Unmarshal(bodyBytes, &alarm)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 201, res.StatusCode)
+		assert.Equal(tt, models.ThirdKnownUserId, alarm.UserId)
+		assert.NotNil(tt, alarm.NextFireAt)
+	})
+
+	t.Run("success list", func(tt *testing.T) {
+		res, err := client.Get(fmt.Sprintf("%s/appointment/%s/alarms", testServer.URL, models.AppointmentRecurringId))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var alarms []*models.Alarm
+		err = json.Unmarshal(bodyBytes, &alarms)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+		assert.Len(tt, alarms, 1)
+		assert.Equal(tt, created.ID, alarms[0].ID)
+	})
+
+	t.Run("fail both offset and time", func(tt *testing.T) {
+		res, err := client.Post(fmt.Sprintf("%s/appointment/%s/alarm", testServer.URL, models.AppointmentRecurringId),
+			"application/json", strings.NewReader(`{"offset_minutes": 15, "at": "2030-01-01T10:00:00Z"}`))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 400, res.StatusCode)
+	})
+
+	t.Run("fail no access to appointment", func(tt *testing.T) {
+		res, err := clientAs(models.SecondKnownUserId).Post(fmt.Sprintf("%s/appointment/%s/alarm", testServer.URL, models.AppointmentRecurringId),
+			"application/json", strings.NewReader(`{"offset_minutes": 15}`))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 403, res.StatusCode)
+	})
+
+	t.Run("success delete", func(tt *testing.T) {
+		req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/appointment/%s/alarm/%s",
+			testServer.URL, models.AppointmentRecurringId, created.ID), nil)
+		if err != nil {
+			tt.Fatal("unable to create request", err)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 202, res.StatusCode)
+
+		res, err = client.Do(req)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 404, res.StatusCode)
+	})
+}
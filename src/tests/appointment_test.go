@@ -137,6 +137,27 @@ func TestAppointmentRead(t *testing.T) {
 		assert.Equal(t, models.AppointmentWholeDayId, resAppt.ID)
 	})
 
+	t.Run("success rendered in requested zone", func(tt *testing.T) {
+		res, err := client.Get(fmt.Sprintf("%s/appointment/%s?tz=Asia/Tokyo", testServer.URL, models.AppointmentFixedTimeId))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Contains(t, string(bodyBytes), `"start":"2020-01-18T05:00:00+09:00"`)
+	})
+
+	t.Run("fail unknown zone", func(tt *testing.T) {
+		res, err := client.Get(fmt.Sprintf("%s/appointment/%s?tz=Mars/Olympus", testServer.URL, models.AppointmentFixedTimeId))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(t, 400, res.StatusCode)
+	})
+
 	t.Run("fail no such appointment", func(tt *testing.T) {
 		res, err := client.Get(fmt.Sprintf("%s/appointment/%s", testServer.URL, models.UnexistingId))
 		if err != nil {
@@ -300,3 +321,464 @@ func TestAppointmentDelete(t *testing.T) {
 		assert.Equal(t, "unable to delete appointment", apiErr.Message)
 	})
 }
+
+func TestAppointmentOccurrences(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+
+	t.Run("success", func(tt *testing.T) {
+		res, err := client.Get(fmt.Sprintf("%s/appointment/%s/occurrences?from=%s&to=%s",
+			testServer.URL, models.AppointmentRecurringId, "2020-01-01T00:00:00Z", "2020-02-01T00:00:00Z"))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var occurrences []*models.Occurrence
+		err = json.Unmarshal(bodyBytes, &occurrences)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Len(t, occurrences, 8)
+	})
+
+	t.Run("fail invalid range", func(tt *testing.T) {
+		res, err := client.Get(fmt.Sprintf("%s/appointment/%s/occurrences?from=%s",
+			testServer.URL, models.AppointmentRecurringId, "2020-01-01T00:00:00Z"))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var apiErr controllers.ApiError
+		err = json.Unmarshal(bodyBytes, &apiErr)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(t, 400, res.StatusCode)
+	})
+
+	t.Run("fail no such appointment", func(tt *testing.T) {
+		res, err := client.Get(fmt.Sprintf("%s/appointment/%s/occurrences?from=%s&to=%s",
+			testServer.URL, models.UnexistingId, "2020-01-01T00:00:00Z", "2020-02-01T00:00:00Z"))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(t, 404, res.StatusCode)
+	})
+}
+
+func TestAppointmentCreateRecurring(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+
+	t.Run("success", func(tt *testing.T) {
+		res, err := client.Post(
+			fmt.Sprintf("%s/calendar/%s/appointment", testServer.URL, models.KnownCalendarId),
+			"application/json", strings.NewReader(`
+				{"subject": "daily standup",
+				"start": "2020-02-03T09:00:00Z",
+				"end": "2020-02-03T09:15:00Z",
+				"recurrence": "FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR"}`))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(t, 201, res.StatusCode)
+	})
+
+	t.Run("fail invalid recurrence", func(tt *testing.T) {
+		res, err := client.Post(
+			fmt.Sprintf("%s/calendar/%s/appointment", testServer.URL, models.KnownCalendarId),
+			"application/json", strings.NewReader(`
+				{"subject": "hourly standup",
+				"start": "2020-02-03T09:00:00Z",
+				"end": "2020-02-03T09:15:00Z",
+				"recurrence": "FREQ=HOURLY"}`))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(t, 409, res.StatusCode)
+	})
+}
+
+func TestAppointmentOccurrenceExceptions(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+
+	t.Run("success update this occurrence", func(tt *testing.T) {
+		res, err := client.Post(
+			fmt.Sprintf("%s/appointment/%s/occurrence/%s?scope=this",
+				testServer.URL, models.AppointmentRecurringId, "2020-01-08T09:00:00Z"),
+			"application/json", strings.NewReader(`{"start": "2020-01-08T15:00:00Z"}`))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var resAppt models.Appointment
+		err = json.Unmarshal(bodyBytes, &resAppt)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Len(t, resAppt.Exceptions, 1)
+	})
+
+	t.Run("success cancel this occurrence", func(tt *testing.T) {
+		req, err := http.NewRequest("DELETE",
+			fmt.Sprintf("%s/appointment/%s/occurrence/%s",
+				testServer.URL, models.AppointmentRecurringId, "2020-01-13T09:00:00Z"), nil)
+		if err != nil {
+			tt.Fatal("unable to create request", err)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(t, 202, res.StatusCode)
+	})
+
+	t.Run("fail invalid scope", func(tt *testing.T) {
+		res, err := client.Post(
+			fmt.Sprintf("%s/appointment/%s/occurrence/%s?scope=some",
+				testServer.URL, models.AppointmentRecurringId, "2020-01-08T09:00:00Z"),
+			"application/json", strings.NewReader(`{}`))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(t, 400, res.StatusCode)
+	})
+
+	t.Run("fail no such occurrence", func(tt *testing.T) {
+		res, err := client.Post(
+			fmt.Sprintf("%s/appointment/%s/occurrence/%s",
+				testServer.URL, models.AppointmentRecurringId, "2020-01-09T09:00:00Z"),
+			"application/json", strings.NewReader(`{"subject": "some"}`))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(t, 409, res.StatusCode)
+	})
+}
+
+func TestAppointmentCreateConflicts(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+	defer func(policy models.ConflictPolicy) { models.AppointmentConflictPolicy = policy }(models.AppointmentConflictPolicy)
+
+	overlapping := `{"subject": "late dinner", "start": "2020-01-17T21:00:00Z", "end": "2020-01-17T23:00:00Z"}`
+
+	t.Run("fail reject", func(tt *testing.T) {
+		models.AppointmentConflictPolicy = models.ConflictReject
+		res, err := client.Post(
+			fmt.Sprintf("%s/calendar/%s/appointment", testServer.URL, models.KnownCalendarId),
+			"application/json", strings.NewReader(overlapping))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 409, res.StatusCode)
+	})
+
+	t.Run("success warn", func(tt *testing.T) {
+		models.AppointmentConflictPolicy = models.ConflictWarn
+		res, err := client.Post(
+			fmt.Sprintf("%s/calendar/%s/appointment", testServer.URL, models.KnownCalendarId),
+			"application/json", strings.NewReader(overlapping))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var responseCreated models.ResponseCreated
+		err = json.Unmarshal(bodyBytes, &responseCreated)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 201, res.StatusCode)
+		assert.Len(tt, responseCreated.Conflicts, 1)
+		assert.Equal(tt, models.AppointmentFixedTimeId, responseCreated.Conflicts[0].AppointmentId)
+	})
+}
+
+func TestAppointmentOccurrenceConflicts(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+	defer func(policy models.ConflictPolicy) { models.AppointmentConflictPolicy = policy }(models.AppointmentConflictPolicy)
+
+	// the second occurrence of the weekly sync moved over the dinner of the same calendar
+	overlapping := `{"start": "2020-01-17T21:00:00Z", "end": "2020-01-17T21:30:00Z"}`
+
+	for _, scope := range []models.OccurrenceScope{models.ScopeThis, models.ScopeFollowing} {
+		t.Run(fmt.Sprintf("fail reject %s", scope), func(tt *testing.T) {
+			models.AppointmentConflictPolicy = models.ConflictReject
+			res, err := client.Post(
+				fmt.Sprintf("%s/appointment/%s/occurrence/%s?scope=%s",
+					testServer.URL, models.AppointmentRecurringId, "2020-01-08T09:00:00Z", scope),
+				"application/json", strings.NewReader(overlapping))
+			if err != nil {
+				tt.Fatal("unable to execute request", err)
+			}
+			assert.Equal(tt, 409, res.StatusCode)
+		})
+	}
+
+	t.Run("success warn", func(tt *testing.T) {
+		models.AppointmentConflictPolicy = models.ConflictWarn
+		res, err := client.Post(
+			fmt.Sprintf("%s/appointment/%s/occurrence/%s",
+				testServer.URL, models.AppointmentRecurringId, "2020-01-08T09:00:00Z"),
+			"application/json", strings.NewReader(overlapping))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var appt models.Appointment
+		err = json.Unmarshal(bodyBytes, &appt)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+		if assert.Len(tt, appt.Conflicts, 1) {
+			assert.Equal(tt, models.AppointmentFixedTimeId, appt.Conflicts[0].AppointmentId)
+		}
+	})
+}
+
+func TestAppointmentController_Search(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+
+	t.Run("success", func(tt *testing.T) {
+		res, err := client.Get(fmt.Sprintf("%s/appointment/search?q=%s&calendar_id=%s",
+			testServer.URL, "team+sync", models.KnownCalendarId))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var results models.SearchResults
+		err = json.Unmarshal(bodyBytes, &results)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+		assert.Len(tt, results.Results, 1)
+		assert.Equal(tt, models.AppointmentRecurringId, results.Results[0].ID)
+		assert.Contains(tt, results.Results[0].DescriptionHighlight, "<mark>team</mark> <mark>sync</mark>")
+	})
+
+	t.Run("fail no scope", func(tt *testing.T) {
+		res, err := client.Get(fmt.Sprintf("%s/appointment/search?q=%s", testServer.URL, "sync"))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 400, res.StatusCode)
+	})
+
+	t.Run("fail no such user", func(tt *testing.T) {
+		res, err := client.Get(fmt.Sprintf("%s/appointment/search?q=%s&user_id=%s",
+			testServer.URL, "sync", models.UnexistingId))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 404, res.StatusCode)
+	})
+}
+
+func TestAppointmentRsvp(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+
+	attendee := clientAs(models.ThirdKnownUserId)
+
+	t.Run("success", func(tt *testing.T) {
+		res, err := attendee.Post(fmt.Sprintf("%s/appointment/%s/rsvp", testServer.URL, models.AppointmentWholeDayId),
+			"application/json", strings.NewReader(`{"status": "declined", "comment": "on vacation"}`))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var resAppt models.Appointment
+		err = json.Unmarshal(bodyBytes, &resAppt)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+		assert.Len(tt, resAppt.Attendees, 1)
+		assert.Equal(tt, models.StatusDeclined, resAppt.Attendees[0].Participation.Status)
+		assert.Equal(tt, "on vacation", resAppt.Attendees[0].Participation.Comment)
+
+		// the organizer sees the answer as well
+		res, err = client.Get(fmt.Sprintf("%s/appointment/%s", testServer.URL, models.AppointmentWholeDayId))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err = ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		resAppt = models.Appointment{}
+		err = json.Unmarshal(bodyBytes, &resAppt)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, models.StatusDeclined, resAppt.Attendees[0].Participation.Status)
+		assert.NotNil(tt, resAppt.Attendees[0].Participation.RsvpAt)
+	})
+
+	t.Run("success add optional attendee", func(tt *testing.T) {
+		res, err := client.Post(fmt.Sprintf("%s/appointment/%s/add-attendees?role=optional", testServer.URL, models.AppointmentFixedTimeId),
+			"application/json", strings.NewReader(fmt.Sprintf(`["%s"]`, models.SecondKnownUserId)))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+
+		res, err = clientAs(models.SecondKnownUserId).Post(fmt.Sprintf("%s/appointment/%s/rsvp", testServer.URL, models.AppointmentFixedTimeId),
+			"application/json", strings.NewReader(`{"status": "accepted"}`))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var resAppt models.Appointment
+		err = json.Unmarshal(bodyBytes, &resAppt)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+		assert.Equal(tt, models.AttendeeOptional, resAppt.Attendees[0].Participation.Role)
+		assert.Equal(tt, models.StatusAccepted, resAppt.Attendees[0].Participation.Status)
+	})
+
+	t.Run("fail invalid status", func(tt *testing.T) {
+		res, err := attendee.Post(fmt.Sprintf("%s/appointment/%s/rsvp", testServer.URL, models.AppointmentWholeDayId),
+			"application/json", strings.NewReader(`{"status": "maybe"}`))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 400, res.StatusCode)
+	})
+
+	t.Run("fail not invited", func(tt *testing.T) {
+		res, err := attendee.Post(fmt.Sprintf("%s/appointment/%s/rsvp", testServer.URL, models.AppointmentRecurringId),
+			"application/json", strings.NewReader(`{"status": "accepted"}`))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 403, res.StatusCode)
+	})
+}
+
+func TestAppointmentExternalAttendees(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+
+	t.Run("success add", func(tt *testing.T) {
+		res, err := client.Post(fmt.Sprintf("%s/appointment/%s/add-attendees", testServer.URL, models.AppointmentFixedTimeId),
+			"application/json", strings.NewReader(fmt.Sprintf(`["%s", {"email": "customer@example.com", "name": "Jane Customer"}]`,
+				models.SecondKnownUserId)))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var resAppt models.Appointment
+		err = json.Unmarshal(bodyBytes, &resAppt)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+		assert.Len(tt, resAppt.Attendees, 1)
+		assert.Len(tt, resAppt.ExternalAttendees, 1)
+		assert.Equal(tt, "customer@example.com", resAppt.ExternalAttendees[0].Email)
+		assert.Equal(tt, "Jane Customer", resAppt.ExternalAttendees[0].Name)
+	})
+
+	t.Run("success exported", func(tt *testing.T) {
+		res, err := client.Get(fmt.Sprintf("%s/calendar/%s.ics", testServer.URL, models.KnownCalendarId))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+		assert.Contains(tt, string(bodyBytes), "ATTENDEE;CN=\"Jane Customer\";ROLE=REQ-PARTICIPANT;PARTSTAT=NEEDS-ACTION:mailto:customer@example.com")
+	})
+
+	t.Run("success remove", func(tt *testing.T) {
+		res, err := client.Post(fmt.Sprintf("%s/appointment/%s/remove-attendees", testServer.URL, models.AppointmentFixedTimeId),
+			"application/json", strings.NewReader(`["customer@example.com"]`))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var resAppt models.Appointment
+		err = json.Unmarshal(bodyBytes, &resAppt)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+		assert.Len(tt, resAppt.Attendees, 1)
+		assert.Len(tt, resAppt.ExternalAttendees, 0)
+	})
+
+	t.Run("fail invalid email", func(tt *testing.T) {
+		res, err := client.Post(fmt.Sprintf("%s/appointment/%s/add-attendees", testServer.URL, models.AppointmentFixedTimeId),
+			"application/json", strings.NewReader(`[{"email": "nobody"}]`))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 400, res.StatusCode)
+	})
+}
@@ -0,0 +1,131 @@
+package tests
+
+import (
+	"bytes"
+	"calendar_service/src/auth"
+	"calendar_service/src/controllers"
+	"calendar_service/src/datasources/postgres/calendardb"
+	"calendar_service/src/models"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestAuthMiddleware(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+
+	get := func(tt *testing.T, authorization string) *http.Response {
+		req, err := http.NewRequest("GET", fmt.Sprintf("%s/user/%s", testServer.URL, models.KnownUserId), nil)
+		if err != nil {
+			tt.Fatal("unable to create request", err)
+		}
+		req.Header.Set("Authorization", authorization)
+		res, err := client.Do(req)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		return res
+	}
+
+	t.Run("success", func(tt *testing.T) {
+		token, _, err := auth.Tokens.Issue(models.KnownUserId, time.Minute)
+		if err != nil {
+			tt.Fatal("unable to issue token", err)
+		}
+		res := get(tt, "Bearer "+token)
+		assert.Equal(tt, 200, res.StatusCode)
+	})
+
+	t.Run("fail missing token", func(tt *testing.T) {
+		res, err := testServer.Client().Get(fmt.Sprintf("%s/user/%s", testServer.URL, models.KnownUserId))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var apiErr controllers.ApiError
+		err = json.Unmarshal(bodyBytes, &apiErr)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 401, res.StatusCode)
+		assert.Equal(tt, "unauthorized", apiErr.GetMessage())
+		assert.Contains(tt, res.Header.Get("WWW-Authenticate"), "Bearer")
+	})
+
+	t.Run("fail expired token", func(tt *testing.T) {
+		token, _, err := auth.Tokens.Issue(models.KnownUserId, -time.Minute)
+		if err != nil {
+			tt.Fatal("unable to issue token", err)
+		}
+		res := get(tt, "Bearer "+token)
+		assert.Equal(tt, 401, res.StatusCode)
+	})
+
+	t.Run("fail foreign signature", func(tt *testing.T) {
+		token, _, err := auth.NewHMACTokenAuth([]byte("another secret"), "calendar").Issue(models.KnownUserId, time.Minute)
+		if err != nil {
+			tt.Fatal("unable to issue token", err)
+		}
+		res := get(tt, "Bearer "+token)
+		assert.Equal(tt, 401, res.StatusCode)
+	})
+
+	t.Run("public root", func(tt *testing.T) {
+		res, err := testServer.Client().Get(testServer.URL + "/")
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+	})
+}
+
+func TestAuthController_Token(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+
+	t.Run("success", func(tt *testing.T) {
+		body := []byte(fmt.Sprintf(`{"user_id": "%s"}`, models.SecondKnownUserId))
+		res, err := testServer.Client().Post(testServer.URL+"/auth/token", "application/json", bytes.NewReader(body))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var response struct {
+			Token string `json:"token"`
+		}
+		err = json.Unmarshal(bodyBytes, &response)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+		userId, err := auth.Tokens.Authenticate(response.Token)
+		assert.Nil(tt, err)
+		assert.Equal(tt, models.SecondKnownUserId, userId)
+	})
+
+	t.Run("fail no such user", func(tt *testing.T) {
+		body := []byte(fmt.Sprintf(`{"user_id": "%s"}`, models.UnexistingId))
+		res, err := testServer.Client().Post(testServer.URL+"/auth/token", "application/json", bytes.NewReader(body))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 404, res.StatusCode)
+	})
+}
@@ -0,0 +1,125 @@
+package tests
+
+import (
+	"calendar_service/src/controllers"
+	"calendar_service/src/datasources/postgres/calendardb"
+	"calendar_service/src/models"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestAuthorization(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+
+	second := clientAs(models.SecondKnownUserId)
+	attendee := clientAs(models.ThirdKnownUserId)
+
+	assertForbidden := func(tt *testing.T, res *http.Response) {
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var apiErr controllers.ApiError
+		err = json.Unmarshal(bodyBytes, &apiErr)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 403, res.StatusCode)
+		assert.Equal(tt, 403, apiErr.StatusCode)
+	}
+
+	t.Run("fail read another user", func(tt *testing.T) {
+		res, err := second.Get(fmt.Sprintf("%s/user/%s", testServer.URL, models.KnownUserId))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assertForbidden(tt, res)
+	})
+
+	t.Run("fail read calendar of another user", func(tt *testing.T) {
+		res, err := second.Get(fmt.Sprintf("%s/calendar/%s", testServer.URL, models.KnownCalendarId))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assertForbidden(tt, res)
+	})
+
+	t.Run("fail create calendar for another user", func(tt *testing.T) {
+		res, err := second.Post(fmt.Sprintf("%s/user/%s/calendar", testServer.URL, models.KnownUserId),
+			"application/json", strings.NewReader(`{"name": "Not mine"}`))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assertForbidden(tt, res)
+	})
+
+	t.Run("fail delete calendar of another user", func(tt *testing.T) {
+		request, err := http.NewRequest("DELETE", fmt.Sprintf("%s/calendar/%s", testServer.URL, models.KnownCalendarId), nil)
+		if err != nil {
+			tt.Fatal("unable to create request", err)
+		}
+		res, err := second.Do(request)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assertForbidden(tt, res)
+	})
+
+	t.Run("fail read appointment of another user", func(tt *testing.T) {
+		res, err := second.Get(fmt.Sprintf("%s/appointment/%s", testServer.URL, models.AppointmentFixedTimeId))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assertForbidden(tt, res)
+	})
+
+	t.Run("success attendee reads appointment", func(tt *testing.T) {
+		res, err := attendee.Get(fmt.Sprintf("%s/appointment/%s", testServer.URL, models.AppointmentWholeDayId))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+	})
+
+	t.Run("fail attendee updates appointment", func(tt *testing.T) {
+		res, err := attendee.Post(fmt.Sprintf("%s/appointment/%s", testServer.URL, models.AppointmentWholeDayId),
+			"application/json", strings.NewReader(`{"subject": "mine now"}`))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assertForbidden(tt, res)
+	})
+
+	t.Run("fail attendee deletes appointment", func(tt *testing.T) {
+		request, err := http.NewRequest("DELETE", fmt.Sprintf("%s/appointment/%s", testServer.URL, models.AppointmentWholeDayId), nil)
+		if err != nil {
+			tt.Fatal("unable to create request", err)
+		}
+		res, err := attendee.Do(request)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assertForbidden(tt, res)
+	})
+
+	t.Run("fail caldav calendar of another user", func(tt *testing.T) {
+		request, err := http.NewRequest("PROPFIND", fmt.Sprintf("%s/caldav/calendars/%s/", testServer.URL, models.KnownCalendarId), nil)
+		if err != nil {
+			tt.Fatal("unable to create request", err)
+		}
+		res, err := second.Do(request)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 403, res.StatusCode)
+	})
+}
@@ -0,0 +1,263 @@
+package tests
+
+import (
+	"calendar_service/src/datasources/postgres/calendardb"
+	"calendar_service/src/models"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func caldavRequest(method, path, body string, headers map[string]string) (*http.Response, string, error) {
+	req, err := http.NewRequest(method, testServer.URL+path, strings.NewReader(body))
+	if err != nil {
+		return nil, "", err
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+	bodyBytes, err := ioutil.ReadAll(res.Body)
+	return res, string(bodyBytes), err
+}
+
+func TestCalDAV(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+
+	calendarPath := fmt.Sprintf("/caldav/calendars/%s/", models.KnownCalendarId)
+
+	t.Run("propfind calendar home", func(tt *testing.T) {
+		res, body, err := caldavRequest("PROPFIND", fmt.Sprintf("/caldav/users/%s/", models.KnownUserId), "",
+			map[string]string{"Depth": "1"})
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 207, res.StatusCode)
+		assert.Contains(tt, body, calendarPath)
+		assert.Contains(tt, body, "<C:calendar/>")
+		assert.Contains(tt, body, "John&#39;s personal calendar")
+	})
+
+	t.Run("propfind calendar lists objects", func(tt *testing.T) {
+		res, body, err := caldavRequest("PROPFIND", calendarPath,
+			`<?xml version="1.0"?><D:propfind xmlns:D="DAV:" xmlns:CS="http://calendarserver.org/ns/">`+
+				`<D:prop><D:getetag/><CS:getctag/><D:unknown/></D:prop></D:propfind>`,
+			map[string]string{"Depth": "1"})
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 207, res.StatusCode)
+		assert.Contains(tt, body, "<CS:getctag>")
+		assert.Contains(tt, body, models.AppointmentFixedTimeId+".ics")
+		assert.Contains(tt, body, models.AppointmentRecurringId+".ics")
+		assert.Contains(tt, body, "404 Not Found")
+	})
+
+	t.Run("calendar-query filters by time range", func(tt *testing.T) {
+		res, body, err := caldavRequest("REPORT", calendarPath,
+			`<?xml version="1.0"?><C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">`+
+				`<D:prop><D:getetag/></D:prop><C:filter><C:comp-filter name="VCALENDAR">`+
+				`<C:comp-filter name="VEVENT"><C:time-range start="20200117T000000Z" end="20200118T000000Z"/>`+
+				`</C:comp-filter></C:comp-filter></C:filter></C:calendar-query>`,
+			map[string]string{"Depth": "1"})
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 207, res.StatusCode)
+		assert.Contains(tt, body, models.AppointmentFixedTimeId+".ics")
+		assert.NotContains(tt, body, models.AppointmentWholeDayId+".ics")
+		assert.NotContains(tt, body, models.AppointmentRecurringId+".ics")
+	})
+
+	t.Run("calendar-multiget returns calendar data", func(tt *testing.T) {
+		res, body, err := caldavRequest("REPORT", calendarPath,
+			`<?xml version="1.0"?><C:calendar-multiget xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">`+
+				`<D:prop><D:getetag/><C:calendar-data/></D:prop>`+
+				`<D:href>`+calendarPath+models.AppointmentRecurringId+`.ics</D:href>`+
+				`<D:href>`+calendarPath+models.UnexistingId+`.ics</D:href>`+
+				`</C:calendar-multiget>`, nil)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 207, res.StatusCode)
+		assert.Contains(tt, body, "RRULE:FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10")
+		assert.Contains(tt, body, "HTTP/1.1 404 Not Found")
+	})
+
+	t.Run("put get and delete calendar object", func(tt *testing.T) {
+		objectPath := calendarPath + models.UnexistingId + ".ics"
+		event := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nBEGIN:VEVENT\r\nUID:caldav-test\r\n" +
+			"DTSTART:20200301T100000Z\r\nDTEND:20200301T110000Z\r\nSUMMARY:%s\r\n" +
+			"ATTENDEE:mailto:kotlinjackson@gmail.com\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+
+		res, _, err := caldavRequest("PUT", objectPath, fmt.Sprintf(event, "CalDAV meeting"),
+			map[string]string{"If-None-Match": "*"})
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 201, res.StatusCode)
+		created := res.Header.Get("ETag")
+		assert.NotEmpty(tt, created)
+
+		res, _, err = caldavRequest("PUT", objectPath, fmt.Sprintf(event, "CalDAV meeting"),
+			map[string]string{"If-None-Match": "*"})
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 412, res.StatusCode)
+
+		res, _, err = caldavRequest("PUT", objectPath, fmt.Sprintf(event, "Renamed meeting"),
+			map[string]string{"If-Match": created})
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 204, res.StatusCode)
+
+		res, body, err := caldavRequest("GET", objectPath, "", nil)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+		assert.Contains(tt, body, "SUMMARY:Renamed meeting")
+		assert.Contains(tt, body, "mailto:kotlinjackson@gmail.com")
+
+		res, _, err = caldavRequest("DELETE", objectPath, "", map[string]string{"If-Match": created})
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 412, res.StatusCode)
+
+		res, _, err = caldavRequest("DELETE", objectPath, "", nil)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 204, res.StatusCode)
+
+		res, _, err = caldavRequest("GET", objectPath, "", nil)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 404, res.StatusCode)
+	})
+
+	t.Run("put keeps the object name and uid of the client", func(tt *testing.T) {
+		objectPath := calendarPath + "F0A4C2E1-client-event.ics"
+		event := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\nBEGIN:VEVENT\r\nUID:client-event@example.com\r\n" +
+			"DTSTART:20200302T100000Z\r\nDTEND:20200302T110000Z\r\nSUMMARY:%s\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+
+		res, _, err := caldavRequest("PUT", objectPath, fmt.Sprintf(event, "Client meeting"), nil)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 201, res.StatusCode)
+
+		res, body, err := caldavRequest("GET", objectPath, "", nil)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+		assert.Contains(tt, body, "UID:client-event@example.com")
+
+		res, body, err = caldavRequest("PROPFIND", calendarPath, "", map[string]string{"Depth": "1"})
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 207, res.StatusCode)
+		assert.Contains(tt, body, objectPath)
+
+		res, _, err = caldavRequest("PUT", calendarPath+"other-name.ics", fmt.Sprintf(event, "Copied meeting"), nil)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 409, res.StatusCode)
+	})
+}
+
+func TestCalDAVAppPassword(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+
+	homePath := fmt.Sprintf("%s/caldav/users/%s/", testServer.URL, models.KnownUserId)
+	var created models.AppPassword
+
+	t.Run("success create", func(tt *testing.T) {
+		res, err := client.Post(fmt.Sprintf("%s/app-password", testServer.URL), "application/json",
+			strings.NewReader(`{"name": "phone"}`))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		err = json.Unmarshal(bodyBytes, &created)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 201, res.StatusCode)
+		assert.NotEmpty(tt, created.Password)
+	})
+
+	t.Run("success basic auth with the email", func(tt *testing.T) {
+		req, _ := http.NewRequest("PROPFIND", homePath, nil)
+		req.SetBasicAuth("jhon@gmail.com", created.Password)
+		res, err := testServer.Client().Do(req)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 207, res.StatusCode)
+	})
+
+	t.Run("fail basic auth with a wrong password", func(tt *testing.T) {
+		req, _ := http.NewRequest("PROPFIND", homePath, nil)
+		req.SetBasicAuth(models.KnownUserId, "wrong")
+		res, err := testServer.Client().Do(req)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 401, res.StatusCode)
+		assert.Contains(tt, res.Header.Values("WWW-Authenticate"), `Basic realm="calendar", charset="UTF-8"`)
+	})
+
+	t.Run("fail basic auth outside caldav", func(tt *testing.T) {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("%s/user/%s", testServer.URL, models.KnownUserId), nil)
+		req.SetBasicAuth(models.KnownUserId, created.Password)
+		res, err := testServer.Client().Do(req)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 401, res.StatusCode)
+	})
+
+	t.Run("fail basic auth once revoked", func(tt *testing.T) {
+		req, _ := http.NewRequest("DELETE", fmt.Sprintf("%s/app-password/%s", testServer.URL, created.ID), nil)
+		res, err := client.Do(req)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 202, res.StatusCode)
+
+		req, _ = http.NewRequest("PROPFIND", homePath, nil)
+		req.SetBasicAuth(models.KnownUserId, created.Password)
+		res, err = testServer.Client().Do(req)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 401, res.StatusCode)
+	})
+}
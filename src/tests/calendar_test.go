@@ -255,3 +255,249 @@ func TestCalendarDelete(t *testing.T) {
 		assert.Equal(t, "unable to delete calendar", apiErr.Message)
 	})
 }
+
+func TestCalendarController_Export(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+
+	t.Run("success", func(tt *testing.T) {
+		res, err := client.Get(fmt.Sprintf("%s/calendar/%s.ics", testServer.URL, models.KnownCalendarId))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		body := string(bodyBytes)
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Equal(t, "text/calendar; charset=utf-8", res.Header.Get("Content-Type"))
+		assert.Contains(t, body, "BEGIN:VCALENDAR")
+		assert.Equal(t, 3, strings.Count(body, "BEGIN:VEVENT"))
+		assert.Contains(t, body, "DTSTART;VALUE=DATE:20200118")
+		assert.Contains(t, body, "RRULE:FREQ=WEEKLY;BYDAY=MO,WE;COUNT=10")
+		assert.Contains(t, body, "mailto:pkolakovski@gmail.com")
+	})
+
+	t.Run("success content negotiation", func(tt *testing.T) {
+		req, err := http.NewRequest("GET", fmt.Sprintf("%s/calendar/%s", testServer.URL, models.KnownCalendarId), nil)
+		if err != nil {
+			tt.Fatal("unable to create request", err)
+		}
+		req.Header.Set("Accept", "text/calendar")
+		res, err := client.Do(req)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Equal(t, "text/calendar; charset=utf-8", res.Header.Get("Content-Type"))
+	})
+
+	t.Run("fail no such calendar", func(tt *testing.T) {
+		res, err := client.Get(fmt.Sprintf("%s/calendar/%s.ics", testServer.URL, models.UnexistingId))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(t, 404, res.StatusCode)
+	})
+}
+
+func TestCalendarController_Import(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+
+	const body = "BEGIN:VCALENDAR\r\n" +
+		"VERSION:2.0\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:new@example.com\r\n" +
+		"SUMMARY:Imported meeting\r\n" +
+		"DTSTART:20200210T100000Z\r\n" +
+		"DTEND:20200210T110000Z\r\n" +
+		"ATTENDEE;CN=Kotlin Jackson:mailto:kotlinjackson@gmail.com\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:duplicate@example.com\r\n" +
+		"SUMMARY:Meet friends\r\n" +
+		"DTSTART:20200210T100000Z\r\n" +
+		"DTEND:20200210T110000Z\r\n" +
+		"END:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\n" +
+		"UID:broken@example.com\r\n" +
+		"SUMMARY:Broken\r\n" +
+		"END:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+
+	t.Run("success", func(tt *testing.T) {
+		res, err := client.Post(fmt.Sprintf("%s/calendar/%s/import", testServer.URL, models.KnownCalendarId),
+			"text/calendar", strings.NewReader(body))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var report models.ImportReport
+		err = json.Unmarshal(bodyBytes, &report)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(t, 200, res.StatusCode)
+		assert.Equal(t, 1, report.Created)
+		assert.Equal(t, 1, report.Skipped)
+		assert.Equal(t, 1, report.Failed)
+	})
+
+	t.Run("fail invalid body", func(tt *testing.T) {
+		res, err := client.Post(fmt.Sprintf("%s/calendar/%s/import", testServer.URL, models.KnownCalendarId),
+			"text/calendar", strings.NewReader("not a calendar"))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(t, 400, res.StatusCode)
+	})
+
+	t.Run("fail body too large", func(tt *testing.T) {
+		res, err := client.Post(fmt.Sprintf("%s/calendar/%s/import", testServer.URL, models.KnownCalendarId),
+			"text/calendar", strings.NewReader(strings.Repeat("x", 10<<20+1)))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(t, 413, res.StatusCode)
+	})
+
+	t.Run("fail no such calendar", func(tt *testing.T) {
+		res, err := client.Post(fmt.Sprintf("%s/calendar/%s/import", testServer.URL, models.UnexistingId),
+			"text/calendar", strings.NewReader(body))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(t, 404, res.StatusCode)
+	})
+}
+
+func TestCalendarController_Appointments(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+
+	t.Run("success", func(tt *testing.T) {
+		res, err := client.Get(fmt.Sprintf("%s/calendar/%s/appointments?from=%s&to=%s&limit=2",
+			testServer.URL, models.KnownCalendarId, "2020-01-17T00:00:00Z", "2020-01-21T00:00:00Z"))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var page models.OccurrencePage
+		err = json.Unmarshal(bodyBytes, &page)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+		assert.Len(tt, page.Occurrences, 2)
+		assert.Equal(tt, models.AppointmentFixedTimeId, page.Occurrences[0].AppointmentId)
+		assert.NotEmpty(tt, page.NextCursor)
+
+		res, err = client.Get(fmt.Sprintf("%s/calendar/%s/appointments?from=%s&to=%s&limit=2&cursor=%s",
+			testServer.URL, models.KnownCalendarId, "2020-01-17T00:00:00Z", "2020-01-21T00:00:00Z", page.NextCursor))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err = ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		page = models.OccurrencePage{}
+		err = json.Unmarshal(bodyBytes, &page)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+		assert.Len(tt, page.Occurrences, 1)
+		assert.Equal(tt, models.AppointmentRecurringId, page.Occurrences[0].AppointmentId)
+		assert.Empty(tt, page.NextCursor)
+	})
+
+	t.Run("fail invalid limit", func(tt *testing.T) {
+		res, err := client.Get(fmt.Sprintf("%s/calendar/%s/appointments?from=%s&to=%s&limit=0",
+			testServer.URL, models.KnownCalendarId, "2020-01-17T00:00:00Z", "2020-01-21T00:00:00Z"))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 400, res.StatusCode)
+	})
+
+	t.Run("fail no such calendar", func(tt *testing.T) {
+		res, err := client.Get(fmt.Sprintf("%s/calendar/%s/appointments?from=%s&to=%s",
+			testServer.URL, models.UnexistingId, "2020-01-17T00:00:00Z", "2020-01-21T00:00:00Z"))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 404, res.StatusCode)
+	})
+}
+
+func TestCalendarController_List(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+
+	t.Run("success", func(tt *testing.T) {
+		res, err := client.Get(fmt.Sprintf("%s/user/%s/calendar?name=john", testServer.URL, models.KnownUserId))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var page models.CalendarPage
+		err = json.Unmarshal(bodyBytes, &page)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+		assert.Len(tt, page.Calendars, 1)
+		assert.Equal(tt, models.KnownCalendarId, page.Calendars[0].ID)
+		assert.Empty(tt, page.NextCursor)
+	})
+
+	t.Run("success no match", func(tt *testing.T) {
+		res, err := client.Get(fmt.Sprintf("%s/user/%s/calendar?name=kotlin", testServer.URL, models.KnownUserId))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var page models.CalendarPage
+		err = json.Unmarshal(bodyBytes, &page)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+		assert.Len(tt, page.Calendars, 0)
+	})
+
+	t.Run("fail no such user", func(tt *testing.T) {
+		res, err := client.Get(fmt.Sprintf("%s/user/%s/calendar", testServer.URL, models.UnexistingId))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 404, res.StatusCode)
+	})
+}
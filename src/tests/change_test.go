@@ -0,0 +1,66 @@
+package tests
+
+import (
+	"calendar_service/src/datasources/postgres/calendardb"
+	"calendar_service/src/models"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestChangeController(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+
+	readChanges := func(tt *testing.T, since string) *models.ChangePage {
+		res, err := client.Get(fmt.Sprintf("%s/changes?since=%s", testServer.URL, since))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+		var page models.ChangePage
+		err = json.Unmarshal(bodyBytes, &page)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		return &page
+	}
+
+	t.Run("success list changes", func(tt *testing.T) {
+		start := readChanges(tt, "")
+
+		res, err := client.Post(fmt.Sprintf("%s/calendar/%s/appointment", testServer.URL, models.KnownCalendarId), "application/json",
+			strings.NewReader(`{"subject": "Change feed", "start": "2020-03-02T10:00:00Z", "end": "2020-03-02T11:00:00Z"}`))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 201, res.StatusCode)
+
+		page := readChanges(tt, start.NextCursor)
+		if assert.Len(tt, page.Changes, 1) {
+			assert.Equal(tt, models.EntityAppointment, page.Changes[0].Entity)
+			assert.Equal(tt, models.ChangeCreate, page.Changes[0].Operation)
+			assert.Nil(tt, page.Changes[0].Before)
+			assert.Contains(tt, string(page.Changes[0].After.RawMessage), "Change feed")
+		}
+		assert.Len(tt, readChanges(tt, page.NextCursor).Changes, 0)
+	})
+
+	t.Run("fail with invalid cursor", func(tt *testing.T) {
+		res, err := client.Get(fmt.Sprintf("%s/changes?since=abc", testServer.URL))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 400, res.StatusCode)
+	})
+}
@@ -0,0 +1,113 @@
+package tests
+
+import (
+	"calendar_service/src/datasources/postgres/calendardb"
+	"calendar_service/src/models"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestETags(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+
+	apptUrl := fmt.Sprintf("%s/appointment/%s", testServer.URL, models.AppointmentFixedTimeId)
+	do := func(tt *testing.T, method, url, body string, header http.Header) *http.Response {
+		request, err := http.NewRequest(method, url, strings.NewReader(body))
+		if err != nil {
+			tt.Fatal("unable to create request", err)
+		}
+		for key, values := range header {
+			request.Header[key] = values
+		}
+		res, err := client.Do(request)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		if _, err := ioutil.ReadAll(res.Body); err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		return res
+	}
+
+	first := do(t, "GET", apptUrl, "", nil)
+	assert.Equal(t, 200, first.StatusCode)
+	etag := first.Header.Get("ETag")
+	if !assert.NotEmpty(t, etag) {
+		return
+	}
+
+	t.Run("not modified", func(tt *testing.T) {
+		res := do(tt, "GET", apptUrl, "", http.Header{"If-None-Match": {etag}})
+		assert.Equal(tt, 304, res.StatusCode)
+		assert.Equal(tt, etag, res.Header.Get("ETag"))
+	})
+
+	body := fmt.Sprintf(`{"calendar_id": "%s", "subject": "Meet friends", "description": "etag",
+		"start": "2020-01-17T20:00:00Z", "end": "2020-01-17T22:30:00Z"}`, models.KnownCalendarId)
+	var current string
+	t.Run("success update at the current version", func(tt *testing.T) {
+		res := do(tt, "POST", apptUrl, body, http.Header{"If-Match": {etag}})
+		assert.Equal(tt, 200, res.StatusCode)
+		current = res.Header.Get("ETag")
+		assert.NotEqual(tt, etag, current)
+	})
+
+	t.Run("modified", func(tt *testing.T) {
+		res := do(tt, "GET", apptUrl, "", http.Header{"If-None-Match": {etag}})
+		assert.Equal(tt, 200, res.StatusCode)
+		// deletes below expect the etag of a fresh read
+		current = res.Header.Get("ETag")
+		assert.NotEqual(tt, etag, current)
+	})
+
+	t.Run("fail update at a stale version", func(tt *testing.T) {
+		res := do(tt, "POST", apptUrl, body, http.Header{"If-Match": {etag}})
+		assert.Equal(tt, 412, res.StatusCode)
+	})
+
+	t.Run("fail delete at a stale version", func(tt *testing.T) {
+		res := do(tt, "DELETE", apptUrl, "", http.Header{"If-Match": {etag}})
+		assert.Equal(tt, 412, res.StatusCode)
+	})
+
+	t.Run("fail with several etags", func(tt *testing.T) {
+		res := do(tt, "DELETE", apptUrl, "", http.Header{"If-Match": {etag + ", " + current}})
+		assert.Equal(tt, 400, res.StatusCode)
+	})
+
+	t.Run("fail attendees and rsvp at a stale version", func(tt *testing.T) {
+		attendees := fmt.Sprintf(`["%s"]`, models.SecondKnownUserId)
+		res := do(tt, "POST", apptUrl+"/add-attendees", attendees, http.Header{"If-Match": {etag}})
+		assert.Equal(tt, 412, res.StatusCode)
+		res = do(tt, "POST", apptUrl+"/remove-attendees", attendees, http.Header{"If-Match": {etag}})
+		assert.Equal(tt, 412, res.StatusCode)
+		res = do(tt, "POST", apptUrl+"/rsvp", `{"status": "accepted"}`, http.Header{"If-Match": {etag}})
+		assert.Equal(tt, 412, res.StatusCode)
+	})
+
+	t.Run("success occurrences at the current version only", func(tt *testing.T) {
+		seriesUrl := fmt.Sprintf("%s/appointment/%s", testServer.URL, models.AppointmentRecurringId)
+		res := do(tt, "GET", seriesUrl, "", nil)
+		stale := res.Header.Get("ETag")
+		res = do(tt, "DELETE", seriesUrl+"/occurrence/2020-01-08T09:00:00Z", "", http.Header{"If-Match": {stale}})
+		assert.Equal(tt, 202, res.StatusCode)
+		res = do(tt, "DELETE", seriesUrl+"/occurrence/2020-01-13T09:00:00Z", "", http.Header{"If-Match": {stale}})
+		assert.Equal(tt, 412, res.StatusCode)
+		res = do(tt, "POST", seriesUrl+"/occurrence/2020-01-15T09:00:00Z", `{"subject": "moved sync"}`,
+			http.Header{"If-Match": {stale}})
+		assert.Equal(tt, 412, res.StatusCode)
+	})
+
+	t.Run("success delete at the current version", func(tt *testing.T) {
+		res := do(tt, "DELETE", apptUrl, "", http.Header{"If-Match": {current}})
+		assert.Equal(tt, 202, res.StatusCode)
+	})
+}
@@ -0,0 +1,134 @@
+package tests
+
+import (
+	"calendar_service/src/controllers"
+	"calendar_service/src/datasources/postgres/calendardb"
+	"calendar_service/src/models"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestFreeBusyController_Query(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+
+	t.Run("success", func(tt *testing.T) {
+		body := fmt.Sprintf(`{"user_ids": ["%s"], "from": "2020-01-18T00:00:00Z", "to": "2020-01-19T00:00:00Z"}`,
+			models.ThirdKnownUserId)
+		res, err := client.Post(testServer.URL+"/freebusy", "application/json", strings.NewReader(body))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var freeBusy models.FreeBusy
+		err = json.Unmarshal(bodyBytes, &freeBusy)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+		assert.Len(tt, freeBusy.Users, 1)
+		assert.Len(tt, freeBusy.Users[0].Busy, 1)
+		assert.Equal(tt, "2020-01-18T00:00:00Z", freeBusy.Users[0].Busy[0].Start.Format("2006-01-02T15:04:05Z07:00"))
+	})
+
+	t.Run("success hides calendars not shared with the caller", func(tt *testing.T) {
+		body := fmt.Sprintf(`{"user_ids": ["%s"], "from": "2020-01-17T00:00:00Z", "to": "2020-01-21T00:00:00Z"}`,
+			models.KnownUserId)
+		res, err := clientAs(models.SecondKnownUserId).Post(testServer.URL+"/freebusy", "application/json", strings.NewReader(body))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var freeBusy models.FreeBusy
+		err = json.Unmarshal(bodyBytes, &freeBusy)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+		assert.Len(tt, freeBusy.Users, 1)
+		assert.Empty(tt, freeBusy.Users[0].Busy)
+	})
+
+	t.Run("fail invalid range", func(tt *testing.T) {
+		body := fmt.Sprintf(`{"user_ids": ["%s"], "from": "2020-01-19T00:00:00Z", "to": "2020-01-18T00:00:00Z"}`,
+			models.KnownUserId)
+		res, err := client.Post(testServer.URL+"/freebusy", "application/json", strings.NewReader(body))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var apiErr controllers.ApiError
+		err = json.Unmarshal(bodyBytes, &apiErr)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 400, res.StatusCode)
+		assert.Equal(tt, "from should be before to", apiErr.Message)
+	})
+}
+
+func TestFreeBusyController_Slots(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+
+	t.Run("success", func(tt *testing.T) {
+		body := fmt.Sprintf(`{"user_ids": ["%s", "%s"], "from": "2020-01-17T19:00:00Z", "to": "2020-01-18T00:00:00Z", `+
+			`"duration": 60, "count": 3}`, models.KnownUserId, models.SecondKnownUserId)
+		res, err := client.Post(testServer.URL+"/freebusy/slots", "application/json", strings.NewReader(body))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var slots models.Slots
+		err = json.Unmarshal(bodyBytes, &slots)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+		assert.Len(tt, slots.Slots, 3)
+		assert.Equal(tt, "2020-01-17T19:00:00Z", slots.Slots[0].Start.Format("2006-01-02T15:04:05Z07:00"))
+		assert.Equal(tt, "2020-01-17T22:30:00Z", slots.Slots[1].Start.Format("2006-01-02T15:04:05Z07:00"))
+	})
+
+	t.Run("fail no duration", func(tt *testing.T) {
+		body := fmt.Sprintf(`{"user_ids": ["%s"], "from": "2020-01-17T19:00:00Z", "to": "2020-01-18T00:00:00Z"}`,
+			models.KnownUserId)
+		res, err := client.Post(testServer.URL+"/freebusy/slots", "application/json", strings.NewReader(body))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var apiErr controllers.ApiError
+		err = json.Unmarshal(bodyBytes, &apiErr)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 400, res.StatusCode)
+		assert.Equal(tt, "duration should be a positive number of minutes", apiErr.Message)
+	})
+}
@@ -2,6 +2,7 @@ package tests
 
 import (
 	"calendar_service/src/app"
+	"calendar_service/src/auth"
 	"calendar_service/src/datasources/postgres/calendardb"
 	"calendar_service/src/models"
 	"fmt"
@@ -10,6 +11,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 )
 
 var (
@@ -30,8 +32,38 @@ func TestMain(m *testing.M) {
 	}
 	router := app.InitApp()
 	testServer = httptest.NewServer(router)
-	client = testServer.Client()
+	// testServer.Client() stays unauthenticated
+	client = clientAs(models.KnownUserId)
 	models.RecreateTables(calendardb.DB)
 	models.InitIndexes(calendardb.DB)
+	if err := app.InitBroker().Start(); err != nil {
+		fmt.Println("unable to start broker", err)
+		os.Exit(1)
+	}
 	os.Exit(m.Run())
 }
+
+// clientAs returns a client authenticated as the user
+func clientAs(userId string) *http.Client {
+	return &http.Client{Transport: &bearerTransport{userId: userId, base: testServer.Client().Transport}}
+}
+
+// bearerTransport authenticates the requests of the test client as userId
+// unless the request carries its own Authorization header
+type bearerTransport struct {
+	userId string
+	base   http.RoundTripper
+}
+
+func (t *bearerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	if r.Header.Get("Authorization") != "" {
+		return t.base.RoundTrip(r)
+	}
+	token, _, err := auth.Tokens.Issue(t.userId, time.Hour)
+	if err != nil {
+		return nil, err
+	}
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+token)
+	return t.base.RoundTrip(r)
+}
@@ -0,0 +1,180 @@
+package tests
+
+import (
+	"calendar_service/src/datasources/postgres/calendardb"
+	"calendar_service/src/models"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestCalendarController_Share(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+
+	second := clientAs(models.SecondKnownUserId)
+	third := clientAs(models.ThirdKnownUserId)
+
+	share := func(tt *testing.T, c *http.Client, userId string, level models.ShareLevel) *http.Response {
+		res, err := c.Post(fmt.Sprintf("%s/calendar/%s/share", testServer.URL, models.KnownCalendarId),
+			"application/json", strings.NewReader(fmt.Sprintf(`{"user_id": "%s", "level": "%s"}`, userId, level)))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		return res
+	}
+
+	t.Run("success read level", func(tt *testing.T) {
+		res := share(tt, client, models.SecondKnownUserId, models.ShareRead)
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var created models.CalendarShare
+		err = json.Unmarshal(bodyBytes, &created)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+		assert.Equal(tt, models.KnownCalendarId, created.CalendarId)
+		assert.Equal(tt, models.ShareRead, created.Level)
+
+		res, err = second.Get(fmt.Sprintf("%s/calendar/%s", testServer.URL, models.KnownCalendarId))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+
+		res, err = second.Post(fmt.Sprintf("%s/calendar/%s/appointment", testServer.URL, models.KnownCalendarId),
+			"application/json", strings.NewReader(`{"subject": "sneaky", "start": "2020-02-01T10:00:00Z", "end": "2020-02-01T11:00:00Z"}`))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 403, res.StatusCode)
+
+		res = share(tt, second, models.ThirdKnownUserId, models.ShareRead)
+		assert.Equal(tt, 403, res.StatusCode)
+	})
+
+	t.Run("success shared calendars of user", func(tt *testing.T) {
+		res, err := second.Get(fmt.Sprintf("%s/user/%s", testServer.URL, models.SecondKnownUserId))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var usr models.User
+		err = json.Unmarshal(bodyBytes, &usr)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+		assert.Len(tt, usr.SharedCalendars, 1)
+		assert.Equal(tt, models.KnownCalendarId, usr.SharedCalendars[0].CalendarId)
+		assert.Equal(tt, models.KnownUserId, usr.SharedCalendars[0].OwnerId)
+		assert.Equal(tt, models.ShareRead, usr.SharedCalendars[0].Level)
+	})
+
+	t.Run("success write level", func(tt *testing.T) {
+		res := share(tt, client, models.SecondKnownUserId, models.ShareWrite)
+		assert.Equal(tt, 200, res.StatusCode)
+
+		res, err := second.Post(fmt.Sprintf("%s/calendar/%s/appointment", testServer.URL, models.KnownCalendarId),
+			"application/json", strings.NewReader(`{"subject": "shared work", "start": "2020-02-01T10:00:00Z", "end": "2020-02-01T11:00:00Z"}`))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 201, res.StatusCode)
+
+		req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/calendar/%s", testServer.URL, models.KnownCalendarId), nil)
+		if err != nil {
+			tt.Fatal("unable to create request", err)
+		}
+		res, err = second.Do(req)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 403, res.StatusCode)
+	})
+
+	t.Run("success free/busy level hides details", func(tt *testing.T) {
+		res := share(tt, client, models.ThirdKnownUserId, models.ShareFreeBusy)
+		assert.Equal(tt, 200, res.StatusCode)
+
+		res, err := third.Get(fmt.Sprintf("%s/calendar/%s/appointments?from=%s&to=%s",
+			testServer.URL, models.KnownCalendarId, "2020-01-17T00:00:00Z", "2020-01-18T00:00:00Z"))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var page models.OccurrencePage
+		err = json.Unmarshal(bodyBytes, &page)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+		assert.Len(tt, page.Occurrences, 1)
+		assert.Empty(tt, page.Occurrences[0].Subject)
+		assert.Empty(tt, page.Occurrences[0].Description)
+
+		res, err = third.Get(fmt.Sprintf("%s/calendar/%s", testServer.URL, models.KnownCalendarId))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 403, res.StatusCode)
+	})
+
+	t.Run("success manage level shares further", func(tt *testing.T) {
+		res := share(tt, client, models.SecondKnownUserId, models.ShareManage)
+		assert.Equal(tt, 200, res.StatusCode)
+		res = share(tt, second, models.ThirdKnownUserId, models.ShareRead)
+		assert.Equal(tt, 200, res.StatusCode)
+	})
+
+	t.Run("success unshare", func(tt *testing.T) {
+		req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/calendar/%s/share?user_id=%s",
+			testServer.URL, models.KnownCalendarId, models.SecondKnownUserId), nil)
+		if err != nil {
+			tt.Fatal("unable to create request", err)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 202, res.StatusCode)
+
+		res, err = second.Get(fmt.Sprintf("%s/calendar/%s", testServer.URL, models.KnownCalendarId))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 403, res.StatusCode)
+
+		res, err = client.Do(req)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 404, res.StatusCode)
+	})
+
+	t.Run("fail unknown level", func(tt *testing.T) {
+		res := share(tt, client, models.SecondKnownUserId, models.ShareLevel("admin"))
+		assert.Equal(tt, 400, res.StatusCode)
+	})
+
+	t.Run("fail share with owner", func(tt *testing.T) {
+		res := share(tt, client, models.KnownUserId, models.ShareRead)
+		assert.Equal(tt, 404, res.StatusCode)
+	})
+}
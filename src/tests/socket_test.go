@@ -0,0 +1,175 @@
+package tests
+
+import (
+	"calendar_service/src/auth"
+	"calendar_service/src/controllers"
+	"calendar_service/src/datasources/postgres/calendardb"
+	"calendar_service/src/models"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type socketReply struct {
+	Type   string         `json:"type"`
+	Id     string         `json:"id"`
+	Topic  string         `json:"topic"`
+	Change *models.Change `json:"change"`
+	Status int            `json:"status"`
+	Error  string         `json:"error"`
+}
+
+// dialAs opens a websocket authenticated as the user
+func dialAs(tt *testing.T, userId string) *websocket.Conn {
+	token, _, err := auth.Tokens.Issue(userId, time.Hour)
+	if err != nil {
+		tt.Fatal("unable to issue token", err)
+	}
+	url := "ws" + strings.TrimPrefix(testServer.URL, "http") + "/events/ws"
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Authorization": {"Bearer " + token}})
+	if err != nil {
+		tt.Fatal("unable to dial", err)
+	}
+	return conn
+}
+
+func request(tt *testing.T, conn *websocket.Conn, req map[string]string) *socketReply {
+	if err := conn.WriteJSON(req); err != nil {
+		tt.Fatal("unable to write request", err)
+	}
+	return readReply(tt, conn)
+}
+
+func readReply(tt *testing.T, conn *websocket.Conn) *socketReply {
+	_ = conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	reply := &socketReply{}
+	if err := conn.ReadJSON(reply); err != nil {
+		tt.Fatal("unable to read reply", err)
+	}
+	return reply
+}
+
+func TestSocketController(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+
+	createAppointment := func(tt *testing.T, subject string) {
+		res, err := client.Post(fmt.Sprintf("%s/calendar/%s/appointment", testServer.URL, models.KnownCalendarId), "application/json",
+			strings.NewReader(fmt.Sprintf(`{"subject": "%s", "start": "2020-03-02T10:00:00Z", "end": "2020-03-02T11:00:00Z"}`, subject)))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 201, res.StatusCode)
+	}
+	calendar := "calendar:" + models.KnownCalendarId
+
+	t.Run("success subscribe and unsubscribe", func(tt *testing.T) {
+		conn := dialAs(tt, models.KnownUserId)
+		defer conn.Close()
+
+		reply := request(tt, conn, map[string]string{"type": "subscribe", "id": "1", "topic": calendar})
+		assert.Equal(tt, "subscribed", reply.Type)
+		assert.Equal(tt, "1", reply.Id)
+		assert.Equal(tt, calendar, reply.Topic)
+
+		createAppointment(tt, "Live")
+		reply = readReply(tt, conn)
+		assert.Equal(tt, "change", reply.Type)
+		assert.Equal(tt, calendar, reply.Topic)
+		if assert.NotNil(tt, reply.Change) {
+			assert.Equal(tt, models.EventAppointmentCreated, reply.Change.Event)
+			assert.Contains(tt, string(reply.Change.After.RawMessage), "Live")
+		}
+
+		reply = request(tt, conn, map[string]string{"type": "unsubscribe", "id": "2", "topic": calendar})
+		assert.Equal(tt, "unsubscribed", reply.Type)
+		reply = request(tt, conn, map[string]string{"type": "ping", "id": "3"})
+		assert.Equal(tt, "pong", reply.Type)
+		assert.Equal(tt, "3", reply.Id)
+	})
+
+	t.Run("success replay since cursor", func(tt *testing.T) {
+		createAppointment(tt, "Missed")
+		conn := dialAs(tt, models.KnownUserId)
+		defer conn.Close()
+
+		agenda := "agenda:" + models.KnownUserId
+		reply := request(tt, conn, map[string]string{"type": "subscribe", "topic": agenda, "since": "0"})
+		assert.Equal(tt, "subscribed", reply.Type)
+		reply = readReply(tt, conn)
+		assert.Equal(tt, "change", reply.Type)
+		assert.Equal(tt, agenda, reply.Topic)
+	})
+
+	t.Run("fail subscribe without access", func(tt *testing.T) {
+		conn := dialAs(tt, models.ThirdKnownUserId)
+		defer conn.Close()
+
+		reply := request(tt, conn, map[string]string{"type": "subscribe", "topic": calendar})
+		assert.Equal(tt, "error", reply.Type)
+		assert.Equal(tt, 403, reply.Status)
+		reply = request(tt, conn, map[string]string{"type": "subscribe", "topic": "agenda:" + models.KnownUserId})
+		assert.Equal(tt, "error", reply.Type)
+		assert.Equal(tt, 403, reply.Status)
+	})
+
+	t.Run("fail invalid requests", func(tt *testing.T) {
+		conn := dialAs(tt, models.KnownUserId)
+		defer conn.Close()
+
+		reply := request(tt, conn, map[string]string{"type": "subscribe", "topic": "appointment:" + models.AppointmentFixedTimeId})
+		assert.Equal(tt, 400, reply.Status)
+		reply = request(tt, conn, map[string]string{"type": "subscribe", "topic": calendar, "since": "yesterday"})
+		assert.Equal(tt, 400, reply.Status)
+		reply = request(tt, conn, map[string]string{"type": "unsubscribe", "topic": calendar})
+		assert.Equal(tt, 404, reply.Status)
+		reply = request(tt, conn, map[string]string{"type": "publish"})
+		assert.Equal(tt, 400, reply.Status)
+	})
+
+	t.Run("success token offered as a subprotocol", func(tt *testing.T) {
+		token, _, err := auth.Tokens.Issue(models.KnownUserId, time.Hour)
+		if err != nil {
+			tt.Fatal("unable to issue token", err)
+		}
+		url := "ws" + strings.TrimPrefix(testServer.URL, "http") + "/events/ws"
+		dialer := websocket.Dialer{Subprotocols: []string{controllers.SocketProtocol, controllers.SocketTokenProtocol + token}}
+		conn, res, err := dialer.Dial(url, nil)
+		if err != nil {
+			tt.Fatal("unable to dial", err)
+		}
+		defer conn.Close()
+		assert.Equal(tt, controllers.SocketProtocol, res.Header.Get("Sec-WebSocket-Protocol"))
+		reply := request(tt, conn, map[string]string{"type": "ping", "id": "1"})
+		assert.Equal(tt, "pong", reply.Type)
+	})
+
+	t.Run("success short lived token in the query", func(tt *testing.T) {
+		token, _, err := auth.Tokens.Issue(models.KnownUserId, auth.QueryTokenTTL)
+		if err != nil {
+			tt.Fatal("unable to issue token", err)
+		}
+		url := "ws" + strings.TrimPrefix(testServer.URL, "http") + "/events/ws?access_token=" + token
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			tt.Fatal("unable to dial", err)
+		}
+		conn.Close()
+	})
+
+	t.Run("fail unauthenticated", func(tt *testing.T) {
+		url := "ws" + strings.TrimPrefix(testServer.URL, "http") + "/events/ws"
+		_, res, err := websocket.DefaultDialer.Dial(url, nil)
+		assert.NotNil(tt, err)
+		if assert.NotNil(tt, res) {
+			assert.Equal(tt, 401, res.StatusCode)
+		}
+	})
+}
@@ -0,0 +1,227 @@
+package tests
+
+import (
+	"bufio"
+	"calendar_service/src/auth"
+	"calendar_service/src/datasources/postgres/calendardb"
+	"calendar_service/src/models"
+	"calendar_service/src/services"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type serverSentEvent struct {
+	id    string
+	event string
+	data  string
+}
+
+// readEvent reads the next event of the stream, skipping comments
+func readEvent(reader *bufio.Reader) (*serverSentEvent, error) {
+	e := &serverSentEvent{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "" && e.event != "":
+			return e, nil
+		case strings.HasPrefix(line, "id: "):
+			e.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			e.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			e.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestStreamController(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+
+	createAppointment := func(tt *testing.T, subject string) {
+		res, err := client.Post(fmt.Sprintf("%s/calendar/%s/appointment", testServer.URL, models.KnownCalendarId), "application/json",
+			strings.NewReader(fmt.Sprintf(`{"subject": "%s", "start": "2020-03-02T10:00:00Z", "end": "2020-03-02T11:00:00Z"}`, subject)))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 201, res.StatusCode)
+	}
+
+	t.Run("success replay and live events", func(tt *testing.T) {
+		createAppointment(tt, "Missed")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+			fmt.Sprintf("%s/calendar/%s/events/stream", testServer.URL, models.KnownCalendarId), nil)
+		if err != nil {
+			tt.Fatal("unable to create request", err)
+		}
+		req.Header.Set("Last-Event-ID", "0")
+		res, err := client.Do(req)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		defer res.Body.Close()
+		assert.Equal(tt, 200, res.StatusCode)
+		assert.Equal(tt, "text/event-stream", res.Header.Get("Content-Type"))
+		reader := bufio.NewReader(res.Body)
+
+		missed, err := readEvent(reader)
+		if err != nil {
+			tt.Fatal("unable to read event", err)
+		}
+		assert.Equal(tt, string(models.EventAppointmentCreated), missed.event)
+		assert.Contains(tt, missed.data, "Missed")
+
+		createAppointment(tt, "Live")
+		event, err := readEvent(reader)
+		if err != nil {
+			tt.Fatal("unable to read event", err)
+		}
+		assert.Equal(tt, string(models.EventAppointmentCreated), event.event)
+		var change models.Change
+		if err := json.Unmarshal([]byte(event.data), &change); err != nil {
+			tt.Fatal("unable to unmarshal event", err)
+		}
+		assert.Equal(tt, event.id, change.Cursor)
+		assert.Contains(tt, string(change.After.RawMessage), "Live")
+		assert.NotEqual(tt, missed.id, event.id)
+	})
+
+	t.Run("success stream ends once shares change", func(tt *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+			fmt.Sprintf("%s/calendar/%s/events/stream", testServer.URL, models.KnownCalendarId), nil)
+		if err != nil {
+			tt.Fatal("unable to create request", err)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		defer res.Body.Close()
+		assert.Equal(tt, 200, res.StatusCode)
+		reader := bufio.NewReader(res.Body)
+
+		res, err = client.Post(fmt.Sprintf("%s/calendar/%s/share", testServer.URL, models.KnownCalendarId), "application/json",
+			strings.NewReader(fmt.Sprintf(`{"user_id": "%s", "level": "read"}`, models.SecondKnownUserId)))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+
+		event, err := readEvent(reader)
+		if err != nil {
+			tt.Fatal("unable to read event", err)
+		}
+		assert.Equal(tt, string(models.EventSharesChanged), event.event)
+		// the client reconnects and its access is checked anew
+		_, err = readEvent(reader)
+		assert.Equal(tt, io.EOF, err)
+	})
+
+	t.Run("success short lived token in the query", func(tt *testing.T) {
+		res, err := client.Post(testServer.URL+"/auth/query-token", "application/json", nil)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+		var issued struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&issued); err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+			fmt.Sprintf("%s/calendar/%s/events/stream?access_token=%s", testServer.URL, models.KnownCalendarId, issued.Token), nil)
+		if err != nil {
+			tt.Fatal("unable to create request", err)
+		}
+		res, err = testServer.Client().Do(req)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		defer res.Body.Close()
+		assert.Equal(tt, 200, res.StatusCode)
+		assert.Equal(tt, "text/event-stream", res.Header.Get("Content-Type"))
+	})
+
+	t.Run("fail long lived token in the query", func(tt *testing.T) {
+		token, _, err := auth.Tokens.Issue(models.KnownUserId, time.Hour)
+		if err != nil {
+			tt.Fatal("unable to issue token", err)
+		}
+		res, err := testServer.Client().Get(
+			fmt.Sprintf("%s/calendar/%s/events/stream?access_token=%s", testServer.URL, models.KnownCalendarId, token))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 401, res.StatusCode)
+
+		res, err = testServer.Client().Get(fmt.Sprintf("%s/user/%s?access_token=%s", testServer.URL, models.KnownUserId, token))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 401, res.StatusCode)
+	})
+
+	t.Run("fail replay of too many missed changes", func(tt *testing.T) {
+		err := calendardb.DB.Exec(`INSERT INTO outbox (event, entity, entity_id, operation, calendar_ids, created_at)
+			SELECT ?, ?, ?, ?, ARRAY[?], now() FROM generate_series(0, ?)`,
+			models.EventAppointmentUpdated, models.EntityAppointment, models.UnexistingId, models.ChangeUpdate,
+			models.KnownCalendarId, services.MaxReplayedChanges).Error
+		if err != nil {
+			tt.Fatal("unable to insert changes", err)
+		}
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/calendar/%s/events/stream", testServer.URL, models.KnownCalendarId), nil)
+		if err != nil {
+			tt.Fatal("unable to create request", err)
+		}
+		req.Header.Set("Last-Event-ID", "0")
+		res, err := client.Do(req)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 410, res.StatusCode)
+	})
+
+	t.Run("fail for user without access", func(tt *testing.T) {
+		res, err := clientAs(models.ThirdKnownUserId).Get(fmt.Sprintf("%s/calendar/%s/events/stream", testServer.URL, models.KnownCalendarId))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 403, res.StatusCode)
+	})
+
+	t.Run("fail with invalid last event id", func(tt *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/calendar/%s/events/stream", testServer.URL, models.KnownCalendarId), nil)
+		if err != nil {
+			tt.Fatal("unable to create request", err)
+		}
+		req.Header.Set("Last-Event-ID", "yesterday")
+		res, err := client.Do(req)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 400, res.StatusCode)
+	})
+}
@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"calendar_service/src/datasources/postgres/calendardb"
+	"calendar_service/src/models"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"testing"
+)
+
+func TestCalendarSync(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+
+	syncPage := func(tt *testing.T, token string, limit int) *models.SyncResult {
+		res, err := client.Get(fmt.Sprintf("%s/calendar/%s/sync?sync_token=%s&limit=%d", testServer.URL, models.KnownCalendarId, token, limit))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+		var result models.SyncResult
+		err = json.Unmarshal(bodyBytes, &result)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		return &result
+	}
+	sync := func(tt *testing.T, token string) *models.SyncResult {
+		return syncPage(tt, token, models.DefaultSyncLimit)
+	}
+
+	t.Run("success full sync in pages", func(tt *testing.T) {
+		full := sync(tt, "")
+		assert.False(tt, full.More)
+
+		ids := make([]string, 0)
+		token := ""
+		for {
+			page := syncPage(tt, token, 1)
+			for _, appt := range page.Appointments {
+				ids = append(ids, appt.ID)
+			}
+			token = page.SyncToken
+			if !page.More {
+				break
+			}
+			assert.Len(tt, page.Appointments, 1)
+		}
+		assert.Len(tt, ids, len(full.Appointments))
+		// the last page hands over to the change feed
+		assert.Equal(tt, full.SyncToken, token)
+	})
+
+	t.Run("success sync deletion", func(tt *testing.T) {
+		full := sync(tt, "")
+		assert.NotEmpty(tt, full.Appointments)
+		assert.Empty(tt, full.Deleted)
+
+		req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/appointment/%s", testServer.URL, models.AppointmentFixedTimeId), nil)
+		if err != nil {
+			tt.Fatal("unable to create request", err)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 202, res.StatusCode)
+
+		result := sync(tt, full.SyncToken)
+		assert.Empty(tt, result.Appointments)
+		if assert.Len(tt, result.Deleted, 1) {
+			assert.Equal(tt, models.AppointmentFixedTimeId, result.Deleted[0].ID)
+		}
+		assert.Len(tt, sync(tt, "").Appointments, len(full.Appointments)-1)
+	})
+
+	t.Run("fail with invalid sync token", func(tt *testing.T) {
+		res, err := client.Get(fmt.Sprintf("%s/calendar/%s/sync?sync_token=abc", testServer.URL, models.KnownCalendarId))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 400, res.StatusCode)
+	})
+
+	t.Run("fail for user without access", func(tt *testing.T) {
+		res, err := clientAs(models.ThirdKnownUserId).Get(fmt.Sprintf("%s/calendar/%s/sync", testServer.URL, models.KnownCalendarId))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 403, res.StatusCode)
+	})
+}
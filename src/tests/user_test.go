@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"calendar_service/src/auth"
 	"calendar_service/src/controllers"
 	"calendar_service/src/datasources/postgres/calendardb"
 	"calendar_service/src/models"
@@ -242,3 +243,156 @@ func TestUserController_Update(t *testing.T) {
 		assert.Equal(t, "unable to update user", apiErr.Message)
 	})
 }
+
+func TestUserController_Agenda(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+
+	t.Run("success", func(tt *testing.T) {
+		res, err := clientAs(models.ThirdKnownUserId).Get(fmt.Sprintf("%s/user/%s/agenda?from=%s&to=%s",
+			testServer.URL, models.ThirdKnownUserId, "2020-01-17T00:00:00Z", "2020-01-21T00:00:00Z"))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var agenda models.Agenda
+		err = json.Unmarshal(bodyBytes, &agenda)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+		assert.Len(tt, agenda.Entries, 1)
+		assert.Equal(tt, models.AppointmentWholeDayId, agenda.Entries[0].AppointmentId)
+		assert.Equal(tt, models.KnownCalendarId, agenda.Entries[0].CalendarId)
+		assert.Equal(tt, models.RoleAttendee, agenda.Entries[0].Role)
+	})
+
+	t.Run("fail invalid time range", func(tt *testing.T) {
+		res, err := client.Get(fmt.Sprintf("%s/user/%s/agenda?from=%s",
+			testServer.URL, models.KnownUserId, "2020-01-17T00:00:00Z"))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 400, res.StatusCode)
+	})
+
+	t.Run("fail no such user", func(tt *testing.T) {
+		res, err := client.Get(fmt.Sprintf("%s/user/%s/agenda?from=%s&to=%s",
+			testServer.URL, models.UnexistingId, "2020-01-17T00:00:00Z", "2020-01-21T00:00:00Z"))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 404, res.StatusCode)
+	})
+}
+
+func TestUserController_List(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+
+	list := func(tt *testing.T, query string) (*http.Response, models.UserPage) {
+		res, err := client.Get(fmt.Sprintf("%s/user?%s", testServer.URL, query))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var page models.UserPage
+		if res.StatusCode == http.StatusOK {
+			err = json.Unmarshal(bodyBytes, &page)
+			if err != nil {
+				tt.Fatal("unable to unmarshal response", err)
+			}
+		}
+		return res, page
+	}
+
+	t.Run("success pages", func(tt *testing.T) {
+		res, page := list(tt, "limit=2")
+		assert.Equal(tt, 200, res.StatusCode)
+		assert.Len(tt, page.Users, 2)
+		assert.Equal(tt, models.KnownUserId, page.Users[0].ID)
+		assert.Equal(tt, models.SecondKnownUserId, page.Users[1].ID)
+		assert.NotEmpty(tt, page.NextCursor)
+
+		res, page = list(tt, "limit=2&cursor="+page.NextCursor)
+		assert.Equal(tt, 200, res.StatusCode)
+		assert.Len(tt, page.Users, 1)
+		assert.Equal(tt, models.ThirdKnownUserId, page.Users[0].ID)
+		assert.Empty(tt, page.NextCursor)
+	})
+
+	t.Run("success sorted", func(tt *testing.T) {
+		res, page := list(tt, "sort=last_name&order=desc")
+		assert.Equal(tt, 200, res.StatusCode)
+		assert.Len(tt, page.Users, 3)
+		assert.Equal(tt, models.ThirdKnownUserId, page.Users[0].ID)
+		assert.Equal(tt, models.KnownUserId, page.Users[2].ID)
+	})
+
+	t.Run("success filtered", func(tt *testing.T) {
+		res, page := list(tt, "name=kot")
+		assert.Equal(tt, 200, res.StatusCode)
+		assert.Len(tt, page.Users, 1)
+		assert.Equal(tt, models.SecondKnownUserId, page.Users[0].ID)
+
+		res, page = list(tt, "email=JHON@gmail.com")
+		assert.Equal(tt, 200, res.StatusCode)
+		assert.Len(tt, page.Users, 1)
+		assert.Equal(tt, models.KnownUserId, page.Users[0].ID)
+	})
+
+	t.Run("fail unknown sort field", func(tt *testing.T) {
+		res, _ := list(tt, "sort=password")
+		assert.Equal(tt, 400, res.StatusCode)
+	})
+
+	t.Run("fail cursor of another sort", func(tt *testing.T) {
+		_, page := list(tt, "limit=1")
+		res, _ := list(tt, "limit=1&sort=first_name&cursor="+page.NextCursor)
+		assert.Equal(tt, 400, res.StatusCode)
+	})
+}
+
+func TestUserController_Registration(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+	register := func(tt *testing.T, c *http.Client, email string) int {
+		res, err := c.Post(fmt.Sprintf("%s/user", testServer.URL), "application/json", strings.NewReader(
+			fmt.Sprintf(`{"first_name": "Ada", "last_name": "Lovelace", "email": "%s"}`, email)))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		return res.StatusCode
+	}
+
+	t.Run("open registration needs no token", func(tt *testing.T) {
+		assert.Equal(tt, 201, register(tt, testServer.Client(), "ada@example.com"))
+	})
+
+	t.Run("admin registration", func(tt *testing.T) {
+		open := auth.Registration
+		defer func() { auth.Registration = open }()
+		auth.Registration, err = auth.NewRegistrationPolicy(auth.AdminRegistration, []string{models.KnownUserId})
+		if err != nil {
+			tt.Fatal("unable to set up registration", err)
+		}
+		assert.Equal(tt, 401, register(tt, testServer.Client(), "lovelace@example.com"))
+		assert.Equal(tt, 403, register(tt, clientAs(models.SecondKnownUserId), "lovelace@example.com"))
+		assert.Equal(tt, 201, register(tt, client, "lovelace@example.com"))
+	})
+}
@@ -0,0 +1,145 @@
+package tests
+
+import (
+	"calendar_service/src/datasources/postgres/calendardb"
+	"calendar_service/src/models"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestWebhookController(t *testing.T) {
+	err := models.MockDbData(calendardb.DB)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(calendardb.DB)
+
+	var created models.Webhook
+
+	t.Run("success create", func(tt *testing.T) {
+		res, err := client.Post(fmt.Sprintf("%s/webhook", testServer.URL), "application/json",
+			strings.NewReader(`{"url": "https://example.com/hook", "events": ["appointment.created", "appointment.deleted"]}`))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		err = json.Unmarshal(bodyBytes, &created)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 201, res.StatusCode)
+		assert.Equal(tt, models.KnownUserId, created.UserId)
+		assert.NotEmpty(tt, created.Secret)
+	})
+
+	t.Run("fail create with unknown event", func(tt *testing.T) {
+		res, err := client.Post(fmt.Sprintf("%s/webhook", testServer.URL), "application/json",
+			strings.NewReader(`{"url": "https://example.com/hook", "events": ["appointment.moved"]}`))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 400, res.StatusCode)
+	})
+
+	t.Run("fail create with private address", func(tt *testing.T) {
+		for _, url := range []string{"http://169.254.169.254/latest/meta-data", "http://127.0.0.1:8080/hook", "http://localhost/hook", "http://10.0.0.1/hook"} {
+			res, err := client.Post(fmt.Sprintf("%s/webhook", testServer.URL), "application/json",
+				strings.NewReader(fmt.Sprintf(`{"url": "%s"}`, url)))
+			if err != nil {
+				tt.Fatal("unable to execute request", err)
+			}
+			assert.Equal(tt, 400, res.StatusCode, url)
+		}
+	})
+
+	t.Run("success list without secrets", func(tt *testing.T) {
+		res, err := client.Get(fmt.Sprintf("%s/webhook", testServer.URL))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var webhooks []*models.Webhook
+		err = json.Unmarshal(bodyBytes, &webhooks)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+		if assert.Len(tt, webhooks, 1) {
+			assert.Equal(tt, created.ID, webhooks[0].ID)
+			assert.Empty(tt, webhooks[0].Secret)
+		}
+	})
+
+	t.Run("success deliveries of created appointment", func(tt *testing.T) {
+		res, err := client.Post(fmt.Sprintf("%s/calendar/%s/appointment", testServer.URL, models.KnownCalendarId), "application/json",
+			strings.NewReader(`{"subject": "Webhook review", "start": "2020-03-02T10:00:00Z", "end": "2020-03-02T11:00:00Z"}`))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 201, res.StatusCode)
+
+		res, err = client.Get(fmt.Sprintf("%s/webhook/%s/deliveries?status=pending", testServer.URL, created.ID))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		bodyBytes, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			tt.Fatal("unable to read response body", err)
+		}
+		var deliveries []*models.WebhookDelivery
+		err = json.Unmarshal(bodyBytes, &deliveries)
+		if err != nil {
+			tt.Fatal("unable to unmarshal response", err)
+		}
+		assert.Equal(tt, 200, res.StatusCode)
+		if assert.Len(tt, deliveries, 1) {
+			assert.Equal(tt, models.EventAppointmentCreated, deliveries[0].Event)
+			assert.Contains(tt, string(deliveries[0].Payload.RawMessage), "Webhook review")
+		}
+	})
+
+	t.Run("fail deliveries with invalid status", func(tt *testing.T) {
+		res, err := client.Get(fmt.Sprintf("%s/webhook/%s/deliveries?status=lost", testServer.URL, created.ID))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 400, res.StatusCode)
+	})
+
+	t.Run("fail deliveries of webhook of another user", func(tt *testing.T) {
+		res, err := clientAs(models.SecondKnownUserId).Get(fmt.Sprintf("%s/webhook/%s/deliveries", testServer.URL, created.ID))
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 404, res.StatusCode)
+	})
+
+	t.Run("success delete", func(tt *testing.T) {
+		req, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/webhook/%s", testServer.URL, created.ID), nil)
+		if err != nil {
+			tt.Fatal("unable to create request", err)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 202, res.StatusCode)
+
+		res, err = client.Do(req)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		assert.Equal(tt, 404, res.StatusCode)
+	})
+}
@@ -0,0 +1,38 @@
+package webhooks
+
+import (
+	"calendar_service/src/models"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewClient(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/moved" {
+			http.Redirect(w, r, "http://169.254.169.254/latest/meta-data", http.StatusFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+	client := NewClient(time.Second)
+
+	t.Run("refuses private addresses", func(tt *testing.T) {
+		models.AllowPrivateWebhooks = false
+		defer func() { models.AllowPrivateWebhooks = true }()
+		_, err := client.Post(receiver.URL, "application/json", nil)
+		assert.NotNil(tt, err)
+	})
+
+	t.Run("does not follow redirects", func(tt *testing.T) {
+		resp, err := client.Post(receiver.URL+"/moved", "application/json", nil)
+		if err != nil {
+			tt.Fatal("unable to execute request", err)
+		}
+		resp.Body.Close()
+		assert.Equal(tt, http.StatusFound, resp.StatusCode)
+	})
+}
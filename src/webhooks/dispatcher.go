@@ -0,0 +1,163 @@
+package webhooks
+
+import (
+	"bytes"
+	"calendar_service/src/logger"
+	"calendar_service/src/models"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// batchSize is the number of deliveries claimed at once
+	batchSize = 50
+	// lease is how long a claimed delivery stays locked
+	lease = 5 * time.Minute
+	// MaxAttempts is the number of attempts after which a delivery is given up
+	MaxAttempts = 10
+	// baseRetryDelay is the delay before the second attempt, it doubles with every further attempt
+	baseRetryDelay = 30 * time.Second
+	maxRetryDelay  = 6 * time.Hour
+
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// Dispatcher sends the pending webhook deliveries every interval. Like the alarm
+// scheduler it keeps its state in the db, several instances can run side by side
+type Dispatcher struct {
+	db       *gorm.DB
+	client   *http.Client
+	interval time.Duration
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewDispatcher(db *gorm.DB, client *http.Client, interval time.Duration) *Dispatcher {
+	return &Dispatcher{db: db, client: client, interval: interval}
+}
+
+func (d *Dispatcher) Start() {
+	d.stop = make(chan struct{})
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		ticker := time.NewTicker(d.interval)
+		defer ticker.Stop()
+		for {
+			if _, err := d.DeliverDue(time.Now()); err != nil {
+				logger.Logger.Errorw("unable to deliver webhooks", "err", err.Error())
+			}
+			select {
+			case <-d.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop waits for the deliveries being sent
+func (d *Dispatcher) Stop() {
+	close(d.stop)
+	d.wg.Wait()
+}
+
+// DeliverDue sends the deliveries due at now and returns how many succeeded
+func (d *Dispatcher) DeliverDue(now time.Time) (int, error) {
+	delivered := 0
+	for {
+		deliveries, err := models.ClaimDueDeliveries(now, now.Add(lease), batchSize, d.db)
+		if err != nil {
+			return delivered, err
+		}
+		for _, delivery := range deliveries {
+			if d.deliver(delivery, now) {
+				delivered++
+			}
+		}
+		if len(deliveries) < batchSize {
+			return delivered, nil
+		}
+	}
+}
+
+func (d *Dispatcher) deliver(delivery *models.WebhookDelivery, now time.Time) bool {
+	webhook := &models.Webhook{}
+	if err := d.db.Where("id = ?", delivery.WebhookId).First(webhook).Error; err != nil {
+		logger.Logger.Errorw("unable to read webhook of delivery", "delivery_id", delivery.ID, "err", err.Error())
+		return false
+	}
+
+	status, err := d.send(webhook, delivery, now)
+	var retryAt *time.Time
+	if err != nil {
+		logger.Logger.Infow("unable to deliver webhook", "delivery_id", delivery.ID, "err", err.Error())
+		if delivery.Attempts+1 < MaxAttempts {
+			at := now.Add(RetryDelay(delivery.Attempts + 1))
+			retryAt = &at
+		}
+	}
+	if err := delivery.Attempted(now, status, err, retryAt, d.db); err != nil {
+		logger.Logger.Errorw("unable to record webhook delivery", "delivery_id", delivery.ID, "err", err.Error())
+	}
+	return err == nil
+}
+
+// send posts the payload of the delivery, any response but a 2xx one is a failure
+func (d *Dispatcher) send(webhook *models.Webhook, delivery *models.WebhookDelivery, now time.Time) (int, error) {
+	body := []byte(delivery.Payload.RawMessage)
+	req, err := http.NewRequest(http.MethodPost, webhook.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := now.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, string(delivery.Event))
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(SignatureHeader, fmt.Sprintf("t=%d,v1=%s", timestamp, Sign(webhook.Secret, timestamp, body)))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook responded with status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of "<timestamp>.<body>" keyed with
+// the secret of the webhook. Receivers compute it again to authenticate deliveries
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// RetryDelay is the time waited after the failed attempt number attempts
+func RetryDelay(attempts int) time.Duration {
+	delay := baseRetryDelay
+	for i := 1; i < attempts; i++ {
+		delay *= 2
+		if delay >= maxRetryDelay {
+			return maxRetryDelay
+		}
+	}
+	return delay
+}
@@ -0,0 +1,169 @@
+package webhooks
+
+import (
+	"calendar_service/src/config"
+	"calendar_service/src/models"
+	"fmt"
+	"github.com/jinzhu/gorm"
+	_ "github.com/jinzhu/gorm/dialects/postgres"
+	"github.com/joho/godotenv"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	db *gorm.DB
+)
+
+func TestMain(m *testing.M) {
+	var err error
+	err = godotenv.Load("../../.env.test")
+	if err != nil {
+		fmt.Println("unable to load test env")
+		os.Exit(1)
+	}
+	if err := config.Load(); err != nil {
+		fmt.Println("unable to load config", err)
+		os.Exit(1)
+	}
+	db, err = models.InitDbConnection(
+		config.Config.CalendarDb.Host,
+		config.Config.CalendarDb.Port,
+		config.Config.CalendarDb.User,
+		config.Config.CalendarDb.Password,
+		config.Config.CalendarDb.DbName,
+		config.Config.CalendarDb.SslMode,
+		config.Config.CalendarDb.MaxOpenConnections,
+		config.Config.CalendarDb.MaxIdleConnections,
+		config.Config.CalendarDb.ConnectionMaxLifetime)
+	if err != nil {
+		fmt.Println("unable to connect to db", err)
+		os.Exit(1)
+	}
+	models.RecreateTables(db)
+	models.InitIndexes(db)
+	// the receivers of the tests listen on the loopback
+	models.AllowPrivateWebhooks = true
+	os.Exit(m.Run())
+}
+
+func TestRetryDelay(t *testing.T) {
+	assert.Equal(t, 30*time.Second, RetryDelay(1))
+	assert.Equal(t, time.Minute, RetryDelay(2))
+	assert.Equal(t, 4*time.Minute, RetryDelay(4))
+	assert.Equal(t, maxRetryDelay, RetryDelay(MaxAttempts))
+}
+
+func TestDispatcher_DeliverDue(t *testing.T) {
+	err := models.MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(db)
+
+	failing := true
+	var received []*http.Request
+	var bodies [][]byte
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = append(received, r)
+		bodies = append(bodies, body)
+		if failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	webhook := &models.Webhook{UserId: models.KnownUserId, Url: receiver.URL}
+	if err := webhook.Create(db); err != nil {
+		t.Fatal("unable to create webhook", err)
+	}
+	event := &models.Event{ID: "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11", Type: models.EventCalendarUpdated, OccurredAt: time.Now()}
+	if err := models.EnqueueEvent(event, []string{models.KnownUserId}, db); err != nil {
+		t.Fatal("unable to enqueue event", err)
+	}
+
+	dispatcher := NewDispatcher(db, receiver.Client(), time.Minute)
+	now := time.Now()
+	delivered, err := dispatcher.DeliverDue(now)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, delivered)
+	assert.Len(t, received, 1)
+
+	// the failed delivery waits for the retry delay
+	delivered, err = dispatcher.DeliverDue(now.Add(RetryDelay(1) / 2))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, delivered)
+	assert.Len(t, received, 1)
+
+	failing = false
+	retryAt := now.Add(RetryDelay(1))
+	delivered, err = dispatcher.DeliverDue(retryAt)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, delivered)
+	if !assert.Len(t, received, 2) {
+		return
+	}
+
+	last := received[1]
+	assert.Equal(t, string(models.EventCalendarUpdated), last.Header.Get(EventHeader))
+	assert.NotEmpty(t, last.Header.Get(DeliveryHeader))
+	signature := last.Header.Get(SignatureHeader)
+	expected := fmt.Sprintf("t=%d,v1=%s", retryAt.Unix(), Sign(webhook.Secret, retryAt.Unix(), bodies[1]))
+	assert.Equal(t, expected, signature)
+	assert.True(t, strings.Contains(string(bodies[1]), event.ID))
+
+	query := models.DeliveryQuery{WebhookId: webhook.ID}
+	deliveries, err := query.Run(db)
+	assert.Nil(t, err)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, models.DeliverySucceeded, deliveries[0].Status)
+	assert.Equal(t, 2, deliveries[0].Attempts)
+	assert.Equal(t, http.StatusNoContent, deliveries[0].ResponseStatus)
+}
+
+func TestDispatcher_GivesUp(t *testing.T) {
+	err := models.MockDbData(db)
+	if err != nil {
+		t.Fatal("unable to mock db")
+	}
+	defer models.DropAllData(db)
+
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+
+	webhook := &models.Webhook{UserId: models.KnownUserId, Url: receiver.URL}
+	if err := webhook.Create(db); err != nil {
+		t.Fatal("unable to create webhook", err)
+	}
+	event := &models.Event{ID: "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11", Type: models.EventCalendarUpdated, OccurredAt: time.Now()}
+	if err := models.EnqueueEvent(event, []string{models.KnownUserId}, db); err != nil {
+		t.Fatal("unable to enqueue event", err)
+	}
+
+	dispatcher := NewDispatcher(db, receiver.Client(), time.Minute)
+	now := time.Now()
+	for i := 0; i < MaxAttempts; i++ {
+		_, err := dispatcher.DeliverDue(now)
+		assert.Nil(t, err)
+		now = now.Add(maxRetryDelay)
+	}
+
+	query := models.DeliveryQuery{WebhookId: webhook.ID}
+	deliveries, err := query.Run(db)
+	assert.Nil(t, err)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, models.DeliveryFailed, deliveries[0].Status)
+	assert.Equal(t, MaxAttempts, deliveries[0].Attempts)
+	assert.Nil(t, deliveries[0].NextAttemptAt)
+}